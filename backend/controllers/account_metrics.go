@@ -0,0 +1,397 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+
+	"github.com/google/uuid"
+)
+
+// metricsAccount is a connected account as the metrics collector needs it.
+type metricsAccount struct {
+	UserID      string
+	Platform    string
+	SocialID    string
+	AccessToken string
+	ExpiresAt   *time.Time
+}
+
+// accountMetricsFetcher reads an account's current audience counts.
+type accountMetricsFetcher func(db *sql.DB, account metricsAccount) (models.AccountMetrics, error)
+
+var accountMetricsFetchers = map[string]accountMetricsFetcher{
+	"facebook":  fetchFacebookAccountMetrics,
+	"instagram": fetchInstagramAccountMetrics,
+	"twitter":   fetchTwitterAccountMetrics,
+	"mastodon":  fetchMastodonAccountMetrics,
+	"youtube":   fetchYouTubeAccountMetrics,
+	"telegram":  fetchTelegramAccountMetrics,
+}
+
+// CollectAccountMetrics snapshots every connected account that doesn't have
+// a snapshot for today yet. Running it more than once a day retries the
+// accounts that failed.
+func CollectAccountMetrics(db *sql.DB) {
+	now := time.Now().UTC()
+	done, err := models.ListAccountsWithMetricsOn(db, now)
+	if err != nil {
+		log.Printf("[Analytics] Failed to load today's account metrics: %v", err)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT user_id, platform, COALESCE(social_id, ''), access_token, access_token_expires_at
+		FROM social_accounts
+	`)
+	if err != nil {
+		log.Printf("[Analytics] Failed to load social accounts: %v", err)
+		return
+	}
+	var accounts []metricsAccount
+	for rows.Next() {
+		var a metricsAccount
+		if err := rows.Scan(&a.UserID, &a.Platform, &a.SocialID, &a.AccessToken, &a.ExpiresAt); err != nil {
+			log.Printf("[Analytics] Failed to read social account: %v", err)
+			continue
+		}
+		if _, ok := accountMetricsFetchers[a.Platform]; ok && !done[a.UserID+":"+a.Platform] {
+			accounts = append(accounts, a)
+		}
+	}
+	rows.Close()
+	if len(accounts) == 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, analyticsConcurrency)
+	for _, account := range accounts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(account metricsAccount) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			m, err := accountMetricsFetchers[account.Platform](db, account)
+			if err != nil {
+				log.Printf("[Analytics] Failed to fetch %s account metrics for user %s: %v", account.Platform, account.UserID, err)
+				return
+			}
+			if err := saveAccountMetrics(db, account.UserID, account.Platform, account.SocialID, m); err != nil {
+				log.Printf("[Analytics] Failed to store %s account metrics for user %s: %v", account.Platform, account.UserID, err)
+			}
+		}(account)
+	}
+	wg.Wait()
+	log.Printf("[Analytics] Collected account metrics for %d accounts", len(accounts))
+}
+
+// saveAccountMetrics stores m as today's snapshot of the account.
+func saveAccountMetrics(db *sql.DB, userID, platform, socialID string, m models.AccountMetrics) error {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	m.ID = uuid.New()
+	m.UserID = uid
+	m.Platform = platform
+	m.SocialID = socialID
+	m.SnapshotDate = now
+	m.CreatedAt = now
+	return models.SaveAccountMetrics(db, m)
+}
+
+func fetchFacebookAccountMetrics(db *sql.DB, account metricsAccount) (models.AccountMetrics, error) {
+	params := url.Values{}
+	params.Set("fields", "fan_count")
+	params.Set("access_token", account.AccessToken)
+	var page struct {
+		FanCount int `json:"fan_count"`
+	}
+	if err := graphAPIRequest(http.MethodGet, url.PathEscape(account.SocialID), params, &page); err != nil {
+		return models.AccountMetrics{}, err
+	}
+	return models.AccountMetrics{Followers: page.FanCount}, nil
+}
+
+func fetchInstagramAccountMetrics(db *sql.DB, account metricsAccount) (models.AccountMetrics, error) {
+	params := url.Values{}
+	params.Set("fields", "followers_count,follows_count,media_count")
+	params.Set("access_token", account.AccessToken)
+	var user struct {
+		FollowersCount int `json:"followers_count"`
+		FollowsCount   int `json:"follows_count"`
+		MediaCount     int `json:"media_count"`
+	}
+	if err := graphAPIRequest(http.MethodGet, url.PathEscape(account.SocialID), params, &user); err != nil {
+		return models.AccountMetrics{}, err
+	}
+	return models.AccountMetrics{
+		Followers: user.FollowersCount,
+		Following: &user.FollowsCount,
+		Posts:     &user.MediaCount,
+	}, nil
+}
+
+func fetchTwitterAccountMetrics(db *sql.DB, account metricsAccount) (models.AccountMetrics, error) {
+	if account.ExpiresAt != nil && time.Now().After(*account.ExpiresAt) {
+		return models.AccountMetrics{}, &postAccountError{Message: "twitter access token has expired"}
+	}
+	req, err := http.NewRequest(http.MethodGet, "https://api.twitter.com/2/users/me?user.fields=public_metrics", nil)
+	if err != nil {
+		return models.AccountMetrics{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+account.AccessToken)
+
+	resp, err := analyticsClient.Do(req)
+	if err != nil {
+		return models.AccountMetrics{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return models.AccountMetrics{}, fmt.Errorf("Twitter API error (status: %d)", resp.StatusCode)
+	}
+
+	var res struct {
+		Data struct {
+			PublicMetrics struct {
+				FollowersCount int `json:"followers_count"`
+				FollowingCount int `json:"following_count"`
+				TweetCount     int `json:"tweet_count"`
+			} `json:"public_metrics"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return models.AccountMetrics{}, err
+	}
+	pm := res.Data.PublicMetrics
+	return models.AccountMetrics{
+		Followers: pm.FollowersCount,
+		Following: &pm.FollowingCount,
+		Posts:     &pm.TweetCount,
+	}, nil
+}
+
+func fetchMastodonAccountMetrics(db *sql.DB, account metricsAccount) (models.AccountMetrics, error) {
+	if account.ExpiresAt != nil && time.Now().After(*account.ExpiresAt) {
+		return models.AccountMetrics{}, &postAccountError{Message: "mastodon access token has expired"}
+	}
+	instanceURL, err := mastodonInstanceURL(account.SocialID)
+	if err != nil {
+		return models.AccountMetrics{}, err
+	}
+	var user struct {
+		FollowersCount int `json:"followers_count"`
+		FollowingCount int `json:"following_count"`
+		StatusesCount  int `json:"statuses_count"`
+	}
+	if err := mastodonRequest(http.MethodGet, instanceURL+"/api/v1/accounts/verify_credentials", account.AccessToken, nil, &user); err != nil {
+		return models.AccountMetrics{}, err
+	}
+	return models.AccountMetrics{
+		Followers: user.FollowersCount,
+		Following: &user.FollowingCount,
+		Posts:     &user.StatusesCount,
+	}, nil
+}
+
+func fetchYouTubeAccountMetrics(db *sql.DB, account metricsAccount) (models.AccountMetrics, error) {
+	client, err := newYouTubeClient(db, account.UserID)
+	if err != nil {
+		return models.AccountMetrics{}, err
+	}
+	params := url.Values{}
+	params.Set("part", "statistics")
+	params.Set("mine", "true")
+	var res YouTubeChannelInfo
+	if err := client.request(http.MethodGet, "channels", params, nil, &res); err != nil {
+		return models.AccountMetrics{}, err
+	}
+	if len(res.Items) == 0 {
+		return models.AccountMetrics{}, errors.New("no YouTube channel found")
+	}
+	return youtubeChannelMetrics(res.Items[0].Statistics)
+}
+
+// youtubeChannelMetrics converts the channel statistics the Data API returns.
+func youtubeChannelMetrics(stats YouTubeChannelStatistics) (models.AccountMetrics, error) {
+	if stats.HiddenSubscriberCount {
+		return models.AccountMetrics{}, errors.New("the channel hides its subscriber count")
+	}
+	var m models.AccountMetrics
+	var err error
+	if m.Followers, err = strconv.Atoi(stats.SubscriberCount); err != nil {
+		return m, fmt.Errorf("invalid subscriber count %q", stats.SubscriberCount)
+	}
+	if videos, err := strconv.Atoi(stats.VideoCount); err == nil {
+		m.Posts = &videos
+	}
+	if views, err := strconv.ParseInt(stats.ViewCount, 10, 64); err == nil {
+		m.Views = &views
+	}
+	return m, nil
+}
+
+// saveYouTubeChannelMetrics records the statistics read when the channel is
+// connected, so growth is tracked from that day on.
+func saveYouTubeChannelMetrics(db *sql.DB, userID, channelID string, stats YouTubeChannelStatistics) {
+	m, err := youtubeChannelMetrics(stats)
+	if err != nil {
+		log.Printf("[YouTube] Not recording channel metrics for user %s: %v", userID, err)
+		return
+	}
+	if err := saveAccountMetrics(db, userID, "youtube", channelID, m); err != nil {
+		log.Printf("[YouTube] Failed to store channel metrics for user %s: %v", userID, err)
+	}
+}
+
+func fetchTelegramAccountMetrics(db *sql.DB, account metricsAccount) (models.AccountMetrics, error) {
+	botToken, err := telegramBotTokenForUser(db, account.UserID)
+	if err != nil {
+		return models.AccountMetrics{}, err
+	}
+	if botToken == "" {
+		return models.AccountMetrics{}, errors.New("Telegram bot token not set")
+	}
+	var count int
+	if err := lib.TelegramCall(botToken, "getChatMemberCount", map[string]interface{}{"chat_id": account.SocialID}, &count); err != nil {
+		return models.AccountMetrics{}, err
+	}
+	return models.AccountMetrics{Followers: count}, nil
+}
+
+// AccountGrowthPoint is an account's audience at the end of a bucket. Change
+// is the difference from the previous point, null when there is none or the
+// platform account was switched in between.
+type AccountGrowthPoint struct {
+	Date      string `json:"date"` // of the snapshot, 2006-01-02
+	Followers int    `json:"followers"`
+	Change    *int   `json:"change"`
+	Following *int   `json:"following,omitempty"`
+	Posts     *int   `json:"posts,omitempty"`
+	Views     *int64 `json:"views,omitempty"`
+}
+
+// AccountGrowth is the audience growth of the user's account on a platform
+// over the range.
+type AccountGrowth struct {
+	Platform   string               `json:"platform"`
+	Followers  int                  `json:"followers"` // at the last point
+	Change     int                  `json:"change"`    // over the range
+	ChangeRate *float64             `json:"changeRate"`
+	Points     []AccountGrowthPoint `json:"points"`
+}
+
+type AccountGrowthResponse struct {
+	From      time.Time       `json:"from"`
+	To        time.Time       `json:"to"`
+	Interval  string          `json:"interval"`
+	Platforms []AccountGrowth `json:"platforms"`
+}
+
+// accountGrowth returns the growth of the user's accounts on the given
+// platforms, or all platforms if none are given, over the UTC days covering
+// [from, to).
+func accountGrowth(db *sql.DB, userID string, platforms []string, interval string, from, to time.Time) (*AccountGrowthResponse, error) {
+	from = from.Truncate(24 * time.Hour)
+	to = to.Add(24*time.Hour - time.Nanosecond).Truncate(24 * time.Hour)
+
+	baselines, err := models.ListAccountMetricsBefore(db, userID, platforms, from)
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := models.ListAccountMetrics(db, userID, platforms, interval, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := make(map[string]models.AccountMetrics, len(baselines))
+	for _, m := range baselines {
+		previous[m.Platform] = m
+	}
+	res := &AccountGrowthResponse{
+		From:      from,
+		To:        to,
+		Interval:  interval,
+		Platforms: []AccountGrowth{},
+	}
+	var growth *AccountGrowth
+	var first models.AccountMetrics
+	for _, m := range metrics {
+		if growth == nil || growth.Platform != m.Platform {
+			res.Platforms = append(res.Platforms, AccountGrowth{Platform: m.Platform, Points: []AccountGrowthPoint{}})
+			growth = &res.Platforms[len(res.Platforms)-1]
+			first = m
+			if base, ok := previous[m.Platform]; ok && base.SocialID == m.SocialID {
+				first = base
+			}
+		}
+		point := AccountGrowthPoint{
+			Date:      m.SnapshotDate.Format("2006-01-02"),
+			Followers: m.Followers,
+			Following: m.Following,
+			Posts:     m.Posts,
+			Views:     m.Views,
+		}
+		if prev, ok := previous[m.Platform]; ok && prev.SocialID == m.SocialID {
+			change := m.Followers - prev.Followers
+			point.Change = &change
+		} else {
+			// A different account; growth starts over from here
+			first = m
+		}
+		previous[m.Platform] = m
+
+		growth.Points = append(growth.Points, point)
+		growth.Followers = m.Followers
+		growth.Change = m.Followers - first.Followers
+		growth.ChangeRate = nil
+		if first.Followers > 0 {
+			rate := float64(growth.Change) / float64(first.Followers)
+			growth.ChangeRate = &rate
+		}
+	}
+	return res, nil
+}
+
+// GET /api/analytics/growth
+// Follower counts of the user's accounts per day, week or month. Snapshots
+// are taken once a day, so dates are UTC days.
+func GetAccountGrowthHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		query, err := parseAnalyticsQuery(r, "day")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		res, err := accountGrowth(db, userID, query.platforms, query.interval, query.from, query.to)
+		if err != nil {
+			log.Printf("[Analytics] Failed to load account metrics for user %s: %v", userID, err)
+			http.Error(w, "Failed to load growth", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}
+}
@@ -0,0 +1,489 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	analyticsDefaultRange = 30 * 24 * time.Hour
+	analyticsMaxRange     = 366 * 24 * time.Hour
+	analyticsTopPosts     = 5
+	analyticsMaxTopPosts  = 50
+)
+
+var analyticsIntervals = map[string]bool{"day": true, "week": true, "month": true}
+
+// AnalyticsTotals adds up what posts gained in a date range. EngagementRate
+// is engagements per impression, or per view on platforms that only report
+// views; it's null when no post reported either.
+type AnalyticsTotals struct {
+	Posts          int      `json:"posts"` // published in the range
+	Likes          int      `json:"likes"`
+	Comments       int      `json:"comments"`
+	Shares         int      `json:"shares"`
+	Views          int      `json:"views"`
+	Impressions    int      `json:"impressions"`
+	Engagements    int      `json:"engagements"`
+	EngagementRate *float64 `json:"engagementRate"`
+
+	// Engagements and reach of the posts the rate can be computed for
+	rateEngagements int
+	reach           int
+}
+
+func (t *AnalyticsTotals) add(g models.PostMetricGain) {
+	engagements := g.Likes + g.Comments + g.Shares
+	t.Likes += g.Likes
+	t.Comments += g.Comments
+	t.Shares += g.Shares
+	t.Views += g.Views
+	t.Impressions += g.Impressions
+	t.Engagements += engagements
+
+	reach := g.Impressions
+	if reach == 0 {
+		reach = g.Views
+	}
+	if reach > 0 {
+		t.reach += reach
+		t.rateEngagements += engagements
+	}
+}
+
+func (t *AnalyticsTotals) finish() {
+	if t.reach > 0 {
+		rate := float64(t.rateEngagements) / float64(t.reach)
+		t.EngagementRate = &rate
+	}
+}
+
+// PlatformAnalytics is the totals of the user's account on one platform.
+type PlatformAnalytics struct {
+	Platform string          `json:"platform"`
+	Totals   AnalyticsTotals `json:"totals"`
+}
+
+// TopPost is a post ranked by the engagements it gained in the range.
+type TopPost struct {
+	PostID         string    `json:"postId"`
+	Platform       string    `json:"platform"`
+	Message        string    `json:"message"`
+	Status         string    `json:"status"`
+	PostedAt       time.Time `json:"postedAt"`
+	Likes          int       `json:"likes"`
+	Comments       int       `json:"comments"`
+	Shares         int       `json:"shares"`
+	Views          int       `json:"views"`
+	Impressions    int       `json:"impressions"`
+	Engagements    int       `json:"engagements"`
+	EngagementRate *float64  `json:"engagementRate"`
+}
+
+// AnalyticsPeriod is the totals of the period before the requested one.
+type AnalyticsPeriod struct {
+	From   time.Time       `json:"from"`
+	To     time.Time       `json:"to"`
+	Totals AnalyticsTotals `json:"totals"`
+}
+
+type AnalyticsSummaryResponse struct {
+	From      time.Time           `json:"from"`
+	To        time.Time           `json:"to"`
+	Platform  string              `json:"platform,omitempty"`
+	Totals    AnalyticsTotals     `json:"totals"`
+	Platforms []PlatformAnalytics `json:"platforms"`
+	TopPosts  []TopPost           `json:"topPosts"`
+	Previous  *AnalyticsPeriod    `json:"previous,omitempty"`
+	// Relative change from the previous period per metric, e.g. 0.25 for a
+	// quarter more; null where the previous period had none
+	Change map[string]*float64 `json:"change,omitempty"`
+}
+
+type AnalyticsTimeSeriesResponse struct {
+	From     time.Time               `json:"from"`
+	To       time.Time               `json:"to"`
+	Platform string                  `json:"platform,omitempty"`
+	Interval string                  `json:"interval"`
+	TimeZone string                  `json:"timeZone"`
+	Points   []models.AnalyticsPoint `json:"points"`
+	Previous []models.AnalyticsPoint `json:"previous,omitempty"` // same buckets, one period earlier
+}
+
+type PostAnalyticsResponse struct {
+	PostID   string                  `json:"postId"`
+	Platform string                  `json:"platform"`
+	PostedAt time.Time               `json:"postedAt"`
+	Interval string                  `json:"interval,omitempty"`
+	TimeZone string                  `json:"timeZone"`
+	Points   []models.AnalyticsPoint `json:"points"` // running totals
+}
+
+// analyticsQuery is the date range and filters shared by the analytics
+// endpoints.
+type analyticsQuery struct {
+	from, to  time.Time
+	platforms []string
+	interval  string
+	location  *time.Location
+	compare   bool
+}
+
+// parseAnalyticsQuery reads from and to (dates, or RFC 3339 times; to is
+// inclusive for dates), platform (one or more, comma separated; all by
+// default), compare and the bucketing parameters. The range defaults to the
+// last 30 days.
+func parseAnalyticsQuery(r *http.Request, defaultInterval string) (analyticsQuery, error) {
+	q := r.URL.Query()
+	query := analyticsQuery{platforms: parseAnalyticsPlatforms(q.Get("platform"))}
+
+	var err error
+	if query.interval, query.location, err = parseAnalyticsBuckets(r, defaultInterval); err != nil {
+		return query, err
+	}
+	if c := q.Get("compare"); c != "" {
+		if query.compare, err = strconv.ParseBool(c); err != nil {
+			return query, errors.New("compare must be true or false")
+		}
+	}
+
+	query.to = time.Now().UTC()
+	if s := q.Get("to"); s != "" {
+		if query.to, err = parseAnalyticsTime(s, query.location, true); err != nil {
+			return query, errors.New("to must be a date (2006-01-02) or an RFC 3339 time")
+		}
+	}
+	query.from = query.to.Add(-analyticsDefaultRange)
+	if s := q.Get("from"); s != "" {
+		if query.from, err = parseAnalyticsTime(s, query.location, false); err != nil {
+			return query, errors.New("from must be a date (2006-01-02) or an RFC 3339 time")
+		}
+	}
+	if !query.from.Before(query.to) {
+		return query, errors.New("from must be before to")
+	}
+	if query.to.Sub(query.from) > analyticsMaxRange {
+		return query, errors.New("the range can be at most 366 days")
+	}
+	return query, nil
+}
+
+// parseAnalyticsPlatforms splits a comma-separated platform list.
+func parseAnalyticsPlatforms(s string) []string {
+	platforms := []string{}
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			platforms = append(platforms, p)
+		}
+	}
+	return platforms
+}
+
+// parseAnalyticsBuckets reads interval (day, week or month) and tz (an IANA
+// time zone, UTC by default), which buckets are aligned to.
+func parseAnalyticsBuckets(r *http.Request, defaultInterval string) (string, *time.Location, error) {
+	q := r.URL.Query()
+	interval := q.Get("interval")
+	if interval == "" {
+		interval = defaultInterval
+	}
+	if interval != "" && !analyticsIntervals[interval] {
+		return "", nil, errors.New("interval must be day, week or month")
+	}
+
+	location := time.UTC
+	if tz := q.Get("tz"); tz != "" {
+		// Local is the server's zone, which Postgres doesn't know by that name
+		loc, err := time.LoadLocation(tz)
+		if err != nil || tz == "Local" {
+			return "", nil, errors.New("tz must be a time zone like Europe/Berlin")
+		}
+		location = loc
+	}
+	return interval, location, nil
+}
+
+// parseAnalyticsTime parses a date as midnight in loc, or the midnight after
+// it if end is set, so that date ranges include their last day.
+func parseAnalyticsTime(s string, loc *time.Location, end bool) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, loc); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t.UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	return t.UTC(), err
+}
+
+// previousPeriod returns the period of the same length right before
+// [from, to).
+func previousPeriod(from, to time.Time) (time.Time, time.Time) {
+	return from.Add(-to.Sub(from)), from
+}
+
+// analyticsTotals adds up the gains of the user's posts in [from, to).
+func analyticsTotals(db *sql.DB, userID string, platforms []string, from, to time.Time) (AnalyticsTotals, map[string]*AnalyticsTotals, []models.PostMetricGain, error) {
+	gains, err := models.ListPostMetricGains(db, userID, platforms, from, to, from.Add(-analyticsMaxAge))
+	if err != nil {
+		return AnalyticsTotals{}, nil, nil, err
+	}
+	counts, err := models.CountPublishedPosts(db, userID, platforms, from, to)
+	if err != nil {
+		return AnalyticsTotals{}, nil, nil, err
+	}
+
+	var totals AnalyticsTotals
+	byPlatform := make(map[string]*AnalyticsTotals)
+	forPlatform := func(p string) *AnalyticsTotals {
+		if byPlatform[p] == nil {
+			byPlatform[p] = &AnalyticsTotals{}
+		}
+		return byPlatform[p]
+	}
+	for _, g := range gains {
+		totals.add(g)
+		forPlatform(g.Platform).add(g)
+	}
+	for p, n := range counts {
+		totals.Posts += n
+		forPlatform(p).Posts = n
+	}
+	totals.finish()
+	for _, t := range byPlatform {
+		t.finish()
+	}
+	return totals, byPlatform, gains, nil
+}
+
+// analyticsChange returns the relative change of each metric.
+func analyticsChange(current, previous AnalyticsTotals) map[string]*float64 {
+	change := func(cur, prev float64) *float64 {
+		if prev == 0 {
+			return nil
+		}
+		c := (cur - prev) / prev
+		return &c
+	}
+	changes := map[string]*float64{
+		"posts":       change(float64(current.Posts), float64(previous.Posts)),
+		"likes":       change(float64(current.Likes), float64(previous.Likes)),
+		"comments":    change(float64(current.Comments), float64(previous.Comments)),
+		"shares":      change(float64(current.Shares), float64(previous.Shares)),
+		"views":       change(float64(current.Views), float64(previous.Views)),
+		"impressions": change(float64(current.Impressions), float64(previous.Impressions)),
+		"engagements": change(float64(current.Engagements), float64(previous.Engagements)),
+	}
+	if current.EngagementRate != nil && previous.EngagementRate != nil {
+		changes["engagementRate"] = change(*current.EngagementRate, *previous.EngagementRate)
+	} else {
+		changes["engagementRate"] = nil
+	}
+	return changes
+}
+
+// analyticsSummary builds the summary of the user's posts on the given
+// platforms, or all platforms if none are given, with up to limit top posts.
+func analyticsSummary(db *sql.DB, userID string, platforms []string, from, to time.Time, limit int, compare bool) (*AnalyticsSummaryResponse, error) {
+	totals, byPlatform, gains, err := analyticsTotals(db, userID, platforms, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &AnalyticsSummaryResponse{
+		From:      from,
+		To:        to,
+		Platform:  strings.Join(platforms, ","),
+		Totals:    totals,
+		Platforms: []PlatformAnalytics{},
+		TopPosts:  []TopPost{},
+	}
+	for p, t := range byPlatform {
+		res.Platforms = append(res.Platforms, PlatformAnalytics{Platform: p, Totals: *t})
+	}
+	sort.Slice(res.Platforms, func(i, j int) bool {
+		a, b := res.Platforms[i].Totals, res.Platforms[j].Totals
+		if a.Engagements != b.Engagements {
+			return a.Engagements > b.Engagements
+		}
+		return res.Platforms[i].Platform < res.Platforms[j].Platform
+	})
+
+	sort.Slice(gains, func(i, j int) bool {
+		a, b := gains[i].Likes+gains[i].Comments+gains[i].Shares, gains[j].Likes+gains[j].Comments+gains[j].Shares
+		if a != b {
+			return a > b
+		}
+		return gains[i].PostedAt.After(gains[j].PostedAt)
+	})
+	for _, g := range gains {
+		if len(res.TopPosts) == limit {
+			break
+		}
+		var t AnalyticsTotals
+		t.add(g)
+		t.finish()
+		res.TopPosts = append(res.TopPosts, TopPost{
+			PostID:         g.PostID.String(),
+			Platform:       g.Platform,
+			Message:        g.Message,
+			Status:         g.Status,
+			PostedAt:       g.PostedAt,
+			Likes:          g.Likes,
+			Comments:       g.Comments,
+			Shares:         g.Shares,
+			Views:          g.Views,
+			Impressions:    g.Impressions,
+			Engagements:    t.Engagements,
+			EngagementRate: t.EngagementRate,
+		})
+	}
+
+	if compare {
+		prevFrom, prevTo := previousPeriod(from, to)
+		previous, _, _, err := analyticsTotals(db, userID, platforms, prevFrom, prevTo)
+		if err != nil {
+			return nil, err
+		}
+		res.Previous = &AnalyticsPeriod{From: prevFrom, To: prevTo, Totals: previous}
+		res.Change = analyticsChange(totals, previous)
+	}
+	return res, nil
+}
+
+// GET /api/analytics/summary
+// Totals of the user's posts over a date range, per platform and overall,
+// with the top posts. Metrics are what the posts gained in the range, so
+// they add up to the time series of the same range.
+func GetAnalyticsSummaryHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		query, err := parseAnalyticsQuery(r, "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		limit := analyticsTopPosts
+		if s := r.URL.Query().Get("limit"); s != "" {
+			if limit, err = strconv.Atoi(s); err != nil || limit < 0 || limit > analyticsMaxTopPosts {
+				http.Error(w, "limit must be between 0 and 50", http.StatusBadRequest)
+				return
+			}
+		}
+
+		res, err := analyticsSummary(db, userID, query.platforms, query.from, query.to, limit, query.compare)
+		if err != nil {
+			log.Printf("[Analytics] Failed to compute totals for user %s: %v", userID, err)
+			http.Error(w, "Failed to load analytics", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+// GET /api/analytics/timeseries
+// What the user's posts gained per day, week or month of a date range.
+func GetAnalyticsTimeSeriesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		query, err := parseAnalyticsQuery(r, "day")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		tz := query.location.String()
+		points, err := models.ListAnalyticsTimeSeries(db, userID, query.platforms, query.interval, tz,
+			query.from, query.to, query.from.Add(-analyticsMaxAge))
+		if err != nil {
+			log.Printf("[Analytics] Failed to load time series for user %s: %v", userID, err)
+			http.Error(w, "Failed to load analytics", http.StatusInternalServerError)
+			return
+		}
+
+		res := AnalyticsTimeSeriesResponse{
+			From:     query.from,
+			To:       query.to,
+			Platform: strings.Join(query.platforms, ","),
+			Interval: query.interval,
+			TimeZone: tz,
+			Points:   points,
+		}
+		if query.compare {
+			from, to := previousPeriod(query.from, query.to)
+			if res.Previous, err = models.ListAnalyticsTimeSeries(db, userID, query.platforms, query.interval, tz,
+				from, to, from.Add(-analyticsMaxAge)); err != nil {
+				log.Printf("[Analytics] Failed to load previous time series for user %s: %v", userID, err)
+				http.Error(w, "Failed to load analytics", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+// GET /api/analytics/posts/{id}
+// The running totals of one post, every snapshot or one point per interval.
+func GetPostAnalyticsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		interval, location, err := parseAnalyticsBuckets(r, "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		post, ok := loadManagedPost(w, db, userID, mux.Vars(r)["id"])
+		if !ok {
+			return
+		}
+
+		tz := location.String()
+		points, err := models.ListPostAnalyticsSeries(db, post.ID, interval, tz)
+		if err != nil {
+			log.Printf("[Analytics] Failed to load analytics of post %s: %v", post.ID, err)
+			http.Error(w, "Failed to load analytics", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(PostAnalyticsResponse{
+			PostID:   post.ID.String(),
+			Platform: post.Platform,
+			PostedAt: post.PostedAt,
+			Interval: interval,
+			TimeZone: tz,
+			Points:   points,
+		})
+	}
+}
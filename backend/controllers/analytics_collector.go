@@ -0,0 +1,644 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// Posts older than this aren't snapshotted anymore
+	analyticsMaxAge = 90 * 24 * time.Hour
+
+	// Accounts collected from at the same time
+	analyticsConcurrency = 4
+
+	youtubeStatsBatchSize = 50
+	twitterStatsBatchSize = 100
+)
+
+// analyticsUnread marks a metric the platform couldn't report this time,
+// e.g. because an insights call failed. The previous snapshot's value is
+// stored in its place: gains are the difference between snapshots, so a 0
+// would show up as a drop followed by a jump.
+const analyticsUnread = -1
+
+// analyticsFetcher returns the current metrics of a user's posts on one
+// platform, keyed by post ID. Posts it couldn't read are left out.
+type analyticsFetcher func(db *sql.DB, userID string, posts []models.Post) (map[uuid.UUID]models.PostAnalytics, error)
+
+var analyticsFetchers = map[string]analyticsFetcher{
+	"facebook":  fetchFacebookAnalytics,
+	"instagram": fetchInstagramAnalytics,
+	"twitter":   fetchTwitterAnalytics,
+	"mastodon":  fetchMastodonAnalytics,
+	"youtube":   fetchYouTubeAnalytics,
+	"telegram":  fetchTelegramAnalytics,
+}
+
+// Platforms whose scheduled posts go live under the ID they were scheduled
+// with
+var analyticsScheduledPlatforms = []string{"facebook", "youtube"}
+
+var analyticsClient = &http.Client{Timeout: 30 * time.Second}
+
+// analyticsInterval is how often a post of the given age is snapshotted.
+// Engagement settles as a post gets older, so snapshots get further apart; 0
+// means the post isn't tracked anymore.
+func analyticsInterval(age time.Duration) time.Duration {
+	switch {
+	case age < 24*time.Hour:
+		return time.Hour
+	case age < 7*24*time.Hour:
+		return 6 * time.Hour
+	case age < 30*24*time.Hour:
+		return 24 * time.Hour
+	case age < analyticsMaxAge:
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+// CollectPostAnalytics snapshots the metrics of every published post that is
+// due according to analyticsInterval. It's meant to run more often than the
+// shortest interval.
+func CollectPostAnalytics(db *sql.DB) {
+	now := time.Now().UTC()
+	since := now.Add(-analyticsMaxAge)
+
+	// The platform publishes scheduled posts without telling us. Mastodon
+	// toots get a new ID and are handled by ResolveScheduledMastodonPosts.
+	if err := models.PublishDueScheduledPosts(db, analyticsScheduledPlatforms); err != nil {
+		log.Printf("[Analytics] Failed to mark due scheduled posts published: %v", err)
+	}
+
+	posts, err := models.ListPublishedPostsSince(db, since)
+	if err != nil {
+		log.Printf("[Analytics] Failed to load published posts: %v", err)
+		return
+	}
+	latest, err := models.LatestAnalyticsSnapshots(db, since)
+	if err != nil {
+		log.Printf("[Analytics] Failed to load previous snapshots: %v", err)
+		return
+	}
+
+	type accountKey struct{ userID, platform string }
+	due := make(map[accountKey][]models.Post)
+	for _, post := range posts {
+		if _, ok := analyticsFetchers[post.Platform]; !ok || post.PlatformPostID == "" {
+			continue
+		}
+		interval := analyticsInterval(now.Sub(post.PostedAt))
+		if interval == 0 {
+			continue
+		}
+		// Snapshots are taken a little early rather than a whole run late
+		if last, ok := latest[post.ID]; ok && now.Sub(last) < interval-5*time.Minute {
+			continue
+		}
+		key := accountKey{post.UserID.String(), post.Platform}
+		due[key] = append(due[key], post)
+	}
+	if len(due) == 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	saved := 0
+	sem := make(chan struct{}, analyticsConcurrency)
+	for key, posts := range due {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(key accountKey, posts []models.Post) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			n := collectAccountAnalytics(db, key.userID, key.platform, posts, now)
+			mu.Lock()
+			saved += n
+			mu.Unlock()
+		}(key, posts)
+	}
+	wg.Wait()
+	log.Printf("[Analytics] Stored %d snapshots from %d accounts", saved, len(due))
+}
+
+// collectAccountAnalytics fetches and stores the snapshots of one user's posts
+// on one platform, returning how many were stored.
+func collectAccountAnalytics(db *sql.DB, userID, platform string, posts []models.Post, now time.Time) int {
+	metrics, err := analyticsFetchers[platform](db, userID, posts)
+	if err != nil {
+		var account *postAccountError
+		if errors.As(err, &account) {
+			log.Printf("[Analytics] Skipping %s posts of user %s: %v", platform, userID, err)
+		} else {
+			log.Printf("[Analytics] Failed to fetch %s metrics for user %s: %v", platform, userID, err)
+		}
+		return 0
+	}
+
+	previous, err := previousAnalytics(db, metrics)
+	if err != nil {
+		log.Printf("[Analytics] Failed to load previous %s snapshots for user %s: %v", platform, userID, err)
+		return 0
+	}
+
+	saved := 0
+	for _, post := range posts {
+		m, ok := metrics[post.ID]
+		if !ok {
+			continue
+		}
+		carryForwardAnalytics(&m, previous[post.ID])
+		m.ID = uuid.New()
+		m.PostID = post.ID
+		m.SnapshotAt = now
+		m.CreatedAt = now
+		if err := models.SavePostAnalytics(db, m); err != nil {
+			log.Printf("[Analytics] Failed to store snapshot of post %s: %v", post.ID, err)
+			continue
+		}
+		saved++
+	}
+	return saved
+}
+
+// previousAnalytics loads the latest snapshot of the posts that have an
+// unread metric.
+func previousAnalytics(db *sql.DB, metrics map[uuid.UUID]models.PostAnalytics) (map[uuid.UUID]models.PostAnalytics, error) {
+	var ids []uuid.UUID
+	for id, m := range metrics {
+		if m.Likes < 0 || m.Comments < 0 || m.Shares < 0 || m.Views < 0 || m.Impressions < 0 {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return models.LatestPostAnalytics(db, ids)
+}
+
+// carryForwardAnalytics replaces unread metrics with their previous values,
+// or 0 for a post's first snapshot.
+func carryForwardAnalytics(m *models.PostAnalytics, previous models.PostAnalytics) {
+	for _, f := range []struct {
+		metric   *int
+		previous int
+	}{
+		{&m.Likes, previous.Likes},
+		{&m.Comments, previous.Comments},
+		{&m.Shares, previous.Shares},
+		{&m.Views, previous.Views},
+		{&m.Impressions, previous.Impressions},
+	} {
+		if *f.metric < 0 {
+			*f.metric = f.previous
+		}
+	}
+}
+
+// fetchFacebookAnalytics reads Page posts and videos. Feed posts have
+// "pageID_postID" IDs; videos and Reels have a bare video ID.
+func fetchFacebookAnalytics(db *sql.DB, userID string, posts []models.Post) (map[uuid.UUID]models.PostAnalytics, error) {
+	accessToken, _, err := postAccount(db, userID, "facebook", false)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make(map[uuid.UUID]models.PostAnalytics)
+	for _, post := range posts {
+		var m models.PostAnalytics
+		var err error
+		if strings.Contains(post.PlatformPostID, "_") {
+			m, err = facebookPostMetrics(post.PlatformPostID, accessToken)
+		} else {
+			m, err = facebookVideoMetrics(post.PlatformPostID, accessToken)
+		}
+		if err != nil {
+			log.Printf("[Facebook] Failed to fetch metrics for post %s: %v", post.ID, err)
+			continue
+		}
+		metrics[post.ID] = m
+	}
+	return metrics, nil
+}
+
+func facebookPostMetrics(postID, accessToken string) (models.PostAnalytics, error) {
+	params := url.Values{}
+	params.Set("fields", "reactions.summary(total_count).limit(0),comments.summary(total_count).limit(0),shares")
+	params.Set("access_token", accessToken)
+	var res struct {
+		Reactions struct {
+			Summary struct {
+				TotalCount int `json:"total_count"`
+			} `json:"summary"`
+		} `json:"reactions"`
+		Comments struct {
+			Summary struct {
+				TotalCount int `json:"total_count"`
+			} `json:"summary"`
+		} `json:"comments"`
+		Shares struct {
+			Count int `json:"count"`
+		} `json:"shares"`
+	}
+	if err := graphAPIRequest(http.MethodGet, url.PathEscape(postID), params, &res); err != nil {
+		return models.PostAnalytics{}, err
+	}
+	m := models.PostAnalytics{
+		Likes:       res.Reactions.Summary.TotalCount,
+		Comments:    res.Comments.Summary.TotalCount,
+		Shares:      res.Shares.Count,
+		Impressions: analyticsUnread,
+	}
+
+	// Insights need the page to have enough followers; the counts above are
+	// still worth keeping without them
+	insights, err := lib.FetchFacebookPostAnalytics(postID, accessToken)
+	if err != nil {
+		log.Printf("[Facebook] No insights for post %s: %v", postID, err)
+	} else if v, ok := insights["post_impressions"].(float64); ok {
+		m.Impressions = int(v)
+	}
+	return m, nil
+}
+
+func facebookVideoMetrics(videoID, accessToken string) (models.PostAnalytics, error) {
+	params := url.Values{}
+	params.Set("fields", "likes.summary(total_count).limit(0),comments.summary(total_count).limit(0)")
+	params.Set("access_token", accessToken)
+	var res struct {
+		Likes struct {
+			Summary struct {
+				TotalCount int `json:"total_count"`
+			} `json:"summary"`
+		} `json:"likes"`
+		Comments struct {
+			Summary struct {
+				TotalCount int `json:"total_count"`
+			} `json:"summary"`
+		} `json:"comments"`
+	}
+	if err := graphAPIRequest(http.MethodGet, url.PathEscape(videoID), params, &res); err != nil {
+		return models.PostAnalytics{}, err
+	}
+	m := models.PostAnalytics{
+		Likes:       res.Likes.Summary.TotalCount,
+		Comments:    res.Comments.Summary.TotalCount,
+		Views:       analyticsUnread,
+		Impressions: analyticsUnread,
+	}
+
+	params = url.Values{}
+	params.Set("metric", "total_video_views,total_video_impressions")
+	params.Set("access_token", accessToken)
+	var insights graphInsights
+	if err := graphAPIRequest(http.MethodGet, url.PathEscape(videoID)+"/video_insights", params, &insights); err != nil {
+		log.Printf("[Facebook] No insights for video %s: %v", videoID, err)
+		return m, nil
+	}
+	m.Views = insights.value("total_video_views")
+	m.Impressions = insights.value("total_video_impressions")
+	return m, nil
+}
+
+// graphInsights is the response of a Graph API insights edge.
+type graphInsights struct {
+	Data []struct {
+		Name   string `json:"name"`
+		Values []struct {
+			Value json.RawMessage `json:"value"`
+		} `json:"values"`
+	} `json:"data"`
+}
+
+// value returns a numeric metric, or analyticsUnread if it's missing or not a
+// number.
+func (g graphInsights) value(name string) int {
+	for _, metric := range g.Data {
+		if metric.Name != name || len(metric.Values) == 0 {
+			continue
+		}
+		var n float64
+		if json.Unmarshal(metric.Values[0].Value, &n) == nil {
+			return int(n)
+		}
+	}
+	return analyticsUnread
+}
+
+func fetchInstagramAnalytics(db *sql.DB, userID string, posts []models.Post) (map[uuid.UUID]models.PostAnalytics, error) {
+	accessToken, _, err := postAccount(db, userID, "instagram", false)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make(map[uuid.UUID]models.PostAnalytics)
+	for _, post := range posts {
+		params := url.Values{}
+		params.Set("fields", "media_product_type,like_count,comments_count")
+		params.Set("access_token", accessToken)
+		var media struct {
+			MediaProductType string `json:"media_product_type"`
+			LikeCount        int    `json:"like_count"`
+			CommentsCount    int    `json:"comments_count"`
+		}
+		if err := graphAPIRequest(http.MethodGet, url.PathEscape(post.PlatformPostID), params, &media); err != nil {
+			log.Printf("[Instagram] Failed to fetch metrics for post %s: %v", post.ID, err)
+			continue
+		}
+		// Impressions and plays were replaced by views, so impressions
+		// aren't reported anymore
+		m := models.PostAnalytics{
+			Likes:       media.LikeCount,
+			Comments:    media.CommentsCount,
+			Shares:      analyticsUnread,
+			Views:       analyticsUnread,
+			Impressions: analyticsUnread,
+		}
+
+		// Stories have no shares
+		metric := "views,shares"
+		if media.MediaProductType == "STORY" {
+			metric = "views"
+			m.Shares = 0
+		}
+		params = url.Values{}
+		params.Set("metric", metric)
+		params.Set("access_token", accessToken)
+		var insights graphInsights
+		if err := graphAPIRequest(http.MethodGet, url.PathEscape(post.PlatformPostID)+"/insights", params, &insights); err != nil {
+			log.Printf("[Instagram] No insights for post %s: %v", post.ID, err)
+		} else {
+			if media.MediaProductType != "STORY" {
+				m.Shares = insights.value("shares")
+			}
+			m.Views = insights.value("views")
+		}
+		metrics[post.ID] = m
+	}
+	return metrics, nil
+}
+
+func fetchTwitterAnalytics(db *sql.DB, userID string, posts []models.Post) (map[uuid.UUID]models.PostAnalytics, error) {
+	accessToken, _, err := postAccount(db, userID, "twitter", true)
+	if err != nil {
+		return nil, err
+	}
+
+	byTweet := make(map[string]uuid.UUID, len(posts))
+	ids := make([]string, 0, len(posts))
+	for _, post := range posts {
+		byTweet[post.PlatformPostID] = post.ID
+		ids = append(ids, post.PlatformPostID)
+	}
+
+	metrics := make(map[uuid.UUID]models.PostAnalytics)
+	for start := 0; start < len(ids); start += twitterStatsBatchSize {
+		end := start + twitterStatsBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		params := url.Values{}
+		params.Set("ids", strings.Join(ids[start:end], ","))
+		params.Set("tweet.fields", "public_metrics")
+		req, err := http.NewRequest(http.MethodGet, "https://api.twitter.com/2/tweets?"+params.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		resp, err := analyticsClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var res struct {
+			Data []struct {
+				ID            string `json:"id"`
+				PublicMetrics struct {
+					RetweetCount    int `json:"retweet_count"`
+					ReplyCount      int `json:"reply_count"`
+					LikeCount       int `json:"like_count"`
+					QuoteCount      int `json:"quote_count"`
+					ImpressionCount int `json:"impression_count"`
+				} `json:"public_metrics"`
+			} `json:"data"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+			return nil, fmt.Errorf("Twitter API error %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+		err = json.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		// Deleted tweets are reported in "errors" and simply don't appear here
+		for _, tweet := range res.Data {
+			postID, ok := byTweet[tweet.ID]
+			if !ok {
+				continue
+			}
+			pm := tweet.PublicMetrics
+			metrics[postID] = models.PostAnalytics{
+				Likes:       pm.LikeCount,
+				Comments:    pm.ReplyCount,
+				Shares:      pm.RetweetCount + pm.QuoteCount,
+				Impressions: pm.ImpressionCount,
+			}
+		}
+	}
+	return metrics, nil
+}
+
+func fetchMastodonAnalytics(db *sql.DB, userID string, posts []models.Post) (map[uuid.UUID]models.PostAnalytics, error) {
+	accessToken, socialID, err := postAccount(db, userID, "mastodon", true)
+	if err != nil {
+		return nil, err
+	}
+	instanceURL, err := mastodonInstanceURL(socialID)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make(map[uuid.UUID]models.PostAnalytics)
+	for _, post := range posts {
+		var status struct {
+			RepliesCount    int `json:"replies_count"`
+			ReblogsCount    int `json:"reblogs_count"`
+			FavouritesCount int `json:"favourites_count"`
+		}
+		endpoint := instanceURL + "/api/v1/statuses/" + url.PathEscape(post.PlatformPostID)
+		if err := mastodonRequest(http.MethodGet, endpoint, accessToken, nil, &status); err != nil {
+			log.Printf("[Mastodon] Failed to fetch metrics for post %s: %v", post.ID, err)
+			continue
+		}
+		metrics[post.ID] = models.PostAnalytics{
+			Likes:    status.FavouritesCount,
+			Comments: status.RepliesCount,
+			Shares:   status.ReblogsCount,
+		}
+	}
+	return metrics, nil
+}
+
+func fetchYouTubeAnalytics(db *sql.DB, userID string, posts []models.Post) (map[uuid.UUID]models.PostAnalytics, error) {
+	client, err := newYouTubeClient(db, userID)
+	if err == sql.ErrNoRows {
+		return nil, &postAccountError{Message: "youtube account not connected"}
+	} else if err != nil {
+		return nil, err
+	}
+
+	byVideo := make(map[string]uuid.UUID, len(posts))
+	ids := make([]string, 0, len(posts))
+	for _, post := range posts {
+		byVideo[post.PlatformPostID] = post.ID
+		ids = append(ids, post.PlatformPostID)
+	}
+
+	metrics := make(map[uuid.UUID]models.PostAnalytics)
+	for start := 0; start < len(ids); start += youtubeStatsBatchSize {
+		end := start + youtubeStatsBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		params := url.Values{}
+		params.Set("part", "statistics")
+		params.Set("id", strings.Join(ids[start:end], ","))
+		var res struct {
+			Items []struct {
+				ID         string `json:"id"`
+				Statistics struct {
+					ViewCount    string `json:"viewCount"`
+					LikeCount    string `json:"likeCount"`
+					CommentCount string `json:"commentCount"`
+				} `json:"statistics"`
+			} `json:"items"`
+		}
+		if err := client.request(http.MethodGet, "videos", params, nil, &res); err != nil {
+			return nil, err
+		}
+		for _, item := range res.Items {
+			postID, ok := byVideo[item.ID]
+			if !ok {
+				continue
+			}
+			metrics[postID] = models.PostAnalytics{
+				Views:    youtubeCount(item.Statistics.ViewCount),
+				Likes:    youtubeCount(item.Statistics.LikeCount),
+				Comments: youtubeCount(item.Statistics.CommentCount),
+			}
+		}
+	}
+	return metrics, nil
+}
+
+// youtubeCount parses a statistics count, which is a string and missing when
+// the owner hides it.
+func youtubeCount(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return analyticsUnread
+	}
+	return n
+}
+
+var telegramViewsPattern = regexp.MustCompile(`<span class="tgme_widget_message_views">([^<]+)</span>`)
+
+// fetchTelegramAnalytics reads view counts. The Bot API doesn't expose them,
+// so they come from the public embed page of the message, which only exists
+// for public channels and groups.
+func fetchTelegramAnalytics(db *sql.DB, userID string, posts []models.Post) (map[uuid.UUID]models.PostAnalytics, error) {
+	usernames := make(map[string]string) // chat to public username
+	metrics := make(map[uuid.UUID]models.PostAnalytics)
+	for _, post := range posts {
+		botToken, chatID, err := telegramPostBot(db, userID, post)
+		if err != nil {
+			return nil, err
+		}
+		username, ok := usernames[chatID]
+		if !ok {
+			if strings.HasPrefix(chatID, "@") {
+				username = strings.TrimPrefix(chatID, "@")
+			} else {
+				var chat lib.TelegramChat
+				if err := lib.TelegramCall(botToken, "getChat", map[string]interface{}{"chat_id": chatID}, &chat); err != nil {
+					log.Printf("[Telegram] Failed to look up chat %s: %v", chatID, err)
+					continue
+				}
+				username = chat.Username
+			}
+			usernames[chatID] = username
+		}
+		if username == "" {
+			continue
+		}
+
+		views, err := telegramMessageViews(username, post.PlatformPostID)
+		if err != nil {
+			log.Printf("[Telegram] Failed to fetch views for post %s: %v", post.ID, err)
+			continue
+		}
+		metrics[post.ID] = models.PostAnalytics{Views: views}
+	}
+	return metrics, nil
+}
+
+func telegramMessageViews(username, messageID string) (int, error) {
+	endpoint := fmt.Sprintf("https://t.me/%s/%s?embed=1", url.PathEscape(username), url.PathEscape(messageID))
+	resp, err := analyticsClient.Get(endpoint)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("embed page returned status %d", resp.StatusCode)
+	}
+	page, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, err
+	}
+	match := telegramViewsPattern.FindSubmatch(page)
+	if match == nil {
+		return 0, errors.New("no view count on the embed page")
+	}
+	return parseTelegramCount(html.UnescapeString(string(match[1])))
+}
+
+// parseTelegramCount parses abbreviated counts like "987", "1.2K" or "3M".
+func parseTelegramCount(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(s, "K"):
+		multiplier, s = 1e3, strings.TrimSuffix(s, "K")
+	case strings.HasSuffix(s, "M"):
+		multiplier, s = 1e6, strings.TrimSuffix(s, "M")
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid view count %q", s)
+	}
+	return int(n * multiplier), nil
+}
@@ -0,0 +1,306 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	htmltemplate "html/template"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+	"unicode/utf8"
+
+	"social-sync-backend/models"
+	"social-sync-backend/utils"
+)
+
+const reportTopPosts = 5
+
+// analyticsReport is what a report email shows: totals with the change from
+// the previous period, top posts and follower growth.
+type analyticsReport struct {
+	Name     string
+	Period   string // e.g. "Oct 12 – Oct 18, 2026"
+	Accounts string // the account set, e.g. "All accounts"
+	Summary  *AnalyticsSummaryResponse
+	Growth   *AccountGrowthResponse
+	AppURL   string
+}
+
+// buildAnalyticsReport gathers the report of a subscription for [from, to).
+func buildAnalyticsReport(db *sql.DB, sub models.ReportSubscription, from, to time.Time) (*analyticsReport, error) {
+	userID := sub.UserID.String()
+	summary, err := analyticsSummary(db, userID, sub.Platforms, from, to, reportTopPosts, true)
+	if err != nil {
+		return nil, err
+	}
+	growth, err := accountGrowth(db, userID, sub.Platforms, "day", from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := reportLocation(sub.TimeZone)
+	last := to.In(loc).Add(-time.Nanosecond)
+	period := fmt.Sprintf("%s – %s", from.In(loc).Format("Jan 2"), last.Format("Jan 2, 2006"))
+	if sub.Frequency == models.ReportMonthly {
+		period = from.In(loc).Format("January 2006")
+	}
+
+	accounts := "All accounts"
+	if len(sub.Platforms) > 0 {
+		names := make([]string, len(sub.Platforms))
+		for i, p := range sub.Platforms {
+			names[i] = platformName(p)
+		}
+		accounts = strings.Join(names, ", ")
+	}
+
+	return &analyticsReport{
+		Name:     sub.Name,
+		Period:   period,
+		Accounts: accounts,
+		Summary:  summary,
+		Growth:   growth,
+		AppURL:   utils.GetFrontendURL(),
+	}, nil
+}
+
+// sendAnalyticsReport emails the report for [from, to) to the subscription's
+// recipients, or to the user if it has none.
+func sendAnalyticsReport(db *sql.DB, sub models.ReportSubscription, from, to time.Time) error {
+	recipients := sub.Recipients
+	if len(recipients) == 0 {
+		var email string
+		if err := db.QueryRow(`SELECT email FROM users WHERE id = $1`, sub.UserID).Scan(&email); err != nil {
+			return fmt.Errorf("failed to look up the user's email: %w", err)
+		}
+		recipients = []string{email}
+	}
+
+	report, err := buildAnalyticsReport(db, sub, from, to)
+	if err != nil {
+		return err
+	}
+	var text, html bytes.Buffer
+	if err := reportTextTemplate.Execute(&text, report); err != nil {
+		return err
+	}
+	if err := reportHTMLTemplate.Execute(&html, report); err != nil {
+		return err
+	}
+	csvData, err := analyticsCSV(db, sub, from, to)
+	if err != nil {
+		return err
+	}
+
+	loc := reportLocation(sub.TimeZone)
+	filename := fmt.Sprintf("socialsync-analytics-%s-to-%s.csv",
+		from.In(loc).Format("2006-01-02"), to.In(loc).Add(-time.Nanosecond).Format("2006-01-02"))
+	return utils.SendEmail(utils.Email{
+		To:      recipients,
+		Subject: fmt.Sprintf("%s: %s", sub.Name, report.Period),
+		Text:    text.String(),
+		HTML:    html.String(),
+		Attachments: []utils.EmailAttachment{
+			{Filename: filename, ContentType: "text/csv", Data: csvData},
+		},
+	})
+}
+
+// analyticsCSV writes every snapshot taken in the period, one row each.
+func analyticsCSV(db *sql.DB, sub models.ReportSubscription, from, to time.Time) ([]byte, error) {
+	snapshots, err := models.ListAnalyticsSnapshots(db, sub.UserID.String(), sub.Platforms, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"snapshot_at", "post_id", "platform", "platform_post_id", "posted_at",
+		"likes", "comments", "shares", "views", "impressions"})
+	for _, s := range snapshots {
+		w.Write([]string{
+			s.SnapshotAt.UTC().Format(time.RFC3339),
+			s.PostID.String(),
+			s.Platform,
+			s.PlatformPostID,
+			s.PostedAt.UTC().Format(time.RFC3339),
+			strconv.Itoa(s.Likes),
+			strconv.Itoa(s.Comments),
+			strconv.Itoa(s.Shares),
+			strconv.Itoa(s.Views),
+			strconv.Itoa(s.Impressions),
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// reportLocation returns the subscription's time zone, which was validated
+// when it was saved.
+func reportLocation(tz string) *time.Location {
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func platformName(platform string) string {
+	switch platform {
+	case "youtube":
+		return "YouTube"
+	case "linkedin":
+		return "LinkedIn"
+	case "tiktok":
+		return "TikTok"
+	}
+	if platform == "" {
+		return ""
+	}
+	return strings.ToUpper(platform[:1]) + platform[1:]
+}
+
+// formatCount writes a count with thousands separators.
+func formatCount(n int) string {
+	if n < 0 {
+		return "-" + formatCount(-n)
+	}
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// formatChange writes a relative change like "+12.5%", or "–" if there is
+// nothing to compare with.
+func formatChange(change *float64) string {
+	if change == nil {
+		return "–"
+	}
+	return fmt.Sprintf("%+.1f%%", *change*100)
+}
+
+func formatRate(rate *float64) string {
+	if rate == nil {
+		return "–"
+	}
+	return fmt.Sprintf("%.2f%%", *rate*100)
+}
+
+func formatSigned(n int) string {
+	if n > 0 {
+		return "+" + formatCount(n)
+	}
+	return formatCount(n)
+}
+
+func excerpt(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= 80 {
+		return s
+	}
+	return string([]rune(s)[:79]) + "…"
+}
+
+var reportFuncs = map[string]interface{}{
+	"count":    formatCount,
+	"change":   formatChange,
+	"rate":     formatRate,
+	"signed":   formatSigned,
+	"platform": platformName,
+	"excerpt":  excerpt,
+	"add1":     func(i int) int { return i + 1 },
+	"metric": func(changes map[string]*float64, name string) *float64 {
+		return changes[name]
+	},
+}
+
+var reportTextTemplate = texttemplate.Must(texttemplate.New("report").Funcs(reportFuncs).Parse(`{{.Name}}
+{{.Period}} · {{.Accounts}}
+
+TOTALS (change from the previous period)
+Posts published   {{count .Summary.Totals.Posts}} ({{change (metric .Summary.Change "posts")}})
+Engagements       {{count .Summary.Totals.Engagements}} ({{change (metric .Summary.Change "engagements")}})
+Likes             {{count .Summary.Totals.Likes}} ({{change (metric .Summary.Change "likes")}})
+Comments          {{count .Summary.Totals.Comments}} ({{change (metric .Summary.Change "comments")}})
+Shares            {{count .Summary.Totals.Shares}} ({{change (metric .Summary.Change "shares")}})
+Views             {{count .Summary.Totals.Views}} ({{change (metric .Summary.Change "views")}})
+Impressions       {{count .Summary.Totals.Impressions}} ({{change (metric .Summary.Change "impressions")}})
+Engagement rate   {{rate .Summary.Totals.EngagementRate}} ({{change (metric .Summary.Change "engagementRate")}})
+{{if .Summary.Platforms}}
+BY ACCOUNT
+{{range .Summary.Platforms}}{{platform .Platform}}: {{count .Totals.Posts}} posts, {{count .Totals.Engagements}} engagements, {{rate .Totals.EngagementRate}} engagement rate
+{{end}}{{end}}{{if .Summary.TopPosts}}
+TOP POSTS
+{{range $i, $p := .Summary.TopPosts}}{{add1 $i}}. [{{platform $p.Platform}}] {{excerpt $p.Message}}
+   {{count $p.Engagements}} engagements · {{count $p.Likes}} likes · {{count $p.Comments}} comments · {{count $p.Shares}} shares
+{{end}}{{end}}{{if .Growth.Platforms}}
+FOLLOWERS
+{{range .Growth.Platforms}}{{platform .Platform}}: {{count .Followers}} ({{signed .Change}})
+{{end}}{{end}}
+See the full analytics at {{.AppURL}}/home/analytics
+A CSV of every metrics snapshot in the period is attached.
+`))
+
+var reportHTMLTemplate = htmltemplate.Must(htmltemplate.New("report").Funcs(reportFuncs).Parse(`<!DOCTYPE html>
+<html>
+<body style="margin:0;padding:24px;background:#f4f5f7;font-family:Helvetica,Arial,sans-serif;color:#1f2933;">
+<table role="presentation" width="100%" cellpadding="0" cellspacing="0" style="max-width:640px;margin:0 auto;background:#ffffff;border-radius:8px;">
+<tr><td style="padding:24px 24px 8px;">
+  <h1 style="margin:0;font-size:20px;">{{.Name}}</h1>
+  <p style="margin:4px 0 0;color:#616e7c;">{{.Period}} · {{.Accounts}}</p>
+</td></tr>
+
+<tr><td style="padding:16px 24px;">
+  <h2 style="font-size:16px;margin:0 0 8px;">Totals</h2>
+  <table role="presentation" width="100%" cellpadding="6" cellspacing="0" style="border-collapse:collapse;font-size:14px;">
+    <tr style="color:#616e7c;text-align:left;"><th>Metric</th><th style="text-align:right;">Value</th><th style="text-align:right;">vs. previous</th></tr>
+    <tr><td>Posts published</td><td style="text-align:right;">{{count .Summary.Totals.Posts}}</td><td style="text-align:right;">{{change (metric .Summary.Change "posts")}}</td></tr>
+    <tr><td>Engagements</td><td style="text-align:right;">{{count .Summary.Totals.Engagements}}</td><td style="text-align:right;">{{change (metric .Summary.Change "engagements")}}</td></tr>
+    <tr><td>Likes</td><td style="text-align:right;">{{count .Summary.Totals.Likes}}</td><td style="text-align:right;">{{change (metric .Summary.Change "likes")}}</td></tr>
+    <tr><td>Comments</td><td style="text-align:right;">{{count .Summary.Totals.Comments}}</td><td style="text-align:right;">{{change (metric .Summary.Change "comments")}}</td></tr>
+    <tr><td>Shares</td><td style="text-align:right;">{{count .Summary.Totals.Shares}}</td><td style="text-align:right;">{{change (metric .Summary.Change "shares")}}</td></tr>
+    <tr><td>Views</td><td style="text-align:right;">{{count .Summary.Totals.Views}}</td><td style="text-align:right;">{{change (metric .Summary.Change "views")}}</td></tr>
+    <tr><td>Impressions</td><td style="text-align:right;">{{count .Summary.Totals.Impressions}}</td><td style="text-align:right;">{{change (metric .Summary.Change "impressions")}}</td></tr>
+    <tr><td>Engagement rate</td><td style="text-align:right;">{{rate .Summary.Totals.EngagementRate}}</td><td style="text-align:right;">{{change (metric .Summary.Change "engagementRate")}}</td></tr>
+  </table>
+</td></tr>
+{{if .Summary.Platforms}}
+<tr><td style="padding:16px 24px;">
+  <h2 style="font-size:16px;margin:0 0 8px;">By account</h2>
+  <table role="presentation" width="100%" cellpadding="6" cellspacing="0" style="border-collapse:collapse;font-size:14px;">
+    <tr style="color:#616e7c;text-align:left;"><th>Account</th><th style="text-align:right;">Posts</th><th style="text-align:right;">Engagements</th><th style="text-align:right;">Rate</th></tr>
+    {{range .Summary.Platforms}}<tr><td>{{platform .Platform}}</td><td style="text-align:right;">{{count .Totals.Posts}}</td><td style="text-align:right;">{{count .Totals.Engagements}}</td><td style="text-align:right;">{{rate .Totals.EngagementRate}}</td></tr>
+    {{end}}
+  </table>
+</td></tr>
+{{end}}{{if .Summary.TopPosts}}
+<tr><td style="padding:16px 24px;">
+  <h2 style="font-size:16px;margin:0 0 8px;">Top posts</h2>
+  {{range .Summary.TopPosts}}<p style="margin:0 0 12px;font-size:14px;">
+    <strong>{{platform .Platform}}</strong> · {{excerpt .Message}}<br>
+    <span style="color:#616e7c;">{{count .Engagements}} engagements · {{count .Likes}} likes · {{count .Comments}} comments · {{count .Shares}} shares</span>
+  </p>
+  {{end}}
+</td></tr>
+{{end}}{{if .Growth.Platforms}}
+<tr><td style="padding:16px 24px;">
+  <h2 style="font-size:16px;margin:0 0 8px;">Followers</h2>
+  <table role="presentation" width="100%" cellpadding="6" cellspacing="0" style="border-collapse:collapse;font-size:14px;">
+    {{range .Growth.Platforms}}<tr><td>{{platform .Platform}}</td><td style="text-align:right;">{{count .Followers}}</td><td style="text-align:right;">{{signed .Change}}</td></tr>
+    {{end}}
+  </table>
+</td></tr>
+{{end}}
+<tr><td style="padding:16px 24px 24px;font-size:13px;color:#616e7c;">
+  <a href="{{.AppURL}}/home/analytics" style="color:#3b82f6;">See the full analytics</a>.
+  A CSV of every metrics snapshot in the period is attached.
+</td></tr>
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+)
+
+type BlueskyConnectRequest struct {
+	Handle      string `json:"handle"`
+	AppPassword string `json:"appPassword"`
+}
+
+// blueskyAccount is a connected Bluesky account with a usable session.
+type blueskyAccount struct {
+	DID        string
+	AccessJwt  string
+	RefreshJwt string
+
+	// login signs in again when the refresh token is no longer accepted, and
+	// save stores a renewed session. Both may be nil.
+	login func() (*lib.BlueskySession, error)
+	save  func(session *lib.BlueskySession)
+}
+
+// refresh renews the session with the refresh token, falling back to login.
+func (a *blueskyAccount) refresh() error {
+	var session *lib.BlueskySession
+	var err error
+	if a.RefreshJwt != "" {
+		session, err = lib.BlueskyRefreshSession(a.RefreshJwt)
+		if err != nil {
+			log.Printf("[Bluesky] refreshSession failed for %s: %v", a.DID, err)
+		}
+	}
+	if session == nil {
+		if a.login == nil {
+			return errors.New("Bluesky session expired. Please reconnect your account.")
+		}
+		if session, err = a.login(); err != nil {
+			return fmt.Errorf("Bluesky session expired and sign-in failed: %v", err)
+		}
+	}
+
+	a.AccessJwt = session.AccessJwt
+	a.RefreshJwt = session.RefreshJwt
+	if a.save != nil {
+		a.save(session)
+	}
+	return nil
+}
+
+// call runs fn with the access token. When the PDS rejects the token as
+// expired, the session is refreshed and fn is run once more.
+func (a *blueskyAccount) call(fn func(accessJwt string) error) error {
+	err := fn(a.AccessJwt)
+	var apiErr *lib.BlueskyError
+	if !errors.As(err, &apiErr) || !apiErr.IsExpiredToken() {
+		return err
+	}
+	if err := a.refresh(); err != nil {
+		return err
+	}
+	return fn(a.AccessJwt)
+}
+
+// POST /connect/bluesky
+// Bluesky has no OAuth for third-party apps yet, so users connect with their
+// handle and an app password. The password is stored encrypted so an expired
+// session can be recreated without asking the user again.
+func ConnectBlueskyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var req BlueskyConnectRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		handle := strings.TrimPrefix(strings.TrimSpace(req.Handle), "@")
+		if handle == "" || req.AppPassword == "" {
+			http.Error(w, "handle and appPassword are required", http.StatusBadRequest)
+			return
+		}
+
+		session, err := lib.BlueskyCreateSession(handle, req.AppPassword)
+		if err != nil {
+			log.Printf("[Bluesky] createSession failed for user %s: %v", userID, err)
+			var apiErr *lib.BlueskyError
+			if errors.As(err, &apiErr) && apiErr.Status == http.StatusUnauthorized {
+				http.Error(w, "Invalid Bluesky handle or app password", http.StatusUnauthorized)
+				return
+			}
+			http.Error(w, "Failed to sign in to Bluesky", http.StatusBadGateway)
+			return
+		}
+
+		encryptedPassword, err := lib.EncryptSecret(req.AppPassword)
+		if err != nil {
+			log.Printf("[Bluesky] Failed to encrypt app password: %v", err)
+			http.Error(w, "Failed to store Bluesky credentials", http.StatusInternalServerError)
+			return
+		}
+
+		profileName := "@" + session.Handle
+		var avatar *string
+		if profile, err := lib.BlueskyGetProfile(session.AccessJwt, session.DID); err != nil {
+			log.Printf("[Bluesky] getProfile failed for %s: %v", session.DID, err)
+		} else {
+			if profile.DisplayName != "" {
+				profileName = fmt.Sprintf("%s (@%s)", profile.DisplayName, session.Handle)
+			}
+			if profile.Avatar != "" {
+				avatar = &profile.Avatar
+			}
+		}
+
+		_, err = db.Exec(`
+			INSERT INTO social_accounts (
+				user_id, platform, social_id, access_token, access_token_expires_at,
+				refresh_token, encrypted_secret, profile_picture_url, profile_name, connected_at
+			) VALUES (
+				$1, 'bluesky', $2, $3, $4, $5, $6, $7, $8, NOW()
+			)
+			ON CONFLICT (user_id, platform) DO UPDATE SET
+				access_token = EXCLUDED.access_token,
+				access_token_expires_at = EXCLUDED.access_token_expires_at,
+				refresh_token = EXCLUDED.refresh_token,
+				encrypted_secret = EXCLUDED.encrypted_secret,
+				social_id = EXCLUDED.social_id,
+				profile_picture_url = EXCLUDED.profile_picture_url,
+				profile_name = EXCLUDED.profile_name,
+				connected_at = NOW()
+		`,
+			userID,
+			session.DID,
+			session.AccessJwt,
+			lib.BlueskyTokenExpiry(session.AccessJwt),
+			session.RefreshJwt,
+			encryptedPassword,
+			avatar,
+			profileName,
+		)
+		if err != nil {
+			log.Printf("[Bluesky] Failed to save account for user %s: %v", userID, err)
+			http.Error(w, "Failed to save Bluesky account", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Bluesky account connected successfully!",
+			"handle":  session.Handle,
+		})
+	}
+}
+
+// getBlueskyAccount loads the user's Bluesky session, refreshing it when the
+// access token has expired and logging in again with the stored app password
+// when the refresh token is no longer accepted.
+func getBlueskyAccount(db *sql.DB, userID string) (*blueskyAccount, error) {
+	var (
+		did, accessJwt string
+		expiresAt      *time.Time
+		refreshJwt     *string
+		encrypted      *string
+	)
+	err := db.QueryRow(`
+		SELECT social_id, access_token, access_token_expires_at, refresh_token, encrypted_secret
+		FROM social_accounts
+		WHERE user_id = $1 AND platform = 'bluesky'
+	`, userID).Scan(&did, &accessJwt, &expiresAt, &refreshJwt, &encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	account := &blueskyAccount{DID: did, AccessJwt: accessJwt}
+	if refreshJwt != nil {
+		account.RefreshJwt = *refreshJwt
+	}
+	if encrypted != nil {
+		account.login = func() (*lib.BlueskySession, error) {
+			password, err := lib.DecryptSecret(*encrypted)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read stored Bluesky credentials: %v", err)
+			}
+			return lib.BlueskyCreateSession(did, password)
+		}
+	}
+	account.save = func(session *lib.BlueskySession) {
+		_, err := db.Exec(`
+			UPDATE social_accounts
+			SET access_token = $1, access_token_expires_at = $2, refresh_token = $3, last_synced_at = NOW()
+			WHERE user_id = $4 AND platform = 'bluesky'
+		`, session.AccessJwt, lib.BlueskyTokenExpiry(session.AccessJwt), session.RefreshJwt, userID)
+		if err != nil {
+			log.Printf("[Bluesky] Failed to store refreshed session for user %s: %v", userID, err)
+		}
+	}
+
+	if expiresAt != nil && !time.Now().Add(time.Minute).Before(*expiresAt) {
+		if err := account.refresh(); err != nil {
+			return nil, err
+		}
+	}
+	return account, nil
+}
@@ -0,0 +1,501 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+	"social-sync-backend/utils"
+)
+
+const (
+	blueskyCharLimit     = 300
+	blueskyMaxImages     = 4
+	blueskyMaxImageBytes = 1000000
+	blueskyMaxTagChars   = 64
+)
+
+type BlueskyPostRequest struct {
+	Message         string             `json:"message"`
+	MediaUrls       []string           `json:"mediaUrls,omitempty"`
+	Media           []models.MediaItem `json:"media,omitempty"`
+	DisableLinkCard bool               `json:"disableLinkCard,omitempty"` // skip the preview card for the first link
+	ThreadOptions
+}
+
+// blueskyFacet annotates a byte range of the post text as a link, mention or tag.
+type blueskyFacet struct {
+	Index struct {
+		ByteStart int `json:"byteStart"`
+		ByteEnd   int `json:"byteEnd"`
+	} `json:"index"`
+	Features []map[string]string `json:"features"`
+}
+
+var (
+	blueskyURLPattern     = regexp.MustCompile(`https?://[^\s<>"]+`)
+	blueskyMentionPattern = regexp.MustCompile(`(?:^|[\s(])(@[a-zA-Z0-9][a-zA-Z0-9.-]*\.[a-zA-Z][a-zA-Z0-9-]*)`)
+	blueskyTagPattern     = regexp.MustCompile(`(?:^|\s)([#＃][^\s#＃]+)`)
+
+	metaTagPattern  = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	metaAttrPattern = regexp.MustCompile(`(?is)(property|name|content)\s*=\s*("[^"]*"|'[^']*')`)
+	titleTagPattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+func PostToBlueskyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var req BlueskyPostRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		mediaItems, err := resolveMediaItems(db, userID, req.MediaUrls, req.Media)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		media := make([]threadMedia, 0, len(mediaItems))
+		for _, item := range mediaItems {
+			if isVideoURL(item.URL) {
+				http.Error(w, "Bluesky video uploads are not supported yet", http.StatusBadRequest)
+				return
+			}
+			media = append(media, threadMedia{URL: item.URL, AltText: item.AltText})
+		}
+
+		message := strings.TrimSpace(req.Message)
+		if message == "" && len(req.Thread) == 0 && len(media) == 0 {
+			http.Error(w, "Message cannot be empty", http.StatusBadRequest)
+			return
+		}
+
+		texts, err := buildThreadSegments(message, req.ThreadOptions, blueskyCharLimit, utils.BlueskyTextLength, "Bluesky")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(texts) == 0 {
+			texts = []string{""}
+		}
+
+		segments, err := distributeThreadMedia(texts, media, blueskyMaxImages)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		account, err := getBlueskyAccount(db, userID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Bluesky account not connected", http.StatusBadRequest)
+				return
+			}
+			log.Printf("[Bluesky] Failed to load session for user %s: %v", userID, err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		results, err := publishBlueskyThread(account, segments, req.DisableLinkCard)
+
+		if len(results) > 0 {
+			if err := saveThreadPosts(db, userID, "bluesky", segments, results); err != nil {
+				log.Printf("ERROR: Failed to save Bluesky posts for user %s: %v", userID, err)
+			}
+		}
+
+		if err != nil {
+			var tErr *threadError
+			errors.As(err, &tErr)
+			log.Printf("[Bluesky] Publish failed for user %s: %v", userID, err)
+
+			status := http.StatusBadGateway
+			var apiErr *lib.BlueskyError
+			if errors.As(err, &apiErr) && apiErr.Status == http.StatusBadRequest {
+				status = http.StatusBadRequest
+			}
+
+			if len(segments) == 1 {
+				http.Error(w, fmt.Sprintf("Failed to post to Bluesky: %v", tErr.Err), status)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadGateway)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":         fmt.Sprintf("Thread failed at segment %d of %d: %v", tErr.Index+1, len(segments), tErr.Err),
+				"failedSegment": tErr.Index,
+				"segments":      results,
+			})
+			return
+		}
+
+		response := map[string]interface{}{
+			"message": "Posted to Bluesky successfully",
+			"uri":     results[0].ID,
+			"url":     results[0].URL,
+		}
+		if len(results) > 1 {
+			response["message"] = "Thread posted to Bluesky successfully"
+			response["segments"] = results
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// publishBlueskyThread posts the segments as a reply chain: every reply points
+// at the first post as its root and at the previous one as its parent. Only
+// the first link in the thread gets a preview card.
+func publishBlueskyThread(account *blueskyAccount, segments []threadSegment, disableLinkCard bool) ([]threadSegmentResult, error) {
+	var root *lib.BlueskyStrongRef
+	refs := make(map[string]*lib.BlueskyStrongRef)
+	linkCardUsed := disableLinkCard
+
+	return publishThread(segments, func(seg threadSegment, replyTo string) (string, string, error) {
+		record := map[string]interface{}{
+			"$type":     "app.bsky.feed.post",
+			"text":      seg.Text,
+			"createdAt": time.Now().UTC().Format(time.RFC3339Nano),
+		}
+		if facets := buildBlueskyFacets(seg.Text); len(facets) > 0 {
+			record["facets"] = facets
+		}
+
+		if len(seg.Media) > 0 {
+			embed, err := blueskyImagesEmbed(account, seg.Media)
+			if err != nil {
+				return "", "", err
+			}
+			record["embed"] = embed
+		} else if !linkCardUsed {
+			if link := blueskyURLPattern.FindString(seg.Text); link != "" {
+				linkCardUsed = true
+				embed, err := blueskyLinkCardEmbed(account, trimURLPunctuation(link))
+				if err != nil {
+					log.Printf("[Bluesky] Skipping link card for %s: %v", link, err)
+				} else {
+					record["embed"] = embed
+				}
+			}
+		}
+
+		if replyTo != "" {
+			record["reply"] = map[string]interface{}{
+				"root":   root,
+				"parent": refs[replyTo],
+			}
+		}
+
+		var ref *lib.BlueskyStrongRef
+		err := account.call(func(accessJwt string) error {
+			var err error
+			ref, err = lib.BlueskyCreateRecord(accessJwt, account.DID, "app.bsky.feed.post", record)
+			return err
+		})
+		if err != nil {
+			return "", "", err
+		}
+		if root == nil {
+			root = ref
+		}
+		refs[ref.URI] = ref
+		return ref.URI, blueskyPostURL(account.DID, ref.URI), nil
+	})
+}
+
+// deleteBlueskyPost deletes a post by its at:// record URI.
+func deleteBlueskyPost(account *blueskyAccount, uri string) error {
+	// at://<did>/<collection>/<rkey>
+	parts := strings.Split(strings.TrimPrefix(uri, "at://"), "/")
+	if !strings.HasPrefix(uri, "at://") || len(parts) != 3 {
+		return fmt.Errorf("invalid Bluesky post URI %q", uri)
+	}
+	return account.call(func(accessJwt string) error {
+		return lib.BlueskyDeleteRecord(accessJwt, parts[0], parts[1], parts[2])
+	})
+}
+
+// blueskyPostURL turns an at:// record URI into a bsky.app link.
+func blueskyPostURL(did, uri string) string {
+	rkey := uri[strings.LastIndex(uri, "/")+1:]
+	return fmt.Sprintf("https://bsky.app/profile/%s/post/%s", did, rkey)
+}
+
+// buildBlueskyFacets finds links, mentions and hashtags in text. Facet indexes
+// are UTF-8 byte offsets. Mentions whose handle cannot be resolved are left as
+// plain text.
+func buildBlueskyFacets(text string) []blueskyFacet {
+	var facets []blueskyFacet
+	add := func(start, end int, feature map[string]string) {
+		f := blueskyFacet{Features: []map[string]string{feature}}
+		f.Index.ByteStart = start
+		f.Index.ByteEnd = end
+		facets = append(facets, f)
+	}
+
+	for _, loc := range blueskyURLPattern.FindAllStringIndex(text, -1) {
+		link := trimURLPunctuation(text[loc[0]:loc[1]])
+		add(loc[0], loc[0]+len(link), map[string]string{
+			"$type": "app.bsky.richtext.facet#link",
+			"uri":   link,
+		})
+	}
+
+	for _, loc := range blueskyMentionPattern.FindAllStringSubmatchIndex(text, -1) {
+		mention := strings.TrimRight(text[loc[2]:loc[3]], ".-")
+		did, err := lib.BlueskyResolveHandle(mention[1:])
+		if err != nil {
+			log.Printf("[Bluesky] Could not resolve mention %s: %v", mention, err)
+			continue
+		}
+		add(loc[2], loc[2]+len(mention), map[string]string{
+			"$type": "app.bsky.richtext.facet#mention",
+			"did":   did,
+		})
+	}
+
+	for _, loc := range blueskyTagPattern.FindAllStringSubmatchIndex(text, -1) {
+		tag := strings.TrimRightFunc(text[loc[2]:loc[3]], unicode.IsPunct)
+		_, hashSize := utf8.DecodeRuneInString(tag)
+		name := tag[hashSize:]
+		if name == "" || strings.IndexFunc(name, func(r rune) bool { return !unicode.IsDigit(r) }) == -1 {
+			continue
+		}
+		if utf8.RuneCountInString(name) > blueskyMaxTagChars {
+			continue
+		}
+		add(loc[2], loc[2]+len(tag), map[string]string{
+			"$type": "app.bsky.richtext.facet#tag",
+			"tag":   name,
+		})
+	}
+
+	return facets
+}
+
+func trimURLPunctuation(link string) string {
+	return strings.TrimRight(link, `.,!?:;)'"]}`)
+}
+
+// blueskyImagesEmbed uploads up to four images as blobs and returns the embed.
+func blueskyImagesEmbed(account *blueskyAccount, media []threadMedia) (map[string]interface{}, error) {
+	images := make([]map[string]interface{}, 0, len(media))
+	for i, m := range media {
+		blob, err := uploadBlueskyBlob(account, m.URL)
+		if err != nil {
+			return nil, fmt.Errorf("image %d: %w", i+1, err)
+		}
+		images = append(images, map[string]interface{}{
+			"image": blob,
+			"alt":   m.AltText,
+		})
+	}
+	return map[string]interface{}{
+		"$type":  "app.bsky.embed.images",
+		"images": images,
+	}, nil
+}
+
+func uploadBlueskyBlob(account *blueskyAccount, mediaURL string) (*lib.BlueskyBlob, error) {
+	body, _, mediaType, err := downloadMedia(mediaURL)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return uploadBlueskyImage(account, body, mediaType)
+}
+
+// uploadBlueskyImage reads an image of at most blueskyMaxImageBytes and
+// uploads it as a blob.
+func uploadBlueskyImage(account *blueskyAccount, body io.Reader, mediaType string) (*lib.BlueskyBlob, error) {
+	if !strings.HasPrefix(mediaType, "image/") {
+		return nil, fmt.Errorf("unsupported media type %q", mediaType)
+	}
+	data, err := io.ReadAll(io.LimitReader(body, blueskyMaxImageBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read media: %v", err)
+	}
+	if len(data) > blueskyMaxImageBytes {
+		return nil, fmt.Errorf("image exceeds Bluesky's %d byte limit", blueskyMaxImageBytes)
+	}
+
+	var blob *lib.BlueskyBlob
+	err = account.call(func(accessJwt string) error {
+		blob, err = lib.BlueskyUploadBlob(accessJwt, data, mediaType)
+		return err
+	})
+	return blob, err
+}
+
+// blueskyLinkCardEmbed builds an external embed from the page's Open Graph tags.
+// Bluesky does not fetch previews itself, so the client has to. The link comes
+// from the post text, so the page and its image are fetched with
+// linkCardClient, which only reaches public addresses.
+func blueskyLinkCardEmbed(account *blueskyAccount, link string) (map[string]interface{}, error) {
+	resp, err := linkCardGet(link)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	page, err := io.ReadAll(io.LimitReader(resp.Body, linkCardMaxPageBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	meta := make(map[string]string)
+	for _, tag := range metaTagPattern.FindAllString(string(page), -1) {
+		var key, content string
+		for _, attr := range metaAttrPattern.FindAllStringSubmatch(tag, -1) {
+			value := html.UnescapeString(strings.Trim(attr[2], `"'`))
+			if strings.EqualFold(attr[1], "content") {
+				content = value
+			} else {
+				key = strings.ToLower(value)
+			}
+		}
+		if key != "" && meta[key] == "" {
+			meta[key] = strings.TrimSpace(content)
+		}
+	}
+
+	title := meta["og:title"]
+	if title == "" {
+		if m := titleTagPattern.FindStringSubmatch(string(page)); m != nil {
+			title = strings.TrimSpace(html.UnescapeString(m[1]))
+		}
+	}
+	description := meta["og:description"]
+	if description == "" {
+		description = meta["description"]
+	}
+
+	external := map[string]interface{}{
+		"uri":         link,
+		"title":       title,
+		"description": description,
+	}
+	if image := meta["og:image"]; image != "" {
+		if base, err := url.Parse(link); err == nil {
+			if ref, err := base.Parse(image); err == nil {
+				image = ref.String()
+			}
+		}
+		if thumb, err := blueskyLinkCardThumb(account, image); err != nil {
+			log.Printf("[Bluesky] Link card thumbnail skipped for %s: %v", link, err)
+		} else {
+			external["thumb"] = thumb
+		}
+	}
+
+	return map[string]interface{}{
+		"$type":    "app.bsky.embed.external",
+		"external": external,
+	}, nil
+}
+
+func blueskyLinkCardThumb(account *blueskyAccount, imageURL string) (*lib.BlueskyBlob, error) {
+	resp, err := linkCardGet(imageURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return uploadBlueskyImage(account, resp.Body, mediaType)
+}
+
+const (
+	linkCardMaxPageBytes = 1 << 20
+	linkCardMaxRedirects = 3
+)
+
+// linkCardAddrAllowed reports whether a link card may be fetched from ip.
+// Tests replace it to reach local servers.
+var linkCardAddrAllowed = isPublicIP
+
+// cgnatRange is the carrier-grade NAT range, which net.IP.IsPrivate leaves out.
+var cgnatRange = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || cgnatRange.Contains(ip))
+}
+
+// linkCardClient fetches pages named in post text. Every address is checked
+// after DNS resolution, so a public name can't resolve to an internal
+// service; proxies are bypassed for the same reason.
+var linkCardClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !linkCardAddrAllowed(ip) {
+					return fmt.Errorf("address %s is not public", host)
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 5 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) > linkCardMaxRedirects {
+			return fmt.Errorf("stopped after %d redirects", linkCardMaxRedirects)
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+		}
+		return nil
+	},
+}
+
+// linkCardGet fetches an http(s) URL with linkCardClient. The caller closes
+// the body of the returned 200 response.
+func linkCardGet(rawURL string) (*http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	resp, err := linkCardClient.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return resp, nil
+}
@@ -0,0 +1,489 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"social-sync-backend/lib"
+)
+
+// stubPDS is a minimal PDS that implements the XRPC methods the Bluesky
+// publisher uses. Access tokens in expired are answered with ExpiredToken.
+type stubPDS struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	tokens   int
+	expired  map[string]bool
+	refresh  map[string]bool // refresh tokens the PDS still accepts
+	password string
+	records  []map[string]interface{}
+	deleted  []string
+	blobs    []stubBlob
+	calls    []string
+}
+
+type stubBlob struct {
+	Auth        string
+	ContentType string
+	Size        int
+}
+
+func newStubPDS(t *testing.T) *stubPDS {
+	pds := &stubPDS{
+		expired:  make(map[string]bool),
+		refresh:  make(map[string]bool),
+		password: "app-password",
+	}
+	pds.Server = httptest.NewServer(http.HandlerFunc(pds.serve))
+	t.Cleanup(pds.Close)
+	t.Setenv("BLUESKY_PDS_URL", pds.URL)
+	return pds
+}
+
+func (p *stubPDS) serve(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	nsid := strings.TrimPrefix(r.URL.Path, "/xrpc/")
+	p.calls = append(p.calls, nsid)
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	fail := func(status int, code string) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": code, "message": code})
+	}
+	reply := func(v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+	authorized := func() bool {
+		if p.expired[token] {
+			fail(http.StatusBadRequest, "ExpiredToken")
+			return false
+		}
+		if !strings.HasPrefix(token, "access-") {
+			fail(http.StatusUnauthorized, "AuthenticationRequired")
+			return false
+		}
+		return true
+	}
+
+	switch nsid {
+	case "com.atproto.server.createSession":
+		var body struct {
+			Identifier string `json:"identifier"`
+			Password   string `json:"password"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Password != p.password {
+			fail(http.StatusUnauthorized, "AuthenticationRequired")
+			return
+		}
+		reply(p.newSession())
+
+	case "com.atproto.server.refreshSession":
+		if !p.refresh[token] {
+			fail(http.StatusBadRequest, "ExpiredToken")
+			return
+		}
+		delete(p.refresh, token)
+		reply(p.newSession())
+
+	case "com.atproto.identity.resolveHandle":
+		handle := r.URL.Query().Get("handle")
+		if handle != "alice.test" {
+			fail(http.StatusBadRequest, "InvalidRequest")
+			return
+		}
+		reply(map[string]string{"did": "did:plc:alice"})
+
+	case "com.atproto.repo.uploadBlob":
+		if !authorized() {
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		p.blobs = append(p.blobs, stubBlob{Auth: token, ContentType: r.Header.Get("Content-Type"), Size: len(data)})
+		blob := map[string]interface{}{
+			"$type":    "blob",
+			"ref":      map[string]string{"$link": fmt.Sprintf("bafyblob%d", len(p.blobs))},
+			"mimeType": r.Header.Get("Content-Type"),
+			"size":     len(data),
+		}
+		reply(map[string]interface{}{"blob": blob})
+
+	case "com.atproto.repo.createRecord":
+		if !authorized() {
+			return
+		}
+		var body struct {
+			Repo   string                 `json:"repo"`
+			Record map[string]interface{} `json:"record"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		p.records = append(p.records, body.Record)
+		n := len(p.records)
+		reply(map[string]string{
+			"uri": fmt.Sprintf("at://%s/app.bsky.feed.post/rkey%d", body.Repo, n),
+			"cid": fmt.Sprintf("bafycid%d", n),
+		})
+
+	case "com.atproto.repo.deleteRecord":
+		if !authorized() {
+			return
+		}
+		var body struct {
+			Repo       string `json:"repo"`
+			Collection string `json:"collection"`
+			Rkey       string `json:"rkey"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		p.deleted = append(p.deleted, fmt.Sprintf("at://%s/%s/%s", body.Repo, body.Collection, body.Rkey))
+		reply(map[string]interface{}{})
+
+	default:
+		fail(http.StatusNotImplemented, "MethodNotImplemented")
+	}
+}
+
+func (p *stubPDS) newSession() *lib.BlueskySession {
+	p.tokens++
+	session := &lib.BlueskySession{
+		AccessJwt:  fmt.Sprintf("access-%d", p.tokens),
+		RefreshJwt: fmt.Sprintf("refresh-%d", p.tokens),
+		Handle:     "alice.test",
+		DID:        "did:plc:alice",
+	}
+	p.refresh[session.RefreshJwt] = true
+	return session
+}
+
+// newStubAccount signs in to the stub PDS and returns an account that logs
+// in again with the app password, like getBlueskyAccount does.
+func newStubAccount(t *testing.T, pds *stubPDS) (*blueskyAccount, *[]*lib.BlueskySession) {
+	session, err := lib.BlueskyCreateSession("alice.test", pds.password)
+	if err != nil {
+		t.Fatalf("createSession: %v", err)
+	}
+	var saved []*lib.BlueskySession
+	account := &blueskyAccount{
+		DID:        session.DID,
+		AccessJwt:  session.AccessJwt,
+		RefreshJwt: session.RefreshJwt,
+		login: func() (*lib.BlueskySession, error) {
+			return lib.BlueskyCreateSession(session.DID, pds.password)
+		},
+		save: func(s *lib.BlueskySession) { saved = append(saved, s) },
+	}
+	return account, &saved
+}
+
+// newMediaServer serves a PNG and an HTML page with Open Graph tags.
+func newMediaServer(t *testing.T) *httptest.Server {
+	png := []byte("\x89PNG\r\n\x1a\nstub image")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(png)
+		case "/article":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(w, `<html><head>
+				<title>Fallback title</title>
+				<meta property="og:title" content="Caf&eacute; opening">
+				<meta name="description" content="Coffee &amp; cake">
+				<meta property="og:image" content="/image.png">
+			</head><body></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestBlueskySessionRefreshesOnExpiredToken(t *testing.T) {
+	pds := newStubPDS(t)
+	account, saved := newStubAccount(t, pds)
+	pds.expired[account.AccessJwt] = true
+
+	results, err := publishBlueskyThread(account, []threadSegment{{Text: "hello"}}, true)
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if len(results) != 1 || len(pds.records) != 1 {
+		t.Fatalf("got %d results and %d records, want 1 each", len(results), len(pds.records))
+	}
+	if account.AccessJwt != "access-2" || account.RefreshJwt != "refresh-2" {
+		t.Errorf("session not refreshed: %+v", account)
+	}
+	if len(*saved) != 1 || (*saved)[0].AccessJwt != "access-2" {
+		t.Errorf("refreshed session not saved: %+v", *saved)
+	}
+	want := []string{
+		"com.atproto.server.createSession",
+		"com.atproto.repo.createRecord",
+		"com.atproto.server.refreshSession",
+		"com.atproto.repo.createRecord",
+	}
+	if strings.Join(pds.calls, ",") != strings.Join(want, ",") {
+		t.Errorf("calls = %v, want %v", pds.calls, want)
+	}
+}
+
+func TestBlueskySessionLogsInWhenRefreshTokenIsRejected(t *testing.T) {
+	pds := newStubPDS(t)
+	account, saved := newStubAccount(t, pds)
+	pds.expired[account.AccessJwt] = true
+	delete(pds.refresh, account.RefreshJwt)
+
+	if _, err := publishBlueskyThread(account, []threadSegment{{Text: "hello"}}, true); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if len(*saved) != 1 || account.AccessJwt != "access-2" {
+		t.Errorf("expected a new session from createSession, got %+v", account)
+	}
+
+	// Without stored credentials the user has to reconnect
+	account.login = nil
+	pds.expired[account.AccessJwt] = true
+	delete(pds.refresh, account.RefreshJwt)
+	if _, err := publishBlueskyThread(account, []threadSegment{{Text: "again"}}, true); err == nil || !strings.Contains(err.Error(), "reconnect") {
+		t.Errorf("err = %v, want a reconnect error", err)
+	}
+}
+
+func TestBlueskyCreateSessionRejectsWrongPassword(t *testing.T) {
+	newStubPDS(t)
+
+	_, err := lib.BlueskyCreateSession("alice.test", "wrong")
+	apiErr, ok := err.(*lib.BlueskyError)
+	if !ok || apiErr.Status != http.StatusUnauthorized || apiErr.Code != "AuthenticationRequired" {
+		t.Fatalf("err = %#v, want a 401 AuthenticationRequired", err)
+	}
+	if apiErr.IsExpiredToken() {
+		t.Error("a wrong password must not be treated as an expired token")
+	}
+}
+
+func TestBuildBlueskyFacetsUsesByteOffsets(t *testing.T) {
+	newStubPDS(t)
+
+	// é is 2 bytes and 👋 is 4, so byte offsets differ from rune offsets
+	text := "héllo 👋 @alice.test see https://example.com/a?b=1. #café #42 @bob.test"
+	facets := buildBlueskyFacets(text)
+
+	type span struct {
+		typ        string
+		start, end int
+		covers     string
+		value      string
+	}
+	want := []span{
+		{"app.bsky.richtext.facet#link", 28, 53, "https://example.com/a?b=1", "https://example.com/a?b=1"},
+		{"app.bsky.richtext.facet#mention", 12, 23, "@alice.test", "did:plc:alice"},
+		{"app.bsky.richtext.facet#tag", 55, 61, "#café", "café"},
+	}
+	if len(facets) != len(want) {
+		t.Fatalf("got %d facets, want %d: %+v", len(facets), len(want), facets)
+	}
+	for i, w := range want {
+		f := facets[i]
+		feature := f.Features[0]
+		value := feature["uri"] + feature["did"] + feature["tag"]
+		if feature["$type"] != w.typ || f.Index.ByteStart != w.start || f.Index.ByteEnd != w.end || value != w.value {
+			t.Errorf("facet %d = %s [%d,%d) %q, want %s [%d,%d) %q",
+				i, feature["$type"], f.Index.ByteStart, f.Index.ByteEnd, value, w.typ, w.start, w.end, w.value)
+			continue
+		}
+		if covered := text[f.Index.ByteStart:f.Index.ByteEnd]; covered != w.covers {
+			t.Errorf("facet %d covers %q, want %q", i, covered, w.covers)
+		}
+	}
+}
+
+func TestBlueskyImagesEmbedUploadsBlobsWithAltText(t *testing.T) {
+	pds := newStubPDS(t)
+	media := newMediaServer(t)
+	account, _ := newStubAccount(t, pds)
+
+	segments := []threadSegment{{
+		Text: "two pictures",
+		Media: []threadMedia{
+			{URL: media.URL + "/image.png", AltText: "A cup of coffee"},
+			{URL: media.URL + "/image.png", AltText: "A slice of cake"},
+		},
+	}}
+	if _, err := publishBlueskyThread(account, segments, false); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	if len(pds.blobs) != 2 {
+		t.Fatalf("uploaded %d blobs, want 2", len(pds.blobs))
+	}
+	for _, b := range pds.blobs {
+		if b.ContentType != "image/png" || b.Auth != account.AccessJwt || b.Size == 0 {
+			t.Errorf("unexpected upload %+v", b)
+		}
+	}
+
+	embed := pds.records[0]["embed"].(map[string]interface{})
+	if embed["$type"] != "app.bsky.embed.images" {
+		t.Fatalf("embed type = %v", embed["$type"])
+	}
+	images := embed["images"].([]interface{})
+	for i, alt := range []string{"A cup of coffee", "A slice of cake"} {
+		image := images[i].(map[string]interface{})
+		blob := image["image"].(map[string]interface{})
+		if image["alt"] != alt || blob["mimeType"] != "image/png" {
+			t.Errorf("image %d = %v", i, image)
+		}
+		if ref := blob["ref"].(map[string]interface{}); ref["$link"] != fmt.Sprintf("bafyblob%d", i+1) {
+			t.Errorf("image %d blob ref = %v", i, ref)
+		}
+	}
+}
+
+// allowLocalLinkCards lets link cards reach the httptest servers on loopback.
+func allowLocalLinkCards(t *testing.T) {
+	linkCardAddrAllowed = func(net.IP) bool { return true }
+	t.Cleanup(func() { linkCardAddrAllowed = isPublicIP })
+}
+
+func TestBlueskyLinkCardEmbed(t *testing.T) {
+	pds := newStubPDS(t)
+	media := newMediaServer(t)
+	account, _ := newStubAccount(t, pds)
+	allowLocalLinkCards(t)
+
+	link := media.URL + "/article"
+	segments := []threadSegment{{Text: "Read this: " + link + "."}, {Text: "and again " + link}}
+	if _, err := publishBlueskyThread(account, segments, false); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	embed, ok := pds.records[0]["embed"].(map[string]interface{})
+	if !ok || embed["$type"] != "app.bsky.embed.external" {
+		t.Fatalf("first post embed = %v", pds.records[0]["embed"])
+	}
+	external := embed["external"].(map[string]interface{})
+	if external["uri"] != link || external["title"] != "Café opening" || external["description"] != "Coffee & cake" {
+		t.Errorf("external = %v", external)
+	}
+	thumb, ok := external["thumb"].(map[string]interface{})
+	if !ok || thumb["mimeType"] != "image/png" || len(pds.blobs) != 1 {
+		t.Errorf("thumb = %v, blobs = %d", external["thumb"], len(pds.blobs))
+	}
+
+	// Only the first link in a thread gets a card
+	if _, ok := pds.records[1]["embed"]; ok {
+		t.Errorf("second post has an embed: %v", pds.records[1]["embed"])
+	}
+}
+
+func TestBlueskyLinkCardRefusesPrivateAddresses(t *testing.T) {
+	pds := newStubPDS(t)
+	media := newMediaServer(t)
+	account, _ := newStubAccount(t, pds)
+
+	if _, err := blueskyLinkCardEmbed(account, media.URL+"/article"); err == nil || !strings.Contains(err.Error(), "not public") {
+		t.Errorf("loopback link: err = %v, want a refusal", err)
+	}
+	if _, err := blueskyLinkCardEmbed(account, "file:///etc/passwd"); err == nil {
+		t.Error("file link was fetched")
+	}
+
+	for _, addr := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1", "0.0.0.0", "::1", "fe80::1", "fd00::1"} {
+		if isPublicIP(net.ParseIP(addr)) {
+			t.Errorf("%s is treated as public", addr)
+		}
+	}
+	for _, addr := range []string{"93.184.216.34", "2606:2800:220:1::1"} {
+		if !isPublicIP(net.ParseIP(addr)) {
+			t.Errorf("%s is treated as private", addr)
+		}
+	}
+}
+
+func TestBlueskyLinkCardFollowsLimitedRedirects(t *testing.T) {
+	pds := newStubPDS(t)
+	account, _ := newStubAccount(t, pds)
+	allowLocalLinkCards(t)
+
+	var hops int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hops++
+		http.Redirect(w, r, fmt.Sprintf("/hop%d", hops), http.StatusFound)
+	}))
+	t.Cleanup(srv.Close)
+
+	if _, err := blueskyLinkCardEmbed(account, srv.URL); err == nil || !strings.Contains(err.Error(), "redirects") {
+		t.Errorf("err = %v, want the redirect limit", err)
+	}
+	if hops != linkCardMaxRedirects+1 {
+		t.Errorf("server saw %d requests, want %d", hops, linkCardMaxRedirects+1)
+	}
+}
+
+func TestBlueskyThreadReplyRefs(t *testing.T) {
+	pds := newStubPDS(t)
+	account, _ := newStubAccount(t, pds)
+
+	segments := []threadSegment{{Text: "one"}, {Text: "two"}, {Text: "three"}}
+	results, err := publishBlueskyThread(account, segments, true)
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	if results[0].URL != "https://bsky.app/profile/did:plc:alice/post/rkey1" {
+		t.Errorf("url = %s", results[0].URL)
+	}
+
+	if _, ok := pds.records[0]["reply"]; ok {
+		t.Error("the first post must not be a reply")
+	}
+	ref := func(n int) map[string]interface{} {
+		return map[string]interface{}{
+			"uri": fmt.Sprintf("at://did:plc:alice/app.bsky.feed.post/rkey%d", n),
+			"cid": fmt.Sprintf("bafycid%d", n),
+		}
+	}
+	for i := 1; i < 3; i++ {
+		reply := pds.records[i]["reply"].(map[string]interface{})
+		root := reply["root"].(map[string]interface{})
+		parent := reply["parent"].(map[string]interface{})
+		if fmt.Sprint(root) != fmt.Sprint(ref(1)) {
+			t.Errorf("post %d root = %v, want %v", i+1, root, ref(1))
+		}
+		if fmt.Sprint(parent) != fmt.Sprint(ref(i)) {
+			t.Errorf("post %d parent = %v, want %v", i+1, parent, ref(i))
+		}
+	}
+}
+
+func TestDeleteBlueskyPost(t *testing.T) {
+	pds := newStubPDS(t)
+	account, _ := newStubAccount(t, pds)
+	pds.expired[account.AccessJwt] = true
+
+	uri := "at://did:plc:alice/app.bsky.feed.post/rkey1"
+	if err := deleteBlueskyPost(account, uri); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if len(pds.deleted) != 1 || pds.deleted[0] != uri {
+		t.Errorf("deleted = %v, want [%s]", pds.deleted, uri)
+	}
+
+	if err := deleteBlueskyPost(account, "https://bsky.app/profile/alice.test/post/rkey1"); err == nil {
+		t.Error("expected an error for a URL that isn't a record URI")
+	}
+}
@@ -3,10 +3,13 @@ package controllers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"log"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,11 +17,45 @@ import (
 	"social-sync-backend/models"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 )
 
+// Facebook accepts scheduled_publish_time between 10 minutes and 30 days ahead
+const (
+	facebookMinScheduleDelay = 10 * time.Minute
+	facebookMaxScheduleDelay = 30 * 24 * time.Hour
+)
+
+var facebookCountryCode = regexp.MustCompile(`^[A-Z]{2}$`)
+
 type FacebookPostRequest struct {
-	Message   string   `json:"message"`
-	MediaUrls []string `json:"mediaUrls"`
+	Message   string             `json:"message"`
+	MediaUrls []string           `json:"mediaUrls"`
+	Media     []models.MediaItem `json:"media,omitempty"` // media with alt text, merged with MediaUrls
+
+	Type        string     `json:"type,omitempty"`        // post (default) or reel
+	Link        string     `json:"link,omitempty"`        // shared with a preview; can't be combined with media
+	ScheduledAt *time.Time `json:"scheduledAt,omitempty"` // Facebook publishes it at this time
+
+	Targeting     *FacebookTargeting     `json:"targeting,omitempty"`     // who can see the post at all
+	FeedTargeting *FacebookFeedTargeting `json:"feedTargeting,omitempty"` // whose News Feed shows it
+}
+
+// FacebookTargeting restricts the audience of a post. Anyone outside it can't
+// see the post, even on the Page.
+type FacebookTargeting struct {
+	Countries []string `json:"countries,omitempty"` // ISO 3166 codes
+	AgeMin    int      `json:"ageMin,omitempty"`
+}
+
+// FacebookFeedTargeting limits whose feeds a post shows up in. It stays
+// visible to everyone on the Page.
+type FacebookFeedTargeting struct {
+	Countries []string `json:"countries,omitempty"`
+	AgeMin    int      `json:"ageMin,omitempty"`
+	AgeMax    int      `json:"ageMax,omitempty"`
+	Genders   []int    `json:"genders,omitempty"` // 1 male, 2 female
+	Locales   []int    `json:"locales,omitempty"` // Facebook locale IDs
 }
 
 func PostToFacebookHandler(db *sql.DB) http.HandlerFunc {
@@ -43,11 +80,34 @@ func PostToFacebookHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		if strings.TrimSpace(req.Message) == "" {
+		if strings.TrimSpace(req.Message) == "" && req.Link == "" {
 			http.Error(w, "Message cannot be empty", http.StatusBadRequest)
 			return
 		}
 
+		mediaItems, err := resolveMediaItems(db, userIDStr, req.MediaUrls, req.Media)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Separate images and videos
+		var images []models.MediaItem
+		var imageUrls, videoUrls []string
+		for _, item := range mediaItems {
+			if strings.Contains(item.URL, ".mp4") || isVideoURL(item.URL) {
+				videoUrls = append(videoUrls, item.URL)
+			} else {
+				images = append(images, item)
+				imageUrls = append(imageUrls, item.URL)
+			}
+		}
+
+		if err := validateFacebookPost(req, len(imageUrls), len(videoUrls)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		// Fetch Facebook page access token and page ID from DB
 		var accessToken, pageID string
 		err = db.QueryRow(`
@@ -60,187 +120,391 @@ func PostToFacebookHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		urlEncode := func(s string) string {
-			return url.QueryEscape(s)
-		}
-
-		// Helper function to save post in DB, now accepts multiple media URLs
-		savePost := func(platformPostID string, mediaURLs []string) error {
-			post := models.Post{
-				ID:             uuid.New(),
-				UserID:         userID,
-				Platform:       "facebook",
-				PlatformPostID: platformPostID,
-				Message:        req.Message,
-				MediaURLs:      mediaURLs,
-				PostedAt:       time.Now().UTC(),
-				Status:         "posted",
-				CreatedAt:      time.Now().UTC(),
-				UpdatedAt:      time.Now().UTC(),
+		scheduled := req.ScheduledAt != nil
+		// Parameters shared by feed posts and videos
+		postParams := func() url.Values {
+			form := url.Values{}
+			form.Set("access_token", accessToken)
+			if scheduled {
+				form.Set("published", "false")
+				form.Set("scheduled_publish_time", strconv.FormatInt(req.ScheduledAt.Unix(), 10))
 			}
-			return models.SavePost(db, post)
-		}
-
-		type fbResponse struct {
-			ID string `json:"id"`
+			if req.Targeting != nil {
+				setGraphJSON(form, "targeting", req.Targeting.graphValue())
+			}
+			if req.FeedTargeting != nil {
+				setGraphJSON(form, "feed_targeting", req.FeedTargeting.graphValue())
+			}
+			return form
 		}
 
-		// CASE 1: Text only post
-		if len(req.MediaUrls) == 0 {
-			postURL := fmt.Sprintf("https://graph.facebook.com/%s/feed", pageID)
-			payload := strings.NewReader(fmt.Sprintf("message=%s&access_token=%s", urlEncode(req.Message), urlEncode(accessToken)))
-
-			resp, err := http.Post(postURL, "application/x-www-form-urlencoded", payload)
-			if err != nil {
-				http.Error(w, "Failed to publish text post", http.StatusInternalServerError)
-				return
+		var postID string
+		var mediaURLs []string
+		var kind string
+
+		switch {
+		// CASE 1: Reel
+		case req.Type == "reel":
+			kind = "Reel"
+			mediaURLs = videoUrls
+			postID, err = publishFacebookReel(pageID, accessToken, videoUrls[0], req.Message, req.ScheduledAt)
+
+		// CASE 2: Text or link post
+		case len(mediaItems) == 0:
+			kind = "Text post"
+			form := postParams()
+			form.Set("message", req.Message)
+			if req.Link != "" {
+				kind = "Link post"
+				form.Set("link", req.Link)
 			}
-			defer resp.Body.Close()
-
-			body, _ := io.ReadAll(resp.Body)
-			if resp.StatusCode != http.StatusOK {
-				http.Error(w, fmt.Sprintf("Facebook API error: %s", body), http.StatusInternalServerError)
-				return
+			postID, err = facebookCreate(pageID+"/feed", form)
+
+		// CASE 3: Single video
+		case len(videoUrls) > 0:
+			kind = "Video post"
+			mediaURLs = videoUrls
+			form := postParams()
+			form.Set("file_url", videoUrls[0])
+			form.Set("description", req.Message)
+			postID, err = facebookCreate(pageID+"/videos", form)
+
+		// CASE 4: One or more images
+		default:
+			kind = "Image post"
+			mediaURLs = imageUrls
+			var attachedMediaIDs []string
+			for _, image := range images {
+				form := url.Values{}
+				form.Set("access_token", accessToken)
+				form.Set("url", image.URL)
+				form.Set("published", "false")
+				if scheduled {
+					// Unpublished photos only outlive the request when temporary
+					form.Set("temporary", "true")
+				}
+				if image.AltText != "" {
+					form.Set("alt_text_custom", image.AltText)
+				}
+				var id string
+				if id, err = facebookCreate(pageID+"/photos", form); err != nil {
+					break
+				}
+				attachedMediaIDs = append(attachedMediaIDs, id)
 			}
-
-			var fbRes fbResponse
-			if err := json.Unmarshal(body, &fbRes); err != nil || fbRes.ID == "" {
-				http.Error(w, "Failed to parse Facebook post ID", http.StatusInternalServerError)
-				return
+			if err == nil {
+				form := postParams()
+				form.Set("message", req.Message)
+				for i, id := range attachedMediaIDs {
+					form.Set(fmt.Sprintf("attached_media[%d]", i), fmt.Sprintf(`{"media_fbid":"%s"}`, id))
+				}
+				postID, err = facebookCreate(pageID+"/feed", form)
 			}
+		}
 
-			if err := savePost(fbRes.ID, nil); err != nil {
-				http.Error(w, "Failed to save post in database", http.StatusInternalServerError)
-				return
-			}
+		if err != nil {
+			log.Printf("[Facebook] %s failed for user %s: %v", kind, userIDStr, err)
+			status, result := facebookPublishError(err)
+			writePublishResult(w, status, result)
+			return
+		}
 
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte(fmt.Sprintf("Text post published successfully with post ID %s", fbRes.ID)))
+		now := time.Now().UTC()
+		post := models.Post{
+			ID:             uuid.New(),
+			UserID:         userID,
+			Platform:       "facebook",
+			PlatformPostID: postID,
+			Message:        req.Message,
+			MediaURLs:      mediaURLs,
+			PostedAt:       now,
+			Status:         "posted",
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		result := PublishResult{
+			Platform: "facebook",
+			Status:   "posted",
+			PostID:   postID,
+			Message:  fmt.Sprintf("%s published successfully", kind),
+		}
+		if scheduled {
+			post.PostedAt = req.ScheduledAt.UTC()
+			post.Status = "scheduled"
+			result.Status = "scheduled"
+			result.Message = fmt.Sprintf("%s scheduled for %s", kind, req.ScheduledAt.UTC().Format(time.RFC3339))
+		}
+		if err := models.SavePost(db, post); err != nil {
+			log.Printf("ERROR: Failed to save Facebook post for user %s: %v", userIDStr, err)
+			http.Error(w, "Failed to save post in database", http.StatusInternalServerError)
 			return
 		}
 
-		// Separate images and videos
-		var imageUrls, videoUrls []string
-		for _, u := range req.MediaUrls {
-			if strings.Contains(u, ".mp4") || strings.Contains(u, "/video/") {
-				videoUrls = append(videoUrls, u)
-			} else {
-				imageUrls = append(imageUrls, u)
-			}
+		writePublishResult(w, http.StatusOK, result)
+	}
+}
+
+// validateFacebookPost checks the combination of post type, media, link,
+// schedule and targeting before anything is uploaded.
+func validateFacebookPost(req FacebookPostRequest, images, videos int) error {
+	switch req.Type {
+	case "", "post":
+		if images > 0 && videos > 0 {
+			return errors.New("Facebook does not support mixed image and video posts")
+		}
+		if videos > 1 {
+			return errors.New("Facebook only supports posting one video at a time")
+		}
+	case "reel":
+		if videos != 1 || images > 0 {
+			return errors.New("A Facebook Reel needs exactly one video")
+		}
+		if req.Targeting != nil || req.FeedTargeting != nil {
+			return errors.New("Facebook Reels don't support audience targeting")
 		}
+	default:
+		return errors.New("type must be post or reel")
+	}
 
-		// CASE 2: Single video only
-		if len(videoUrls) > 0 && len(imageUrls) == 0 {
-			if len(videoUrls) > 1 {
-				http.Error(w, "Facebook only supports posting one video at a time", http.StatusBadRequest)
-				return
-			}
+	if req.Link != "" {
+		if images+videos > 0 {
+			return errors.New("A link post can't have media; Facebook shows the link preview instead")
+		}
+		if u, err := url.Parse(req.Link); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("link must be an http(s) URL")
+		}
+	}
 
-			videoURL := fmt.Sprintf("https://graph.facebook.com/%s/videos", pageID)
-			payload := strings.NewReader(fmt.Sprintf("file_url=%s&description=%s&access_token=%s",
-				urlEncode(videoUrls[0]), urlEncode(req.Message), urlEncode(accessToken)))
+	if req.ScheduledAt != nil {
+		until := time.Until(*req.ScheduledAt)
+		if until < facebookMinScheduleDelay || until > facebookMaxScheduleDelay {
+			return errors.New("scheduledAt must be between 10 minutes and 30 days in the future")
+		}
+	}
 
-			resp, err := http.Post(videoURL, "application/x-www-form-urlencoded", payload)
-			if err != nil {
-				http.Error(w, "Failed to upload video", http.StatusInternalServerError)
-				return
+	if t := req.Targeting; t != nil {
+		if err := validateFacebookCountries(t.Countries); err != nil {
+			return err
+		}
+		if t.AgeMin != 0 && (t.AgeMin < 13 || t.AgeMin > 65) {
+			return errors.New("targeting.ageMin must be between 13 and 65")
+		}
+	}
+	if t := req.FeedTargeting; t != nil {
+		if err := validateFacebookCountries(t.Countries); err != nil {
+			return err
+		}
+		if (t.AgeMin != 0 && (t.AgeMin < 13 || t.AgeMin > 65)) || (t.AgeMax != 0 && (t.AgeMax < 13 || t.AgeMax > 65)) {
+			return errors.New("feedTargeting ages must be between 13 and 65")
+		}
+		if t.AgeMin != 0 && t.AgeMax != 0 && t.AgeMin > t.AgeMax {
+			return errors.New("feedTargeting.ageMin can't be above ageMax")
+		}
+		for _, g := range t.Genders {
+			if g != 1 && g != 2 {
+				return errors.New("feedTargeting.genders takes 1 (male) and 2 (female)")
 			}
-			defer resp.Body.Close()
+		}
+	}
+	return nil
+}
 
-			body, _ := io.ReadAll(resp.Body)
-			if resp.StatusCode != http.StatusOK {
-				http.Error(w, fmt.Sprintf("Facebook video upload failed: %s", body), http.StatusInternalServerError)
-				return
-			}
+func validateFacebookCountries(countries []string) error {
+	for _, c := range countries {
+		if !facebookCountryCode.MatchString(c) {
+			return fmt.Errorf("%q is not a two-letter uppercase country code", c)
+		}
+	}
+	return nil
+}
 
-			var fbRes fbResponse
-			if err := json.Unmarshal(body, &fbRes); err != nil || fbRes.ID == "" {
-				http.Error(w, "Failed to parse Facebook video post ID", http.StatusInternalServerError)
-				return
-			}
+func (t FacebookTargeting) graphValue() map[string]interface{} {
+	v := map[string]interface{}{}
+	if len(t.Countries) > 0 {
+		v["geo_locations"] = map[string][]string{"countries": t.Countries}
+	}
+	if t.AgeMin != 0 {
+		v["age_min"] = t.AgeMin
+	}
+	return v
+}
 
-			if err := savePost(fbRes.ID, videoUrls); err != nil {
-				http.Error(w, "Failed to save video post in database", http.StatusInternalServerError)
-				return
-			}
+func (t FacebookFeedTargeting) graphValue() map[string]interface{} {
+	v := map[string]interface{}{}
+	if len(t.Countries) > 0 {
+		v["geo_locations"] = map[string][]string{"countries": t.Countries}
+	}
+	if t.AgeMin != 0 {
+		v["age_min"] = t.AgeMin
+	}
+	if t.AgeMax != 0 {
+		v["age_max"] = t.AgeMax
+	}
+	if len(t.Genders) > 0 {
+		v["genders"] = t.Genders
+	}
+	if len(t.Locales) > 0 {
+		v["locales"] = t.Locales
+	}
+	return v
+}
 
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte(fmt.Sprintf("Video post published successfully with post ID %s", fbRes.ID)))
-			return
-		}
+// facebookCreate POSTs to a Graph edge and returns the ID of the new object.
+func facebookCreate(path string, form url.Values) (string, error) {
+	var res struct {
+		ID string `json:"id"`
+	}
+	if err := graphAPIRequest(http.MethodPost, path, form, &res); err != nil {
+		return "", err
+	}
+	if res.ID == "" {
+		return "", errors.New("Facebook returned no ID")
+	}
+	return res.ID, nil
+}
 
-		// CASE 3: Multiple images only
-		if len(imageUrls) > 0 && len(videoUrls) == 0 {
-			var attachedMediaIDs []string
+// publishFacebookReel runs the video_reels upload session: start a session,
+// have Facebook fetch the hosted video, then finish it as published or
+// scheduled. Facebook processes the reel afterwards; the video ID is its ID.
+func publishFacebookReel(pageID, accessToken, videoURL, description string, scheduledAt *time.Time) (string, error) {
+	form := url.Values{}
+	form.Set("upload_phase", "start")
+	form.Set("access_token", accessToken)
+	var session struct {
+		VideoID   string `json:"video_id"`
+		UploadURL string `json:"upload_url"`
+	}
+	if err := graphAPIRequest(http.MethodPost, pageID+"/video_reels", form, &session); err != nil {
+		return "", err
+	}
+	if session.VideoID == "" || session.UploadURL == "" {
+		return "", errors.New("Facebook did not start a Reel upload session")
+	}
 
-			for _, mediaURL := range imageUrls {
-				uploadURL := fmt.Sprintf("https://graph.facebook.com/%s/photos?access_token=%s", pageID, urlEncode(accessToken))
-				payload := fmt.Sprintf("url=%s&published=false", urlEncode(mediaURL))
+	req, err := http.NewRequest(http.MethodPost, session.UploadURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "OAuth "+accessToken)
+	req.Header.Set("file_url", videoURL)
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("Reel upload failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Reel upload failed with status %d", resp.StatusCode)
+	}
 
-				resp, err := http.Post(uploadURL, "application/x-www-form-urlencoded", strings.NewReader(payload))
-				if err != nil {
-					http.Error(w, "Failed to upload image", http.StatusInternalServerError)
-					return
-				}
-				body, _ := io.ReadAll(resp.Body)
-				resp.Body.Close()
+	form = url.Values{}
+	form.Set("upload_phase", "finish")
+	form.Set("video_id", session.VideoID)
+	form.Set("description", description)
+	form.Set("access_token", accessToken)
+	if scheduledAt != nil {
+		form.Set("video_state", "SCHEDULED")
+		form.Set("scheduled_publish_time", strconv.FormatInt(scheduledAt.Unix(), 10))
+	} else {
+		form.Set("video_state", "PUBLISHED")
+	}
+	var finished struct {
+		Success bool `json:"success"`
+	}
+	if err := graphAPIRequest(http.MethodPost, pageID+"/video_reels", form, &finished); err != nil {
+		return "", err
+	}
+	if !finished.Success {
+		return "", errors.New("Facebook did not accept the Reel")
+	}
+	return session.VideoID, nil
+}
 
-				if resp.StatusCode != http.StatusOK {
-					http.Error(w, fmt.Sprintf("Image upload failed: %s", body), http.StatusInternalServerError)
-					return
-				}
+// facebookPublishError turns a failed Graph call into a publish result.
+// Graph API throttling codes are retryable.
+func facebookPublishError(err error) (int, PublishResult) {
+	result := PublishResult{Platform: "facebook", Status: "failed", Message: fmt.Sprintf("Facebook API error: %v", err)}
+	var apiErr *graphAPIError
+	if errors.As(err, &apiErr) {
+		result.Message = fmt.Sprintf("Facebook API error: %s", apiErr.Message)
+		switch apiErr.Code {
+		case 4, 17, 32, 613:
+			result.Error = &PublishError{Code: "RATELIMIT", Retryable: true}
+			return http.StatusTooManyRequests, result
+		}
+	}
+	return http.StatusBadGateway, result
+}
 
-				var fbRes fbResponse
-				if err := json.Unmarshal(body, &fbRes); err != nil || fbRes.ID == "" {
-					http.Error(w, "Failed to parse media ID", http.StatusInternalServerError)
-					return
-				}
-				attachedMediaIDs = append(attachedMediaIDs, fbRes.ID)
-			}
+// GET /api/facebook/scheduled
+// Lists the posts scheduled through us that Facebook hasn't published yet.
+func GetFacebookScheduledPostsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
 
-			var mediaParams []string
-			for i, id := range attachedMediaIDs {
-				mediaParams = append(mediaParams, fmt.Sprintf(`attached_media[%d]={"media_fbid":"%s"}`, i, id))
-			}
+		if err := models.MarkDueScheduledPosts(db, userID, "facebook"); err != nil {
+			log.Printf("[Facebook] Failed to update due scheduled posts for user %s: %v", userID, err)
+		}
+		posts, err := models.ListPostsByStatus(db, userID, "facebook", "scheduled")
+		if err != nil {
+			http.Error(w, "Failed to load scheduled posts", http.StatusInternalServerError)
+			return
+		}
 
-			postURL := fmt.Sprintf("https://graph.facebook.com/%s/feed", pageID)
-			finalPayload := fmt.Sprintf(
-				"message=%s&%s&access_token=%s",
-				urlEncode(req.Message),
-				strings.Join(mediaParams, "&"),
-				urlEncode(accessToken),
-			)
-
-			resp, err := http.Post(postURL, "application/x-www-form-urlencoded", strings.NewReader(finalPayload))
-			if err != nil {
-				http.Error(w, "Failed to publish image post", http.StatusInternalServerError)
-				return
-			}
-			body, _ := io.ReadAll(resp.Body)
-			resp.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(posts)
+	}
+}
 
-			if resp.StatusCode != http.StatusOK {
-				http.Error(w, fmt.Sprintf("Post failed: %s", body), http.StatusInternalServerError)
-				return
-			}
+// DELETE /api/facebook/scheduled/{postId}
+// Cancels a scheduled post by deleting it on Facebook before it goes out.
+func CancelFacebookScheduledPostHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+		postID := mux.Vars(r)["postId"]
 
-			var fbRes fbResponse
-			if err := json.Unmarshal(body, &fbRes); err != nil || fbRes.ID == "" {
-				http.Error(w, "Failed to parse Facebook post ID", http.StatusInternalServerError)
-				return
-			}
+		post, err := models.GetPostByPlatformID(db, userID, "facebook", postID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Scheduled post not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to load post", http.StatusInternalServerError)
+			return
+		}
+		if post.Status != "scheduled" || !post.PostedAt.After(time.Now()) {
+			http.Error(w, "Post is not scheduled anymore", http.StatusConflict)
+			return
+		}
 
-			if err := savePost(fbRes.ID, imageUrls); err != nil {
-				http.Error(w, "Failed to save image post in database", http.StatusInternalServerError)
-				return
-			}
+		var accessToken string
+		err = db.QueryRow(`
+			SELECT access_token FROM social_accounts
+			WHERE user_id = $1 AND platform = 'facebook'`, userID).Scan(&accessToken)
+		if err != nil {
+			http.Error(w, "Facebook Page not connected", http.StatusBadRequest)
+			return
+		}
 
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte(fmt.Sprintf("Image post published successfully with post ID %s", fbRes.ID)))
+		form := url.Values{}
+		form.Set("access_token", accessToken)
+		if err := graphAPIRequest(http.MethodDelete, url.PathEscape(postID), form, nil); err != nil {
+			log.Printf("[Facebook] Failed to cancel scheduled post %s: %v", postID, err)
+			status, result := facebookPublishError(err)
+			writePublishResult(w, status, result)
 			return
 		}
 
-		// CASE 4: Mixed media not supported
-		http.Error(w, "Facebook does not support mixed image and video posts", http.StatusBadRequest)
+		if err := models.UpdatePostStatus(db, "facebook", postID, "cancelled"); err != nil {
+			log.Printf("[Facebook] Failed to mark post %s cancelled: %v", postID, err)
+		}
+		w.WriteHeader(http.StatusNoContent)
 	}
 }
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Define the Graph API version used for Facebook and Instagram publishing
+const graphAPIVersion = "v20.0" // <--- IMPORTANT: Update to the latest stable version
+
+// graphAPIError is a failed Graph API call.
+type graphAPIError struct {
+	Status  int
+	Code    int
+	Message string
+}
+
+func (e *graphAPIError) Error() string {
+	return fmt.Sprintf("Graph API error (status %d, code %d): %s", e.Status, e.Code, e.Message)
+}
+
+// graphAPIRequest calls the Graph API. GET and DELETE parameters go in the
+// query string, POST parameters in a form body.
+func graphAPIRequest(method, path string, params url.Values, out interface{}) error {
+	endpoint := fmt.Sprintf("https://graph.facebook.com/%s/%s", graphAPIVersion, strings.TrimPrefix(path, "/"))
+
+	var req *http.Request
+	var err error
+	if method == http.MethodPost {
+		req, err = http.NewRequest(method, endpoint, strings.NewReader(params.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		req, err = http.NewRequest(method, endpoint+"?"+params.Encode(), nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var errRes struct {
+			Error struct {
+				Message string `json:"message"`
+				Code    int    `json:"code"`
+			} `json:"error"`
+		}
+		apiErr := &graphAPIError{Status: resp.StatusCode, Message: string(body)}
+		if json.Unmarshal(body, &errRes) == nil && errRes.Error.Message != "" {
+			apiErr.Code = errRes.Error.Code
+			apiErr.Message = errRes.Error.Message
+		}
+		return apiErr
+	}
+	if out != nil {
+		return json.Unmarshal(body, out)
+	}
+	return nil
+}
+
+// setGraphJSON sets a parameter the Graph API expects as a JSON value.
+func setGraphJSON(form url.Values, key string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	form.Set(key, string(data))
+}
@@ -3,88 +3,69 @@ package controllers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"social-sync-backend/middleware" // Assuming this path is correct for your project
-)
-
-// Define the Instagram Graph API version to use
-const instagramAPIVersion = "v20.0" // <--- IMPORTANT: Update to the latest stable version
+	"social-sync-backend/models"
+	"social-sync-backend/utils"
 
-type InstagramPostRequest struct {
-	Caption   string   `json:"caption"`
-	MediaUrls []string `json:"mediaUrls"`
-}
-
-// waitForMediaReady polls Instagram media container status until ready or timeout
-// This function checks the status of individual media containers (images/videos)
-// and also the carousel container itself.
-func waitForMediaReady(mediaID, accessToken string) error {
-	// Construct the URL to check the media container's status
-	statusURL := fmt.Sprintf("https://graph.facebook.com/%s/%s?fields=status_code&access_token=%s", instagramAPIVersion, mediaID, accessToken)
-
-	const maxRetries = 30              // Increased retries for more robust waiting (from 10)
-	const delay = 5 * time.Second      // Increased delay (from 3s), total wait time now up to 150 seconds
-	const initialDelay = 3 * time.Second // Initial delay before the first retry
+	"github.com/google/uuid"
+)
 
-	// Small initial delay before starting the loop to allow Instagram some initial processing time
-	time.Sleep(initialDelay)
+// Limits Instagram enforces on posts
+const (
+	instagramMaxCarouselItems = 10
+	instagramMaxHashtags      = 30
+	instagramMaxMentions      = 20
+	instagramMaxUserTags      = 20 // per media item
+	instagramMaxCollaborators = 3
+)
 
-	for i := 0; i < maxRetries; i++ {
-		resp, err := http.Get(statusURL)
-		if err != nil {
-			return fmt.Errorf("failed to get media status: %w", err) // Return immediately on network error
-		}
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			return fmt.Errorf("failed to read media status response: %w", err) // Return immediately on read error
-		}
+var (
+	instagramHashtagPattern = regexp.MustCompile(`(?:^|\s)#[\pL\pN_]+`)
+	instagramMentionPattern = regexp.MustCompile(`(?:^|\s)@[\w.]+`)
+	instagramLocationID     = regexp.MustCompile(`^[0-9]+$`)
+)
 
-		if resp.StatusCode != http.StatusOK {
-			// Check if it's a specific Instagram error that means it will never be ready
-			var errRes struct {
-				Error struct {
-					Message string `json:"message"`
-					Code    int    `json:"code"`
-					Type    string `json:"type"`
-				} `json:"error"`
-			}
-			if json.Unmarshal(body, &errRes) == nil {
-				if errRes.Error.Code == 100 && strings.Contains(strings.ToLower(errRes.Error.Message), "invalid parameter") {
-					// This often indicates a permanent issue with the media itself (e.g., corrupted, unsupported format)
-					return fmt.Errorf("media processing failed due to invalid media content: %s", errRes.Error.Message)
-				}
-			}
-			return fmt.Errorf("media status check failed with HTTP status %d: %s", resp.StatusCode, body)
-		}
+type InstagramPostRequest struct {
+	Caption   string             `json:"caption"`
+	MediaUrls []string           `json:"mediaUrls"`
+	Media     []models.MediaItem `json:"media,omitempty"` // media with alt text, merged with MediaUrls
 
-		var res struct {
-			StatusCode string `json:"status_code"`
-		}
-		if err := json.Unmarshal(body, &res); err != nil {
-			return fmt.Errorf("failed to parse media status response: %w", err)
-		}
+	Type string `json:"type,omitempty"` // feed (default), reel or story
 
-		if res.StatusCode == "FINISHED" {
-			return nil // Media is ready to publish
-		} else if res.StatusCode == "ERROR" {
-			return fmt.Errorf("media upload failed with status 'ERROR'")
-		}
+	// Reels only
+	ShareToFeed *bool  `json:"shareToFeed,omitempty"` // also show the reel in the feed, default true
+	CoverURL    string `json:"coverUrl,omitempty"`    // cover image, or
+	ThumbOffset *int   `json:"thumbOffset,omitempty"` // cover frame in milliseconds
 
-		// Media is not yet finished, wait and retry
-		time.Sleep(delay)
-	}
+	UserTags      []InstagramUserTagRequest `json:"userTags,omitempty"`
+	LocationID    string                    `json:"locationId,omitempty"` // Facebook Page ID of the place
+	Collaborators []string                  `json:"collaborators,omitempty"`
+	FirstComment  string                    `json:"firstComment,omitempty"` // posted right after publishing, e.g. for hashtags
+}
 
-	// If loop finishes, it means media wasn't ready within the max retries
-	return fmt.Errorf("media not ready for ID %s after %d retries (%s total wait)", mediaID, maxRetries, time.Duration(maxRetries)*delay)
+// InstagramUserTagRequest tags an account on the media item at MediaIndex.
+// Feed images need a position; Reels tags have none.
+type InstagramUserTagRequest struct {
+	MediaIndex int      `json:"mediaIndex,omitempty"`
+	Username   string   `json:"username"`
+	X          *float64 `json:"x,omitempty"`
+	Y          *float64 `json:"y,omitempty"`
 }
 
+// POST /api/instagram/post
+// Instagram processes media containers asynchronously, which can take minutes
+// for videos, so the post is published by a background job. The response
+// carries the job ID; progress is available from /api/instagram/jobs/{jobId}
+// or as server-sent events from /api/instagram/jobs/{jobId}/events.
 func PostToInstagramHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, err := middleware.GetUserIDFromContext(r)
@@ -99,186 +80,216 @@ func PostToInstagramHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		if strings.TrimSpace(req.Caption) == "" {
+		if req.Type == "" {
+			req.Type = "feed"
+		}
+		if req.Type != "story" && strings.TrimSpace(req.Caption) == "" {
 			http.Error(w, "Caption cannot be empty", http.StatusBadRequest)
 			return
 		}
 
-		mediaCount := len(req.MediaUrls)
+		mediaItems, err := resolveMediaItems(db, userID, req.MediaUrls, req.Media)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mediaCount := len(mediaItems)
 		if mediaCount == 0 {
 			http.Error(w, "Instagram requires at least one media URL", http.StatusBadRequest)
 			return
 		}
-		if mediaCount > 10 {
-			http.Error(w, "Instagram carousel posts can have at most 10 media items", http.StatusBadRequest)
+
+		// Everything is checked here, before any container exists
+		if err := validateInstagramPost(req, mediaItems); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		var accessToken, instagramUserID string
+		var connected bool
 		err = db.QueryRow(`
-			SELECT access_token, social_id
-			FROM social_accounts
-			WHERE user_id = $1 AND platform = 'instagram'`, userID).Scan(&accessToken, &instagramUserID)
-		if err != nil {
+			SELECT EXISTS (SELECT 1 FROM social_accounts WHERE user_id = $1 AND platform = 'instagram')
+		`, userID).Scan(&connected)
+		if err != nil || !connected {
 			http.Error(w, "Instagram account not connected", http.StatusBadRequest)
 			return
 		}
 
-		mediaContainerIDs := make([]string, 0, mediaCount)
-
-		// Declare 'body' here once for the entire function scope
-		var body []byte
-
-		for _, mediaURL := range req.MediaUrls {
-			form := url.Values{}
-			form.Set("is_carousel_item", "true") // All media items are considered carousel items for this flow
-
-			lower := strings.ToLower(mediaURL)
-			if strings.HasSuffix(lower, ".mp4") || strings.HasSuffix(lower, ".mov") {
-				form.Set("media_type", "VIDEO")
-				form.Set("video_url", mediaURL)
-			} else {
-				form.Set("media_type", "IMAGE")
-				form.Set("image_url", mediaURL)
-			}
-
-			form.Set("access_token", accessToken)
-
-			// Step 1: Create individual media container
-			createMediaURL := fmt.Sprintf("https://graph.facebook.com/%s/%s/media", instagramAPIVersion, instagramUserID)
-			resp, err := http.Post(
-				createMediaURL,
-				"application/x-www-form-urlencoded",
-				strings.NewReader(form.Encode()),
-			)
-			if err != nil {
-				http.Error(w, "Failed to create media container", http.StatusInternalServerError)
-				return
-			}
-			// Use '=' for reassignment, not ':='
-			body, err = io.ReadAll(resp.Body)
-			resp.Body.Close()
-			if err != nil {
-				http.Error(w, "Failed to read media container creation response", http.StatusInternalServerError)
-				return
-			}
-
-			if resp.StatusCode != http.StatusOK {
-				http.Error(w, fmt.Sprintf("Media container creation failed: %s", body), http.StatusInternalServerError)
-				return
-			}
-
-			var result struct {
-				ID string `json:"id"`
-			}
-			if err := json.Unmarshal(body, &result); err != nil || result.ID == "" {
-				http.Error(w, "Invalid response from media container creation", http.StatusInternalServerError)
-				return
-			}
-
-			// Step 2: Wait for individual media container to be ready
-			if err := waitForMediaReady(result.ID, accessToken); err != nil {
-				http.Error(w, fmt.Sprintf("Media item failed to process: %v", err), http.StatusInternalServerError)
-				return
-			}
-
-			mediaContainerIDs = append(mediaContainerIDs, result.ID)
+		uid, err := uuid.Parse(userID)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
 		}
 
-		if mediaCount == 1 {
-			// Single media post publish (This path handles both images and videos)
-			publishForm := url.Values{}
-			publishForm.Set("creation_id", mediaContainerIDs[0])
-			publishForm.Set("caption", req.Caption) // Add caption for single media posts
-			publishForm.Set("access_token", accessToken)
-
-			publishURL := fmt.Sprintf("https://graph.facebook.com/%s/%s/media_publish", instagramAPIVersion, instagramUserID)
-			publishResp, err := http.Post(publishURL, "application/x-www-form-urlencoded", strings.NewReader(publishForm.Encode()))
-			if err != nil {
-				http.Error(w, "Failed to publish post", http.StatusInternalServerError)
-				return
-			}
-			// Use '=' for reassignment, not ':='
-			body, err = io.ReadAll(publishResp.Body)
-			publishResp.Body.Close()
-			if err != nil {
-				http.Error(w, "Failed to read publish response", http.StatusInternalServerError)
-				return
-			}
+		now := time.Now().UTC()
+		job := models.InstagramJob{
+			ID:        uuid.New(),
+			UserID:    uid,
+			Caption:   req.Caption,
+			Status:    models.InstagramJobQueued,
+			CreatedAt: now,
+			UpdatedAt: now,
+			Options: models.InstagramJobOptions{
+				Type:          req.Type,
+				ShareToFeed:   req.ShareToFeed == nil || *req.ShareToFeed,
+				CoverURL:      req.CoverURL,
+				ThumbOffset:   req.ThumbOffset,
+				LocationID:    req.LocationID,
+				Collaborators: trimInstagramUsernames(req.Collaborators),
+				FirstComment:  strings.TrimSpace(req.FirstComment),
+			},
+		}
+		for _, item := range mediaItems {
+			job.Items = append(job.Items, models.InstagramJobItem{
+				URL:     item.URL,
+				AltText: item.AltText,
+				Video:   isVideoURL(item.URL),
+				Status:  "pending",
+			})
+		}
+		for _, tag := range req.UserTags {
+			job.Items[tag.MediaIndex].UserTags = append(job.Items[tag.MediaIndex].UserTags, models.InstagramUserTag{
+				Username: strings.TrimPrefix(strings.TrimSpace(tag.Username), "@"),
+				X:        tag.X,
+				Y:        tag.Y,
+			})
+		}
+		if err := models.SaveInstagramJob(db, job); err != nil {
+			http.Error(w, "Failed to queue Instagram post", http.StatusInternalServerError)
+			return
+		}
 
-			if publishResp.StatusCode != http.StatusOK {
-				http.Error(w, fmt.Sprintf("Publish failed: %s", body), http.StatusInternalServerError)
-				return
-			}
+		go runInstagramJob(db, job.ID)
 
-		} else {
-			// Carousel post creation and publish
-			carouselForm := url.Values{}
-			carouselForm.Set("media_type", "CAROUSEL")
-			carouselForm.Set("children", strings.Join(mediaContainerIDs, ","))
-			carouselForm.Set("caption", req.Caption)
-			carouselForm.Set("access_token", accessToken)
+		writePublishResult(w, http.StatusAccepted, PublishResult{
+			Platform: "instagram",
+			Status:   "processing",
+			JobID:    job.ID.String(),
+			Message:  fmt.Sprintf("Instagram post queued. Follow /api/instagram/jobs/%s for progress.", job.ID),
+		})
+	}
+}
 
-			// Step 3: Create carousel container
-			createCarouselURL := fmt.Sprintf("https://graph.facebook.com/%s/%s/media", instagramAPIVersion, instagramUserID)
-			carouselResp, err := http.Post(createCarouselURL, "application/x-www-form-urlencoded", strings.NewReader(carouselForm.Encode()))
-			if err != nil {
-				http.Error(w, "Failed to create carousel container", http.StatusInternalServerError)
-				return
-			}
-			// Use '=' for reassignment, not ':='
-			body, err = io.ReadAll(carouselResp.Body)
-			carouselResp.Body.Close()
-			if err != nil {
-				http.Error(w, "Failed to read carousel container creation response", http.StatusInternalServerError)
-				return
-			}
+// validateInstagramPost checks a post against the constraints of its type:
+// feed posts take 1 to 10 images and videos, Reels exactly one video and
+// Stories exactly one image or video with no caption or tags.
+func validateInstagramPost(req InstagramPostRequest, media []models.MediaItem) error {
+	videos := 0
+	for _, item := range media {
+		if isVideoURL(item.URL) {
+			videos++
+		}
+	}
 
-			if carouselResp.StatusCode != http.StatusOK {
-				http.Error(w, fmt.Sprintf("Carousel container creation failed: %s", body), http.StatusInternalServerError)
-				return
-			}
+	switch req.Type {
+	case "feed":
+		if len(media) > instagramMaxCarouselItems {
+			return fmt.Errorf("Instagram carousel posts can have at most %d media items", instagramMaxCarouselItems)
+		}
+	case "reel":
+		if len(media) != 1 || videos != 1 {
+			return errors.New("An Instagram Reel needs exactly one video")
+		}
+	case "story":
+		if len(media) != 1 {
+			return errors.New("An Instagram Story needs exactly one image or video")
+		}
+		if strings.TrimSpace(req.Caption) != "" {
+			return errors.New("Instagram Stories don't support captions")
+		}
+		if len(req.UserTags) > 0 || req.LocationID != "" || len(req.Collaborators) > 0 || req.FirstComment != "" {
+			return errors.New("Instagram Stories don't support tags, locations, collaborators or comments")
+		}
+	default:
+		return errors.New("type must be feed, reel or story")
+	}
 
-			var carouselResult struct {
-				ID string `json:"id"`
-			}
-			if err := json.Unmarshal(body, &carouselResult); err != nil || carouselResult.ID == "" {
-				http.Error(w, "Invalid carousel container creation response", http.StatusInternalServerError)
-				return
-			}
+	if req.Type != "reel" && (req.ShareToFeed != nil || req.CoverURL != "" || req.ThumbOffset != nil) {
+		return errors.New("shareToFeed, coverUrl and thumbOffset only apply to Reels")
+	}
+	if req.CoverURL != "" && req.ThumbOffset != nil {
+		return errors.New("Use either coverUrl or thumbOffset, not both")
+	}
+	if req.ThumbOffset != nil && *req.ThumbOffset < 0 {
+		return errors.New("thumbOffset can't be negative")
+	}
+	if req.CoverURL != "" && !isImage(strings.ToLower(req.CoverURL)) {
+		return errors.New("coverUrl must be an image")
+	}
 
-			// Step 4: Wait for carousel container to be ready
-			if err := waitForMediaReady(carouselResult.ID, accessToken); err != nil {
-				http.Error(w, fmt.Sprintf("Carousel post failed to process: %v", err), http.StatusInternalServerError)
-				return
-			}
+	for _, text := range []struct{ name, value string }{{"Caption", req.Caption}, {"First comment", req.FirstComment}} {
+		if n := utf8.RuneCountInString(text.value); n > utils.PlatformTextLimits["instagram"] {
+			return fmt.Errorf("%s exceeds Instagram's %d character limit (%d characters)", text.name, utils.PlatformTextLimits["instagram"], n)
+		}
+	}
+	// Hashtags moved to the first comment still count towards the post's limit
+	combined := req.Caption + "\n" + req.FirstComment
+	if n := len(instagramHashtagPattern.FindAllString(combined, -1)); n > instagramMaxHashtags {
+		return fmt.Errorf("Instagram allows at most %d hashtags per post (found %d)", instagramMaxHashtags, n)
+	}
+	if n := len(instagramMentionPattern.FindAllString(req.Caption, -1)); n > instagramMaxMentions {
+		return fmt.Errorf("Instagram allows at most %d mentions per caption (found %d)", instagramMaxMentions, n)
+	}
 
-			// Step 5: Publish the carousel
-			publishForm := url.Values{}
-			publishForm.Set("creation_id", carouselResult.ID)
-			publishForm.Set("access_token", accessToken)
+	if req.LocationID != "" && !instagramLocationID.MatchString(req.LocationID) {
+		return errors.New("locationId must be the numeric ID of a Facebook Page with a location")
+	}
+	if len(req.Collaborators) > instagramMaxCollaborators {
+		return fmt.Errorf("Instagram allows at most %d collaborators", instagramMaxCollaborators)
+	}
+	for _, c := range trimInstagramUsernames(req.Collaborators) {
+		if c == "" {
+			return errors.New("Collaborators must be usernames")
+		}
+	}
 
-			publishURL := fmt.Sprintf("https://graph.facebook.com/%s/%s/media_publish", instagramAPIVersion, instagramUserID)
-			publishResp, err := http.Post(publishURL, "application/x-www-form-urlencoded", strings.NewReader(publishForm.Encode()))
-			if err != nil {
-				http.Error(w, "Failed to publish carousel post", http.StatusInternalServerError)
-				return
-			}
-			// Use '=' for reassignment, not ':='
-			body, err = io.ReadAll(publishResp.Body)
-			publishResp.Body.Close()
-			if err != nil {
-				http.Error(w, "Failed to read publish response", http.StatusInternalServerError)
-				return
-			}
+	tagsPerItem := make(map[int]int)
+	for _, tag := range req.UserTags {
+		if tag.MediaIndex < 0 || tag.MediaIndex >= len(media) {
+			return fmt.Errorf("User tag for @%s refers to media item %d, which doesn't exist", tag.Username, tag.MediaIndex)
+		}
+		if strings.TrimPrefix(strings.TrimSpace(tag.Username), "@") == "" {
+			return errors.New("User tags need a username")
+		}
+		tagsPerItem[tag.MediaIndex]++
+		if tagsPerItem[tag.MediaIndex] > instagramMaxUserTags {
+			return fmt.Errorf("Instagram allows at most %d user tags per media item", instagramMaxUserTags)
+		}
 
-			if publishResp.StatusCode != http.StatusOK {
-				http.Error(w, fmt.Sprintf("Carousel publish failed: %s", body), http.StatusInternalServerError)
-				return
+		if req.Type == "reel" {
+			continue
+		}
+		// Feed videos can't carry tags; a single one is published as a Reel
+		if isVideoURL(media[tag.MediaIndex].URL) && len(media) > 1 {
+			return fmt.Errorf("User tags can only be placed on images (media item %d is a video)", tag.MediaIndex)
+		}
+		if !isVideoURL(media[tag.MediaIndex].URL) {
+			if tag.X == nil || tag.Y == nil || *tag.X < 0 || *tag.X > 1 || *tag.Y < 0 || *tag.Y > 1 {
+				return fmt.Errorf("User tag for @%s needs x and y between 0 and 1", tag.Username)
 			}
 		}
+	}
+	return nil
+}
+
+func trimInstagramUsernames(names []string) []string {
+	trimmed := make([]string, 0, len(names))
+	for _, name := range names {
+		trimmed = append(trimmed, strings.TrimPrefix(strings.TrimSpace(name), "@"))
+	}
+	return trimmed
+}
 
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Instagram post published successfully"))
+// createInstagramContainer creates a media container and returns its ID.
+func createInstagramContainer(instagramUserID string, form url.Values) (string, error) {
+	var result struct {
+		ID string `json:"id"`
+	}
+	if err := graphAPIRequest(http.MethodPost, instagramUserID+"/media", form, &result); err != nil {
+		return "", err
+	}
+	if result.ID == "" {
+		return "", fmt.Errorf("invalid response from media container creation")
 	}
+	return result.ID, nil
 }
@@ -0,0 +1,622 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	instagramPollEvery       = 5 * time.Second
+	instagramJobTimeout      = 30 * time.Minute // per run, after which a job fails
+	instagramEventsHeartbeat = 15 * time.Second
+)
+
+// Jobs currently being worked on, so a job never runs twice in this process.
+var (
+	instagramJobsMu      sync.Mutex
+	instagramJobsRunning = make(map[uuid.UUID]bool)
+)
+
+// Subscribers to job progress, fed by every job update.
+var (
+	instagramJobSubsMu sync.Mutex
+	instagramJobSubs   = make(map[uuid.UUID]map[chan models.InstagramJob]struct{})
+)
+
+// StartInstagramJobs resumes the jobs that were interrupted by a restart.
+// Containers that were already created are reused.
+func StartInstagramJobs(db *sql.DB) {
+	ids, err := models.ListUnfinishedInstagramJobIDs(db)
+	if err != nil {
+		log.Printf("❌ Failed to load Instagram jobs: %v", err)
+		return
+	}
+	for _, id := range ids {
+		go runInstagramJob(db, id)
+	}
+	if len(ids) > 0 {
+		log.Printf("✅ Resumed %d Instagram jobs.", len(ids))
+	}
+}
+
+// runInstagramJob publishes the job, records the post and posts the first
+// comment.
+func runInstagramJob(db *sql.DB, jobID uuid.UUID) {
+	instagramJobsMu.Lock()
+	if instagramJobsRunning[jobID] {
+		instagramJobsMu.Unlock()
+		return
+	}
+	instagramJobsRunning[jobID] = true
+	instagramJobsMu.Unlock()
+	defer func() {
+		instagramJobsMu.Lock()
+		delete(instagramJobsRunning, jobID)
+		instagramJobsMu.Unlock()
+	}()
+
+	job, err := models.GetInstagramJobByID(db, jobID)
+	if err != nil {
+		log.Printf("[Instagram] Failed to load job %s: %v", jobID, err)
+		return
+	}
+
+	update := func() {
+		job.UpdatedAt = time.Now().UTC()
+		if err := models.UpdateInstagramJob(db, *job); err != nil {
+			log.Printf("[Instagram] Failed to save job %s: %v", jobID, err)
+		}
+		broadcastInstagramJob(*job)
+	}
+	fail := func(msg string) {
+		log.Printf("[Instagram] Job %s failed: %s", jobID, msg)
+		job.Status = models.InstagramJobFailed
+		job.Error = msg
+		update()
+	}
+
+	var accessToken, instagramUserID string
+	err = db.QueryRow(`
+		SELECT access_token, social_id
+		FROM social_accounts
+		WHERE user_id = $1 AND platform = 'instagram'`, job.UserID).Scan(&accessToken, &instagramUserID)
+	if err != nil {
+		fail("Instagram account not connected")
+		return
+	}
+
+	// A job interrupted while publishing may already be live, and publishing
+	// its container again would fail
+	if job.Status == models.InstagramJobPublishing && job.MediaID == "" {
+		if job.MediaID, err = recoverInstagramMedia(job, instagramUserID, accessToken); err != nil {
+			fail(err.Error())
+			return
+		}
+		if job.MediaID != "" {
+			log.Printf("[Instagram] Job %s was already published as %s", jobID, job.MediaID)
+		}
+	}
+	if job.MediaID == "" {
+		if job.MediaID, err = publishInstagramJob(job, instagramUserID, accessToken, update); err != nil {
+			fail(err.Error())
+			return
+		}
+	}
+
+	// Record the post before the first comment, so a restart can't publish it twice
+	job.Status = models.InstagramJobPublished
+	update()
+
+	now := time.Now().UTC()
+	post := models.Post{
+		ID:             uuid.New(),
+		UserID:         job.UserID,
+		Platform:       "instagram",
+		PlatformPostID: job.MediaID,
+		Message:        job.Caption,
+		PostedAt:       now,
+		Status:         "posted",
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	for _, item := range job.Items {
+		post.MediaURLs = append(post.MediaURLs, item.URL)
+	}
+	if err := models.SavePost(db, post); err != nil {
+		log.Printf("ERROR: Failed to save Instagram post for job %s: %v", jobID, err)
+	}
+	log.Printf("[Instagram] Job %s published as %s", jobID, job.MediaID)
+
+	// The post is out either way; a failed comment is only reported on the job
+	if job.Options.FirstComment != "" {
+		form := url.Values{}
+		form.Set("message", job.Options.FirstComment)
+		form.Set("access_token", accessToken)
+		var comment struct {
+			ID string `json:"id"`
+		}
+		if err := graphAPIRequest(http.MethodPost, job.MediaID+"/comments", form, &comment); err != nil {
+			log.Printf("[Instagram] First comment on %s failed: %v", job.MediaID, err)
+			job.Error = fmt.Sprintf("Published, but the first comment failed: %v", err)
+		} else {
+			job.CommentID = comment.ID
+		}
+		update()
+	}
+}
+
+// publishInstagramJob creates the job's media containers in parallel, waits
+// for Instagram to finish processing them, creates the carousel if there is
+// more than one item and publishes. It returns the published media ID.
+func publishInstagramJob(job *models.InstagramJob, instagramUserID, accessToken string, update func()) (string, error) {
+	if job.Status == models.InstagramJobQueued {
+		job.Status = models.InstagramJobProcessing
+		update()
+	}
+	deadline := time.Now().Add(instagramJobTimeout)
+	carousel := len(job.Items) > 1
+
+	// Step 1: create the missing containers, all at once
+	errs := make([]error, len(job.Items))
+	var wg sync.WaitGroup
+	for i := range job.Items {
+		if job.Items[i].ContainerID != "" {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			item := &job.Items[i]
+			form := instagramContainerForm(job, *item, carousel)
+			form.Set("access_token", accessToken)
+			item.ContainerID, errs[i] = createInstagramContainer(instagramUserID, form)
+			if errs[i] == nil {
+				item.Status = "processing"
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			job.Items[i].Status = "failed"
+			return "", fmt.Errorf("Media item %d could not be created: %v", i+1, err)
+		}
+	}
+	update()
+
+	// Step 2: wait for Instagram to process them
+	if err := waitForInstagramContainers(job, accessToken, deadline, update); err != nil {
+		return "", err
+	}
+
+	if carousel {
+		// Step 3: the carousel container holds the caption
+		if job.CarouselID == "" {
+			form := url.Values{}
+			form.Set("media_type", "CAROUSEL")
+			form.Set("children", strings.Join(instagramContainerIDs(job.Items), ","))
+			form.Set("caption", job.Caption)
+			setInstagramPostFields(form, job.Options)
+			form.Set("access_token", accessToken)
+			id, err := createInstagramContainer(instagramUserID, form)
+			if err != nil {
+				return "", fmt.Errorf("Carousel could not be created: %v", err)
+			}
+			job.CarouselID = id
+			update()
+		}
+		if _, err := instagramContainerStatuses([]string{job.CarouselID}, accessToken, deadline, nil); err != nil {
+			return "", fmt.Errorf("Carousel failed to process: %v", err)
+		}
+	}
+
+	// Step 4: publish
+	job.Status = models.InstagramJobPublishing
+	update()
+
+	form := url.Values{}
+	form.Set("creation_id", instagramCreationID(job))
+	form.Set("access_token", accessToken)
+	var published struct {
+		ID string `json:"id"`
+	}
+	if err := graphAPIRequest(http.MethodPost, instagramUserID+"/media_publish", form, &published); err != nil {
+		return "", fmt.Errorf("Publish failed: %v", err)
+	}
+	if published.ID == "" {
+		return "", errors.New("Publish failed: Instagram returned no media ID")
+	}
+	return published.ID, nil
+}
+
+// instagramCreationID is the container that gets published: the carousel, or
+// the only item.
+func instagramCreationID(job *models.InstagramJob) string {
+	if len(job.Items) > 1 {
+		return job.CarouselID
+	}
+	return job.Items[0].ContainerID
+}
+
+// recoverInstagramMedia returns the media ID of a job whose container was
+// published before the job could record it, or "" if the container was not
+// published. The post is found among the account's latest media by its
+// caption and by being newer than the publish attempt.
+func recoverInstagramMedia(job *models.InstagramJob, instagramUserID, accessToken string) (string, error) {
+	creationID := instagramCreationID(job)
+	if creationID == "" {
+		return "", nil
+	}
+
+	params := url.Values{}
+	params.Set("fields", "status_code")
+	params.Set("access_token", accessToken)
+	var container struct {
+		StatusCode string `json:"status_code"`
+	}
+	if err := graphAPIRequest(http.MethodGet, creationID, params, &container); err != nil {
+		return "", fmt.Errorf("Could not check whether the post was published: %v", err)
+	}
+	if container.StatusCode != "PUBLISHED" {
+		return "", nil
+	}
+
+	edge := "media"
+	if job.Options.Type == "story" {
+		edge = "stories"
+	}
+	params = url.Values{}
+	params.Set("fields", "id,caption,timestamp")
+	params.Set("limit", "25")
+	params.Set("access_token", accessToken)
+	var media struct {
+		Data []struct {
+			ID        string `json:"id"`
+			Caption   string `json:"caption"`
+			Timestamp string `json:"timestamp"`
+		} `json:"data"`
+	}
+	if err := graphAPIRequest(http.MethodGet, instagramUserID+"/"+edge, params, &media); err != nil {
+		return "", fmt.Errorf("Published, but the post could not be looked up: %v", err)
+	}
+
+	// UpdatedAt is when the job started publishing; allow for clock skew
+	since := job.UpdatedAt.Add(-time.Minute)
+	for _, m := range media.Data {
+		posted, err := time.Parse("2006-01-02T15:04:05-0700", m.Timestamp)
+		if err != nil || posted.Before(since) {
+			continue
+		}
+		if edge == "media" && m.Caption != job.Caption {
+			continue
+		}
+		return m.ID, nil
+	}
+	return "", errors.New("Published, but the post could not be found among the account's latest media")
+}
+
+// instagramContainerForm builds the container parameters for one item. Feed
+// videos outside a carousel are published as Reels, which replaced the
+// VIDEO media type for feed posts.
+func instagramContainerForm(job *models.InstagramJob, item models.InstagramJobItem, carousel bool) url.Values {
+	form := url.Values{}
+	opts := job.Options
+
+	switch {
+	case opts.Type == "story":
+		form.Set("media_type", "STORIES")
+		if item.Video {
+			form.Set("video_url", item.URL)
+		} else {
+			form.Set("image_url", item.URL)
+		}
+		return form
+
+	case carousel:
+		form.Set("is_carousel_item", "true")
+		if item.Video {
+			form.Set("media_type", "VIDEO")
+			form.Set("video_url", item.URL)
+			return form
+		}
+
+	case item.Video:
+		form.Set("media_type", "REELS")
+		form.Set("video_url", item.URL)
+		form.Set("share_to_feed", strconv.FormatBool(opts.Type == "feed" || opts.ShareToFeed))
+		if opts.CoverURL != "" {
+			form.Set("cover_url", opts.CoverURL)
+		}
+		if opts.ThumbOffset != nil {
+			form.Set("thumb_offset", strconv.Itoa(*opts.ThumbOffset))
+		}
+		form.Set("caption", job.Caption)
+		setInstagramPostFields(form, opts)
+		if len(item.UserTags) > 0 {
+			// Reels tags have no position
+			tags := make([]map[string]string, 0, len(item.UserTags))
+			for _, tag := range item.UserTags {
+				tags = append(tags, map[string]string{"username": tag.Username})
+			}
+			setGraphJSON(form, "user_tags", tags)
+		}
+		return form
+
+	default:
+		form.Set("caption", job.Caption)
+		setInstagramPostFields(form, opts)
+	}
+
+	// An image, alone or in a carousel
+	form.Set("image_url", item.URL)
+	if item.AltText != "" {
+		form.Set("alt_text", item.AltText)
+	}
+	if len(item.UserTags) > 0 {
+		setGraphJSON(form, "user_tags", item.UserTags)
+	}
+	return form
+}
+
+// setInstagramPostFields sets the fields that belong to the post as a whole:
+// on the single container, or on the carousel container.
+func setInstagramPostFields(form url.Values, opts models.InstagramJobOptions) {
+	if opts.LocationID != "" {
+		form.Set("location_id", opts.LocationID)
+	}
+	if len(opts.Collaborators) > 0 {
+		setGraphJSON(form, "collaborators", opts.Collaborators)
+	}
+}
+
+func instagramContainerIDs(items []models.InstagramJobItem) []string {
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ContainerID)
+	}
+	return ids
+}
+
+// waitForInstagramContainers polls the item containers until all of them are
+// finished, recording progress on the job as it changes.
+func waitForInstagramContainers(job *models.InstagramJob, accessToken string, deadline time.Time, update func()) error {
+	_, err := instagramContainerStatuses(instagramContainerIDs(job.Items), accessToken, deadline, func(statuses map[string]string) {
+		changed := false
+		for i := range job.Items {
+			status := "processing"
+			if s := statuses[job.Items[i].ContainerID]; s == "FINISHED" || s == "PUBLISHED" {
+				status = "finished"
+			}
+			if job.Items[i].Status != status {
+				job.Items[i].Status = status
+				changed = true
+			}
+		}
+		if changed {
+			update()
+		}
+	})
+	if err != nil {
+		var cErr *instagramContainerError
+		if errors.As(err, &cErr) {
+			for i := range job.Items {
+				if job.Items[i].ContainerID == cErr.ContainerID {
+					job.Items[i].Status = "failed"
+					return fmt.Errorf("Media item %d failed to process: %s", i+1, cErr.Status)
+				}
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// instagramContainerError is a container that Instagram could not process.
+type instagramContainerError struct {
+	ContainerID string
+	Status      string
+}
+
+func (e *instagramContainerError) Error() string {
+	return fmt.Sprintf("container %s has status %s", e.ContainerID, e.Status)
+}
+
+// instagramContainerStatuses polls the status of the containers with a single
+// request per round until all are FINISHED or the deadline passes. progress,
+// if set, receives the statuses after every round.
+func instagramContainerStatuses(ids []string, accessToken string, deadline time.Time, progress func(map[string]string)) (map[string]string, error) {
+	params := url.Values{}
+	params.Set("ids", strings.Join(ids, ","))
+	params.Set("fields", "status_code")
+	params.Set("access_token", accessToken)
+
+	for {
+		var res map[string]struct {
+			StatusCode string `json:"status_code"`
+		}
+		err := graphAPIRequest(http.MethodGet, "", params, &res)
+		if err != nil {
+			var gErr *graphAPIError
+			// Error code 100 means the media itself is unusable; anything else may pass
+			if errors.As(err, &gErr) && gErr.Code == 100 {
+				return nil, fmt.Errorf("media processing failed due to invalid media content: %s", gErr.Message)
+			}
+			log.Printf("[Instagram] Container status check failed: %v", err)
+		} else {
+			statuses := make(map[string]string, len(ids))
+			finished := 0
+			for _, id := range ids {
+				status := res[id].StatusCode
+				statuses[id] = status
+				switch status {
+				case "FINISHED", "PUBLISHED":
+					finished++
+				case "ERROR", "EXPIRED":
+					return statuses, &instagramContainerError{ContainerID: id, Status: status}
+				}
+			}
+			if progress != nil {
+				progress(statuses)
+			}
+			if finished == len(ids) {
+				return statuses, nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("media not ready after %s", instagramJobTimeout)
+		}
+		time.Sleep(instagramPollEvery)
+	}
+}
+
+// broadcastInstagramJob sends the job's current state to its subscribers.
+// Subscribers only ever need the latest state, so a pending one is replaced.
+func broadcastInstagramJob(job models.InstagramJob) {
+	job.Items = append([]models.InstagramJobItem(nil), job.Items...)
+
+	instagramJobSubsMu.Lock()
+	defer instagramJobSubsMu.Unlock()
+	for ch := range instagramJobSubs[job.ID] {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- job
+	}
+}
+
+func subscribeInstagramJob(jobID uuid.UUID) chan models.InstagramJob {
+	ch := make(chan models.InstagramJob, 1)
+	instagramJobSubsMu.Lock()
+	defer instagramJobSubsMu.Unlock()
+	if instagramJobSubs[jobID] == nil {
+		instagramJobSubs[jobID] = make(map[chan models.InstagramJob]struct{})
+	}
+	instagramJobSubs[jobID][ch] = struct{}{}
+	return ch
+}
+
+func unsubscribeInstagramJob(jobID uuid.UUID, ch chan models.InstagramJob) {
+	instagramJobSubsMu.Lock()
+	defer instagramJobSubsMu.Unlock()
+	delete(instagramJobSubs[jobID], ch)
+	if len(instagramJobSubs[jobID]) == 0 {
+		delete(instagramJobSubs, jobID)
+	}
+}
+
+// GET /api/instagram/jobs/{jobId}
+func GetInstagramJobHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		job, err := models.GetInstagramJob(db, userID, mux.Vars(r)["jobId"])
+		if err == sql.ErrNoRows {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to load job", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(job)
+	}
+}
+
+// GET /api/instagram/jobs/{jobId}/events
+// Streams the job as server-sent "job" events until it is published or
+// failed. EventSource can't set headers, so the JWT may be passed as ?token=.
+func InstagramJobEventsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		jobID, err := uuid.Parse(mux.Vars(r)["jobId"])
+		if err != nil {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+
+		// Subscribe before reading the current state so no update is missed
+		updates := subscribeInstagramJob(jobID)
+		defer unsubscribeInstagramJob(jobID, updates)
+
+		job, err := models.GetInstagramJob(db, userID, jobID.String())
+		if err == sql.ErrNoRows {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to load job", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no") // keep nginx from buffering the stream
+
+		send := func(job models.InstagramJob) bool {
+			data, err := json.Marshal(job)
+			if err != nil {
+				return false
+			}
+			if _, err := fmt.Fprintf(w, "event: job\ndata: %s\n\n", data); err != nil {
+				return false
+			}
+			flusher.Flush()
+			return !job.Done()
+		}
+
+		if !send(*job) {
+			return
+		}
+
+		heartbeat := time.NewTicker(instagramEventsHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case job := <-updates:
+				if !send(job) {
+					return
+				}
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
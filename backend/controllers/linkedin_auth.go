@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"social-sync-backend/middleware"
+	"social-sync-backend/utils"
+
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+var linkedInStates = make(map[string]string) // state -> user_id
+
+// getLinkedInOAuthConfig returns OAuth2 config for LinkedIn. The organization
+// scopes let users post as the company pages they administer.
+func getLinkedInOAuthConfig() *oauth2.Config {
+	redirectURL := utils.GetCallbackURL("linkedin")
+	if redirectURL == "" {
+		log.Fatal("LINKEDIN_REDIRECT_URL is empty!")
+	}
+
+	return &oauth2.Config{
+		ClientID:     os.Getenv("LINKEDIN_CLIENT_ID"),
+		ClientSecret: os.Getenv("LINKEDIN_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+		Scopes: []string{
+			"openid", "profile", "w_member_social",
+			"w_organization_social", "rw_organization_admin",
+		},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   "https://www.linkedin.com/oauth/v2/authorization",
+			TokenURL:  "https://www.linkedin.com/oauth/v2/accessToken",
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+}
+
+// LinkedInRedirectHandler initiates the OAuth flow and redirects to LinkedIn auth page
+func LinkedInRedirectHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		config := getLinkedInOAuthConfig()
+
+		appUserIDStr, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated.", http.StatusUnauthorized)
+			return
+		}
+		if _, err := uuid.Parse(appUserIDStr); err != nil {
+			http.Error(w, "Invalid user ID format.", http.StatusInternalServerError)
+			return
+		}
+
+		state := generateState()
+		linkedInStates[state] = appUserIDStr
+
+		http.Redirect(w, r, config.AuthCodeURL(state), http.StatusTemporaryRedirect)
+	}
+}
+
+// LinkedInCallbackHandler handles LinkedIn OAuth callback, fetches the member profile, saves to DB, then redirects frontend
+func LinkedInCallbackHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		state := r.URL.Query().Get("state")
+		appUserIDStr, exists := linkedInStates[state]
+		if state == "" || !exists {
+			http.Error(w, "Invalid or expired state parameter", http.StatusBadRequest)
+			return
+		}
+		delete(linkedInStates, state)
+
+		if errMsg := r.URL.Query().Get("error"); errMsg != "" {
+			redirectURL := fmt.Sprintf("%s/home/manage-accounts?error=linkedin", utils.GetFrontendURL())
+			http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+			return
+		}
+
+		code := r.URL.Query().Get("code")
+		if code == "" {
+			http.Error(w, "Missing code parameter", http.StatusBadRequest)
+			return
+		}
+
+		config := getLinkedInOAuthConfig()
+		token, err := config.Exchange(context.Background(), code)
+		if err != nil {
+			http.Error(w, "Token exchange failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		client := config.Client(context.Background(), token)
+		userResp, err := client.Get("https://api.linkedin.com/v2/userinfo")
+		if err != nil {
+			http.Error(w, "Failed to fetch user info: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer userResp.Body.Close()
+
+		var userData struct {
+			Sub     string `json:"sub"`
+			Name    string `json:"name"`
+			Picture string `json:"picture"`
+		}
+		if err := json.NewDecoder(userResp.Body).Decode(&userData); err != nil {
+			http.Error(w, "Failed to decode user data: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if userData.Sub == "" {
+			http.Error(w, "LinkedIn API returned incomplete user data", http.StatusInternalServerError)
+			return
+		}
+
+		var expiresAt *time.Time
+		if token.Expiry != (time.Time{}) {
+			expiresAt = &token.Expiry
+		}
+
+		_, err = db.Exec(`
+			INSERT INTO social_accounts (
+				user_id, platform, social_id, access_token, access_token_expires_at,
+				refresh_token, profile_picture_url, profile_name, connected_at
+			) VALUES (
+				$1, 'linkedin', $2, $3, $4, $5, $6, $7, NOW()
+			)
+			ON CONFLICT (user_id, platform) DO UPDATE SET
+				access_token = EXCLUDED.access_token,
+				access_token_expires_at = EXCLUDED.access_token_expires_at,
+				refresh_token = EXCLUDED.refresh_token,
+				social_id = EXCLUDED.social_id,
+				profile_picture_url = EXCLUDED.profile_picture_url,
+				profile_name = EXCLUDED.profile_name,
+				connected_at = NOW()
+		`,
+			appUserIDStr,
+			userData.Sub,
+			token.AccessToken,
+			expiresAt,
+			token.RefreshToken,
+			userData.Picture,
+			userData.Name,
+		)
+		if err != nil {
+			http.Error(w, "Failed to save LinkedIn account: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		redirectURL := fmt.Sprintf("%s/home/manage-accounts?connected=linkedin", utils.GetFrontendURL())
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+	}
+}
+
+// LinkedInOrganization is a company page the member can post as.
+type LinkedInOrganization struct {
+	URN        string `json:"urn"`
+	Name       string `json:"name"`
+	VanityName string `json:"vanityName,omitempty"`
+}
+
+// GET /api/linkedin/organizations
+// Lists the personal profile and every organization page the member
+// administers, so the composer can pick an author.
+func GetLinkedInOrganizationsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		account, err := getLinkedInAccount(db, userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		orgs, err := listLinkedInOrganizations(account.AccessToken)
+		if err != nil {
+			log.Printf("[LinkedIn] Failed to list organizations for user %s: %v", userID, err)
+			http.Error(w, "Failed to fetch LinkedIn organizations", http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"profile": LinkedInOrganization{
+				URN:  account.PersonURN(),
+				Name: account.ProfileName,
+			},
+			"organizations": orgs,
+		})
+	}
+}
+
+// linkedInAccount is the connected member with a usable access token.
+type linkedInAccount struct {
+	MemberID    string
+	AccessToken string
+	ProfileName string
+}
+
+func (a *linkedInAccount) PersonURN() string {
+	return "urn:li:person:" + a.MemberID
+}
+
+// getLinkedInAccount loads the member's token. LinkedIn only issues refresh
+// tokens to approved partners, so an expired token means reconnecting.
+func getLinkedInAccount(db *sql.DB, userID string) (*linkedInAccount, error) {
+	var account linkedInAccount
+	var expiresAt *time.Time
+	var profileName *string
+	err := db.QueryRow(`
+		SELECT social_id, access_token, access_token_expires_at, profile_name
+		FROM social_accounts
+		WHERE user_id = $1 AND platform = 'linkedin'
+	`, userID).Scan(&account.MemberID, &account.AccessToken, &expiresAt, &profileName)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("LinkedIn account not connected")
+	} else if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve LinkedIn account")
+	}
+	if expiresAt != nil && time.Now().After(*expiresAt) {
+		return nil, fmt.Errorf("LinkedIn access token has expired. Please reconnect your account.")
+	}
+	if profileName != nil {
+		account.ProfileName = *profileName
+	}
+	return &account, nil
+}
+
+func listLinkedInOrganizations(accessToken string) ([]LinkedInOrganization, error) {
+	var acls struct {
+		Elements []struct {
+			Organization string `json:"organization"`
+		} `json:"elements"`
+	}
+	err := linkedInRequest(accessToken, "GET", "/organizationAcls?q=roleAssignee&role=ADMINISTRATOR&state=APPROVED", nil, &acls)
+	if err != nil {
+		return nil, err
+	}
+
+	orgs := make([]LinkedInOrganization, 0, len(acls.Elements))
+	for _, acl := range acls.Elements {
+		org := LinkedInOrganization{URN: acl.Organization, Name: acl.Organization}
+		id := acl.Organization[strings.LastIndex(acl.Organization, ":")+1:]
+
+		var details struct {
+			LocalizedName string `json:"localizedName"`
+			VanityName    string `json:"vanityName"`
+		}
+		if err := linkedInRequest(accessToken, "GET", "/organizations/"+id, nil, &details); err != nil {
+			log.Printf("[LinkedIn] Failed to fetch organization %s: %v", id, err)
+		} else {
+			org.Name = details.LocalizedName
+			org.VanityName = details.VanityName
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, nil
+}
@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	linkedInAPIBase = "https://api.linkedin.com/rest"
+
+	linkedInMaxImages = 20
+
+	// Versions are supported for about a year
+	linkedInVersionWarnAge = 10 * 30 * 24 * time.Hour
+)
+
+// linkedInAPIVersion is the monthly version sent in the LinkedIn-Version
+// header. LinkedIn sunsets each version after about a year, so a default
+// here would eventually break every call; it comes from LINKEDIN_API_VERSION,
+// checked at startup by CheckLinkedInAPIVersion.
+func linkedInAPIVersion() string {
+	return os.Getenv("LINKEDIN_API_VERSION")
+}
+
+// CheckLinkedInAPIVersion validates LINKEDIN_API_VERSION, which must be a
+// YYYYMM version. A version close to its sunset is only logged.
+func CheckLinkedInAPIVersion() error {
+	v := linkedInAPIVersion()
+	if v == "" {
+		return errors.New("LINKEDIN_API_VERSION is not set; use a current YYYYMM version from LinkedIn's versioning docs")
+	}
+	released, err := time.Parse("200601", v)
+	if err != nil {
+		return fmt.Errorf("LINKEDIN_API_VERSION %q is not a YYYYMM version", v)
+	}
+	if time.Since(released) > linkedInVersionWarnAge {
+		log.Printf("[LinkedIn] LINKEDIN_API_VERSION %s is close to or past its sunset; update it", v)
+	}
+	return nil
+}
+
+// linkedInAPIError carries LinkedIn's status and message for a failed call.
+type linkedInAPIError struct {
+	Status  int
+	Message string
+}
+
+func (e *linkedInAPIError) Error() string {
+	return fmt.Sprintf("LinkedIn API error (status %d): %s", e.Status, e.Message)
+}
+
+// linkedInDo calls the versioned REST API and returns the response headers and
+// body. Non-2xx responses become a *linkedInAPIError.
+func linkedInDo(accessToken, method, path string, body interface{}) (http.Header, []byte, error) {
+	return linkedInDoRestli(accessToken, method, "", path, body)
+}
+
+// linkedInDoRestli is linkedInDo with an X-RestLi-Method header, which
+// Rest.li uses to mark partial updates and deletes.
+func linkedInDoRestli(accessToken, method, restliMethod, path string, body interface{}) (http.Header, []byte, error) {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, nil, err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, linkedInAPIBase+path, reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("LinkedIn-Version", linkedInAPIVersion())
+	req.Header.Set("X-Restli-Protocol-Version", "2.0.0")
+	if restliMethod != "" {
+		req.Header.Set("X-RestLi-Method", restliMethod)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("LinkedIn request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errResp struct {
+			Message string `json:"message"`
+		}
+		msg := string(respBody)
+		if json.Unmarshal(respBody, &errResp) == nil && errResp.Message != "" {
+			msg = errResp.Message
+		}
+		return nil, nil, &linkedInAPIError{Status: resp.StatusCode, Message: msg}
+	}
+	return resp.Header, respBody, nil
+}
+
+func linkedInRequest(accessToken, method, path string, body interface{}, out interface{}) error {
+	_, respBody, err := linkedInDo(accessToken, method, path, body)
+	if err != nil {
+		return err
+	}
+	if out != nil && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("failed to decode LinkedIn response: %v", err)
+		}
+	}
+	return nil
+}
+
+// uploadLinkedInImage registers an image owned by author and uploads its bytes.
+// It returns the image URN.
+func uploadLinkedInImage(accessToken, author, mediaURL string) (string, error) {
+	var init struct {
+		Value struct {
+			UploadURL string `json:"uploadUrl"`
+			Image     string `json:"image"`
+		} `json:"value"`
+	}
+	err := linkedInRequest(accessToken, "POST", "/images?action=initializeUpload", map[string]interface{}{
+		"initializeUploadRequest": map[string]string{"owner": author},
+	}, &init)
+	if err != nil {
+		return "", err
+	}
+
+	body, size, mediaType, err := downloadMedia(mediaURL)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	if err := putLinkedInUpload(accessToken, init.Value.UploadURL, body, size, mediaType, nil); err != nil {
+		return "", err
+	}
+	return init.Value.Image, nil
+}
+
+// uploadLinkedInVideo uploads a video in the parts LinkedIn asks for and
+// finalizes it. The file is buffered on disk because every part is addressed
+// by byte range. It returns the video URN.
+func uploadLinkedInVideo(accessToken, author, mediaURL string) (string, error) {
+	tmp, size, err := bufferMedia(mediaURL)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var init struct {
+		Value struct {
+			Video              string `json:"video"`
+			UploadToken        string `json:"uploadToken"`
+			UploadInstructions []struct {
+				UploadURL string `json:"uploadUrl"`
+				FirstByte int64  `json:"firstByte"`
+				LastByte  int64  `json:"lastByte"`
+			} `json:"uploadInstructions"`
+		} `json:"value"`
+	}
+	err = linkedInRequest(accessToken, "POST", "/videos?action=initializeUpload", map[string]interface{}{
+		"initializeUploadRequest": map[string]interface{}{
+			"owner":           author,
+			"fileSizeBytes":   size,
+			"uploadCaptions":  false,
+			"uploadThumbnail": false,
+		},
+	}, &init)
+	if err != nil {
+		return "", err
+	}
+
+	etags := make([]string, 0, len(init.Value.UploadInstructions))
+	for i, part := range init.Value.UploadInstructions {
+		length := part.LastByte - part.FirstByte + 1
+		var etag string
+		section := io.NewSectionReader(tmp, part.FirstByte, length)
+		if err := putLinkedInUpload(accessToken, part.UploadURL, section, length, "application/octet-stream", &etag); err != nil {
+			return "", fmt.Errorf("video part %d: %w", i+1, err)
+		}
+		etags = append(etags, etag)
+	}
+
+	err = linkedInRequest(accessToken, "POST", "/videos?action=finalizeUpload", map[string]interface{}{
+		"finalizeUploadRequest": map[string]interface{}{
+			"video":           init.Value.Video,
+			"uploadToken":     init.Value.UploadToken,
+			"uploadedPartIds": etags,
+		},
+	}, nil)
+	if err != nil {
+		return "", err
+	}
+	return init.Value.Video, nil
+}
+
+// putLinkedInUpload PUTs media bytes to an upload URL, storing the part's ETag
+// in etag when requested.
+func putLinkedInUpload(accessToken, uploadURL string, body io.Reader, size int64, mediaType string, etag *string) error {
+	req, err := http.NewRequest("PUT", uploadURL, body)
+	if err != nil {
+		return err
+	}
+	if size > 0 {
+		req.ContentLength = size
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	if mediaType != "" {
+		req.Header.Set("Content-Type", mediaType)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("upload failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return &linkedInAPIError{Status: resp.StatusCode, Message: strings.TrimSpace(string(respBody))}
+	}
+	if etag != nil {
+		*etag = resp.Header.Get("ETag")
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+	"social-sync-backend/utils"
+
+	"github.com/google/uuid"
+)
+
+type LinkedInPostRequest struct {
+	Message         string             `json:"message"`
+	MediaUrls       []string           `json:"mediaUrls,omitempty"`
+	Media           []models.MediaItem `json:"media,omitempty"`
+	OrganizationURN string             `json:"organizationUrn,omitempty"` // post as a company page instead of the member
+	Article         *LinkedInArticle   `json:"article,omitempty"`
+	Visibility      string             `json:"visibility,omitempty"` // PUBLIC (default) or CONNECTIONS
+}
+
+// LinkedInArticle shares a link as an article card. LinkedIn does not scrape
+// the page, so title and description are sent as given; LinkedIn requires
+// the title.
+type LinkedInArticle struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
+
+var (
+	linkedInHashtagPattern = regexp.MustCompile(`(^|\s)#(\w+)`)
+	linkedInReservedChars  = strings.NewReplacer(
+		`\`, `\\`, `|`, `\|`, `{`, `\{`, `}`, `\}`, `@`, `\@`, `[`, `\[`, `]`, `\]`,
+		`(`, `\(`, `)`, `\)`, `<`, `\<`, `>`, `\>`, `#`, `\#`, `*`, `\*`, `_`, `\_`, `~`, `\~`,
+	)
+)
+
+func PostToLinkedInHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var req LinkedInPostRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		mediaItems, err := resolveMediaItems(db, userID, req.MediaUrls, req.Media)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		message := strings.TrimSpace(req.Message)
+		if message == "" && len(mediaItems) == 0 && req.Article == nil {
+			http.Error(w, "Message cannot be empty", http.StatusBadRequest)
+			return
+		}
+		if n := utils.MeasureText("linkedin", message, 0); !n.Valid {
+			http.Error(w, fmt.Sprintf("Message exceeds LinkedIn's %d character limit (%d characters)", n.Limit, n.Length), http.StatusBadRequest)
+			return
+		}
+
+		var videos int
+		for _, item := range mediaItems {
+			if isVideoURL(item.URL) {
+				videos++
+			}
+		}
+		switch {
+		case req.Article != nil && len(mediaItems) > 0:
+			http.Error(w, "A LinkedIn post can contain an article link or media, but not both", http.StatusBadRequest)
+			return
+		case req.Article != nil && strings.TrimSpace(req.Article.URL) == "":
+			http.Error(w, "article.url is required", http.StatusBadRequest)
+			return
+		case req.Article != nil && strings.TrimSpace(req.Article.Title) == "":
+			http.Error(w, "article.title is required", http.StatusBadRequest)
+			return
+		case videos > 0 && len(mediaItems) > 1:
+			http.Error(w, "A LinkedIn post can contain one video or up to 20 images, but not both", http.StatusBadRequest)
+			return
+		case len(mediaItems) > linkedInMaxImages:
+			http.Error(w, fmt.Sprintf("A LinkedIn post can contain at most %d images", linkedInMaxImages), http.StatusBadRequest)
+			return
+		}
+
+		visibility := strings.ToUpper(req.Visibility)
+		if visibility == "" {
+			visibility = "PUBLIC"
+		}
+		if visibility != "PUBLIC" && visibility != "CONNECTIONS" {
+			http.Error(w, "visibility must be PUBLIC or CONNECTIONS", http.StatusBadRequest)
+			return
+		}
+
+		account, err := getLinkedInAccount(db, userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Post as the member unless a managed page was picked
+		author := account.PersonURN()
+		if req.OrganizationURN != "" {
+			if !strings.HasPrefix(req.OrganizationURN, "urn:li:organization:") {
+				http.Error(w, "Invalid organizationUrn", http.StatusBadRequest)
+				return
+			}
+			if visibility != "PUBLIC" {
+				http.Error(w, "Organization posts must be PUBLIC", http.StatusBadRequest)
+				return
+			}
+			author = req.OrganizationURN
+		}
+
+		content, err := buildLinkedInContent(account.AccessToken, author, mediaItems, req.Article)
+		if err != nil {
+			log.Printf("[LinkedIn] Media upload failed for user %s: %v", userID, err)
+			http.Error(w, fmt.Sprintf("Failed to upload media to LinkedIn: %v", err), http.StatusBadGateway)
+			return
+		}
+
+		postPayload := map[string]interface{}{
+			"author":     author,
+			"commentary": linkedInCommentary(message),
+			"visibility": visibility,
+			"distribution": map[string]interface{}{
+				"feedDistribution":               "MAIN_FEED",
+				"targetEntities":                 []interface{}{},
+				"thirdPartyDistributionChannels": []interface{}{},
+			},
+			"lifecycleState":            "PUBLISHED",
+			"isReshareDisabledByAuthor": false,
+		}
+		if content != nil {
+			postPayload["content"] = content
+		}
+
+		headers, _, err := linkedInDo(account.AccessToken, "POST", "/posts", postPayload)
+		if err != nil {
+			log.Printf("[LinkedIn] Post failed for user %s: %v", userID, err)
+			status := http.StatusBadGateway
+			var apiErr *linkedInAPIError
+			if errors.As(err, &apiErr) && (apiErr.Status == http.StatusUnauthorized || apiErr.Status == http.StatusForbidden) {
+				status = apiErr.Status
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		postURN := headers.Get("x-restli-id")
+
+		uid, _ := uuid.Parse(userID)
+		now := time.Now().UTC()
+		post := models.Post{
+			ID:             uuid.New(),
+			UserID:         uid,
+			Platform:       "linkedin",
+			PlatformPostID: postURN,
+			Message:        message,
+			MediaURLs:      mediaItemURLs(mediaItems),
+			PostedAt:       now,
+			Status:         "posted",
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		if err := models.SavePost(db, post); err != nil {
+			log.Printf("ERROR: Failed to save LinkedIn post for user %s: %v", userID, err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Posted to LinkedIn successfully",
+			"postId":  postURN,
+			"url":     "https://www.linkedin.com/feed/update/" + url.PathEscape(postURN),
+			"author":  author,
+		})
+	}
+}
+
+// buildLinkedInContent uploads the media and returns the post's content block:
+// media for a single image or video, multiImage for several images, or article.
+func buildLinkedInContent(accessToken, author string, items []models.MediaItem, article *LinkedInArticle) (map[string]interface{}, error) {
+	if article != nil {
+		a := map[string]interface{}{
+			"source": strings.TrimSpace(article.URL),
+			"title":  strings.TrimSpace(article.Title),
+		}
+		if article.Description != "" {
+			a["description"] = article.Description
+		}
+		return map[string]interface{}{"article": a}, nil
+	}
+
+	switch len(items) {
+	case 0:
+		return nil, nil
+	case 1:
+		item := items[0]
+		var id string
+		var err error
+		if isVideoURL(item.URL) {
+			id, err = uploadLinkedInVideo(accessToken, author, item.URL)
+		} else {
+			id, err = uploadLinkedInImage(accessToken, author, item.URL)
+		}
+		if err != nil {
+			return nil, err
+		}
+		media := map[string]interface{}{"id": id}
+		if item.AltText != "" {
+			media["altText"] = item.AltText
+		}
+		return map[string]interface{}{"media": media}, nil
+	}
+
+	images := make([]map[string]interface{}, 0, len(items))
+	for i, item := range items {
+		id, err := uploadLinkedInImage(accessToken, author, item.URL)
+		if err != nil {
+			return nil, fmt.Errorf("image %d: %w", i+1, err)
+		}
+		image := map[string]interface{}{"id": id}
+		if item.AltText != "" {
+			image["altText"] = item.AltText
+		}
+		images = append(images, image)
+	}
+	return map[string]interface{}{
+		"multiImage": map[string]interface{}{"images": images},
+	}, nil
+}
+
+// linkedInCommentary converts plain text to LinkedIn's "little text" format:
+// reserved characters are escaped and #hashtags become hashtag templates.
+func linkedInCommentary(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range linkedInHashtagPattern.FindAllStringSubmatchIndex(text, -1) {
+		b.WriteString(linkedInReservedChars.Replace(text[last:m[3]]))
+		fmt.Fprintf(&b, `{hashtag|\#|%s}`, linkedInReservedChars.Replace(text[m[4]:m[5]]))
+		last = m[1]
+	}
+	b.WriteString(linkedInReservedChars.Replace(text[last:]))
+	return b.String()
+}
+
+// deleteLinkedInPost deletes a post by its URN.
+func deleteLinkedInPost(accessToken, postURN string) error {
+	_, _, err := linkedInDoRestli(accessToken, http.MethodDelete, "DELETE", "/posts/"+url.QueryEscape(postURN), nil)
+	return err
+}
+
+// editLinkedInPost replaces the commentary of a post. Its media and article
+// can't be changed.
+func editLinkedInPost(accessToken, postURN, message string) error {
+	if n := utils.MeasureText("linkedin", message, 0); !n.Valid {
+		return &postNotSupportedError{Message: fmt.Sprintf("Message exceeds LinkedIn's %d character limit (%d characters)", n.Limit, n.Length)}
+	}
+	patch := map[string]interface{}{
+		"patch": map[string]interface{}{
+			"$set": map[string]interface{}{"commentary": linkedInCommentary(message)},
+		},
+	}
+	_, _, err := linkedInDoRestli(accessToken, http.MethodPost, "PARTIAL_UPDATE", "/posts/"+url.QueryEscape(postURN), patch)
+	return err
+}
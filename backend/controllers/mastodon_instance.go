@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const mastodonInstanceCacheTTL = time.Hour
+
+// mastodonInstanceConfig holds the limits an instance enforces on statuses.
+// Servers are free to change them, so they are read from the instance rather
+// than assumed.
+type mastodonInstanceConfig struct {
+	MaxCharacters       int
+	MaxMediaAttachments int
+	PollMaxOptions      int
+	PollMaxOptionChars  int
+	PollMinExpiration   int // seconds
+	PollMaxExpiration   int
+}
+
+// Mastodon's own defaults, used for anything the instance doesn't report.
+var defaultMastodonInstanceConfig = mastodonInstanceConfig{
+	MaxCharacters:       mastodonCharLimit,
+	MaxMediaAttachments: mastodonMaxMedia,
+	PollMaxOptions:      4,
+	PollMaxOptionChars:  50,
+	PollMinExpiration:   300,
+	PollMaxExpiration:   2629746,
+}
+
+type cachedMastodonInstance struct {
+	config    mastodonInstanceConfig
+	fetchedAt time.Time
+}
+
+var (
+	mastodonInstancesMu sync.Mutex
+	mastodonInstances   = make(map[string]cachedMastodonInstance)
+)
+
+// getMastodonInstanceConfig returns the instance's limits, cached for an hour.
+// If the instance can't be read the defaults are returned.
+func getMastodonInstanceConfig(instanceURL string) mastodonInstanceConfig {
+	mastodonInstancesMu.Lock()
+	cached, ok := mastodonInstances[instanceURL]
+	mastodonInstancesMu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < mastodonInstanceCacheTTL {
+		return cached.config
+	}
+
+	config, err := fetchMastodonInstanceConfig(instanceURL)
+	if err != nil {
+		log.Printf("[Mastodon] Could not read instance config for %s, using defaults: %v", instanceURL, err)
+		if ok {
+			return cached.config
+		}
+		return defaultMastodonInstanceConfig
+	}
+
+	mastodonInstancesMu.Lock()
+	mastodonInstances[instanceURL] = cachedMastodonInstance{config: config, fetchedAt: time.Now()}
+	mastodonInstancesMu.Unlock()
+	return config
+}
+
+// fetchMastodonInstanceConfig reads /api/v2/instance, falling back to the v1
+// endpoint for servers older than Mastodon 4.0. Both nest the limits under
+// "configuration".
+func fetchMastodonInstanceConfig(instanceURL string) (mastodonInstanceConfig, error) {
+	var body struct {
+		Configuration struct {
+			Statuses struct {
+				MaxCharacters       int `json:"max_characters"`
+				MaxMediaAttachments int `json:"max_media_attachments"`
+			} `json:"statuses"`
+			Polls struct {
+				MaxOptions             int `json:"max_options"`
+				MaxCharactersPerOption int `json:"max_characters_per_option"`
+				MinExpiration          int `json:"min_expiration"`
+				MaxExpiration          int `json:"max_expiration"`
+			} `json:"polls"`
+		} `json:"configuration"`
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	var lastErr error
+	for _, endpoint := range []string{"/api/v2/instance", "/api/v1/instance"} {
+		resp, err := client.Get(instanceURL + endpoint)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("%s returned status %d", endpoint, resp.StatusCode)
+			continue
+		}
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		c := body.Configuration
+		config := defaultMastodonInstanceConfig
+		setIfPositive(&config.MaxCharacters, c.Statuses.MaxCharacters)
+		setIfPositive(&config.MaxMediaAttachments, c.Statuses.MaxMediaAttachments)
+		setIfPositive(&config.PollMaxOptions, c.Polls.MaxOptions)
+		setIfPositive(&config.PollMaxOptionChars, c.Polls.MaxCharactersPerOption)
+		setIfPositive(&config.PollMinExpiration, c.Polls.MinExpiration)
+		setIfPositive(&config.PollMaxExpiration, c.Polls.MaxExpiration)
+		return config, nil
+	}
+	return mastodonInstanceConfig{}, lastErr
+}
+
+func setIfPositive(dst *int, v int) {
+	if v > 0 {
+		*dst = v
+	}
+}
+
+// mastodonInstanceURL extracts the instance URL from a Mastodon social_id,
+// which is stored as "<instance>:<account id>".
+func mastodonInstanceURL(socialID string) (string, error) {
+	i := strings.LastIndex(socialID, ":")
+	if i <= 0 || (strings.Contains(socialID, "://") && i < strings.Index(socialID, "://")+3) {
+		return "", fmt.Errorf("invalid Mastodon social_id format: %s", socialID)
+	}
+	instanceURL := socialID[:i]
+	if !strings.HasPrefix(instanceURL, "http://") && !strings.HasPrefix(instanceURL, "https://") {
+		instanceURL = "https://" + instanceURL
+	}
+	return instanceURL, nil
+}
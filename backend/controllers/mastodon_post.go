@@ -4,21 +4,66 @@ import (
 	"bytes"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"mime/multipart"
 	"net/http"
+	"path"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"social-sync-backend/lib"
 	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+	"social-sync-backend/utils"
+
+	"github.com/google/uuid"
+)
+
+// Mastodon's defaults, used when the instance doesn't report its own limits
+const (
+	mastodonCharLimit = 500
+	mastodonMaxMedia  = 4
 )
 
+// Mastodon refuses to schedule a status less than five minutes ahead
+const mastodonMinScheduleDelay = 5 * time.Minute
+
+const mastodonDefaultPollExpiry = 24 * 60 * 60 // seconds
+
+var mastodonLanguagePattern = regexp.MustCompile(`^[a-z]{2,3}$`)
+
 type MastodonPostRequest struct {
-	Message    string   `json:"message"`
-	Visibility string   `json:"visibility,omitempty"` // public, unlisted, private, direct
-	Images     []string `json:"images,omitempty"`     // Base64 encoded images or URLs
+	Message    string             `json:"message"`
+	Visibility string             `json:"visibility,omitempty"` // public, unlisted, private, direct
+	Images     []string           `json:"images,omitempty"`     // Base64 encoded images or URLs
+	Media      []models.MediaItem `json:"media,omitempty"`      // media URLs or library assets with alt text
+	ThreadOptions
+	MastodonStatusOptions
+}
+
+// MastodonStatusOptions are the optional status features. The content
+// warning, sensitive flag and language apply to every toot of a thread; the
+// reply target and poll to the first one. Scheduled toots can't be threads.
+type MastodonStatusOptions struct {
+	SpoilerText string        `json:"spoilerText,omitempty"` // content warning shown before the text
+	Sensitive   bool          `json:"sensitive,omitempty"`   // hide media behind a warning
+	Language    string        `json:"language,omitempty"`    // ISO 639 code
+	Poll        *MastodonPoll `json:"poll,omitempty"`        // can't be combined with media
+	ScheduledAt *time.Time    `json:"scheduledAt,omitempty"`
+	InReplyToID string        `json:"inReplyToId,omitempty"`
+}
+
+type MastodonPoll struct {
+	Options    []string `json:"options"`
+	ExpiresIn  int      `json:"expiresIn,omitempty"` // seconds, defaults to one day
+	Multiple   bool     `json:"multiple,omitempty"`
+	HideTotals bool     `json:"hideTotals,omitempty"`
 }
 
 type MastodonMediaResponse struct {
@@ -36,6 +81,9 @@ type MastodonPostResponse struct {
 	CreatedAt        time.Time               `json:"created_at"`
 	Visibility       string                  `json:"visibility"`
 	MediaAttachments []MastodonMediaResponse `json:"media_attachments"`
+	// Only set when the status was scheduled: the API then returns a
+	// ScheduledStatus, whose ID is not a status ID.
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty"`
 }
 
 type MastodonErrorResponse struct {
@@ -45,62 +93,65 @@ type MastodonErrorResponse struct {
 
 func PostToMastodonHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		fmt.Printf("DEBUG: Mastodon post request started\n")
 
 		userID, err := middleware.GetUserIDFromContext(r)
 		if err != nil {
-			fmt.Printf("DEBUG: Error getting user ID: %v\n", err)
 			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
 			return
 		}
-		fmt.Printf("DEBUG: User ID: %s\n", userID)
 
 		var message string
 		var visibility string
+		var mediaItems []models.MediaItem
+		var threadOpts ThreadOptions
+		var statusOpts MastodonStatusOptions
 
 		contentType := r.Header.Get("Content-Type")
-		fmt.Printf("DEBUG: Content-Type: %s\n", contentType)
 
 		if strings.Contains(contentType, "multipart/form-data") {
-			fmt.Printf("DEBUG: Parsing multipart form data\n")
 			err = r.ParseMultipartForm(32 << 20) // 32MB max
 			if err != nil {
-				fmt.Printf("DEBUG: Error parsing multipart form: %v\n", err)
 				http.Error(w, "Failed to parse form data", http.StatusBadRequest)
 				return
 			}
 
 			message = strings.TrimSpace(r.FormValue("message"))
 			visibility = r.FormValue("visibility")
+			threadOpts.Thread = r.MultipartForm.Value["thread"]
+			threadOpts.AutoThread = r.FormValue("autoThread") == "true"
+			threadOpts.Numbering = r.FormValue("numbering") == "true"
+
+			statusOpts, err = parseMastodonStatusOptionsForm(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 		} else {
-			fmt.Printf("DEBUG: Parsing JSON request\n")
 			var req MastodonPostRequest
 			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-				fmt.Printf("DEBUG: Error decoding JSON request body: %v\n", err)
 				http.Error(w, "Invalid request body", http.StatusBadRequest)
 				return
 			}
 			message = strings.TrimSpace(req.Message)
 			visibility = req.Visibility
-		}
+			threadOpts = req.ThreadOptions
+			statusOpts = req.MastodonStatusOptions
 
-		if message == "" {
-			fmt.Printf("DEBUG: Message is empty\n")
-			http.Error(w, "Message cannot be empty", http.StatusBadRequest)
-			return
+			mediaItems, err = resolveMediaItems(db, userID, nil, req.Media)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 		}
-		fmt.Printf("DEBUG: Request message: %s\n", message)
 
-		if len(message) > 500 {
-			fmt.Printf("DEBUG: Message too long: %d characters\n", len(message))
-			http.Error(w, "Message exceeds Mastodon's 500 character limit", http.StatusBadRequest)
+		if message == "" && len(threadOpts.Thread) == 0 {
+			http.Error(w, "Message cannot be empty", http.StatusBadRequest)
 			return
 		}
 
 		if visibility == "" {
 			visibility = "public"
 		}
-		fmt.Printf("DEBUG: Visibility: %s\n", visibility)
 
 		validVisibilities := map[string]bool{
 			"public":   true,
@@ -109,7 +160,6 @@ func PostToMastodonHandler(db *sql.DB) http.HandlerFunc {
 			"direct":   true,
 		}
 		if !validVisibilities[visibility] {
-			fmt.Printf("DEBUG: Invalid visibility: %s\n", visibility)
 			http.Error(w, "Invalid visibility. Must be: public, unlisted, private, or direct", http.StatusBadRequest)
 			return
 		}
@@ -119,7 +169,6 @@ func PostToMastodonHandler(db *sql.DB) http.HandlerFunc {
 		var refreshToken *string
 		var socialID string
 
-		fmt.Printf("DEBUG: Querying database for Mastodon account\n")
 		err = db.QueryRow(`
 			SELECT access_token, access_token_expires_at, refresh_token, social_id
 			FROM social_accounts
@@ -128,73 +177,97 @@ func PostToMastodonHandler(db *sql.DB) http.HandlerFunc {
 
 		if err != nil {
 			if err == sql.ErrNoRows {
-				fmt.Printf("DEBUG: Mastodon account not found in database\n")
 				http.Error(w, "Mastodon account not connected", http.StatusBadRequest)
 				return
 			}
-			fmt.Printf("DEBUG: Database error retrieving Mastodon account: %v\n", err)
+			log.Printf("[Mastodon] Failed to load account for user %s: %v", userID, err)
 			http.Error(w, "Failed to retrieve Mastodon account", http.StatusInternalServerError)
 			return
 		}
-		fmt.Printf("DEBUG: Found Mastodon account, social_id: %s\n", socialID)
 
 		// Extract instance URL from social_id
-		var instanceURL string
-		if strings.Contains(socialID, "://") {
-			lastColonIndex := strings.LastIndex(socialID, ":")
-			if lastColonIndex == -1 {
-				fmt.Printf("DEBUG: Invalid social_id format (no colon found): %s\n", socialID)
-				http.Error(w, "Invalid Mastodon account data", http.StatusInternalServerError)
-				return
-			}
-			instanceURL = socialID[:lastColonIndex]
-		} else {
-			parts := strings.Split(socialID, ":")
-			if len(parts) < 2 {
-				fmt.Printf("DEBUG: Invalid social_id format: %s\n", socialID)
-				http.Error(w, "Invalid Mastodon account data", http.StatusInternalServerError)
-				return
-			}
-			instanceURL = parts[0]
-			if !strings.HasPrefix(instanceURL, "http://") && !strings.HasPrefix(instanceURL, "https://") {
-				instanceURL = "https://" + instanceURL
-			}
+		instanceURL, err := mastodonInstanceURL(socialID)
+		if err != nil {
+			log.Printf("[Mastodon] Invalid account for user %s: %v", userID, err)
+			http.Error(w, "Invalid Mastodon account data", http.StatusInternalServerError)
+			return
 		}
-		fmt.Printf("DEBUG: Instance URL: %s\n", instanceURL)
 
 		if tokenExpiry != nil && time.Now().After(*tokenExpiry) {
-			fmt.Printf("DEBUG: Token expired\n")
 			http.Error(w, "Mastodon access token has expired. Please reconnect your account.", http.StatusUnauthorized)
 			return
 		}
 
+		instance := getMastodonInstanceConfig(instanceURL)
+
+		// The content warning counts towards the character limit of each toot
+		charLimit := instance.MaxCharacters - utils.MastodonTextLength(statusOpts.SpoilerText)
+		if charLimit <= 0 {
+			http.Error(w, fmt.Sprintf("Content warning exceeds Mastodon's %d character limit", instance.MaxCharacters), http.StatusBadRequest)
+			return
+		}
+		texts, err := buildThreadSegments(message, threadOpts, charLimit, utils.MastodonTextLength, "Mastodon")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		perPost := instance.MaxMediaAttachments
+		maxMedia := perPost * len(texts)
+
+		// Check what kind of media is coming before anything is uploaded
+		var planned []threadMedia
+		if strings.Contains(contentType, "multipart/form-data") {
+			for _, fileHeader := range r.MultipartForm.File["images"] {
+				planned = append(planned, threadMedia{Video: isValidVideoFile(fileHeader.Filename)})
+			}
+		} else {
+			for _, item := range mediaItems {
+				planned = append(planned, threadMedia{Video: isVideoURL(item.URL)})
+			}
+		}
+		if err := validateMastodonStatusOptions(statusOpts, instance, len(texts), len(planned) > 0); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(planned) > maxMedia {
+			http.Error(w, fmt.Sprintf("Maximum %d images/videos allowed per post", perPost), http.StatusBadRequest)
+			return
+		}
+		if _, err := distributeThreadMedia(texts, planned, perPost); err != nil {
+			http.Error(w, "Mastodon: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		// Handle media uploads
 		var mediaIDs []string
 		var mediaFileNames []string
+		var mediaURLs []string
 
 		if strings.Contains(contentType, "multipart/form-data") {
 			files := r.MultipartForm.File["images"]
+			// alt_texts values are matched to the images by position
+			altTexts := r.MultipartForm.Value["alt_texts"]
 			if len(files) > 0 {
-				fmt.Printf("DEBUG: Processing %d media files\n", len(files))
 
-				if len(files) > 4 {
-					fmt.Printf("DEBUG: Too many media files: %d (max 4)\n", len(files))
-					http.Error(w, "Maximum 4 images/videos allowed per post", http.StatusBadRequest)
-					return
+				if requireAltText() {
+					for i, fileHeader := range files {
+						if isValidImageFile(fileHeader.Filename) && (i >= len(altTexts) || strings.TrimSpace(altTexts[i]) == "") {
+							http.Error(w, errMissingAltText.Error(), http.StatusBadRequest)
+							return
+						}
+					}
 				}
 
 				for i, fileHeader := range files {
-					fmt.Printf("DEBUG: Processing media %d: %s\n", i+1, fileHeader.Filename)
 
 					if !isValidImageFile(fileHeader.Filename) && !isValidVideoFile(fileHeader.Filename) {
-						fmt.Printf("DEBUG: Invalid media file: %s\n", fileHeader.Filename)
 						http.Error(w, "Invalid media file format. Supported images: jpg,jpeg,png,gif,webp and videos: mp4,mov,avi,mkv,wmv,flv,webm", http.StatusBadRequest)
 						return
 					}
 
 					file, err := fileHeader.Open()
 					if err != nil {
-						fmt.Printf("DEBUG: Error opening file: %v\n", err)
+						log.Printf("[Mastodon] Failed to open upload %s: %v", fileHeader.Filename, err)
 						http.Error(w, "Failed to process media", http.StatusInternalServerError)
 						return
 					}
@@ -202,133 +275,340 @@ func PostToMastodonHandler(db *sql.DB) http.HandlerFunc {
 
 					cloudinaryURL, err := lib.UploadToCloudinary(file, "mastodon-images", fileHeader.Filename)
 					if err != nil {
-						fmt.Printf("DEBUG: Error uploading to Cloudinary: %v\n", err)
+						log.Printf("[Mastodon] Cloudinary upload failed for user %s: %v", userID, err)
 						http.Error(w, "Failed to upload media", http.StatusInternalServerError)
 						return
 					}
-					fmt.Printf("DEBUG: Media uploaded to Cloudinary: %s\n", cloudinaryURL)
 
-					mediaID, err := uploadImageToMastodon(instanceURL, accessToken, cloudinaryURL, fileHeader.Filename)
+					var altText string
+					if i < len(altTexts) {
+						altText = strings.TrimSpace(altTexts[i])
+					}
+
+					mediaID, err := uploadImageToMastodon(instanceURL, accessToken, cloudinaryURL, fileHeader.Filename, altText)
 					if err != nil {
-						fmt.Printf("DEBUG: Error uploading to Mastodon: %v\n", err)
+						log.Printf("[Mastodon] Media upload failed for user %s: %v", userID, err)
 						http.Error(w, "Failed to upload media to Mastodon", http.StatusInternalServerError)
 						return
 					}
-					fmt.Printf("DEBUG: Media uploaded to Mastodon, media ID: %s\n", mediaID)
 					mediaIDs = append(mediaIDs, mediaID)
 					mediaFileNames = append(mediaFileNames, fileHeader.Filename)
+					mediaURLs = append(mediaURLs, cloudinaryURL)
 				}
 			}
-		}
+		} else if len(mediaItems) > 0 {
+			for _, item := range mediaItems {
+				filename := path.Base(item.URL)
+				if q := strings.IndexAny(filename, "?#"); q != -1 {
+					filename = filename[:q]
+				}
 
-		// If any video present, only keep first video media ID, remove others (Mastodon disallows mixing images and videos)
-		hasVideo := false
-		var videoMediaID string
-		for i, fname := range mediaFileNames {
-			if isValidVideoFile(fname) {
-				hasVideo = true
-				videoMediaID = mediaIDs[i]
-				break
-			}
-		}
-		if hasVideo {
-			mediaIDs = []string{}
-			if videoMediaID != "" {
-				mediaIDs = append(mediaIDs, videoMediaID)
+				mediaID, err := uploadImageToMastodon(instanceURL, accessToken, item.URL, filename, item.AltText)
+				if err != nil {
+					log.Printf("[Mastodon] Media upload failed for user %s: %v", userID, err)
+					http.Error(w, "Failed to upload media to Mastodon", http.StatusInternalServerError)
+					return
+				}
+				mediaIDs = append(mediaIDs, mediaID)
+				if isVideoURL(item.URL) && !isValidVideoFile(filename) {
+					filename += ".mp4"
+				}
+				mediaFileNames = append(mediaFileNames, filename)
+				mediaURLs = append(mediaURLs, item.URL)
 			}
 		}
 
-		tootPayload := map[string]interface{}{
-			"status":     message,
-			"visibility": visibility,
-		}
-		if len(mediaIDs) > 0 {
-			tootPayload["media_ids"] = mediaIDs
+		media := make([]threadMedia, 0, len(mediaIDs))
+		for i, id := range mediaIDs {
+			media = append(media, threadMedia{ID: id, URL: mediaURLs[i], Video: isValidVideoFile(mediaFileNames[i])})
 		}
 
-		payloadBytes, err := json.Marshal(tootPayload)
+		// Threads give each video a post of its own; the media was checked to fit above
+		segments, err := distributeThreadMedia(texts, media, perPost)
 		if err != nil {
-			fmt.Printf("DEBUG: Error marshaling payload: %v\n", err)
-			http.Error(w, "Failed to prepare toot payload", http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		fmt.Printf("DEBUG: Payload prepared: %s\n", string(payloadBytes))
 
-		tootURL := instanceURL + "/api/v1/statuses"
-		fmt.Printf("DEBUG: Making request to: %s\n", tootURL)
-		req_mastodon, err := http.NewRequest("POST", tootURL, bytes.NewBuffer(payloadBytes))
-		if err != nil {
-			fmt.Printf("DEBUG: Error creating request: %v\n", err)
-			http.Error(w, "Failed to create request", http.StatusInternalServerError)
-			return
+		buildPayload := func(seg threadSegment, replyTo string) map[string]interface{} {
+			tootPayload := map[string]interface{}{
+				"status":     seg.Text,
+				"visibility": visibility,
+			}
+			if len(seg.Media) > 0 {
+				tootPayload["media_ids"] = seg.mediaIDs()
+				if statusOpts.Sensitive {
+					tootPayload["sensitive"] = true
+				}
+			}
+			if statusOpts.SpoilerText != "" {
+				tootPayload["spoiler_text"] = statusOpts.SpoilerText
+			}
+			if statusOpts.Language != "" {
+				tootPayload["language"] = statusOpts.Language
+			}
+			if replyTo == "" {
+				// The first toot replies to the requested status, the rest to each other
+				replyTo = statusOpts.InReplyToID
+				if poll := statusOpts.Poll; poll != nil {
+					tootPayload["poll"] = map[string]interface{}{
+						"options":     poll.Options,
+						"expires_in":  poll.ExpiresIn,
+						"multiple":    poll.Multiple,
+						"hide_totals": poll.HideTotals,
+					}
+				}
+			}
+			if replyTo != "" {
+				tootPayload["in_reply_to_id"] = replyTo
+			}
+			return tootPayload
 		}
 
-		req_mastodon.Header.Set("Content-Type", "application/json")
-		req_mastodon.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+		if statusOpts.ScheduledAt != nil {
+			tootPayload := buildPayload(segments[0], "")
+			tootPayload["scheduled_at"] = statusOpts.ScheduledAt.UTC().Format(time.RFC3339)
+
+			scheduled, err := createMastodonStatus(instanceURL, accessToken, tootPayload)
+			if err != nil {
+				var apiErr *mastodonAPIError
+				if errors.As(err, &apiErr) {
+					http.Error(w, apiErr.Message, apiErr.Status)
+					return
+				}
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
 
-		client := &http.Client{Timeout: 30 * time.Second}
+			// The instance publishes it; until then only the scheduled status ID exists
+			uid, _ := uuid.Parse(userID)
+			now := time.Now().UTC()
+			post := models.Post{
+				ID:             uuid.New(),
+				UserID:         uid,
+				Platform:       "mastodon",
+				PlatformPostID: scheduled.ID,
+				Message:        segments[0].Text,
+				MediaURLs:      segments[0].mediaURLs(),
+				PostedAt:       statusOpts.ScheduledAt.UTC(),
+				Status:         "scheduled",
+				CreatedAt:      now,
+				UpdatedAt:      now,
+			}
+			if err := models.SavePost(db, post); err != nil {
+				log.Printf("[Mastodon] Failed to save scheduled toot for user %s: %v", userID, err)
+			}
 
-		fmt.Printf("DEBUG: Sending request to Mastodon API\n")
-		resp, err := client.Do(req_mastodon)
-		if err != nil {
-			fmt.Printf("DEBUG: Error making request to Mastodon: %v\n", err)
-			http.Error(w, "Failed to publish toot", http.StatusInternalServerError)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"message":     "Toot scheduled successfully",
+				"scheduledId": scheduled.ID,
+				"scheduledAt": statusOpts.ScheduledAt.UTC(),
+				"content":     segments[0].Text,
+				"visibility":  visibility,
+				"mediaCount":  len(segments[0].Media),
+			})
 			return
 		}
-		defer resp.Body.Close()
 
-		fmt.Printf("DEBUG: Mastodon API response status: %d\n", resp.StatusCode)
+		results, err := publishThread(segments, func(seg threadSegment, replyTo string) (string, string, error) {
+			toot, err := createMastodonStatus(instanceURL, accessToken, buildPayload(seg, replyTo))
+			if err != nil {
+				return "", "", err
+			}
+			return toot.ID, toot.URL, nil
+		})
 
-		if resp.StatusCode == http.StatusOK {
-			fmt.Printf("DEBUG: Success! Toot posted successfully\n")
-			var mastodonResp MastodonPostResponse
-			if err := json.NewDecoder(resp.Body).Decode(&mastodonResp); err != nil {
-				w.WriteHeader(http.StatusOK)
-				w.Write([]byte("Toot published successfully"))
-				return
+		if len(results) > 0 {
+			if err := saveThreadPosts(db, userID, "mastodon", segments, results); err != nil {
+				log.Printf("[Mastodon] Failed to save toots for user %s: %v", userID, err)
 			}
+		}
 
-			response := map[string]interface{}{
-				"message":    "Toot published successfully",
-				"tootId":     mastodonResp.ID,
-				"content":    mastodonResp.Content,
-				"url":        mastodonResp.URL,
-				"visibility": mastodonResp.Visibility,
-				"createdAt":  mastodonResp.CreatedAt,
-				"mediaCount": len(mastodonResp.MediaAttachments),
+		if err != nil {
+			var tErr *threadError
+			errors.As(err, &tErr)
+			status, msg := http.StatusInternalServerError, err.Error()
+			var apiErr *mastodonAPIError
+			if errors.As(err, &apiErr) {
+				status, msg = apiErr.Status, apiErr.Message
 			}
 
+			if len(segments) == 1 {
+				http.Error(w, msg, status)
+				return
+			}
+
+			// Partial thread: report what was posted and where it broke
 			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(response)
+			w.WriteHeader(http.StatusBadGateway)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":         fmt.Sprintf("Thread failed at segment %d of %d: %s", tErr.Index+1, len(segments), msg),
+				"failedSegment": tErr.Index,
+				"segments":      results,
+			})
 			return
 		}
 
-		fmt.Printf("DEBUG: Mastodon API returned error status: %d\n", resp.StatusCode)
-		var errorResp MastodonErrorResponse
-		if err := json.NewDecoder(resp.Body).Decode(&errorResp); err != nil {
-			fmt.Printf("DEBUG: Error decoding error response: %v\n", err)
-			http.Error(w, fmt.Sprintf("Mastodon API error (status: %d)", resp.StatusCode), resp.StatusCode)
-			return
+		response := map[string]interface{}{
+			"message":    "Toot published successfully",
+			"tootId":     results[0].ID,
+			"content":    results[0].Text,
+			"url":        results[0].URL,
+			"visibility": visibility,
+			"mediaCount": len(segments[0].Media),
+		}
+		if len(results) > 1 {
+			response["message"] = "Thread published successfully"
+			response["segments"] = results
 		}
 
-		if errorResp.Error != "" {
-			errorMsg := errorResp.Error
-			if errorResp.ErrorDescription != "" {
-				errorMsg = errorResp.ErrorDescription
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// parseMastodonStatusOptionsForm reads the status options of a multipart
+// request. Poll options are repeated poll_options fields.
+func parseMastodonStatusOptionsForm(r *http.Request) (MastodonStatusOptions, error) {
+	opts := MastodonStatusOptions{
+		SpoilerText: r.FormValue("spoilerText"),
+		Sensitive:   r.FormValue("sensitive") == "true",
+		Language:    r.FormValue("language"),
+		InReplyToID: r.FormValue("inReplyToId"),
+	}
+	if v := r.FormValue("scheduledAt"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return opts, errors.New("scheduledAt must be an RFC 3339 timestamp")
+		}
+		opts.ScheduledAt = &t
+	}
+	if options := r.MultipartForm.Value["poll_options"]; len(options) > 0 {
+		opts.Poll = &MastodonPoll{
+			Options:    options,
+			Multiple:   r.FormValue("poll_multiple") == "true",
+			HideTotals: r.FormValue("poll_hide_totals") == "true",
+		}
+		if v := r.FormValue("poll_expires_in"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return opts, errors.New("poll_expires_in must be a number of seconds")
 			}
-			fmt.Printf("DEBUG: Mastodon API error: %s\n", errorMsg)
-			http.Error(w, fmt.Sprintf("Mastodon API error: %s", errorMsg), resp.StatusCode)
-			return
+			opts.Poll.ExpiresIn = n
 		}
+	}
+	return opts, nil
+}
 
-		fmt.Printf("DEBUG: Unknown Mastodon API error\n")
-		http.Error(w, "Unknown Mastodon API error", resp.StatusCode)
+// validateMastodonStatusOptions checks the options against the instance's
+// limits and normalizes them. It fills in the default poll expiry.
+func validateMastodonStatusOptions(opts MastodonStatusOptions, instance mastodonInstanceConfig, segments int, hasMedia bool) error {
+	if opts.Language != "" && !mastodonLanguagePattern.MatchString(opts.Language) {
+		return errors.New("language must be a lowercase ISO 639 code, e.g. \"en\"")
 	}
+
+	if opts.ScheduledAt != nil {
+		if segments > 1 {
+			return errors.New("Scheduled toots can't be threads: replies need the published toot")
+		}
+		if time.Until(*opts.ScheduledAt) < mastodonMinScheduleDelay {
+			return errors.New("scheduledAt must be at least 5 minutes in the future")
+		}
+	}
+
+	if poll := opts.Poll; poll != nil {
+		if hasMedia {
+			return errors.New("A toot can't have both a poll and media")
+		}
+		if len(poll.Options) < 2 || len(poll.Options) > instance.PollMaxOptions {
+			return fmt.Errorf("A poll needs 2 to %d options", instance.PollMaxOptions)
+		}
+		for i, option := range poll.Options {
+			option = strings.TrimSpace(option)
+			if option == "" {
+				return fmt.Errorf("Poll option %d is empty", i+1)
+			}
+			if n := utf8.RuneCountInString(option); n > instance.PollMaxOptionChars {
+				return fmt.Errorf("Poll option %d exceeds the %d character limit (%d characters)", i+1, instance.PollMaxOptionChars, n)
+			}
+			poll.Options[i] = option
+		}
+		if poll.ExpiresIn == 0 {
+			poll.ExpiresIn = mastodonDefaultPollExpiry
+		}
+		if poll.ExpiresIn < instance.PollMinExpiration || poll.ExpiresIn > instance.PollMaxExpiration {
+			return fmt.Errorf("Poll expiry must be between %d and %d seconds", instance.PollMinExpiration, instance.PollMaxExpiration)
+		}
+	}
+	return nil
+}
+
+// mastodonAPIError carries the user-facing message and HTTP status for a failed status.
+type mastodonAPIError struct {
+	Status  int
+	Message string
+}
+
+func (e *mastodonAPIError) Error() string { return e.Message }
+
+// createMastodonStatus publishes a status and maps API failures to a *mastodonAPIError.
+func createMastodonStatus(instanceURL, accessToken string, tootPayload map[string]interface{}) (*MastodonPostResponse, error) {
+	payloadBytes, err := json.Marshal(tootPayload)
+	if err != nil {
+		log.Printf("[Mastodon] Failed to encode status: %v", err)
+		return nil, &mastodonAPIError{Status: http.StatusInternalServerError, Message: "Failed to prepare toot payload"}
+	}
+
+	tootURL := instanceURL + "/api/v1/statuses"
+	req_mastodon, err := http.NewRequest("POST", tootURL, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		log.Printf("[Mastodon] Failed to create status request: %v", err)
+		return nil, &mastodonAPIError{Status: http.StatusInternalServerError, Message: "Failed to create request"}
+	}
+
+	req_mastodon.Header.Set("Content-Type", "application/json")
+	req_mastodon.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	resp, err := client.Do(req_mastodon)
+	if err != nil {
+		log.Printf("[Mastodon] Status request to %s failed: %v", instanceURL, err)
+		return nil, &mastodonAPIError{Status: http.StatusInternalServerError, Message: "Failed to publish toot"}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		var mastodonResp MastodonPostResponse
+		if err := json.NewDecoder(resp.Body).Decode(&mastodonResp); err != nil {
+			// The toot was posted even if we can't decode the response
+			log.Printf("[Mastodon] Failed to decode status response: %v", err)
+		}
+		return &mastodonResp, nil
+	}
+
+	var errorResp MastodonErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&errorResp); err != nil {
+		return nil, &mastodonAPIError{Status: resp.StatusCode, Message: fmt.Sprintf("Mastodon API error (status: %d)", resp.StatusCode)}
+	}
+
+	if errorResp.Error != "" {
+		errorMsg := errorResp.Error
+		if errorResp.ErrorDescription != "" {
+			errorMsg = errorResp.ErrorDescription
+		}
+		return nil, &mastodonAPIError{Status: resp.StatusCode, Message: fmt.Sprintf("Mastodon API error: %s", errorMsg)}
+	}
+
+	return nil, &mastodonAPIError{Status: resp.StatusCode, Message: "Unknown Mastodon API error"}
 }
 
-// uploadImageToMastodon uploads an image/video to Mastodon and returns the media ID
-func uploadImageToMastodon(instanceURL, accessToken, imageURL, filename string) (string, error) {
+// uploadImageToMastodon uploads an image/video to Mastodon and returns the media ID.
+// description is the alt text shown to screen reader users.
+func uploadImageToMastodon(instanceURL, accessToken, imageURL, filename, description string) (string, error) {
 	resp, err := http.Get(imageURL)
 	if err != nil {
 		return "", fmt.Errorf("failed to download media from Cloudinary: %v", err)
@@ -352,12 +632,12 @@ func uploadImageToMastodon(instanceURL, accessToken, imageURL, filename string)
 		return "", err
 	}
 
-	if filename != "" {
+	if description != "" {
 		descField, err := writer.CreateFormField("description")
 		if err != nil {
 			return "", err
 		}
-		descField.Write([]byte(filename))
+		descField.Write([]byte(description))
 	}
 
 	writer.Close()
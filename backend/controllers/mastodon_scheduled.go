@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-sync-backend/models"
+)
+
+const (
+	// How far before its scheduled time a published toot may be dated, and
+	// how many pages of the account's statuses are searched for it
+	mastodonScheduleSlack    = 5 * time.Minute
+	mastodonStatusSearchPage = 40
+	mastodonStatusSearchMax  = 5
+
+	// A scheduled toot that can't be found this long after its publish time
+	// is given up on and marked failed
+	mastodonScheduleGiveUp = 24 * time.Hour
+)
+
+var (
+	mastodonBreakPattern = regexp.MustCompile(`(?i)<br\s*/?>|</p>\s*<p[^>]*>`)
+	mastodonTagPattern   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// errMastodonScheduledMissing means the instance no longer has the scheduled
+// toot and no published toot matches it.
+var errMastodonScheduledMissing = &postNotSupportedError{Message: "The scheduled toot is no longer on the instance and the published toot couldn't be found"}
+
+// ResolveScheduledMastodonPosts swaps the scheduled status ID of every
+// scheduled toot that is due for the ID of the status the instance published.
+func ResolveScheduledMastodonPosts(db *sql.DB) {
+	posts, err := models.ListDueScheduledPosts(db, "mastodon")
+	if err != nil {
+		log.Printf("[Mastodon] Failed to load due scheduled toots: %v", err)
+		return
+	}
+
+	for i := range posts {
+		post := &posts[i]
+		userID := post.UserID.String()
+		accessToken, socialID, err := postAccount(db, userID, "mastodon", true)
+		if err != nil {
+			log.Printf("[Mastodon] Can't resolve scheduled toot %s: %v", post.ID, err)
+			continue
+		}
+
+		err = resolveMastodonScheduledPost(db, accessToken, socialID, post)
+		if err == errMastodonScheduledMissing && time.Since(post.PostedAt) > mastodonScheduleGiveUp {
+			log.Printf("[Mastodon] Scheduled toot %s was never published, marking it failed", post.ID)
+			if err := models.SetPostStatus(db, post.ID, "failed"); err != nil {
+				log.Printf("[Mastodon] Failed to mark toot %s failed: %v", post.ID, err)
+			}
+		} else if err != nil {
+			log.Printf("[Mastodon] Failed to resolve scheduled toot %s: %v", post.ID, err)
+		}
+	}
+}
+
+// resolveMastodonScheduledPost checks whether a scheduled toot is still
+// waiting on the instance. Once it isn't, the published status is looked up
+// and the post is updated with its ID, both in the database and in post.
+func resolveMastodonScheduledPost(db *sql.DB, accessToken, socialID string, post *models.Post) error {
+	instanceURL, err := mastodonInstanceURL(socialID)
+	if err != nil {
+		return err
+	}
+
+	scheduledURL := instanceURL + "/api/v1/scheduled_statuses/" + url.PathEscape(post.PlatformPostID)
+	err = mastodonRequest(http.MethodGet, scheduledURL, accessToken, nil, nil)
+	var apiErr *mastodonAPIError
+	if err == nil || !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound {
+		// Still scheduled, or the instance couldn't tell us
+		return err
+	}
+
+	accountID := socialID[strings.LastIndex(socialID, ":")+1:]
+	statusID, postedAt, err := findPublishedMastodonStatus(instanceURL, accessToken, accountID, *post)
+	if err != nil {
+		return err
+	}
+	if statusID == "" {
+		return errMastodonScheduledMissing
+	}
+
+	if err := models.SetPostPublished(db, post.ID, statusID, postedAt); err != nil {
+		return err
+	}
+	log.Printf("[Mastodon] Scheduled toot %s was published as status %s", post.ID, statusID)
+	post.PlatformPostID = statusID
+	post.PostedAt = postedAt
+	post.Status = "posted"
+	return nil
+}
+
+// findPublishedMastodonStatus searches the account's statuses for the one a
+// scheduled toot became. The API doesn't link the two, so it is matched by
+// its text among the statuses created from the scheduled time on.
+func findPublishedMastodonStatus(instanceURL, accessToken, accountID string, post models.Post) (string, time.Time, error) {
+	want := normalizeMastodonText(post.Message)
+	since := post.PostedAt.Add(-mastodonScheduleSlack)
+
+	var match struct {
+		id        string
+		createdAt time.Time
+	}
+	maxID := ""
+	for page := 0; page < mastodonStatusSearchMax; page++ {
+		params := url.Values{}
+		params.Set("limit", strconv.Itoa(mastodonStatusSearchPage))
+		params.Set("exclude_reblogs", "true")
+		if maxID != "" {
+			params.Set("max_id", maxID)
+		}
+		var statuses []struct {
+			ID        string    `json:"id"`
+			CreatedAt time.Time `json:"created_at"`
+			Content   string    `json:"content"`
+		}
+		endpoint := instanceURL + "/api/v1/accounts/" + url.PathEscape(accountID) + "/statuses?" + params.Encode()
+		if err := mastodonRequest(http.MethodGet, endpoint, accessToken, nil, &statuses); err != nil {
+			return "", time.Time{}, err
+		}
+
+		// Newest first; keep the earliest match, the one created on schedule
+		for _, s := range statuses {
+			if s.CreatedAt.Before(since) {
+				return match.id, match.createdAt, nil
+			}
+			if mastodonStatusText(s.Content) == want {
+				match.id, match.createdAt = s.ID, s.CreatedAt
+			}
+		}
+		if len(statuses) < mastodonStatusSearchPage {
+			break
+		}
+		maxID = statuses[len(statuses)-1].ID
+	}
+	return match.id, match.createdAt, nil
+}
+
+// mastodonStatusText turns the HTML content of a status back into its text.
+func mastodonStatusText(content string) string {
+	text := mastodonBreakPattern.ReplaceAllString(content, "\n")
+	text = mastodonTagPattern.ReplaceAllString(text, "")
+	return normalizeMastodonText(html.UnescapeString(text))
+}
+
+func normalizeMastodonText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// errMissingAltText is returned by resolveMediaItems when the alt text policy is
+// enabled and an image has no description.
+var errMissingAltText = errors.New("alt text is required for every image")
+
+// requireAltText reports whether publishing images without alt text is blocked.
+// Enable with REQUIRE_MEDIA_ALT_TEXT=true.
+func requireAltText() bool {
+	return strings.EqualFold(os.Getenv("REQUIRE_MEDIA_ALT_TEXT"), "true")
+}
+
+// isVideoURL guesses whether a media URL points at a video. Cloudinary URLs carry
+// the resource type in the path, anything else is judged by its extension.
+func isVideoURL(mediaURL string) bool {
+	lower := strings.ToLower(mediaURL)
+	if i := strings.IndexAny(lower, "?#"); i != -1 {
+		lower = lower[:i]
+	}
+	return strings.Contains(lower, "/video/") || isVideo(lower)
+}
+
+// resolveMediaItems merges the legacy mediaUrls list with structured media items,
+// fills in URLs and alt text from the user's media library and enforces the alt
+// text policy. The returned items always have a URL.
+func resolveMediaItems(db *sql.DB, userID string, mediaURLs []string, items []models.MediaItem) ([]models.MediaItem, error) {
+	resolved := make([]models.MediaItem, 0, len(items)+len(mediaURLs))
+	seen := make(map[string]bool)
+
+	for _, item := range items {
+		item.AltText = strings.TrimSpace(item.AltText)
+
+		if item.AssetID != "" {
+			if _, err := uuid.Parse(item.AssetID); err != nil {
+				return nil, fmt.Errorf("invalid media asset ID %q", item.AssetID)
+			}
+			asset, err := models.GetMediaAsset(db, userID, item.AssetID)
+			if err == sql.ErrNoRows {
+				return nil, fmt.Errorf("media asset %s not found", item.AssetID)
+			} else if err != nil {
+				return nil, fmt.Errorf("failed to load media asset %s: %w", item.AssetID, err)
+			}
+			item.URL = asset.URL
+			if item.AltText == "" && asset.AltText != nil {
+				item.AltText = *asset.AltText
+			}
+		}
+
+		if item.URL == "" {
+			return nil, errors.New("media item requires a url or assetId")
+		}
+		seen[item.URL] = true
+		resolved = append(resolved, item)
+	}
+
+	for _, u := range mediaURLs {
+		if u == "" || seen[u] {
+			continue
+		}
+		seen[u] = true
+		resolved = append(resolved, models.MediaItem{URL: u})
+	}
+
+	// Fall back to the library's alt text for items that were passed by URL only
+	for i := range resolved {
+		if resolved[i].AltText != "" {
+			continue
+		}
+		asset, err := models.FindMediaAssetByURL(db, userID, resolved[i].URL)
+		if err == nil && asset.AltText != nil {
+			resolved[i].AltText = *asset.AltText
+		} else if err != nil && err != sql.ErrNoRows {
+			log.Printf("WARN: failed to look up alt text for %s: %v", resolved[i].URL, err)
+		}
+	}
+
+	if requireAltText() {
+		for _, item := range resolved {
+			if !isVideoURL(item.URL) && item.AltText == "" {
+				return nil, errMissingAltText
+			}
+		}
+	}
+
+	return resolved, nil
+}
+
+// mediaItemURLs returns the URLs of the given items, in order.
+func mediaItemURLs(items []models.MediaItem) []string {
+	urls := make([]string, 0, len(items))
+	for _, item := range items {
+		urls = append(urls, item.URL)
+	}
+	return urls
+}
+
+// ListMediaAssetsHandler returns the authenticated user's media library.
+func ListMediaAssetsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		assets, err := models.ListMediaAssets(db, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to list media assets for user %s: %v", userID, err)
+			http.Error(w, "Failed to fetch media library", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(assets)
+	}
+}
+
+// UpdateMediaAssetHandler updates the alt text of a media library item.
+func UpdateMediaAssetHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		assetID := mux.Vars(r)["id"]
+		if _, err := uuid.Parse(assetID); err != nil {
+			http.Error(w, "Invalid media asset ID", http.StatusBadRequest)
+			return
+		}
+
+		var req struct {
+			AltText *string `json:"altText"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.AltText != nil {
+			trimmed := strings.TrimSpace(*req.AltText)
+			if trimmed == "" {
+				req.AltText = nil
+			} else {
+				req.AltText = &trimmed
+			}
+		}
+
+		err = models.UpdateMediaAssetAltText(db, userID, assetID, req.AltText)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Media asset not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("ERROR: Failed to update media asset %s: %v", assetID, err)
+			http.Error(w, "Failed to update media asset", http.StatusInternalServerError)
+			return
+		}
+
+		asset, err := models.GetMediaAsset(db, userID, assetID)
+		if err != nil {
+			http.Error(w, "Failed to fetch media asset", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(asset)
+	}
+}
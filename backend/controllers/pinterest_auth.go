@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"social-sync-backend/middleware"
+	"social-sync-backend/utils"
+
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+const pinterestAPIURL = "https://api.pinterest.com/v5"
+
+var pinterestStates = make(map[string]string) // state -> user_id
+
+// getPinterestOAuthConfig returns OAuth2 config for Pinterest
+func getPinterestOAuthConfig() *oauth2.Config {
+	redirectURL := utils.GetCallbackURL("pinterest")
+	if redirectURL == "" {
+		log.Fatal("PINTEREST_REDIRECT_URL is empty!")
+	}
+
+	return &oauth2.Config{
+		ClientID:     os.Getenv("PINTEREST_CLIENT_ID"),
+		ClientSecret: os.Getenv("PINTEREST_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"user_accounts:read", "boards:read", "boards:write", "pins:read", "pins:write"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   "https://www.pinterest.com/oauth/",
+			TokenURL:  pinterestAPIURL + "/oauth/token",
+			AuthStyle: oauth2.AuthStyleInHeader,
+		},
+	}
+}
+
+// PinterestRedirectHandler initiates the OAuth flow and redirects to Pinterest auth page
+func PinterestRedirectHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		config := getPinterestOAuthConfig()
+
+		appUserIDStr, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated.", http.StatusUnauthorized)
+			return
+		}
+		if _, err := uuid.Parse(appUserIDStr); err != nil {
+			http.Error(w, "Invalid user ID format.", http.StatusInternalServerError)
+			return
+		}
+
+		state := generateState()
+		pinterestStates[state] = appUserIDStr
+
+		http.Redirect(w, r, config.AuthCodeURL(state), http.StatusTemporaryRedirect)
+	}
+}
+
+// PinterestCallbackHandler handles Pinterest OAuth callback, fetches the account, saves to DB, then redirects frontend
+func PinterestCallbackHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		state := r.URL.Query().Get("state")
+		appUserIDStr, exists := pinterestStates[state]
+		if state == "" || !exists {
+			http.Error(w, "Invalid or expired state parameter", http.StatusBadRequest)
+			return
+		}
+		delete(pinterestStates, state)
+
+		code := r.URL.Query().Get("code")
+		if code == "" {
+			redirectURL := fmt.Sprintf("%s/home/manage-accounts?error=pinterest", utils.GetFrontendURL())
+			http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+			return
+		}
+
+		config := getPinterestOAuthConfig()
+		token, err := config.Exchange(context.Background(), code)
+		if err != nil {
+			http.Error(w, "Token exchange failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var account struct {
+			ID           string `json:"id"`
+			Username     string `json:"username"`
+			ProfileImage string `json:"profile_image"`
+		}
+		if err := pinterestRequest(token.AccessToken, "GET", "/user_account", nil, &account); err != nil {
+			http.Error(w, "Failed to fetch user info: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		socialID := account.ID
+		if socialID == "" {
+			socialID = account.Username
+		}
+
+		var expiresAt *time.Time
+		if token.Expiry != (time.Time{}) {
+			expiresAt = &token.Expiry
+		}
+
+		_, err = db.Exec(`
+			INSERT INTO social_accounts (
+				user_id, platform, social_id, access_token, access_token_expires_at,
+				refresh_token, profile_picture_url, profile_name, connected_at
+			) VALUES (
+				$1, 'pinterest', $2, $3, $4, $5, $6, $7, NOW()
+			)
+			ON CONFLICT (user_id, platform) DO UPDATE SET
+				access_token = EXCLUDED.access_token,
+				access_token_expires_at = EXCLUDED.access_token_expires_at,
+				refresh_token = EXCLUDED.refresh_token,
+				social_id = EXCLUDED.social_id,
+				profile_picture_url = EXCLUDED.profile_picture_url,
+				profile_name = EXCLUDED.profile_name,
+				connected_at = NOW()
+		`,
+			appUserIDStr,
+			socialID,
+			token.AccessToken,
+			expiresAt,
+			token.RefreshToken,
+			account.ProfileImage,
+			"@"+account.Username,
+		)
+		if err != nil {
+			http.Error(w, "Failed to save Pinterest account: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		redirectURL := fmt.Sprintf("%s/home/manage-accounts?connected=pinterest", utils.GetFrontendURL())
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+	}
+}
+
+// getPinterestAccessToken returns a valid access token, refreshing and storing
+// a new one through the oauth2 token source when it has expired.
+func getPinterestAccessToken(db *sql.DB, userID string) (string, error) {
+	var accessToken string
+	var expiresAt *time.Time
+	var refreshToken *string
+	err := db.QueryRow(`
+		SELECT access_token, access_token_expires_at, refresh_token
+		FROM social_accounts
+		WHERE user_id = $1 AND platform = 'pinterest'
+	`, userID).Scan(&accessToken, &expiresAt, &refreshToken)
+	if err != nil {
+		return "", err
+	}
+	if expiresAt == nil || time.Now().Add(time.Minute).Before(*expiresAt) {
+		return accessToken, nil
+	}
+	if refreshToken == nil || *refreshToken == "" {
+		return "", fmt.Errorf("Pinterest access token has expired. Please reconnect your account.")
+	}
+
+	old := &oauth2.Token{AccessToken: accessToken, RefreshToken: *refreshToken, Expiry: *expiresAt}
+	token, err := getPinterestOAuthConfig().TokenSource(context.Background(), old).Token()
+	if err != nil {
+		return "", fmt.Errorf("Pinterest access token has expired and could not be refreshed. Please reconnect your account.")
+	}
+
+	_, err = db.Exec(`
+		UPDATE social_accounts
+		SET access_token = $1, access_token_expires_at = $2, refresh_token = $3, last_synced_at = NOW()
+		WHERE user_id = $4 AND platform = 'pinterest'
+	`, token.AccessToken, token.Expiry, token.RefreshToken, userID)
+	if err != nil {
+		log.Printf("[Pinterest] Failed to store refreshed token for user %s: %v", userID, err)
+	}
+	return token.AccessToken, nil
+}
+
+// pinterestRequest calls the v5 API with a JSON body and decodes the response.
+func pinterestRequest(accessToken, method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, pinterestAPIURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Pinterest request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errResp struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(respBody, &errResp) == nil && errResp.Message != "" {
+			return fmt.Errorf("Pinterest API error (status %d): %s", resp.StatusCode, errResp.Message)
+		}
+		return fmt.Errorf("Pinterest API error (status %d): %s", resp.StatusCode, respBody)
+	}
+	if out != nil && len(respBody) > 0 {
+		return json.Unmarshal(respBody, out)
+	}
+	return nil
+}
@@ -0,0 +1,578 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+	"social-sync-backend/utils"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	pinterestMaxTitleChars   = 100
+	pinterestMaxAltTextChars = 500
+	pinterestMaxImages       = 5 // carousel pins take 2-5 images
+	pinterestMediaPollEvery  = 5 * time.Second
+	pinterestMediaPollFor    = 10 * time.Minute
+)
+
+type PinterestBoard struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Privacy     string `json:"privacy"`
+}
+
+type PinterestBoardRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Privacy     string `json:"privacy,omitempty"` // PUBLIC (default), PROTECTED or SECRET
+}
+
+type PinterestPostRequest struct {
+	BoardID       string             `json:"boardId"`
+	Title         string             `json:"title,omitempty"`
+	Message       string             `json:"message"` // pin description
+	Link          string             `json:"link,omitempty"`
+	AltText       string             `json:"altText,omitempty"` // used when a media item has none
+	CoverImageURL string             `json:"coverImageUrl,omitempty"`
+	MediaUrls     []string           `json:"mediaUrls,omitempty"`
+	Media         []models.MediaItem `json:"media,omitempty"`
+}
+
+// GET /api/pinterest/boards
+func GetPinterestBoardsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		accessToken, err := getPinterestAccessToken(db, userID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Pinterest account not connected", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		boards := []PinterestBoard{}
+		bookmark := ""
+		for {
+			query := url.Values{"page_size": {"100"}}
+			if bookmark != "" {
+				query.Set("bookmark", bookmark)
+			}
+			var page struct {
+				Items    []PinterestBoard `json:"items"`
+				Bookmark string           `json:"bookmark"`
+			}
+			if err := pinterestRequest(accessToken, "GET", "/boards?"+query.Encode(), nil, &page); err != nil {
+				log.Printf("[Pinterest] Failed to list boards for user %s: %v", userID, err)
+				http.Error(w, fmt.Sprintf("Failed to fetch Pinterest boards: %v", err), http.StatusBadGateway)
+				return
+			}
+			boards = append(boards, page.Items...)
+			if page.Bookmark == "" {
+				break
+			}
+			bookmark = page.Bookmark
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"boards": boards})
+	}
+}
+
+// POST /api/pinterest/boards
+func CreatePinterestBoardHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var req PinterestBoardRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			http.Error(w, "Board name is required", http.StatusBadRequest)
+			return
+		}
+		req.Privacy = strings.ToUpper(req.Privacy)
+		if req.Privacy == "" {
+			req.Privacy = "PUBLIC"
+		}
+		if req.Privacy != "PUBLIC" && req.Privacy != "PROTECTED" && req.Privacy != "SECRET" {
+			http.Error(w, "privacy must be PUBLIC, PROTECTED or SECRET", http.StatusBadRequest)
+			return
+		}
+
+		accessToken, err := getPinterestAccessToken(db, userID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Pinterest account not connected", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var board PinterestBoard
+		if err := pinterestRequest(accessToken, "POST", "/boards", req, &board); err != nil {
+			log.Printf("[Pinterest] Failed to create board for user %s: %v", userID, err)
+			http.Error(w, fmt.Sprintf("Failed to create Pinterest board: %v", err), http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(board)
+	}
+}
+
+// POST /api/pinterest/post
+// Image pins are created directly. Video pins are uploaded to Pinterest first;
+// the pin is created in the background once Pinterest finishes processing, so
+// those requests answer 202 with the media ID to poll.
+func PostToPinterestHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var req PinterestPostRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		failed := func(status int, message string) {
+			writePublishResult(w, status, PublishResult{Platform: "pinterest", Status: "failed", Message: message})
+		}
+
+		if strings.TrimSpace(req.BoardID) == "" {
+			failed(http.StatusBadRequest, "boardId is required")
+			return
+		}
+		title := strings.TrimSpace(req.Title)
+		if utf8.RuneCountInString(title) > pinterestMaxTitleChars {
+			failed(http.StatusBadRequest, fmt.Sprintf("Title exceeds Pinterest's %d character limit", pinterestMaxTitleChars))
+			return
+		}
+		message := strings.TrimSpace(req.Message)
+		if n := utils.MeasureText("pinterest", message, 0); !n.Valid {
+			failed(http.StatusBadRequest, fmt.Sprintf("Description exceeds Pinterest's %d character limit (%d characters)", n.Limit, n.Length))
+			return
+		}
+		if req.Link != "" {
+			if u, err := url.Parse(req.Link); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				failed(http.StatusBadRequest, "link must be an http or https URL")
+				return
+			}
+		}
+
+		mediaItems, err := resolveMediaItems(db, userID, req.MediaUrls, req.Media)
+		if err != nil {
+			failed(http.StatusBadRequest, err.Error())
+			return
+		}
+		if len(mediaItems) == 0 {
+			failed(http.StatusBadRequest, "Pinterest pins require an image or video")
+			return
+		}
+		for i := range mediaItems {
+			if mediaItems[i].AltText == "" {
+				mediaItems[i].AltText = req.AltText
+			}
+			if utf8.RuneCountInString(mediaItems[i].AltText) > pinterestMaxAltTextChars {
+				failed(http.StatusBadRequest, fmt.Sprintf("Alt text exceeds Pinterest's %d character limit", pinterestMaxAltTextChars))
+				return
+			}
+		}
+
+		var video *models.MediaItem
+		for i := range mediaItems {
+			if isVideoURL(mediaItems[i].URL) {
+				video = &mediaItems[i]
+				break
+			}
+		}
+		if video != nil && (len(mediaImages(mediaItems)) != len(mediaItems)-1 || len(mediaItems) > 2) {
+			failed(http.StatusBadRequest, "Pinterest video pins take one video and at most one cover image")
+			return
+		}
+		if video == nil && len(mediaItems) > pinterestMaxImages {
+			failed(http.StatusBadRequest, fmt.Sprintf("Pinterest pins can include at most %d images", pinterestMaxImages))
+			return
+		}
+
+		accessToken, err := getPinterestAccessToken(db, userID)
+		if err == sql.ErrNoRows {
+			failed(http.StatusBadRequest, "Pinterest account not connected")
+			return
+		} else if err != nil {
+			failed(http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		pin := map[string]interface{}{"board_id": req.BoardID}
+		if title != "" {
+			pin["title"] = title
+		}
+		if message != "" {
+			pin["description"] = message
+		}
+		if req.Link != "" {
+			pin["link"] = req.Link
+		}
+
+		uid, _ := uuid.Parse(userID)
+		now := time.Now().UTC()
+		post := models.Post{
+			ID:        uuid.New(),
+			UserID:    uid,
+			Platform:  "pinterest",
+			Message:   message,
+			MediaURLs: mediaItemURLs(mediaItems),
+			Target:    req.BoardID,
+			PostedAt:  now,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+
+		if video != nil {
+			// An image sent alongside the video becomes its cover
+			coverURL := req.CoverImageURL
+			if coverURL == "" {
+				if images := mediaImages(mediaItems); len(images) > 0 {
+					coverURL = images[0].URL
+				}
+			}
+			if video.AltText != "" {
+				pin["alt_text"] = video.AltText
+			}
+
+			mediaID, err := uploadPinterestVideo(accessToken, video.URL)
+			if err != nil {
+				log.Printf("[Pinterest] Video upload failed for user %s: %v", userID, err)
+				failed(http.StatusBadGateway, fmt.Sprintf("Failed to upload video to Pinterest: %v", err))
+				return
+			}
+
+			post.PlatformPostID = mediaID
+			post.Status = "processing"
+			if err := models.SavePost(db, post); err != nil {
+				log.Printf("ERROR: Failed to save Pinterest post for user %s: %v", userID, err)
+			}
+
+			go finishPinterestVideoPin(db, userID, mediaID, coverURL, pin)
+
+			writePublishResult(w, http.StatusAccepted, PublishResult{
+				Platform: "pinterest",
+				Status:   "processing",
+				PostID:   mediaID,
+				Message:  fmt.Sprintf("Pinterest is processing the video. Check /api/pinterest/media/%s/status for progress.", mediaID),
+			})
+			return
+		}
+
+		pin["media_source"] = pinterestImageSource(mediaItems)
+		if len(mediaItems) == 1 && mediaItems[0].AltText != "" {
+			pin["alt_text"] = mediaItems[0].AltText
+		}
+
+		var created struct {
+			ID string `json:"id"`
+		}
+		if err := pinterestRequest(accessToken, "POST", "/pins", pin, &created); err != nil {
+			log.Printf("[Pinterest] Pin creation failed for user %s: %v", userID, err)
+			failed(http.StatusBadGateway, fmt.Sprintf("Failed to create Pinterest pin: %v", err))
+			return
+		}
+
+		post.PlatformPostID = created.ID
+		post.Status = "posted"
+		if err := models.SavePost(db, post); err != nil {
+			log.Printf("ERROR: Failed to save Pinterest post for user %s: %v", userID, err)
+		}
+
+		writePublishResult(w, http.StatusOK, PublishResult{
+			Platform: "pinterest",
+			Status:   "posted",
+			PostID:   created.ID,
+			URL:      pinterestPinURL(created.ID),
+			Message:  "Pinned to Pinterest successfully",
+		})
+	}
+}
+
+// GET /api/pinterest/media/{mediaId}/status
+func GetPinterestMediaStatusHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+		mediaID := mux.Vars(r)["mediaId"]
+
+		accessToken, err := getPinterestAccessToken(db, userID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Pinterest account not connected", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var media struct {
+			Status string `json:"status"`
+		}
+		if err := pinterestRequest(accessToken, "GET", "/media/"+url.PathEscape(mediaID), nil, &media); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to fetch Pinterest media status: %v", err), http.StatusBadGateway)
+			return
+		}
+
+		response := map[string]interface{}{
+			"mediaId":     mediaID,
+			"mediaStatus": media.Status,
+		}
+
+		// Once the pin exists the post row carries its ID instead of the media ID
+		var status string
+		err = db.QueryRow(`
+			SELECT status FROM posts
+			WHERE user_id = $1 AND platform = 'pinterest' AND platform_post_id = $2
+		`, userID, mediaID).Scan(&status)
+		switch {
+		case err == nil:
+			response["status"] = status
+		case err == sql.ErrNoRows && media.Status == "succeeded":
+			response["status"] = "posted"
+		case err == sql.ErrNoRows:
+			response["status"] = "failed"
+		default:
+			http.Error(w, "Failed to load Pinterest post", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func pinterestImageSource(items []models.MediaItem) map[string]interface{} {
+	if len(items) == 1 {
+		return map[string]interface{}{"source_type": "image_url", "url": items[0].URL}
+	}
+	images := make([]map[string]string, 0, len(items))
+	for _, item := range items {
+		image := map[string]string{"url": item.URL}
+		if item.AltText != "" {
+			// carousel items have no alt_text field; description is read out instead
+			image["description"] = item.AltText
+		}
+		images = append(images, image)
+	}
+	return map[string]interface{}{"source_type": "multiple_image_urls", "items": images}
+}
+
+// uploadPinterestVideo registers a media upload and sends the file to the
+// returned S3 form, returning the media ID to poll.
+func uploadPinterestVideo(accessToken, videoURL string) (string, error) {
+	var registered struct {
+		MediaID          string            `json:"media_id"`
+		UploadURL        string            `json:"upload_url"`
+		UploadParameters map[string]string `json:"upload_parameters"`
+	}
+	if err := pinterestRequest(accessToken, "POST", "/media", map[string]string{"media_type": "video"}, &registered); err != nil {
+		return "", err
+	}
+
+	video, size, err := bufferMedia(videoURL)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(video.Name())
+	defer video.Close()
+
+	// The S3 form needs a Content-Length, so the size of the multipart
+	// framing is measured with an empty file before the video is streamed
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	filename := path.Base(video.Name())
+	framing := &byteCounter{}
+	if err := writePinterestUploadForm(framing, boundary, registered.UploadParameters, filename, strings.NewReader("")); err != nil {
+		return "", err
+	}
+
+	body, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writePinterestUploadForm(pw, boundary, registered.UploadParameters, filename, video))
+	}()
+	defer body.Close()
+
+	req, err := http.NewRequest("POST", registered.UploadURL, body)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = framing.n + size
+	req.Header.Set("Content-Type", "multipart/form-data; boundary="+boundary)
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("video upload failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("video upload failed (status %d): %s", resp.StatusCode, respBody)
+	}
+	return registered.MediaID, nil
+}
+
+// finishPinterestVideoPin waits for Pinterest to process an uploaded video,
+// creates the pin and records the outcome on the post.
+func finishPinterestVideoPin(db *sql.DB, userID, mediaID, coverURL string, pin map[string]interface{}) {
+	fail := func() {
+		if err := models.UpdatePostStatus(db, "pinterest", mediaID, "failed"); err != nil {
+			log.Printf("[Pinterest] Failed to update post status: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(pinterestMediaPollFor)
+	for {
+		if time.Now().After(deadline) {
+			log.Printf("[Pinterest] Gave up waiting for media %s after %s", mediaID, pinterestMediaPollFor)
+			fail()
+			return
+		}
+		time.Sleep(pinterestMediaPollEvery)
+
+		accessToken, err := getPinterestAccessToken(db, userID)
+		if err != nil {
+			log.Printf("[Pinterest] Stopped tracking media %s: %v", mediaID, err)
+			fail()
+			return
+		}
+		var media struct {
+			Status string `json:"status"`
+		}
+		if err := pinterestRequest(accessToken, "GET", "/media/"+url.PathEscape(mediaID), nil, &media); err != nil {
+			log.Printf("[Pinterest] Status fetch failed for media %s: %v", mediaID, err)
+			continue
+		}
+		if media.Status == "failed" {
+			log.Printf("[Pinterest] Media %s failed processing", mediaID)
+			fail()
+			return
+		}
+		if media.Status != "succeeded" {
+			continue
+		}
+
+		source := map[string]interface{}{"source_type": "video_id", "media_id": mediaID}
+		if coverURL != "" {
+			source["cover_image_url"] = coverURL
+		} else {
+			source["cover_image_key_frame_time"] = 0
+		}
+		pin["media_source"] = source
+
+		var created struct {
+			ID string `json:"id"`
+		}
+		if err := pinterestRequest(accessToken, "POST", "/pins", pin, &created); err != nil {
+			log.Printf("[Pinterest] Pin creation failed for media %s: %v", mediaID, err)
+			fail()
+			return
+		}
+
+		_, err = db.Exec(`
+			UPDATE posts SET platform_post_id = $1, status = 'posted', posted_at = NOW(), updated_at = NOW()
+			WHERE platform = 'pinterest' AND platform_post_id = $2
+		`, created.ID, mediaID)
+		if err != nil {
+			log.Printf("[Pinterest] Failed to record pin %s for media %s: %v", created.ID, mediaID, err)
+		}
+		return
+	}
+}
+
+// writePinterestUploadForm writes the upload form: the parameters, which
+// must precede the file, then the file itself.
+func writePinterestUploadForm(w io.Writer, boundary string, params map[string]string, filename string, file io.Reader) error {
+	form := multipart.NewWriter(w)
+	if err := form.SetBoundary(boundary); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := form.WriteField(key, params[key]); err != nil {
+			return err
+		}
+	}
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return err
+	}
+	return form.Close()
+}
+
+// byteCounter is a writer that only counts what is written to it.
+type byteCounter struct {
+	n int64
+}
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+func pinterestPinURL(pinID string) string {
+	return fmt.Sprintf("https://www.pinterest.com/pin/%s/", pinID)
+}
+
+// deletePinterestPin deletes a pin.
+func deletePinterestPin(accessToken, pinID string) error {
+	return pinterestRequest(accessToken, "DELETE", "/pins/"+url.PathEscape(pinID), nil, nil)
+}
+
+// editPinterestPin replaces the description of a pin.
+func editPinterestPin(accessToken, pinID, description string) error {
+	if n := utils.MeasureText("pinterest", description, 0); !n.Valid {
+		return &postNotSupportedError{Message: fmt.Sprintf("Description exceeds Pinterest's %d character limit (%d characters)", n.Limit, n.Length)}
+	}
+	return pinterestRequest(accessToken, "PATCH", "/pins/"+url.PathEscape(pinID), map[string]interface{}{"description": description}, nil)
+}
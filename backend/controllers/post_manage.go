@@ -0,0 +1,716 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+	"social-sync-backend/utils"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const youtubeTitleLimit = 100
+
+// EditPostRequest is the new content of a published post. For YouTube the
+// message is the video title; description and tags are left as they are
+// unless given. For Reddit it is the body of a text post, since titles can't
+// be changed.
+type EditPostRequest struct {
+	Message     string    `json:"message"`
+	Description *string   `json:"description,omitempty"` // YouTube only
+	Tags        *[]string `json:"tags,omitempty"`        // YouTube only
+}
+
+// postNotSupportedError is returned for posts that can't be deleted or edited
+// in that way, e.g. because the platform's API doesn't offer it.
+type postNotSupportedError struct {
+	Message string
+}
+
+func (e *postNotSupportedError) Error() string { return e.Message }
+
+func notSupported(platform, action string) error {
+	return &postNotSupportedError{Message: fmt.Sprintf("%s posts can't be %s from SocialSync", platform, action)}
+}
+
+// notSupportedByAPI is notSupported for platforms whose API doesn't offer the
+// action.
+func notSupportedByAPI(platform, action string) error {
+	return &postNotSupportedError{Message: fmt.Sprintf("%s posts can't be %s from SocialSync; the %s API doesn't support it", platform, action, platform)}
+}
+
+// postAccountError means the account the post was published with can't be
+// used anymore.
+type postAccountError struct {
+	Message string
+}
+
+func (e *postAccountError) Error() string { return e.Message }
+
+// DELETE /api/posts/{id}
+// Deletes a post on its platform and marks it deleted. Deleting the first
+// segment of a thread deletes the whole thread, last reply first.
+func DeletePostHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		post, ok := loadManagedPost(w, db, userID, mux.Vars(r)["id"])
+		if !ok {
+			return
+		}
+		if post.Status == "deleted" || post.Status == "cancelled" {
+			http.Error(w, "Post was already deleted", http.StatusConflict)
+			return
+		}
+		if post.Status == "processing" {
+			http.Error(w, "Post is still being published; delete it once it's posted", http.StatusConflict)
+			return
+		}
+		if err := refreshScheduledPost(db, userID, post); err != nil {
+			log.Printf("[Posts] Failed to check scheduled post %s: %v", post.ID, err)
+			writePostActionError(w, post.Platform, err)
+			return
+		}
+
+		posts := []models.Post{*post}
+		if post.ThreadRootID != nil && *post.ThreadRootID == post.ID {
+			if posts, err = models.ListThreadPosts(db, post.ID); err != nil {
+				http.Error(w, "Failed to load thread", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		for i := len(posts) - 1; i >= 0; i-- {
+			p := posts[i]
+			if p.Status == "deleted" || p.Status == "cancelled" {
+				continue
+			}
+			if err := deletePlatformPost(db, userID, p); err != nil {
+				log.Printf("[Posts] Failed to delete %s post %s: %v", p.Platform, p.ID, err)
+				if len(posts) > 1 {
+					err = fmt.Errorf("thread segment %d: %w", i+1, err)
+				}
+				writePostActionError(w, p.Platform, err)
+				return
+			}
+			if err := models.SetPostStatus(db, p.ID, "deleted"); err != nil {
+				log.Printf("[Posts] Failed to mark post %s deleted: %v", p.ID, err)
+			}
+			recordPostHistory(db, p, models.PostHistoryDeleted, "")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// PATCH /api/posts/{id}
+// Edits the text of a post on its platform and stores the new text.
+func EditPostHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var req EditPostRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		req.Message = strings.TrimSpace(req.Message)
+		if req.Message == "" {
+			http.Error(w, "Message cannot be empty", http.StatusBadRequest)
+			return
+		}
+
+		post, ok := loadManagedPost(w, db, userID, mux.Vars(r)["id"])
+		if !ok {
+			return
+		}
+		if post.Status != "posted" && post.Status != "scheduled" {
+			http.Error(w, fmt.Sprintf("A %s post can't be edited", post.Status), http.StatusConflict)
+			return
+		}
+		if err := refreshScheduledPost(db, userID, post); err != nil {
+			log.Printf("[Posts] Failed to check scheduled post %s: %v", post.ID, err)
+			writePostActionError(w, post.Platform, err)
+			return
+		}
+		if (req.Description != nil || req.Tags != nil) && post.Platform != "youtube" {
+			http.Error(w, "description and tags can only be edited on YouTube videos", http.StatusBadRequest)
+			return
+		}
+
+		message, err := editPlatformPost(db, userID, *post, req)
+		if err != nil {
+			log.Printf("[Posts] Failed to edit %s post %s: %v", post.Platform, post.ID, err)
+			writePostActionError(w, post.Platform, err)
+			return
+		}
+
+		if err := models.UpdatePostMessage(db, post.ID, message); err != nil {
+			log.Printf("[Posts] Failed to store edit of post %s: %v", post.ID, err)
+		}
+		recordPostHistory(db, *post, models.PostHistoryEdited, message)
+
+		post.Message = message
+		post.UpdatedAt = time.Now().UTC()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(post)
+	}
+}
+
+// GET /api/posts/{id}/history
+func GetPostHistoryHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		post, ok := loadManagedPost(w, db, userID, mux.Vars(r)["id"])
+		if !ok {
+			return
+		}
+		history, err := models.ListPostHistory(db, post.ID)
+		if err != nil {
+			http.Error(w, "Failed to load post history", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(history)
+	}
+}
+
+// loadManagedPost loads the user's post, writing the error response if it
+// can't.
+func loadManagedPost(w http.ResponseWriter, db *sql.DB, userID, postID string) (*models.Post, bool) {
+	if _, err := uuid.Parse(postID); err != nil {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return nil, false
+	}
+	post, err := models.GetPost(db, userID, postID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		http.Error(w, "Failed to load post", http.StatusInternalServerError)
+		return nil, false
+	}
+	return post, true
+}
+
+// refreshScheduledPost brings a scheduled toot whose publish time has passed
+// up to date before it is changed. The instance publishes it under a new
+// status ID, which replaces the scheduled status ID on the post.
+func refreshScheduledPost(db *sql.DB, userID string, post *models.Post) error {
+	if post.Platform != "mastodon" || post.Status != "scheduled" || post.PostedAt.After(time.Now()) {
+		return nil
+	}
+	accessToken, socialID, err := postAccount(db, userID, "mastodon", true)
+	if err != nil {
+		return err
+	}
+	return resolveMastodonScheduledPost(db, accessToken, socialID, post)
+}
+
+func writePostActionError(w http.ResponseWriter, platform string, err error) {
+	var unsupported *postNotSupportedError
+	var account *postAccountError
+	switch {
+	case errors.As(err, &unsupported):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.As(err, &account):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, fmt.Sprintf("%s rejected the change: %v", platform, err), http.StatusBadGateway)
+	}
+}
+
+func recordPostHistory(db *sql.DB, post models.Post, action, message string) {
+	entry := models.PostHistoryEntry{
+		ID:              uuid.New(),
+		PostID:          post.ID,
+		UserID:          post.UserID,
+		Action:          action,
+		PreviousMessage: post.Message,
+		Message:         message,
+		CreatedAt:       time.Now().UTC(),
+	}
+	if err := models.SavePostHistoryEntry(db, entry); err != nil {
+		log.Printf("[Posts] Failed to record %s of post %s: %v", action, post.ID, err)
+	}
+}
+
+// postAccount returns the access token and social ID of the account a post
+// was published with.
+func postAccount(db *sql.DB, userID, platform string, checkExpiry bool) (string, string, error) {
+	var accessToken, socialID string
+	var expiresAt *time.Time
+	err := db.QueryRow(`
+		SELECT access_token, COALESCE(social_id, ''), access_token_expires_at
+		FROM social_accounts
+		WHERE user_id = $1 AND platform = $2
+	`, userID, platform).Scan(&accessToken, &socialID, &expiresAt)
+	if err == sql.ErrNoRows {
+		return "", "", &postAccountError{Message: fmt.Sprintf("%s account not connected", platform)}
+	} else if err != nil {
+		return "", "", err
+	}
+	if checkExpiry && expiresAt != nil && time.Now().After(*expiresAt) {
+		return "", "", &postAccountError{Message: fmt.Sprintf("%s access token has expired. Please reconnect your account.", platform)}
+	}
+	return accessToken, socialID, nil
+}
+
+func deletePlatformPost(db *sql.DB, userID string, post models.Post) error {
+	switch post.Platform {
+	case "facebook":
+		accessToken, _, err := postAccount(db, userID, "facebook", false)
+		if err != nil {
+			return err
+		}
+		form := url.Values{}
+		form.Set("access_token", accessToken)
+		return graphAPIRequest(http.MethodDelete, url.PathEscape(post.PlatformPostID), form, nil)
+
+	case "twitter":
+		accessToken, _, err := postAccount(db, userID, "twitter", true)
+		if err != nil {
+			return err
+		}
+		return deleteTweet(accessToken, post.PlatformPostID)
+
+	case "mastodon":
+		accessToken, socialID, err := postAccount(db, userID, "mastodon", true)
+		if err != nil {
+			return err
+		}
+		instanceURL, err := mastodonInstanceURL(socialID)
+		if err != nil {
+			return err
+		}
+		// Still waiting on the instance; refreshScheduledPost has swapped in
+		// the status ID of toots that were published
+		path := "/api/v1/statuses/"
+		if post.Status == "scheduled" {
+			path = "/api/v1/scheduled_statuses/"
+		}
+		return mastodonRequest(http.MethodDelete, instanceURL+path+url.PathEscape(post.PlatformPostID), accessToken, nil, nil)
+
+	case "telegram":
+		botToken, chatID, err := telegramPostBot(db, userID, post)
+		if err != nil {
+			return err
+		}
+		ids := make([]int, 0, 1+len(post.ExtraPlatformIDs))
+		for _, id := range append([]string{post.PlatformPostID}, post.ExtraPlatformIDs...) {
+			n, err := strconv.Atoi(id)
+			if err != nil {
+				return fmt.Errorf("invalid Telegram message ID %q", id)
+			}
+			ids = append(ids, n)
+		}
+		return lib.TelegramCall(botToken, "deleteMessages", map[string]interface{}{
+			"chat_id":     chatID,
+			"message_ids": ids,
+		}, nil)
+
+	case "youtube":
+		client, err := newYouTubeClient(db, userID)
+		if err == sql.ErrNoRows {
+			return &postAccountError{Message: "youtube account not connected"}
+		} else if err != nil {
+			return err
+		}
+		params := url.Values{}
+		params.Set("id", post.PlatformPostID)
+		return client.request(http.MethodDelete, "videos", params, nil, nil)
+
+	case "bluesky":
+		account, err := getBlueskyAccount(db, userID)
+		if err == sql.ErrNoRows {
+			return &postAccountError{Message: "bluesky account not connected"}
+		} else if err != nil {
+			return err
+		}
+		return deleteBlueskyPost(account, post.PlatformPostID)
+
+	case "linkedin":
+		account, err := getLinkedInAccount(db, userID)
+		if err != nil {
+			return &postAccountError{Message: err.Error()}
+		}
+		return deleteLinkedInPost(account.AccessToken, post.PlatformPostID)
+
+	case "reddit":
+		accessToken, err := redditPostToken(db, userID)
+		if err != nil {
+			return err
+		}
+		return deleteRedditPost(accessToken, post.PlatformPostID)
+
+	case "pinterest":
+		accessToken, err := pinterestPostToken(db, userID)
+		if err != nil {
+			return err
+		}
+		return deletePinterestPin(accessToken, post.PlatformPostID)
+
+	case "threads":
+		_, accessToken, err := getThreadsAccount(db, userID)
+		if err == sql.ErrNoRows {
+			return &postAccountError{Message: "threads account not connected"}
+		} else if err != nil {
+			return err
+		}
+		return threadsDelete("/v1.0/"+url.PathEscape(post.PlatformPostID), url.Values{"access_token": {accessToken}})
+
+	case "discord":
+		webhookURL, err := discordPostWebhook(db, userID, post)
+		if err != nil {
+			return err
+		}
+		return deleteDiscordMessage(webhookURL, post.PlatformPostID)
+
+	case "instagram", "tiktok":
+		return notSupportedByAPI(post.Platform, "deleted")
+
+	case "slack":
+		return &postNotSupportedError{Message: "Messages sent through a Slack incoming webhook can't be deleted or edited"}
+	}
+	return notSupported(post.Platform, "deleted")
+}
+
+// editPlatformPost changes the post on its platform and returns the message
+// to store for it.
+func editPlatformPost(db *sql.DB, userID string, post models.Post, req EditPostRequest) (string, error) {
+	switch post.Platform {
+	case "reddit":
+		accessToken, err := redditPostToken(db, userID)
+		if err != nil {
+			return "", err
+		}
+		return editRedditPost(accessToken, post.PlatformPostID, req.Message)
+	}
+	return req.Message, editPlatformPostText(db, userID, post, req)
+}
+
+// editPlatformPostText changes the text of the post to req.Message.
+func editPlatformPostText(db *sql.DB, userID string, post models.Post, req EditPostRequest) error {
+	switch post.Platform {
+	case "facebook":
+		accessToken, _, err := postAccount(db, userID, "facebook", false)
+		if err != nil {
+			return err
+		}
+		if n := utf8.RuneCountInString(req.Message); n > utils.PlatformTextLimits["facebook"] {
+			return &postNotSupportedError{Message: fmt.Sprintf("Message exceeds Facebook's %d character limit", utils.PlatformTextLimits["facebook"])}
+		}
+		form := url.Values{}
+		form.Set("access_token", accessToken)
+		// Feed posts are "<page>_<post>"; videos and Reels have plain IDs and a description
+		if strings.Contains(post.PlatformPostID, "_") {
+			form.Set("message", req.Message)
+		} else {
+			form.Set("description", req.Message)
+		}
+		return graphAPIRequest(http.MethodPost, url.PathEscape(post.PlatformPostID), form, nil)
+
+	case "mastodon":
+		if post.Status == "scheduled" {
+			return &postNotSupportedError{Message: "Scheduled Mastodon posts can't be edited; delete and schedule it again"}
+		}
+		accessToken, socialID, err := postAccount(db, userID, "mastodon", true)
+		if err != nil {
+			return err
+		}
+		instanceURL, err := mastodonInstanceURL(socialID)
+		if err != nil {
+			return err
+		}
+		return editMastodonStatus(instanceURL, accessToken, post.PlatformPostID, req.Message)
+
+	case "telegram":
+		if len(post.ExtraPlatformIDs) > 0 {
+			return &postNotSupportedError{Message: "This Telegram post was sent as several messages and can't be edited"}
+		}
+		botToken, chatID, err := telegramPostBot(db, userID, post)
+		if err != nil {
+			return err
+		}
+		messageID, err := strconv.Atoi(post.PlatformPostID)
+		if err != nil {
+			return fmt.Errorf("invalid Telegram message ID %q", post.PlatformPostID)
+		}
+		method, field, limit := "editMessageText", "text", utils.PlatformTextLimits["telegram"]
+		if len(post.MediaURLs) > 0 {
+			method, field, limit = "editMessageCaption", "caption", telegramCaptionLimit
+		}
+		if n := utils.TelegramTextLength(req.Message); n > limit {
+			return &postNotSupportedError{Message: fmt.Sprintf("Message exceeds Telegram's %d character limit for this post (%d characters)", limit, n)}
+		}
+		return lib.TelegramCall(botToken, method, map[string]interface{}{
+			"chat_id":    chatID,
+			"message_id": messageID,
+			field:        utils.TelegramHTML(req.Message),
+			"parse_mode": "HTML",
+		}, nil)
+
+	case "youtube":
+		client, err := newYouTubeClient(db, userID)
+		if err == sql.ErrNoRows {
+			return &postAccountError{Message: "youtube account not connected"}
+		} else if err != nil {
+			return err
+		}
+		return updateYouTubeVideo(client, post.PlatformPostID, req)
+
+	case "linkedin":
+		account, err := getLinkedInAccount(db, userID)
+		if err != nil {
+			return &postAccountError{Message: err.Error()}
+		}
+		return editLinkedInPost(account.AccessToken, post.PlatformPostID, req.Message)
+
+	case "pinterest":
+		accessToken, err := pinterestPostToken(db, userID)
+		if err != nil {
+			return err
+		}
+		return editPinterestPin(accessToken, post.PlatformPostID, req.Message)
+
+	case "discord":
+		webhookURL, err := discordPostWebhook(db, userID, post)
+		if err != nil {
+			return err
+		}
+		return editDiscordMessage(webhookURL, post.PlatformPostID, req.Message)
+
+	case "twitter", "instagram", "tiktok", "bluesky", "threads":
+		return notSupportedByAPI(post.Platform, "edited")
+
+	case "slack":
+		return &postNotSupportedError{Message: "Messages sent through a Slack incoming webhook can't be deleted or edited"}
+	}
+	return notSupported(post.Platform, "edited")
+}
+
+// redditPostToken returns the access token for changing a Reddit post.
+func redditPostToken(db *sql.DB, userID string) (string, error) {
+	accessToken, err := getRedditAccessToken(db, userID)
+	if err == sql.ErrNoRows {
+		return "", &postAccountError{Message: "reddit account not connected"}
+	} else if err != nil {
+		return "", &postAccountError{Message: err.Error()}
+	}
+	return accessToken, nil
+}
+
+// pinterestPostToken returns the access token for changing a pin.
+func pinterestPostToken(db *sql.DB, userID string) (string, error) {
+	accessToken, err := getPinterestAccessToken(db, userID)
+	if err == sql.ErrNoRows {
+		return "", &postAccountError{Message: "pinterest account not connected"}
+	} else if err != nil {
+		return "", &postAccountError{Message: err.Error()}
+	}
+	return accessToken, nil
+}
+
+// discordPostWebhook returns the webhook a Discord post was sent through.
+// Posts saved without a message ID can't be changed.
+func discordPostWebhook(db *sql.DB, userID string, post models.Post) (string, error) {
+	if post.PlatformPostID == "" {
+		return "", &postNotSupportedError{Message: "Discord didn't report the ID of this message, so it can't be changed"}
+	}
+	webhookURL, err := getWebhookURL(db, userID, "discord")
+	if err == sql.ErrNoRows {
+		return "", &postAccountError{Message: "discord webhook not connected"}
+	} else if err != nil {
+		return "", &postAccountError{Message: err.Error()}
+	}
+	return webhookURL, nil
+}
+
+// deleteTweet deletes a tweet with the user's OAuth 2.0 token.
+func deleteTweet(accessToken, tweetID string) error {
+	req, err := http.NewRequest(http.MethodDelete, "https://api.twitter.com/2/tweets/"+url.PathEscape(tweetID), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("Twitter API error %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// mastodonRequest calls the Mastodon API with a JSON body and decodes the
+// response into out if set. API failures are returned as a *mastodonAPIError.
+func mastodonRequest(method, endpoint, accessToken string, body, out interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, endpoint, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errorResp MastodonErrorResponse
+		json.NewDecoder(resp.Body).Decode(&errorResp)
+		if errorResp.Error != "" {
+			return &mastodonAPIError{Status: resp.StatusCode, Message: "Mastodon API error: " + errorResp.Error}
+		}
+		return &mastodonAPIError{Status: resp.StatusCode, Message: fmt.Sprintf("Mastodon API error (status: %d)", resp.StatusCode)}
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// editMastodonStatus replaces the text of a status, keeping its media,
+// content warning and language.
+func editMastodonStatus(instanceURL, accessToken, statusID, message string) error {
+	statusURL := instanceURL + "/api/v1/statuses/" + url.PathEscape(statusID)
+	var current struct {
+		SpoilerText     string `json:"spoiler_text"`
+		Sensitive       bool   `json:"sensitive"`
+		Language        string `json:"language"`
+		MediaAttachment []struct {
+			ID string `json:"id"`
+		} `json:"media_attachments"`
+	}
+	if err := mastodonRequest(http.MethodGet, statusURL, accessToken, nil, &current); err != nil {
+		return err
+	}
+
+	instance := getMastodonInstanceConfig(instanceURL)
+	if n := utils.MastodonTextLength(message) + utils.MastodonTextLength(current.SpoilerText); n > instance.MaxCharacters {
+		return &postNotSupportedError{Message: fmt.Sprintf("Message exceeds the instance's %d character limit (%d characters with the content warning)", instance.MaxCharacters, n)}
+	}
+
+	mediaIDs := make([]string, 0, len(current.MediaAttachment))
+	for _, m := range current.MediaAttachment {
+		mediaIDs = append(mediaIDs, m.ID)
+	}
+	payload := map[string]interface{}{
+		"status":       message,
+		"spoiler_text": current.SpoilerText,
+		"sensitive":    current.Sensitive,
+		"media_ids":    mediaIDs,
+	}
+	if current.Language != "" {
+		payload["language"] = current.Language
+	}
+	return mastodonRequest(http.MethodPut, statusURL, accessToken, payload, nil)
+}
+
+// telegramPostBot returns the bot and chat a Telegram post was sent with.
+func telegramPostBot(db *sql.DB, userID string, post models.Post) (string, string, error) {
+	botToken, err := telegramBotTokenForUser(db, userID)
+	if err != nil {
+		return "", "", err
+	}
+	if botToken == "" {
+		return "", "", errors.New("Telegram bot token not set")
+	}
+	chatID := post.Target
+	if chatID == "" {
+		// Posts from before the chat was recorded went to the connected chat
+		if _, chatID, err = postAccount(db, userID, "telegram", false); err != nil {
+			return "", "", err
+		}
+	}
+	return botToken, chatID, nil
+}
+
+// updateYouTubeVideo changes the title, and optionally the description and
+// tags, of a video. videos.update replaces the whole snippet, so the current
+// one is read first.
+func updateYouTubeVideo(client *youtubeClient, videoID string, req EditPostRequest) error {
+	if n := utf8.RuneCountInString(req.Message); n > youtubeTitleLimit {
+		return &postNotSupportedError{Message: fmt.Sprintf("YouTube titles can be at most %d characters (%d characters)", youtubeTitleLimit, n)}
+	}
+
+	params := url.Values{}
+	params.Set("part", "snippet")
+	params.Set("id", videoID)
+	var res struct {
+		Items []struct {
+			Snippet struct {
+				Title           string   `json:"title"`
+				Description     string   `json:"description"`
+				Tags            []string `json:"tags,omitempty"`
+				CategoryID      string   `json:"categoryId"`
+				DefaultLanguage string   `json:"defaultLanguage,omitempty"`
+			} `json:"snippet"`
+		} `json:"items"`
+	}
+	if err := client.request(http.MethodGet, "videos", params, nil, &res); err != nil {
+		return err
+	}
+	if len(res.Items) == 0 {
+		return errors.New("video not found on YouTube")
+	}
+
+	snippet := res.Items[0].Snippet
+	snippet.Title = req.Message
+	if req.Description != nil {
+		snippet.Description = *req.Description
+	}
+	if req.Tags != nil {
+		snippet.Tags = *req.Tags
+	}
+	params.Del("id")
+	body := map[string]interface{}{"id": videoID, "snippet": snippet}
+	return client.request(http.MethodPut, "videos", params, body, nil)
+}
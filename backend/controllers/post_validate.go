@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"social-sync-backend/middleware"
+	"social-sync-backend/utils"
+)
+
+type ValidatePostRequest struct {
+	Message   string   `json:"message"`
+	Platforms []string `json:"platforms"`
+	ThreadOptions
+}
+
+// PlatformValidation is the composer's view of a message on one platform.
+// Segments is set when the message is (or would be) posted as a thread.
+type PlatformValidation struct {
+	utils.TextLength
+	Segments []utils.TextLength `json:"segments,omitempty"`
+}
+
+// ValidatePostHandler measures a draft against each platform's length rules so
+// the composer can show live remaining counts.
+func ValidatePostHandler(w http.ResponseWriter, r *http.Request) {
+	if _, err := middleware.GetUserIDFromContext(r); err != nil {
+		http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req ValidatePostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	platforms := req.Platforms
+	if len(platforms) == 0 {
+		for p := range utils.PlatformTextLimits {
+			platforms = append(platforms, p)
+		}
+	}
+
+	message := strings.TrimSpace(req.Message)
+	results := make(map[string]PlatformValidation, len(platforms))
+	for _, platform := range platforms {
+		platform = strings.ToLower(strings.TrimSpace(platform))
+		if _, ok := utils.PlatformTextLimits[platform]; !ok {
+			http.Error(w, "Unsupported platform: "+platform, http.StatusBadRequest)
+			return
+		}
+
+		result := PlatformValidation{TextLength: utils.MeasureText(platform, message, 0)}
+
+		var texts []string
+		switch {
+		case len(req.Thread) > 0:
+			texts = req.Thread
+		case req.AutoThread && !result.Valid && platform == "telegram":
+			// Telegram overflow is split the way PostToTelegram sends it
+			texts = utils.SplitTelegramMarkdown(message, result.Limit)
+		case req.AutoThread && !result.Valid:
+			texts = utils.SplitThread(message, result.Limit, req.Numbering, utils.TextLengthFor(platform))
+		}
+		if len(texts) > 0 {
+			result.Valid = true
+			for _, t := range texts {
+				seg := utils.MeasureText(platform, strings.TrimSpace(t), 0)
+				result.Segments = append(result.Segments, seg)
+				result.Valid = result.Valid && seg.Valid
+			}
+		}
+
+		results[platform] = result
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results": results,
+	})
+}
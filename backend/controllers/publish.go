@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// PublishResult is the response body of the Facebook, Instagram, YouTube,
+// Telegram, Reddit and Pinterest publish handlers. It is not yet used by the
+// other platforms, whose handlers answer with their own fields and report
+// failures as plain text.
+type PublishResult struct {
+	Platform string `json:"platform"`
+	Status   string `json:"status"` // posted, scheduled, processing or failed
+	PostID   string `json:"postId,omitempty"`
+	URL      string `json:"url,omitempty"`
+	JobID    string `json:"jobId,omitempty"` // background job that finishes the publish
+	Message  string `json:"message"`
+
+	Error *PublishError `json:"error,omitempty"`
+}
+
+// PublishError describes why a publish failed in a form the client can act on,
+// e.g. by retrying after a platform rate limit clears.
+type PublishError struct {
+	Code       string `json:"code"`
+	Retryable  bool   `json:"retryable"`
+	RetryAfter int    `json:"retryAfter,omitempty"` // seconds
+}
+
+func writePublishResult(w http.ResponseWriter, status int, result PublishResult) {
+	if result.Error != nil && result.Error.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(result.Error.RetryAfter))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"social-sync-backend/middleware"
+	"social-sync-backend/utils"
+
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+const redditAPIURL = "https://oauth.reddit.com"
+
+var redditStates = make(map[string]string) // state -> user_id
+
+// Reddit rejects requests without a descriptive User-Agent, including the
+// token endpoint, so every client used for Reddit goes through this transport.
+type redditTransport struct{}
+
+func (redditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", redditUserAgent())
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func redditUserAgent() string {
+	if ua := os.Getenv("REDDIT_USER_AGENT"); ua != "" {
+		return ua
+	}
+	return "web:social-sync:v1.0"
+}
+
+func redditHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: redditTransport{}}
+}
+
+func redditContext() context.Context {
+	return context.WithValue(context.Background(), oauth2.HTTPClient, redditHTTPClient(30*time.Second))
+}
+
+// getRedditOAuthConfig returns OAuth2 config for Reddit
+func getRedditOAuthConfig() *oauth2.Config {
+	redirectURL := utils.GetCallbackURL("reddit")
+	if redirectURL == "" {
+		log.Fatal("REDDIT_REDIRECT_URL is empty!")
+	}
+
+	return &oauth2.Config{
+		ClientID:     os.Getenv("REDDIT_CLIENT_ID"),
+		ClientSecret: os.Getenv("REDDIT_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"identity", "submit", "flair", "read", "mysubreddits"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   "https://www.reddit.com/api/v1/authorize",
+			TokenURL:  "https://www.reddit.com/api/v1/access_token",
+			AuthStyle: oauth2.AuthStyleInHeader,
+		},
+	}
+}
+
+// RedditRedirectHandler initiates the OAuth flow and redirects to Reddit auth page
+func RedditRedirectHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		config := getRedditOAuthConfig()
+
+		appUserIDStr, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated.", http.StatusUnauthorized)
+			return
+		}
+		if _, err := uuid.Parse(appUserIDStr); err != nil {
+			http.Error(w, "Invalid user ID format.", http.StatusInternalServerError)
+			return
+		}
+
+		state := generateState()
+		redditStates[state] = appUserIDStr
+
+		// duration=permanent is what makes Reddit issue a refresh token
+		authURL := config.AuthCodeURL(state, oauth2.SetAuthURLParam("duration", "permanent"))
+		http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
+	}
+}
+
+// RedditCallbackHandler handles Reddit OAuth callback, fetches the account, saves to DB, then redirects frontend
+func RedditCallbackHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		state := r.URL.Query().Get("state")
+		appUserIDStr, exists := redditStates[state]
+		if state == "" || !exists {
+			http.Error(w, "Invalid or expired state parameter", http.StatusBadRequest)
+			return
+		}
+		delete(redditStates, state)
+
+		code := r.URL.Query().Get("code")
+		if code == "" {
+			redirectURL := fmt.Sprintf("%s/home/manage-accounts?error=reddit", utils.GetFrontendURL())
+			http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+			return
+		}
+
+		config := getRedditOAuthConfig()
+		token, err := config.Exchange(redditContext(), code)
+		if err != nil {
+			http.Error(w, "Token exchange failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if token.RefreshToken == "" {
+			http.Error(w, "Reddit did not grant a refresh token", http.StatusInternalServerError)
+			return
+		}
+
+		var me struct {
+			ID      string `json:"id"`
+			Name    string `json:"name"`
+			IconImg string `json:"icon_img"`
+		}
+		if err := redditRequest(token.AccessToken, "GET", "/api/v1/me", nil, &me); err != nil {
+			http.Error(w, "Failed to fetch user info: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Reddit returns HTML-escaped URLs in JSON
+		avatar := html.UnescapeString(me.IconImg)
+
+		_, err = db.Exec(`
+			INSERT INTO social_accounts (
+				user_id, platform, social_id, access_token, access_token_expires_at,
+				refresh_token, profile_picture_url, profile_name, connected_at
+			) VALUES (
+				$1, 'reddit', $2, $3, $4, $5, $6, $7, NOW()
+			)
+			ON CONFLICT (user_id, platform) DO UPDATE SET
+				access_token = EXCLUDED.access_token,
+				access_token_expires_at = EXCLUDED.access_token_expires_at,
+				refresh_token = EXCLUDED.refresh_token,
+				social_id = EXCLUDED.social_id,
+				profile_picture_url = EXCLUDED.profile_picture_url,
+				profile_name = EXCLUDED.profile_name,
+				connected_at = NOW()
+		`,
+			appUserIDStr,
+			me.ID,
+			token.AccessToken,
+			token.Expiry,
+			token.RefreshToken,
+			avatar,
+			"u/"+me.Name,
+		)
+		if err != nil {
+			http.Error(w, "Failed to save Reddit account: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		redirectURL := fmt.Sprintf("%s/home/manage-accounts?connected=reddit", utils.GetFrontendURL())
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+	}
+}
+
+// getRedditAccessToken returns a valid access token. Reddit access tokens last
+// an hour; the permanent refresh token is used to get a new one.
+func getRedditAccessToken(db *sql.DB, userID string) (string, error) {
+	var accessToken string
+	var expiresAt *time.Time
+	var refreshToken *string
+	err := db.QueryRow(`
+		SELECT access_token, access_token_expires_at, refresh_token
+		FROM social_accounts
+		WHERE user_id = $1 AND platform = 'reddit'
+	`, userID).Scan(&accessToken, &expiresAt, &refreshToken)
+	if err != nil {
+		return "", err
+	}
+	if expiresAt != nil && time.Now().Add(time.Minute).Before(*expiresAt) {
+		return accessToken, nil
+	}
+	if refreshToken == nil || *refreshToken == "" {
+		return "", fmt.Errorf("Reddit access token has expired. Please reconnect your account.")
+	}
+
+	old := &oauth2.Token{AccessToken: accessToken, RefreshToken: *refreshToken, Expiry: time.Now().Add(-time.Minute)}
+	token, err := getRedditOAuthConfig().TokenSource(redditContext(), old).Token()
+	if err != nil {
+		return "", fmt.Errorf("Reddit access token could not be refreshed. Please reconnect your account.")
+	}
+
+	_, err = db.Exec(`
+		UPDATE social_accounts
+		SET access_token = $1, access_token_expires_at = $2, last_synced_at = NOW()
+		WHERE user_id = $3 AND platform = 'reddit'
+	`, token.AccessToken, token.Expiry, userID)
+	if err != nil {
+		log.Printf("[Reddit] Failed to store refreshed token for user %s: %v", userID, err)
+	}
+	return token.AccessToken, nil
+}
+
+// redditAPIError is a non-2xx response from the Reddit API.
+type redditAPIError struct {
+	Status     int
+	Body       string
+	RetryAfter int // seconds, from the rate limit headers
+}
+
+func (e *redditAPIError) Error() string {
+	return fmt.Sprintf("Reddit API error (status %d): %s", e.Status, e.Body)
+}
+
+// redditRequest calls the OAuth API. Bodies are form-encoded, as Reddit's
+// write endpoints expect, and the response is decoded into out.
+func redditRequest(accessToken, method, path string, form url.Values, out interface{}) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, redditAPIURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := redditHTTPClient(30 * time.Second).Do(req)
+	if err != nil {
+		return fmt.Errorf("Reddit request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := &redditAPIError{Status: resp.StatusCode, Body: strings.TrimSpace(string(respBody))}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			var reset float64
+			fmt.Sscanf(resp.Header.Get("X-Ratelimit-Reset"), "%g", &reset)
+			apiErr.RetryAfter = int(reset)
+		}
+		return apiErr
+	}
+	if out != nil && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("unexpected response from Reddit: %v", err)
+		}
+	}
+	return nil
+}
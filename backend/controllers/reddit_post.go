@@ -0,0 +1,686 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+	"social-sync-backend/utils"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	redditMaxTitleChars    = 300
+	redditMaxSubreddits    = 500 // stop paging the subscription list here
+	redditMaxImageBytes    = 20 * 1024 * 1024
+	redditDefaultRateLimit = 60 // seconds to wait when Reddit does not say
+	redditSubmitPollEvery  = 5 * time.Second
+	redditSubmitPollFor    = 5 * time.Minute
+)
+
+var (
+	subredditNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_]{1,20}$`)
+	redditWaitPattern    = regexp.MustCompile(`(\d+)\s+(second|minute|hour)s?`)
+)
+
+type RedditSubreddit struct {
+	Name           string `json:"name"`
+	Title          string `json:"title"`
+	Icon           string `json:"icon,omitempty"`
+	SubmissionType string `json:"submissionType"` // any, link or self
+	AllowImages    bool   `json:"allowImages"`
+	Over18         bool   `json:"over18"`
+}
+
+type RedditFlair struct {
+	ID           string `json:"id"`
+	Text         string `json:"text"`
+	TextEditable bool   `json:"textEditable"`
+	Background   string `json:"backgroundColor,omitempty"`
+	TextColor    string `json:"textColor,omitempty"`
+}
+
+type RedditPostRequest struct {
+	Subreddit   string             `json:"subreddit"`
+	Title       string             `json:"title"`
+	Message     string             `json:"message,omitempty"` // self post body
+	Link        string             `json:"link,omitempty"`
+	MediaUrls   []string           `json:"mediaUrls,omitempty"`
+	Media       []models.MediaItem `json:"media,omitempty"`
+	FlairID     string             `json:"flairId,omitempty"`
+	FlairText   string             `json:"flairText,omitempty"` // only for editable flairs
+	NSFW        bool               `json:"nsfw,omitempty"`
+	Spoiler     bool               `json:"spoiler,omitempty"`
+	SendReplies *bool              `json:"sendReplies,omitempty"` // defaults to true
+}
+
+// redditSubmitError is one entry of the errors list Reddit returns with a 200
+// from /api/submit, e.g. ["SUBREDDIT_NOTALLOWED", "you aren't allowed to post there.", "sr"].
+type redditSubmitError struct {
+	Code    string
+	Message string
+	Field   string
+}
+
+func (e *redditSubmitError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// redditJSONError returns the first entry of an api_type=json errors list,
+// or nil if there is none.
+func redditJSONError(errs [][]string) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	e := errs[0]
+	submitErr := &redditSubmitError{}
+	if len(e) > 0 {
+		submitErr.Code = e[0]
+	}
+	if len(e) > 1 {
+		submitErr.Message = e[1]
+	}
+	if len(e) > 2 {
+		submitErr.Field = e[2]
+	}
+	return submitErr
+}
+
+// GET /api/reddit/subreddits
+// Lists the subreddits the account is subscribed to, for the subreddit picker.
+func GetRedditSubredditsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		accessToken, err := getRedditAccessToken(db, userID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Reddit account not connected", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		subreddits := []RedditSubreddit{}
+		after := ""
+		for len(subreddits) < redditMaxSubreddits {
+			query := url.Values{"limit": {"100"}, "raw_json": {"1"}}
+			if after != "" {
+				query.Set("after", after)
+			}
+			var listing struct {
+				Data struct {
+					After    string `json:"after"`
+					Children []struct {
+						Data struct {
+							DisplayName    string `json:"display_name"`
+							Title          string `json:"title"`
+							IconImg        string `json:"icon_img"`
+							CommunityIcon  string `json:"community_icon"`
+							SubmissionType string `json:"submission_type"`
+							AllowImages    bool   `json:"allow_images"`
+							Over18         bool   `json:"over18"`
+						} `json:"data"`
+					} `json:"children"`
+				} `json:"data"`
+			}
+			if err := redditRequest(accessToken, "GET", "/subreddits/mine/subscriber?"+query.Encode(), nil, &listing); err != nil {
+				log.Printf("[Reddit] Failed to list subreddits for user %s: %v", userID, err)
+				http.Error(w, fmt.Sprintf("Failed to fetch subreddits: %v", err), http.StatusBadGateway)
+				return
+			}
+			for _, child := range listing.Data.Children {
+				sr := child.Data
+				icon := sr.CommunityIcon
+				if icon == "" {
+					icon = sr.IconImg
+				}
+				subreddits = append(subreddits, RedditSubreddit{
+					Name:           sr.DisplayName,
+					Title:          sr.Title,
+					Icon:           icon,
+					SubmissionType: sr.SubmissionType,
+					AllowImages:    sr.AllowImages,
+					Over18:         sr.Over18,
+				})
+			}
+			if listing.Data.After == "" {
+				break
+			}
+			after = listing.Data.After
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"subreddits": subreddits})
+	}
+}
+
+// GET /api/reddit/subreddits/{subreddit}/flairs
+func GetRedditFlairsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+		subreddit := normalizeSubreddit(mux.Vars(r)["subreddit"])
+		if !subredditNamePattern.MatchString(subreddit) {
+			http.Error(w, "Invalid subreddit name", http.StatusBadRequest)
+			return
+		}
+
+		accessToken, err := getRedditAccessToken(db, userID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Reddit account not connected", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var raw []struct {
+			ID              string `json:"id"`
+			Text            string `json:"text"`
+			TextEditable    bool   `json:"text_editable"`
+			BackgroundColor string `json:"background_color"`
+			TextColor       string `json:"text_color"`
+		}
+		err = redditRequest(accessToken, "GET", "/r/"+subreddit+"/api/link_flair_v2?raw_json=1", nil, &raw)
+		var apiErr *redditAPIError
+		// Subreddits without link flair answer 403
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusForbidden {
+			err = nil
+		}
+		if err != nil {
+			log.Printf("[Reddit] Failed to fetch flairs for r/%s: %v", subreddit, err)
+			http.Error(w, fmt.Sprintf("Failed to fetch flairs: %v", err), http.StatusBadGateway)
+			return
+		}
+
+		flairs := make([]RedditFlair, 0, len(raw))
+		for _, f := range raw {
+			flairs = append(flairs, RedditFlair{
+				ID:           f.ID,
+				Text:         html.UnescapeString(f.Text),
+				TextEditable: f.TextEditable,
+				Background:   f.BackgroundColor,
+				TextColor:    f.TextColor,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"subreddit": subreddit, "flairs": flairs})
+	}
+}
+
+// POST /api/reddit/post
+// Submits a link, text or image post to one subreddit. Failures are reported
+// as a PublishResult with an error code; rate limits are marked retryable.
+func PostToRedditHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var req RedditPostRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		invalid := func(message string) {
+			writePublishResult(w, http.StatusBadRequest, PublishResult{
+				Platform: "reddit",
+				Status:   "failed",
+				Message:  message,
+				Error:    &PublishError{Code: "INVALID_REQUEST"},
+			})
+		}
+
+		subreddit := normalizeSubreddit(req.Subreddit)
+		if !subredditNamePattern.MatchString(subreddit) {
+			invalid("A valid subreddit is required")
+			return
+		}
+		title := strings.TrimSpace(req.Title)
+		if title == "" {
+			invalid("Reddit posts require a title")
+			return
+		}
+		if utf8.RuneCountInString(title) > redditMaxTitleChars {
+			invalid(fmt.Sprintf("Title exceeds Reddit's %d character limit", redditMaxTitleChars))
+			return
+		}
+		message := strings.TrimSpace(req.Message)
+		if n := utils.MeasureText("reddit", message, 0); !n.Valid {
+			invalid(fmt.Sprintf("Post body exceeds Reddit's %d character limit (%d characters)", n.Limit, n.Length))
+			return
+		}
+
+		mediaItems, err := resolveMediaItems(db, userID, req.MediaUrls, req.Media)
+		if err != nil {
+			invalid(err.Error())
+			return
+		}
+
+		form := url.Values{
+			"api_type": {"json"},
+			"sr":       {subreddit},
+			"title":    {title},
+		}
+		switch {
+		case req.Link != "":
+			if u, err := url.Parse(req.Link); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				invalid("link must be an http or https URL")
+				return
+			}
+			if len(mediaItems) > 0 || message != "" {
+				invalid("Link posts cannot include media or body text")
+				return
+			}
+			form.Set("kind", "link")
+			form.Set("url", req.Link)
+			form.Set("resubmit", "true")
+		case len(mediaItems) > 0:
+			if len(mediaItems) > 1 || isVideoURL(mediaItems[0].URL) {
+				invalid("Reddit image posts take a single image")
+				return
+			}
+			if message != "" {
+				invalid("Image posts cannot include body text")
+				return
+			}
+			form.Set("kind", "image")
+		default:
+			form.Set("kind", "self")
+			form.Set("text", message)
+		}
+		if req.FlairID != "" {
+			form.Set("flair_id", req.FlairID)
+			if req.FlairText != "" {
+				form.Set("flair_text", req.FlairText)
+			}
+		}
+		form.Set("nsfw", strconv.FormatBool(req.NSFW))
+		form.Set("spoiler", strconv.FormatBool(req.Spoiler))
+		form.Set("sendreplies", strconv.FormatBool(req.SendReplies == nil || *req.SendReplies))
+
+		accessToken, err := getRedditAccessToken(db, userID)
+		if err == sql.ErrNoRows {
+			invalid("Reddit account not connected")
+			return
+		} else if err != nil {
+			writePublishResult(w, http.StatusUnauthorized, PublishResult{
+				Platform: "reddit",
+				Status:   "failed",
+				Message:  err.Error(),
+				Error:    &PublishError{Code: "AUTH_EXPIRED"},
+			})
+			return
+		}
+
+		if form.Get("kind") == "image" {
+			imageURL, err := uploadRedditImage(accessToken, mediaItems[0].URL)
+			if err != nil {
+				log.Printf("[Reddit] Image upload failed for user %s: %v", userID, err)
+				status, result := redditPublishError(err)
+				writePublishResult(w, status, result)
+				return
+			}
+			form.Set("url", imageURL)
+		}
+
+		var submitted struct {
+			JSON struct {
+				Errors [][]string `json:"errors"`
+				Data   struct {
+					Name              string `json:"name"` // t3_<id>
+					URL               string `json:"url"`
+					UserSubmittedPage string `json:"user_submitted_page"`
+				} `json:"data"`
+			} `json:"json"`
+		}
+		err = redditRequest(accessToken, "POST", "/api/submit", form, &submitted)
+		if err == nil {
+			err = redditJSONError(submitted.JSON.Errors)
+		}
+		if err != nil {
+			log.Printf("[Reddit] Submission to r/%s failed for user %s: %v", subreddit, userID, err)
+			status, result := redditPublishError(err)
+			writePublishResult(w, status, result)
+			return
+		}
+
+		uid, _ := uuid.Parse(userID)
+		now := time.Now().UTC()
+		post := models.Post{
+			ID:             uuid.New(),
+			UserID:         uid,
+			Platform:       "reddit",
+			PlatformPostID: submitted.JSON.Data.Name,
+			Message:        redditPostMessage(title, message, req.Link),
+			MediaURLs:      mediaItemURLs(mediaItems),
+			Target:         subreddit,
+			PostedAt:       now,
+			Status:         "posted",
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+
+		// Image submissions are created asynchronously and only report the
+		// user's submitted page; the submission is looked up once it exists.
+		if post.PlatformPostID == "" {
+			post.Status = "processing"
+			if err := models.SavePost(db, post); err != nil {
+				log.Printf("ERROR: Failed to save Reddit post for user %s: %v", userID, err)
+			}
+
+			go finishRedditImagePost(db, userID, post.ID, subreddit, title, now)
+
+			writePublishResult(w, http.StatusAccepted, PublishResult{
+				Platform: "reddit",
+				Status:   "processing",
+				URL:      submitted.JSON.Data.UserSubmittedPage,
+				Message:  fmt.Sprintf("Reddit is processing the image post to r/%s", subreddit),
+			})
+			return
+		}
+
+		if err := models.SavePost(db, post); err != nil {
+			log.Printf("ERROR: Failed to save Reddit post for user %s: %v", userID, err)
+		}
+
+		writePublishResult(w, http.StatusOK, PublishResult{
+			Platform: "reddit",
+			Status:   "posted",
+			PostID:   post.PlatformPostID,
+			URL:      submitted.JSON.Data.URL,
+			Message:  fmt.Sprintf("Posted to r/%s successfully", subreddit),
+		})
+	}
+}
+
+// finishRedditImagePost waits for an image submission to show up among the
+// user's submissions and records its ID on the post. Reddit doesn't return
+// the ID, so it is matched by subreddit and title.
+func finishRedditImagePost(db *sql.DB, userID string, postID uuid.UUID, subreddit, title string, submittedAt time.Time) {
+	deadline := time.Now().Add(redditSubmitPollFor)
+	username := ""
+	for {
+		if time.Now().After(deadline) {
+			log.Printf("[Reddit] Gave up waiting for image post %s in r/%s after %s", postID, subreddit, redditSubmitPollFor)
+			if err := models.SetPostStatus(db, postID, "failed"); err != nil {
+				log.Printf("[Reddit] Failed to update post status: %v", err)
+			}
+			return
+		}
+		time.Sleep(redditSubmitPollEvery)
+
+		accessToken, err := getRedditAccessToken(db, userID)
+		if err != nil {
+			log.Printf("[Reddit] Stopped tracking image post %s: %v", postID, err)
+			return
+		}
+		if username == "" {
+			var me struct {
+				Name string `json:"name"`
+			}
+			if err := redditRequest(accessToken, "GET", "/api/v1/me", nil, &me); err != nil {
+				log.Printf("[Reddit] Failed to read username for image post %s: %v", postID, err)
+				continue
+			}
+			username = me.Name
+		}
+
+		var listing struct {
+			Data struct {
+				Children []struct {
+					Data struct {
+						Name       string  `json:"name"`
+						Subreddit  string  `json:"subreddit"`
+						Title      string  `json:"title"`
+						CreatedUTC float64 `json:"created_utc"`
+					} `json:"data"`
+				} `json:"children"`
+			} `json:"data"`
+		}
+		if err := redditRequest(accessToken, "GET", "/user/"+url.PathEscape(username)+"/submitted?sort=new&limit=25&raw_json=1", nil, &listing); err != nil {
+			log.Printf("[Reddit] Submission lookup failed for image post %s: %v", postID, err)
+			continue
+		}
+		for _, child := range listing.Data.Children {
+			sub := child.Data
+			createdAt := time.Unix(int64(sub.CreatedUTC), 0).UTC()
+			if !strings.EqualFold(sub.Subreddit, subreddit) || sub.Title != title || createdAt.Before(submittedAt.Add(-time.Minute)) {
+				continue
+			}
+			if err := models.SetPostPublished(db, postID, sub.Name, createdAt); err != nil {
+				log.Printf("[Reddit] Failed to record submission %s for post %s: %v", sub.Name, postID, err)
+			}
+			return
+		}
+	}
+}
+
+// redditPublishError maps a failed Reddit call to a response status and a
+// structured result. Rate limits and Reddit outages are retryable; rule
+// violations such as SUBREDDIT_NOTALLOWED are not.
+func redditPublishError(err error) (int, PublishResult) {
+	result := PublishResult{Platform: "reddit", Status: "failed", Message: err.Error()}
+
+	var submitErr *redditSubmitError
+	var apiErr *redditAPIError
+	switch {
+	case errors.As(err, &submitErr):
+		result.Message = submitErr.Message
+		if submitErr.Code == "RATELIMIT" {
+			result.Error = &PublishError{Code: "RATELIMIT", Retryable: true, RetryAfter: redditWaitSeconds(submitErr.Message)}
+			return http.StatusTooManyRequests, result
+		}
+		result.Error = &PublishError{Code: submitErr.Code}
+		return http.StatusUnprocessableEntity, result
+	case errors.As(err, &apiErr):
+		switch {
+		case apiErr.Status == http.StatusTooManyRequests:
+			retryAfter := apiErr.RetryAfter
+			if retryAfter <= 0 {
+				retryAfter = redditDefaultRateLimit
+			}
+			result.Error = &PublishError{Code: "RATELIMIT", Retryable: true, RetryAfter: retryAfter}
+			return http.StatusTooManyRequests, result
+		case apiErr.Status == http.StatusUnauthorized:
+			result.Error = &PublishError{Code: "AUTH_EXPIRED"}
+			return http.StatusUnauthorized, result
+		case apiErr.Status == http.StatusForbidden:
+			result.Error = &PublishError{Code: "FORBIDDEN"}
+			return http.StatusForbidden, result
+		case apiErr.Status >= 500:
+			result.Error = &PublishError{Code: "PLATFORM_UNAVAILABLE", Retryable: true}
+			return http.StatusBadGateway, result
+		}
+		result.Error = &PublishError{Code: "PLATFORM_ERROR"}
+		return http.StatusBadGateway, result
+	}
+	// Network failures and upload errors
+	result.Error = &PublishError{Code: "PLATFORM_UNAVAILABLE", Retryable: true}
+	return http.StatusBadGateway, result
+}
+
+// redditWaitSeconds reads the wait out of a rate limit message such as
+// "Take a break for 9 minutes before trying again."
+func redditWaitSeconds(message string) int {
+	m := redditWaitPattern.FindStringSubmatch(message)
+	if m == nil {
+		return redditDefaultRateLimit
+	}
+	n, _ := strconv.Atoi(m[1])
+	switch m[2] {
+	case "hour":
+		return n * 3600
+	case "minute":
+		return n * 60
+	}
+	return n
+}
+
+// uploadRedditImage uploads an image to Reddit's media store via an upload
+// lease and returns the hosted URL to submit.
+func uploadRedditImage(accessToken, imageURL string) (string, error) {
+	body, size, mediaType, err := downloadMedia(imageURL)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	if size > redditMaxImageBytes {
+		return "", fmt.Errorf("image exceeds Reddit's %dMB limit", redditMaxImageBytes/(1024*1024))
+	}
+	if !strings.HasPrefix(mediaType, "image/") {
+		return "", fmt.Errorf("unsupported image type %q", mediaType)
+	}
+	filename := path.Base(strings.SplitN(imageURL, "?", 2)[0])
+
+	var lease struct {
+		Args struct {
+			Action string `json:"action"`
+			Fields []struct {
+				Name  string `json:"name"`
+				Value string `json:"value"`
+			} `json:"fields"`
+		} `json:"args"`
+	}
+	err = redditRequest(accessToken, "POST", "/api/media/asset.json", url.Values{
+		"filepath": {filename},
+		"mimetype": {mediaType},
+	}, &lease)
+	if err != nil {
+		return "", err
+	}
+
+	// The lease is an S3 form post; its fields must precede the file
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	key := ""
+	for _, field := range lease.Args.Fields {
+		writer.WriteField(field.Name, field.Value)
+		if field.Name == "key" {
+			key = field.Value
+		}
+	}
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(part, body); err != nil {
+		return "", fmt.Errorf("failed to read image: %v", err)
+	}
+	writer.Close()
+
+	action := "https:" + lease.Args.Action
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Post(action, writer.FormDataContentType(), &form)
+	if err != nil {
+		return "", fmt.Errorf("image upload failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("image upload failed (status %d): %s", resp.StatusCode, respBody)
+	}
+	return action + "/" + key, nil
+}
+
+// normalizeSubreddit accepts "r/name", "/r/name" or "name".
+func normalizeSubreddit(name string) string {
+	name = strings.TrimSpace(name)
+	name = strings.TrimPrefix(name, "/")
+	name = strings.TrimPrefix(name, "r/")
+	return strings.TrimSuffix(name, "/")
+}
+
+// redditPostMessage is what gets stored as the post's message: the title,
+// followed by the body or link.
+func redditPostMessage(title, body, link string) string {
+	for _, s := range []string{body, link} {
+		if s != "" {
+			return title + "\n\n" + s
+		}
+	}
+	return title
+}
+
+// deleteRedditPost deletes a submission by its t3_ fullname.
+func deleteRedditPost(accessToken, fullname string) error {
+	return redditRequest(accessToken, "POST", "/api/del", url.Values{"id": {fullname}}, nil)
+}
+
+// editRedditPost replaces the body of a text post and returns the post's new
+// message. Reddit doesn't allow changing titles, and link and image posts
+// have no body.
+func editRedditPost(accessToken, fullname, body string) (string, error) {
+	if n := utils.MeasureText("reddit", body, 0); !n.Valid {
+		return "", &postNotSupportedError{Message: fmt.Sprintf("Post body exceeds Reddit's %d character limit (%d characters)", n.Limit, n.Length)}
+	}
+
+	var info struct {
+		Data struct {
+			Children []struct {
+				Data struct {
+					Title  string `json:"title"`
+					IsSelf bool   `json:"is_self"`
+				} `json:"data"`
+			} `json:"children"`
+		} `json:"data"`
+	}
+	if err := redditRequest(accessToken, "GET", "/api/info?id="+url.QueryEscape(fullname), nil, &info); err != nil {
+		return "", err
+	}
+	if len(info.Data.Children) == 0 {
+		return "", errors.New("submission not found on Reddit")
+	}
+	submission := info.Data.Children[0].Data
+	if !submission.IsSelf {
+		return "", &postNotSupportedError{Message: "Only the body of Reddit text posts can be edited; link and image posts have none"}
+	}
+
+	var res struct {
+		JSON struct {
+			Errors [][]string `json:"errors"`
+		} `json:"json"`
+	}
+	form := url.Values{
+		"api_type": {"json"},
+		"thing_id": {fullname},
+		"text":     {body},
+	}
+	if err := redditRequest(accessToken, "POST", "/api/editusertext", form, &res); err != nil {
+		return "", err
+	}
+	if err := redditJSONError(res.JSON.Errors); err != nil {
+		return "", err
+	}
+	return redditPostMessage(submission.Title, body, ""), nil
+}
@@ -0,0 +1,364 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	reportSendHour      = 8 // local time of the subscription
+	reportMaxRecipients = 20
+	reportRetryDelay    = time.Hour
+
+	// Recipients don't confirm their addresses, so on-demand sends are limited
+	// to keep the reports from being used to mail strangers
+	reportMaxSubscriptions   = 10
+	reportManualSendInterval = time.Hour
+)
+
+// ReportSubscriptionRequest creates a subscription or, with PATCH, changes
+// the fields that are set.
+type ReportSubscriptionRequest struct {
+	Name       *string   `json:"name"`
+	Frequency  *string   `json:"frequency"`  // weekly or monthly
+	Platforms  *[]string `json:"platforms"`  // the account set; empty for all accounts
+	Recipients *[]string `json:"recipients"` // empty to send to yourself
+	TimeZone   *string   `json:"timeZone"`
+	Enabled    *bool     `json:"enabled"`
+}
+
+// apply copies the request onto the subscription and validates the result.
+func (req ReportSubscriptionRequest) apply(sub *models.ReportSubscription) error {
+	if req.Name != nil {
+		sub.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Frequency != nil {
+		sub.Frequency = *req.Frequency
+	}
+	if req.Platforms != nil {
+		sub.Platforms = []string{}
+		seen := make(map[string]bool)
+		for _, p := range *req.Platforms {
+			p = strings.ToLower(strings.TrimSpace(p))
+			if _, ok := analyticsFetchers[p]; !ok {
+				return fmt.Errorf("analytics aren't collected for platform %q", p)
+			}
+			if !seen[p] {
+				seen[p] = true
+				sub.Platforms = append(sub.Platforms, p)
+			}
+		}
+	}
+	if req.Recipients != nil {
+		if len(*req.Recipients) > reportMaxRecipients {
+			return fmt.Errorf("a report can have at most %d recipients", reportMaxRecipients)
+		}
+		sub.Recipients = []string{}
+		for _, r := range *req.Recipients {
+			addr, err := mail.ParseAddress(strings.TrimSpace(r))
+			if err != nil {
+				return fmt.Errorf("%q is not a valid email address", r)
+			}
+			sub.Recipients = append(sub.Recipients, addr.Address)
+		}
+	}
+	if req.TimeZone != nil {
+		sub.TimeZone = *req.TimeZone
+	}
+	if req.Enabled != nil {
+		sub.Enabled = *req.Enabled
+	}
+
+	if sub.Name == "" {
+		return errors.New("name is required")
+	}
+	if sub.Frequency != models.ReportWeekly && sub.Frequency != models.ReportMonthly {
+		return errors.New("frequency must be weekly or monthly")
+	}
+	if _, err := time.LoadLocation(sub.TimeZone); err != nil || sub.TimeZone == "" || sub.TimeZone == "Local" {
+		return errors.New("timeZone must be a time zone like Europe/Berlin")
+	}
+	return nil
+}
+
+// reportPeriodStart returns the start of the period that contains t: Monday
+// midnight for weekly reports, the first of the month for monthly ones.
+func reportPeriodStart(frequency string, t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	if frequency == models.ReportMonthly {
+		return day.AddDate(0, 0, 1-day.Day())
+	}
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// reportPeriod returns the last complete period before t, the one a report
+// sent at t covers.
+func reportPeriod(frequency string, t time.Time, loc *time.Location) (time.Time, time.Time) {
+	to := reportPeriodStart(frequency, t, loc)
+	if frequency == models.ReportMonthly {
+		return to.AddDate(0, -1, 0), to
+	}
+	return to.AddDate(0, 0, -7), to
+}
+
+// nextReportTime returns when the next report after t is sent: on Monday or
+// the first of the month, in the morning.
+func nextReportTime(frequency string, t time.Time, loc *time.Location) time.Time {
+	start := reportPeriodStart(frequency, t, loc)
+	for {
+		send := time.Date(start.Year(), start.Month(), start.Day(), reportSendHour, 0, 0, 0, loc)
+		if send.After(t) {
+			return send.UTC()
+		}
+		if frequency == models.ReportMonthly {
+			start = start.AddDate(0, 1, 0)
+		} else {
+			start = start.AddDate(0, 0, 7)
+		}
+	}
+}
+
+// SendDueReports emails every report whose time has come. A report that
+// fails is retried an hour later, until its next regular send time.
+func SendDueReports(db *sql.DB) {
+	now := time.Now()
+	subscriptions, err := models.ListDueReportSubscriptions(db, now)
+	if err != nil {
+		log.Printf("[Reports] Failed to load due reports: %v", err)
+		return
+	}
+
+	for _, sub := range subscriptions {
+		loc := reportLocation(sub.TimeZone)
+		from, to := reportPeriod(sub.Frequency, sub.NextSendAt, loc)
+		next := nextReportTime(sub.Frequency, now, loc)
+
+		errMsg := ""
+		if err := sendAnalyticsReport(db, sub, from, to); err != nil {
+			log.Printf("[Reports] Failed to send report %s: %v", sub.ID, err)
+			errMsg = err.Error()
+			if retry := now.Add(reportRetryDelay); retry.Before(next) {
+				next = retry
+			}
+		}
+		if err := models.MarkReportSent(db, sub.ID, now, next, errMsg); err != nil {
+			log.Printf("[Reports] Failed to update report %s: %v", sub.ID, err)
+		}
+	}
+}
+
+// GET /api/analytics/reports
+func ListReportSubscriptionsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		subscriptions, err := models.ListReportSubscriptions(db, userID)
+		if err != nil {
+			http.Error(w, "Failed to load reports", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(subscriptions)
+	}
+}
+
+// POST /api/analytics/reports
+func CreateReportSubscriptionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+		uid, err := uuid.Parse(userID)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		var req ReportSubscriptionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		count, err := models.CountReportSubscriptions(db, userID)
+		if err != nil {
+			log.Printf("[Reports] Failed to count reports for user %s: %v", userID, err)
+			http.Error(w, "Failed to save report", http.StatusInternalServerError)
+			return
+		}
+		if count >= reportMaxSubscriptions {
+			http.Error(w, fmt.Sprintf("You can have at most %d reports", reportMaxSubscriptions), http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now().UTC()
+		sub := models.ReportSubscription{
+			ID:         uuid.New(),
+			UserID:     uid,
+			Frequency:  models.ReportWeekly,
+			Platforms:  []string{},
+			Recipients: []string{},
+			TimeZone:   "UTC",
+			Enabled:    true,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		if err := req.apply(&sub); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sub.NextSendAt = nextReportTime(sub.Frequency, now, reportLocation(sub.TimeZone))
+
+		if err := models.SaveReportSubscription(db, sub); err != nil {
+			log.Printf("[Reports] Failed to save report for user %s: %v", userID, err)
+			http.Error(w, "Failed to save report", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(sub)
+	}
+}
+
+// PATCH /api/analytics/reports/{id}
+func UpdateReportSubscriptionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		sub, ok := loadReportSubscription(w, db, userID, mux.Vars(r)["id"])
+		if !ok {
+			return
+		}
+		var req ReportSubscriptionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		frequency, timeZone, enabled := sub.Frequency, sub.TimeZone, sub.Enabled
+		if err := req.apply(sub); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// A new schedule starts from now
+		if sub.Frequency != frequency || sub.TimeZone != timeZone || (sub.Enabled && !enabled) {
+			sub.NextSendAt = nextReportTime(sub.Frequency, time.Now(), reportLocation(sub.TimeZone))
+		}
+
+		if err := models.UpdateReportSubscription(db, *sub); err != nil {
+			log.Printf("[Reports] Failed to update report %s: %v", sub.ID, err)
+			http.Error(w, "Failed to save report", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sub)
+	}
+}
+
+// DELETE /api/analytics/reports/{id}
+func DeleteReportSubscriptionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		id := mux.Vars(r)["id"]
+		if _, err := uuid.Parse(id); err != nil {
+			http.Error(w, "Report not found", http.StatusNotFound)
+			return
+		}
+		err = models.DeleteReportSubscription(db, userID, id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Report not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to delete report", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// POST /api/analytics/reports/{id}/send
+// Sends the report for the last complete period right away, without changing
+// the schedule. Each report can be sent this way once an hour.
+func SendReportNowHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		sub, ok := loadReportSubscription(w, db, userID, mux.Vars(r)["id"])
+		if !ok {
+			return
+		}
+		claimed, lastSent, err := models.ClaimManualReportSend(db, userID, sub.ID.String(), reportManualSendInterval)
+		if err != nil {
+			log.Printf("[Reports] Failed to claim send of report %s: %v", sub.ID, err)
+			http.Error(w, "Failed to send report", http.StatusInternalServerError)
+			return
+		}
+		if !claimed {
+			retryAfter := time.Until(lastSent.Add(reportManualSendInterval))
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			http.Error(w, "This report was sent recently, try again later", http.StatusTooManyRequests)
+			return
+		}
+		from, to := reportPeriod(sub.Frequency, time.Now(), reportLocation(sub.TimeZone))
+		if err := sendAnalyticsReport(db, *sub, from, to); err != nil {
+			log.Printf("[Reports] Failed to send report %s: %v", sub.ID, err)
+			http.Error(w, "Failed to send report", http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// loadReportSubscription loads the user's subscription, writing the error
+// response if it can't.
+func loadReportSubscription(w http.ResponseWriter, db *sql.DB, userID, id string) (*models.ReportSubscription, bool) {
+	if _, err := uuid.Parse(id); err != nil {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return nil, false
+	}
+	sub, err := models.GetReportSubscription(db, userID, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		http.Error(w, "Failed to load report", http.StatusInternalServerError)
+		return nil, false
+	}
+	return sub, true
+}
@@ -1,138 +1,389 @@
 package controllers
 
 import (
+	"crypto/rand"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math/big"
 	"net/http"
-	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"social-sync-backend/lib"
 	"social-sync-backend/middleware"
 )
 
-type TelegramConnectRequest struct {
-	ChatID string `json:"chat_id"`
+const (
+	telegramCodeLength   = 8
+	telegramCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // no 0/O or 1/I
+	telegramCodeTTL      = 15 * time.Minute
+
+	telegramMaxPhotoBytes = 5 << 20
+)
+
+type TelegramConnectResponse struct {
+	Code         string    `json:"code"`
+	BotUsername  string    `json:"botUsername"`
+	BotLink      string    `json:"botLink"` // adds the bot to a channel as an admin that can post
+	ExpiresAt    time.Time `json:"expiresAt"`
+	Instructions string    `json:"instructions"`
 }
 
 // POST /connect/telegram
+// Starts a connection by issuing a one-time code. The chat is linked when the
+// code is posted in a channel where the bot is an admin, or sent to the bot as
+// "/connect CODE" in a group by one of its admins. Private chats with the bot
+// can't be publish targets; a code sent there gets instructions instead.
 func ConnectTelegram(w http.ResponseWriter, r *http.Request) {
-	log.Printf("[Telegram] ConnectTelegram called")
 	userID, err := middleware.GetUserIDFromContext(r)
 	if err != nil {
-		log.Printf("[Telegram] Unauthorized: %v", err)
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	log.Printf("[Telegram] userID: %v", userID)
 
-	var req TelegramConnectRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("[Telegram] Invalid request body: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	db := lib.GetDB()
+	botToken, err := telegramBotTokenForUser(db, userID)
+	if err != nil {
+		log.Printf("[Telegram] Failed to load bot for user %s: %v", userID, err)
+		http.Error(w, "Failed to load Telegram bot", http.StatusInternalServerError)
 		return
 	}
-	log.Printf("[Telegram] Received chat_id: %v", req.ChatID)
-
-	if req.ChatID == "" {
-		log.Printf("[Telegram] chat_id is required")
-		http.Error(w, "chat_id is required", http.StatusBadRequest)
+	bot, err := lib.TelegramGetMe(botToken)
+	if err != nil {
+		log.Printf("[Telegram] getMe failed: %v", err)
+		http.Error(w, "Telegram bot is not configured", http.StatusInternalServerError)
 		return
 	}
 
-	db := lib.GetDB()
-	var id string
-	err = db.QueryRow(`SELECT id FROM social_accounts WHERE user_id = $1 AND platform = 'telegram'`, userID).Scan(&id)
-	now := time.Now()
+	code, err := generateTelegramCode()
+	if err != nil {
+		http.Error(w, "Failed to generate verification code", http.StatusInternalServerError)
+		return
+	}
+	expiresAt := time.Now().Add(telegramCodeTTL).UTC()
 
-	// Fetch channel info from Telegram API
-	botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
-	if botToken == "" {
-		log.Printf("[Telegram] TELEGRAM_BOT_TOKEN not set")
-		http.Error(w, "Telegram bot token not set", http.StatusInternalServerError)
+	// Only the latest code for a user stays valid
+	_, err = db.Exec(`DELETE FROM telegram_verifications WHERE user_id = $1 AND verified_at IS NULL`, userID)
+	if err == nil {
+		_, err = db.Exec(`
+			INSERT INTO telegram_verifications (user_id, code, expires_at)
+			VALUES ($1, $2, $3)
+		`, userID, code, expiresAt)
+	}
+	if err != nil {
+		log.Printf("[Telegram] Failed to store verification code for user %s: %v", userID, err)
+		http.Error(w, "Failed to start Telegram connection", http.StatusInternalServerError)
 		return
 	}
 
-	getChatURL := fmt.Sprintf("https://api.telegram.org/bot%s/getChat?chat_id=%s", botToken, req.ChatID)
-	resp, err := http.Get(getChatURL)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TelegramConnectResponse{
+		Code:        code,
+		BotUsername: bot.Username,
+		BotLink:     fmt.Sprintf("https://t.me/%s?startchannel&admin=post_messages", bot.Username),
+		ExpiresAt:   expiresAt,
+		Instructions: fmt.Sprintf("Add @%s as an admin that can post, then post %s in your channel, "+
+			"or send /connect %s to the bot from your group.", bot.Username, code, code),
+	})
+}
+
+// GET /connect/telegram/status?code=CODE
+// Lets the frontend poll until the code has been used.
+func GetTelegramConnectStatus(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r)
 	if err != nil {
-		log.Printf("[Telegram] Failed to call getChat: %v", err)
-		http.Error(w, "Failed to fetch channel info from Telegram", http.StatusBadGateway)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	defer resp.Body.Close()
-	var chatResp struct {
-		Ok     bool `json:"ok"`
-		Result struct {
-			Photo *struct {
-				BigFileID   string `json:"big_file_id"`
-				SmallFileID string `json:"small_file_id"`
-			} `json:"photo"`
-			Title string `json:"title"`
-		} `json:"result"`
+	code := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("code")))
+
+	var expiresAt time.Time
+	var verifiedAt *time.Time
+	err = lib.GetDB().QueryRow(`
+		SELECT expires_at, verified_at FROM telegram_verifications
+		WHERE user_id = $1 AND code = $2
+	`, userID, code).Scan(&expiresAt, &verifiedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Verification code not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
-		log.Printf("[Telegram] Failed to decode getChat response: %v", err)
+
+	response := map[string]interface{}{"status": "pending"}
+	switch {
+	case verifiedAt != nil:
+		response["status"] = "connected"
+		var name *string
+		if err := lib.GetDB().QueryRow(`
+			SELECT profile_name FROM social_accounts WHERE user_id = $1 AND platform = 'telegram'
+		`, userID).Scan(&name); err == nil && name != nil {
+			response["chatTitle"] = *name
+		}
+	case time.Now().After(expiresAt):
+		response["status"] = "expired"
 	}
 
-	var profilePicURL *string
-	if chatResp.Ok && chatResp.Result.Photo != nil {
-		// Prefer big_file_id
-		fileID := chatResp.Result.Photo.BigFileID
-		if fileID == "" {
-			fileID = chatResp.Result.Photo.SmallFileID
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func generateTelegramCode() (string, error) {
+	code := make([]byte, telegramCodeLength)
+	max := big.NewInt(int64(len(telegramCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
 		}
-		if fileID != "" {
-			getFileURL := fmt.Sprintf("https://api.telegram.org/bot%s/getFile?file_id=%s", botToken, fileID)
-			fileResp, err := http.Get(getFileURL)
-			if err == nil {
-				defer fileResp.Body.Close()
-				var fileData struct {
-					Ok     bool `json:"ok"`
-					Result struct {
-						FilePath string `json:"file_path"`
-					} `json:"result"`
-				}
-				if err := json.NewDecoder(fileResp.Body).Decode(&fileData); err == nil && fileData.Ok {
-					url := fmt.Sprintf("https://api.telegram.org/file/bot%s/%s", botToken, fileData.Result.FilePath)
-					profilePicURL = &url
-				}
-			}
+		code[i] = telegramCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// extractTelegramCode finds a verification code in a message. Commands
+// (/connect CODE, /start CODE) are explicit; in channel posts the code may
+// appear anywhere in the text.
+func extractTelegramCode(text string, anywhere bool) (code string, command bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return "", false
+	}
+	cmd := strings.ToLower(strings.SplitN(fields[0], "@", 2)[0])
+	if cmd == "/connect" || cmd == "/start" {
+		if len(fields) < 2 {
+			return "", true
 		}
+		return strings.ToUpper(fields[1]), true
+	}
+	if !anywhere {
+		return "", false
+	}
+	for _, f := range fields {
+		f = strings.ToUpper(strings.Trim(f, ".,;:!?\"'()"))
+		if len(f) == telegramCodeLength && strings.Trim(f, telegramCodeAlphabet) == "" {
+			return f, false
+		}
+	}
+	return "", false
+}
+
+// handleTelegramUpdate links a chat to a user when a message carries a valid
+// verification code from someone who controls the chat. botToken is the bot
+// the update was delivered to.
+func handleTelegramUpdate(db *sql.DB, botToken string, update lib.TelegramUpdate) {
+	msg := update.ChannelPost
+	isChannelPost := msg != nil
+	if msg == nil {
+		msg = update.Message
+	}
+	if msg == nil {
+		return
+	}
+	text := msg.Text
+	if text == "" {
+		text = msg.Caption
 	}
 
-	var channelTitle *string
-	if chatResp.Ok {
-		if t := chatResp.Result.Title; t != "" {
-			channelTitle = &t
+	code, command := extractTelegramCode(text, isChannelPost)
+	if msg.Chat.Type == "private" {
+		// A DM only reaches the person talking to the bot; point them at the
+		// channel or group instead of linking it
+		if command {
+			replyTelegram(botToken, msg, "Social Sync publishes to channels and groups, not to this chat. "+
+				"Add me to your channel as an admin that can post messages and post the code there, "+
+				"or send /connect followed by the code in your group.")
 		}
+		return
+	}
+	if code == "" {
+		if command {
+			replyTelegram(botToken, msg, "Send /connect followed by the code shown in Social Sync.")
+		}
+		return
 	}
 
-	if err == sql.ErrNoRows || id == "" {
-		log.Printf("[Telegram] No existing Telegram social account, inserting new record")
-		_, err = db.Exec(`INSERT INTO social_accounts (user_id, platform, social_id, access_token, connected_at, profile_picture_url, profile_name) VALUES ($1, 'telegram', $2, $2, $3, $4, $5)`, userID, req.ChatID, now, profilePicURL, channelTitle)
-		if err != nil {
-			log.Printf("[Telegram] Failed to connect Telegram (insert): %v", err)
-			http.Error(w, "Failed to connect Telegram", http.StatusInternalServerError)
-			return
+	var verificationID, userID string
+	var expiresAt time.Time
+	var verifiedAt *time.Time
+	err := db.QueryRow(`
+		SELECT id, user_id, expires_at, verified_at FROM telegram_verifications WHERE code = $1
+	`, code).Scan(&verificationID, &userID, &expiresAt, &verifiedAt)
+	if err != nil || verifiedAt != nil || time.Now().After(expiresAt) {
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("[Telegram] Failed to look up verification code: %v", err)
 		}
-	} else if err == nil {
-		log.Printf("[Telegram] Existing Telegram social account found, updating record")
-		_, err = db.Exec(`UPDATE social_accounts SET access_token = $1, connected_at = $2, profile_picture_url = $3, profile_name = $4 WHERE id = $5`, req.ChatID, now, profilePicURL, channelTitle, id)
-		if err != nil {
-			log.Printf("[Telegram] Failed to update Telegram connection: %v", err)
-			http.Error(w, "Failed to update Telegram connection", http.StatusInternalServerError)
-			return
+		// Stay quiet about random words in channel posts
+		if command {
+			replyTelegram(botToken, msg, "This code is invalid or has expired. Generate a new one in Social Sync.")
 		}
-	} else {
-		log.Printf("[Telegram] Database error: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("[Telegram] Telegram group connected successfully!")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"message": "Telegram group connected successfully!"}`))
+	// The code must reach the bot that will post for this user
+	if expected, err := telegramBotTokenForUser(db, userID); err != nil || expected != botToken {
+		replyTelegram(botToken, msg, "This code belongs to a different bot. Send it to the bot shown in Social Sync.")
+		return
+	}
+
+	if err := checkTelegramChatControl(botToken, msg, isChannelPost); err != nil {
+		log.Printf("[Telegram] Verification for user %s rejected in chat %d: %v", userID, msg.Chat.ID, err)
+		replyTelegram(botToken, msg, err.Error())
+		return
+	}
+
+	// Claim the code; a concurrent delivery of the same update loses here
+	res, err := db.Exec(`
+		UPDATE telegram_verifications SET verified_at = NOW(), chat_id = $1
+		WHERE id = $2 AND verified_at IS NULL
+	`, msg.Chat.ID, verificationID)
+	if err != nil {
+		log.Printf("[Telegram] Failed to mark code used: %v", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+
+	if err := linkTelegramChat(db, botToken, userID, msg.Chat.ID); err != nil {
+		log.Printf("[Telegram] Failed to link chat %d for user %s: %v", msg.Chat.ID, userID, err)
+		db.Exec(`UPDATE telegram_verifications SET verified_at = NULL, chat_id = NULL WHERE id = $1`, verificationID)
+		replyTelegram(botToken, msg, "Something went wrong while connecting this chat. Please try again.")
+		return
+	}
+	log.Printf("[Telegram] Chat %d connected for user %s", msg.Chat.ID, userID)
+
+	if isChannelPost {
+		// The code has served its purpose; keep it out of the channel history
+		if err := lib.TelegramDeleteMessage(botToken, msg.Chat.ID, msg.MessageID); err != nil {
+			log.Printf("[Telegram] Could not delete verification post: %v", err)
+		}
+		return
+	}
+	replyTelegram(botToken, msg, "Connected! Posts from Social Sync will be published here.")
+}
+
+// checkTelegramChatControl confirms the sender controls the chat and that the
+// bot is allowed to post in it. The error text is shown to the sender.
+func checkTelegramChatControl(botToken string, msg *lib.TelegramMessage, isChannelPost bool) error {
+	chat := msg.Chat
+
+	switch chat.Type {
+	case "channel":
+		// Only admins with posting rights can post in a channel
+		if !isChannelPost {
+			return errors.New("Post the code in the channel itself.")
+		}
+	case "group", "supergroup":
+		if msg.From == nil {
+			return errors.New("Send the code from your own account, not anonymously.")
+		}
+		sender, err := lib.TelegramGetChatMember(botToken, chat.ID, msg.From.ID)
+		if err != nil {
+			return errors.New("Could not check your permissions in this group.")
+		}
+		if sender.Status != "creator" && sender.Status != "administrator" {
+			return errors.New("Only group admins can connect this group.")
+		}
+	default:
+		return fmt.Errorf("Unsupported chat type %q.", chat.Type)
+	}
+
+	bot, err := lib.TelegramGetMe(botToken)
+	if err != nil {
+		return errors.New("Could not check the bot's permissions.")
+	}
+	member, err := lib.TelegramGetChatMember(botToken, chat.ID, bot.ID)
+	if err != nil {
+		return errors.New("Could not check the bot's permissions.")
+	}
+	if !telegramBotCanPost(chat.Type, member) {
+		if chat.Type == "channel" {
+			return errors.New("Make the bot a channel admin with permission to post messages, then try again.")
+		}
+		return errors.New("The bot is not allowed to send messages in this group.")
+	}
+	return nil
+}
+
+func telegramBotCanPost(chatType string, member *lib.TelegramChatMember) bool {
+	switch member.Status {
+	case "creator":
+		return true
+	case "administrator":
+		return chatType != "channel" || (member.CanPostMessages != nil && *member.CanPostMessages)
+	case "member":
+		return chatType != "channel"
+	case "restricted":
+		return chatType != "channel" && member.CanSendMessages != nil && *member.CanSendMessages
+	}
+	return false
+}
+
+// linkTelegramChat stores the verified chat as the user's Telegram account.
+func linkTelegramChat(db *sql.DB, botToken, userID string, chatID int64) error {
+	chat, err := lib.TelegramGetChat(botToken, chatID)
+	if err != nil {
+		return err
+	}
+
+	var profilePicURL *string
+	if chat.Photo != nil {
+		fileID := chat.Photo.BigFileID
+		if fileID == "" {
+			fileID = chat.Photo.SmallFileID
+		}
+		if url, err := storeTelegramChatPhoto(botToken, chatID, fileID); err == nil {
+			profilePicURL = &url
+		} else {
+			log.Printf("[Telegram] Failed to store photo of chat %d: %v", chatID, err)
+		}
+	}
+
+	name := chat.Title
+	if name == "" {
+		name = chat.FirstName
+	}
+	if name == "" && chat.Username != "" {
+		name = "@" + chat.Username
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO social_accounts (
+			user_id, platform, social_id, access_token,
+			profile_picture_url, profile_name, connected_at
+		) VALUES (
+			$1, 'telegram', $2, '', $3, $4, NOW()
+		)
+		ON CONFLICT (user_id, platform) DO UPDATE SET
+			social_id = EXCLUDED.social_id,
+			access_token = EXCLUDED.access_token,
+			profile_picture_url = EXCLUDED.profile_picture_url,
+			profile_name = EXCLUDED.profile_name,
+			connected_at = NOW()
+	`, userID, strconv.FormatInt(chatID, 10), profilePicURL, name)
+	return err
+}
+
+// storeTelegramChatPhoto copies the chat photo to the media store. Telegram's
+// own file URLs contain the bot token and can't be handed to clients.
+func storeTelegramChatPhoto(botToken string, chatID int64, fileID string) (string, error) {
+	photo, err := lib.TelegramDownloadFile(botToken, fileID)
+	if err != nil {
+		return "", err
+	}
+	defer photo.Close()
+	return lib.UploadToCloudinary(io.LimitReader(photo, telegramMaxPhotoBytes), "telegram_chat_pictures", strconv.FormatInt(chatID, 10))
+}
+
+func replyTelegram(botToken string, msg *lib.TelegramMessage, text string) {
+	if err := lib.TelegramSendMessage(botToken, msg.Chat.ID, text); err != nil {
+		log.Printf("[Telegram] Failed to reply in chat %d: %v", msg.Chat.ID, err)
+	}
 }
@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+)
+
+type TelegramBotRequest struct {
+	BotToken string `json:"bot_token"`
+}
+
+type TelegramBotResponse struct {
+	Custom      bool   `json:"custom"` // false when the shared bot is used
+	BotUsername string `json:"botUsername,omitempty"`
+	// Set when a chat is already connected: whether this bot can post there.
+	// If not, the chat has to be verified again through the new bot.
+	CanPostToConnectedChat *bool `json:"canPostToConnectedChat,omitempty"`
+}
+
+// GET /connect/telegram/bot
+func GetTelegramBot(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var username string
+	err = lib.GetDB().QueryRow(`SELECT username FROM telegram_bots WHERE user_id = $1`, userID).Scan(&username)
+	if err != nil && err != sql.ErrNoRows {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	response := TelegramBotResponse{Custom: err == nil, BotUsername: username}
+	if !response.Custom {
+		if bot, err := lib.TelegramGetMe(lib.TelegramBotToken()); err == nil {
+			response.BotUsername = bot.Username
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// PUT /connect/telegram/bot
+// Registers the user's own bot so their posts come from it instead of the
+// shared bot. The token is checked with getMe and stored encrypted.
+func RegisterTelegramBot(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req TelegramBotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	token := strings.TrimSpace(req.BotToken)
+	if token == "" || strings.ContainsAny(token, "/?# ") {
+		http.Error(w, "A valid bot_token is required", http.StatusBadRequest)
+		return
+	}
+
+	bot, err := lib.TelegramGetMe(token)
+	if err != nil || !bot.IsBot {
+		http.Error(w, "Telegram rejected the bot token", http.StatusBadRequest)
+		return
+	}
+
+	encrypted, err := lib.EncryptSecret(token)
+	if err != nil {
+		log.Printf("[Telegram] Failed to encrypt bot token: %v", err)
+		http.Error(w, "Failed to store bot token", http.StatusInternalServerError)
+		return
+	}
+
+	db := lib.GetDB()
+	var previousBotID int64
+	db.QueryRow(`SELECT bot_id FROM telegram_bots WHERE user_id = $1`, userID).Scan(&previousBotID)
+
+	_, err = db.Exec(`
+		INSERT INTO telegram_bots (user_id, bot_id, username, encrypted_token)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE SET
+			bot_id = EXCLUDED.bot_id,
+			username = EXCLUDED.username,
+			encrypted_token = EXCLUDED.encrypted_token,
+			updated_at = NOW()
+	`, userID, bot.ID, bot.Username, encrypted)
+	if err != nil {
+		// bot_id is unique: a bot can only post for one user
+		if strings.Contains(err.Error(), "telegram_bots_bot_id_key") {
+			http.Error(w, "This bot is already registered by another account", http.StatusConflict)
+			return
+		}
+		log.Printf("[Telegram] Failed to save bot for user %s: %v", userID, err)
+		http.Error(w, "Failed to store bot token", http.StatusInternalServerError)
+		return
+	}
+
+	if previousBotID != 0 && previousBotID != bot.ID {
+		stopTelegramBotUpdates(previousBotID)
+	}
+	startTelegramBotUpdates(db, bot.ID, token)
+
+	response := TelegramBotResponse{Custom: true, BotUsername: bot.Username}
+	response.CanPostToConnectedChat = telegramBotCanPostToConnectedChat(db, userID, token, bot.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DELETE /connect/telegram/bot
+// Removes the user's bot; Telegram calls fall back to the shared bot.
+func DeleteTelegramBot(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	db := lib.GetDB()
+	var botID int64
+	var encrypted string
+	err = db.QueryRow(`
+		DELETE FROM telegram_bots WHERE user_id = $1 RETURNING bot_id, encrypted_token
+	`, userID).Scan(&botID, &encrypted)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No custom bot registered", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	stopTelegramBotUpdates(botID)
+	if token, err := lib.DecryptSecret(encrypted); err == nil {
+		if err := lib.TelegramDeleteWebhook(token); err != nil {
+			log.Printf("[Telegram] Failed to clear webhook of bot %d: %v", botID, err)
+		}
+	}
+
+	response := TelegramBotResponse{Custom: false}
+	if bot, err := lib.TelegramGetMe(lib.TelegramBotToken()); err == nil {
+		response.BotUsername = bot.Username
+		response.CanPostToConnectedChat = telegramBotCanPostToConnectedChat(db, userID, lib.TelegramBotToken(), bot.ID)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// telegramBotTokenForUser returns the token of the bot that acts for the user:
+// their own bot if they registered one, otherwise the shared bot.
+func telegramBotTokenForUser(db *sql.DB, userID string) (string, error) {
+	var encrypted string
+	err := db.QueryRow(`SELECT encrypted_token FROM telegram_bots WHERE user_id = $1`, userID).Scan(&encrypted)
+	if err == sql.ErrNoRows {
+		return lib.TelegramBotToken(), nil
+	} else if err != nil {
+		return "", err
+	}
+	return lib.DecryptSecret(encrypted)
+}
+
+// telegramBotCanPostToConnectedChat checks a bot against the user's connected
+// chat, or returns nil when no chat is connected.
+func telegramBotCanPostToConnectedChat(db *sql.DB, userID, botToken string, botID int64) *bool {
+	var socialID string
+	err := db.QueryRow(`
+		SELECT social_id FROM social_accounts WHERE user_id = $1 AND platform = 'telegram'
+	`, userID).Scan(&socialID)
+	if err != nil {
+		return nil
+	}
+	chatID, err := strconv.ParseInt(socialID, 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	canPost := false
+	if chat, err := lib.TelegramGetChat(botToken, chatID); err == nil {
+		if chat.Type == "private" {
+			canPost = true
+		} else if member, err := lib.TelegramGetChatMember(botToken, chatID, botID); err == nil {
+			canPost = telegramBotCanPost(chat.Type, member)
+		}
+	}
+	return &canPost
+}
@@ -1,24 +1,56 @@
 package controllers
 
 import (
-	"bytes"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"log"
 	"net/http"
-	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"social-sync-backend/lib"
 	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+	"social-sync-backend/utils"
+
+	"github.com/google/uuid"
+)
+
+const (
+	telegramCaptionLimit    = 1024
+	telegramMaxAlbumItems   = 10
+	telegramMaxButtonsInRow = 8
 )
 
+type TelegramButton struct {
+	Text string `json:"text"`
+	URL  string `json:"url"`
+}
+
 type TelegramPostRequest struct {
-	Message   string   `json:"message"`
-	MediaUrls []string `json:"mediaUrls"`
+	Message   string             `json:"message"` // Markdown, rendered as Telegram HTML
+	MediaUrls []string           `json:"mediaUrls"`
+	Media     []models.MediaItem `json:"media,omitempty"` // merged with MediaUrls; Telegram has no alt text
+
+	Silent             bool               `json:"silent,omitempty"` // deliver without a notification sound
+	DisableLinkPreview bool               `json:"disableLinkPreview,omitempty"`
+	Buttons            [][]TelegramButton `json:"buttons,omitempty"` // rows of inline URL buttons
+	Pin                bool               `json:"pin,omitempty"`
+}
+
+// telegramMedia is one attachment with the Bot API type it is sent as.
+type telegramMedia struct {
+	Type string // photo, video or document
+	URL  string
 }
 
 // POST /api/telegram/post
+// Photos and videos are grouped into albums, documents into their own albums.
+// The message goes in the caption when it fits Telegram's 1024 character
+// caption limit; otherwise it follows the media as a separate text message.
 func PostToTelegram(w http.ResponseWriter, r *http.Request) {
 	userID, err := middleware.GetUserIDFromContext(r)
 	if err != nil {
@@ -32,117 +64,277 @@ func PostToTelegram(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Message == "" && len(req.MediaUrls) == 0 {
-		http.Error(w, "Message or media required", http.StatusBadRequest)
-		return
+	failed := func(status int, message string) {
+		writePublishResult(w, status, PublishResult{Platform: "telegram", Status: "failed", Message: message})
 	}
 
 	db := lib.GetDB()
+
+	mediaItems, err := resolveMediaItems(db, userID, req.MediaUrls, req.Media)
+	if err != nil {
+		failed(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	message := strings.TrimSpace(req.Message)
+	if message == "" && len(mediaItems) == 0 {
+		failed(http.StatusBadRequest, "Message or media required")
+		return
+	}
+	if err := validateTelegramButtons(req.Buttons); err != nil {
+		failed(http.StatusBadRequest, err.Error())
+		return
+	}
+
 	var chatID string
-	err = db.QueryRow(`SELECT access_token FROM social_accounts WHERE user_id = $1 AND platform = 'telegram'`, userID).Scan(&chatID)
+	err = db.QueryRow(`SELECT social_id FROM social_accounts WHERE user_id = $1 AND platform = 'telegram'`, userID).Scan(&chatID)
 	if err == sql.ErrNoRows {
-		http.Error(w, "Telegram not connected", http.StatusBadRequest)
+		failed(http.StatusBadRequest, "Telegram not connected")
 		return
 	} else if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		failed(http.StatusInternalServerError, "Database error")
 		return
 	}
 
-	botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
+	// Posts come from the user's own bot when they registered one
+	botToken, err := telegramBotTokenForUser(db, userID)
+	if err != nil {
+		failed(http.StatusInternalServerError, "Failed to load Telegram bot")
+		return
+	}
 	if botToken == "" {
-		http.Error(w, "Telegram bot token not set", http.StatusInternalServerError)
+		failed(http.StatusInternalServerError, "Telegram bot token not set")
 		return
 	}
 
-	results := []map[string]interface{}{}
+	albums := telegramAlbums(mediaItems)
+	captionFits := message != "" && utils.TelegramTextLength(message) <= telegramCaptionLimit
+	// Albums can't carry buttons, so they go on a text message instead
+	buttonsOnMedia := len(req.Buttons) > 0 && len(albums) == 1 && len(albums[0]) == 1 && (captionFits || message == "")
+	if len(albums) > 0 && len(req.Buttons) > 0 && !buttonsOnMedia && message == "" {
+		failed(http.StatusBadRequest, "Buttons on an album need message text to attach to")
+		return
+	}
 
-	// Helper to send a POST to Telegram API
-	sendToTelegram := func(api string, payload map[string]interface{}) (int, []byte, error) {
-		apiURL := fmt.Sprintf("https://api.telegram.org/bot%s/%s", botToken, api)
-		body, _ := json.Marshal(payload)
-		resp, err := http.Post(apiURL, "application/json", bytes.NewBuffer(body))
-		if err != nil {
-			return 0, nil, err
+	caption := ""
+	var textChunks []string
+	if len(albums) > 0 && captionFits && (len(req.Buttons) == 0 || buttonsOnMedia) {
+		caption = message
+	} else if message != "" {
+		textChunks = utils.SplitTelegramMarkdown(message, utils.PlatformTextLimits["telegram"])
+	}
+
+	var replyMarkup map[string]interface{}
+	if len(req.Buttons) > 0 {
+		replyMarkup = map[string]interface{}{"inline_keyboard": req.Buttons}
+	}
+
+	var sent []lib.TelegramMessage
+	send := func(method string, payload map[string]interface{}) error {
+		payload["chat_id"] = chatID
+		if req.Silent {
+			payload["disable_notification"] = true
+		}
+		if method == "sendMediaGroup" {
+			var msgs []lib.TelegramMessage
+			if err := lib.TelegramCall(botToken, method, payload, &msgs); err != nil {
+				return err
+			}
+			sent = append(sent, msgs...)
+			return nil
 		}
-		defer resp.Body.Close()
-		respBody, _ := ioutil.ReadAll(resp.Body)
-		return resp.StatusCode, respBody, nil
-	}
-
-	// Separate media into images and videos
-	var images, videos []string
-	for _, url := range req.MediaUrls {
-		if isImage(url) {
-			images = append(images, url)
-		} else if isVideo(url) {
-			videos = append(videos, url)
+		var msg lib.TelegramMessage
+		if err := lib.TelegramCall(botToken, method, payload, &msg); err != nil {
+			return err
 		}
+		sent = append(sent, msg)
+		return nil
 	}
 
-	// If multiple images and no videos, use sendMediaGroup
-	if len(images) > 1 && len(videos) == 0 {
-		media := []map[string]interface{}{}
-		for i, url := range images {
-			item := map[string]interface{}{
-				"type":  "photo",
-				"media": url,
+	err = func() error {
+		for i, album := range albums {
+			albumCaption := ""
+			if i == 0 {
+				albumCaption = caption
 			}
-			if i == 0 && req.Message != "" {
-				item["caption"] = req.Message
-				item["parse_mode"] = "HTML"
+
+			if len(album) == 1 {
+				item := album[0]
+				payload := map[string]interface{}{item.Type: item.URL}
+				if albumCaption != "" {
+					payload["caption"] = utils.TelegramHTML(albumCaption)
+					payload["parse_mode"] = "HTML"
+				}
+				if buttonsOnMedia {
+					payload["reply_markup"] = replyMarkup
+				}
+				if err := send("send"+strings.ToUpper(item.Type[:1])+item.Type[1:], payload); err != nil {
+					return err
+				}
+				continue
+			}
+
+			group := make([]map[string]interface{}, 0, len(album))
+			for j, item := range album {
+				entry := map[string]interface{}{"type": item.Type, "media": item.URL}
+				if j == 0 && albumCaption != "" {
+					entry["caption"] = utils.TelegramHTML(albumCaption)
+					entry["parse_mode"] = "HTML"
+				}
+				group = append(group, entry)
+			}
+			if err := send("sendMediaGroup", map[string]interface{}{"media": group}); err != nil {
+				return err
 			}
-			media = append(media, item)
-		}
-		payload := map[string]interface{}{
-			"chat_id": chatID,
-			"media":   media,
 		}
-		status, respBody, err := sendToTelegram("sendMediaGroup", payload)
-		results = append(results, map[string]interface{}{"type": "media_group", "status": status, "response": string(respBody), "error": err})
-	} else {
-		// Send each image as photo
-		for _, url := range images {
+
+		for i, chunk := range textChunks {
 			payload := map[string]interface{}{
-				"chat_id":    chatID,
-				"photo":      url,
-				"caption":    req.Message,
+				"text":       utils.TelegramHTML(chunk),
 				"parse_mode": "HTML",
 			}
-			status, respBody, err := sendToTelegram("sendPhoto", payload)
-			results = append(results, map[string]interface{}{"type": "photo", "status": status, "response": string(respBody), "error": err})
+			if req.DisableLinkPreview {
+				payload["link_preview_options"] = map[string]bool{"is_disabled": true}
+			}
+			// Thread the overflow text onto the media it belongs to
+			if i == 0 && len(sent) > 0 {
+				payload["reply_parameters"] = map[string]interface{}{
+					"message_id":                  sent[0].MessageID,
+					"allow_sending_without_reply": true,
+				}
+			}
+			if i == len(textChunks)-1 && replyMarkup != nil && !buttonsOnMedia {
+				payload["reply_markup"] = replyMarkup
+			}
+			if err := send("sendMessage", payload); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		log.Printf("[Telegram] Post failed for user %s after %d messages: %v", userID, len(sent), err)
+		result := PublishResult{Platform: "telegram", Status: "failed", Message: fmt.Sprintf("Failed to post to Telegram: %v", err)}
+		status := http.StatusBadGateway
+		var tgErr *lib.TelegramError
+		if errors.As(err, &tgErr) {
+			result.Message = fmt.Sprintf("Telegram rejected the post: %s", tgErr.Description)
+			if tgErr.Parameters.RetryAfter > 0 {
+				status = http.StatusTooManyRequests
+				result.Error = &PublishError{Code: "RATELIMIT", Retryable: true, RetryAfter: tgErr.Parameters.RetryAfter}
+			}
 		}
+		if len(sent) > 0 {
+			result.Message += fmt.Sprintf(" (%d messages were already sent)", len(sent))
+		}
+		writePublishResult(w, status, result)
+		return
 	}
 
-	// Send each video as video
-	for _, url := range videos {
-		payload := map[string]interface{}{
-			"chat_id":    chatID,
-			"video":      url,
-			"caption":    req.Message,
-			"parse_mode": "HTML",
+	first := sent[0]
+	if req.Pin {
+		err := lib.TelegramCall(botToken, "pinChatMessage", map[string]interface{}{
+			"chat_id":              chatID,
+			"message_id":           first.MessageID,
+			"disable_notification": req.Silent,
+		}, nil)
+		if err != nil {
+			// The post itself went out; pinning needs an extra admin right
+			log.Printf("[Telegram] Failed to pin message %d in chat %s: %v", first.MessageID, chatID, err)
 		}
-		status, respBody, err := sendToTelegram("sendVideo", payload)
-		results = append(results, map[string]interface{}{"type": "video", "status": status, "response": string(respBody), "error": err})
 	}
 
-	// If no media, or if message is present and no media sent, send as text
-	if len(req.MediaUrls) == 0 {
-		payload := map[string]interface{}{
-			"chat_id":    chatID,
-			"text":       req.Message,
-			"parse_mode": "HTML",
-		}
-		status, respBody, err := sendToTelegram("sendMessage", payload)
-		results = append(results, map[string]interface{}{"type": "text", "status": status, "response": string(respBody), "error": err})
+	uid, _ := uuid.Parse(userID)
+	now := time.Now().UTC()
+	messageID := strconv.Itoa(first.MessageID)
+	post := models.Post{
+		ID:             uuid.New(),
+		UserID:         uid,
+		Platform:       "telegram",
+		PlatformPostID: messageID,
+		Message:        message,
+		MediaURLs:      mediaItemURLs(mediaItems),
+		Target:         chatID,
+		PostedAt:       now,
+		Status:         "posted",
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	for _, msg := range sent[1:] {
+		post.ExtraPlatformIDs = append(post.ExtraPlatformIDs, strconv.Itoa(msg.MessageID))
+	}
+	if err := models.SavePost(db, post); err != nil {
+		log.Printf("ERROR: Failed to save Telegram post for user %s: %v", userID, err)
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Message sent to Telegram channel!",
-		"results": results,
+	writePublishResult(w, http.StatusOK, PublishResult{
+		Platform: "telegram",
+		Status:   "posted",
+		PostID:   messageID,
+		URL:      telegramMessageURL(first.Chat, first.MessageID),
+		Message:  "Message sent to Telegram channel!",
 	})
 }
 
+// telegramAlbums groups media into sendMediaGroup batches. Photos and videos
+// can share an album; documents can only be grouped with documents.
+func telegramAlbums(items []models.MediaItem) [][]telegramMedia {
+	var visual, documents []telegramMedia
+	for _, item := range items {
+		switch {
+		case isImage(strings.ToLower(item.URL)):
+			visual = append(visual, telegramMedia{Type: "photo", URL: item.URL})
+		case isVideoURL(item.URL):
+			visual = append(visual, telegramMedia{Type: "video", URL: item.URL})
+		default:
+			documents = append(documents, telegramMedia{Type: "document", URL: item.URL})
+		}
+	}
+
+	var albums [][]telegramMedia
+	for _, list := range [][]telegramMedia{visual, documents} {
+		for len(list) > 0 {
+			n := len(list)
+			if n > telegramMaxAlbumItems {
+				n = telegramMaxAlbumItems
+			}
+			albums = append(albums, list[:n])
+			list = list[n:]
+		}
+	}
+	return albums
+}
+
+func validateTelegramButtons(rows [][]TelegramButton) error {
+	for _, row := range rows {
+		if len(row) == 0 || len(row) > telegramMaxButtonsInRow {
+			return fmt.Errorf("each button row needs 1 to %d buttons", telegramMaxButtonsInRow)
+		}
+		for _, b := range row {
+			if strings.TrimSpace(b.Text) == "" {
+				return errors.New("buttons need text")
+			}
+			lower := strings.ToLower(b.URL)
+			if !strings.HasPrefix(lower, "https://") && !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "tg://") {
+				return fmt.Errorf("button %q needs an http(s) or tg:// URL", b.Text)
+			}
+		}
+	}
+	return nil
+}
+
+// telegramMessageURL links to a message in a public chat by username, or in
+// a private channel or supergroup by its internal ID (members only).
+func telegramMessageURL(chat lib.TelegramChat, messageID int) string {
+	if chat.Username != "" {
+		return fmt.Sprintf("https://t.me/%s/%d", chat.Username, messageID)
+	}
+	if id := strconv.FormatInt(chat.ID, 10); strings.HasPrefix(id, "-100") {
+		return fmt.Sprintf("https://t.me/c/%s/%d", strings.TrimPrefix(id, "-100"), messageID)
+	}
+	return ""
+}
+
 // Helper functions to check file type
 func isImage(url string) bool {
 	return hasAnySuffix(url, ".jpg", ".jpeg", ".png", ".gif", ".webp")
@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"social-sync-backend/lib"
+
+	"github.com/gorilla/mux"
+)
+
+const telegramPollTimeout = 30 // seconds per getUpdates long poll
+
+// Stop channels of the running getUpdates pollers, keyed by bot ID. The shared
+// bot uses key 0.
+var (
+	telegramPollersMu sync.Mutex
+	telegramPollers   = make(map[int64]chan struct{})
+)
+
+// POST /webhooks/telegram and /webhooks/telegram/{botId}
+// Receives bot updates when TELEGRAM_WEBHOOK_URL is set: the bare path for the
+// shared bot, the bot ID suffix for bots registered by users. Telegram sends
+// the secret registered with setWebhook in a header, which is the only thing
+// that distinguishes its deliveries from anyone else's.
+func TelegramWebhookHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var botID int64
+		botToken := lib.TelegramBotToken()
+		if idStr, ok := mux.Vars(r)["botId"]; ok {
+			id, err := strconv.ParseInt(idStr, 10, 64)
+			if err != nil {
+				http.Error(w, "Not found", http.StatusNotFound)
+				return
+			}
+			var encrypted string
+			if err := db.QueryRow(`SELECT encrypted_token FROM telegram_bots WHERE bot_id = $1`, id).Scan(&encrypted); err != nil {
+				http.Error(w, "Not found", http.StatusNotFound)
+				return
+			}
+			if botToken, err = lib.DecryptSecret(encrypted); err != nil {
+				log.Printf("[Telegram] Failed to decrypt token of bot %d: %v", id, err)
+				http.Error(w, "Internal error", http.StatusInternalServerError)
+				return
+			}
+			botID = id
+		}
+
+		secret := telegramWebhookSecret(botID)
+		got := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+		if secret == "" || subtle.ConstantTimeCompare([]byte(got), []byte(secret)) != 1 {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		var update lib.TelegramUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, "Invalid update", http.StatusBadRequest)
+			return
+		}
+		handleTelegramUpdate(db, botToken, update)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// telegramWebhookSecret is the secret_token for a bot's webhook. User bots get
+// one derived from TELEGRAM_WEBHOOK_SECRET so each webhook has its own.
+func telegramWebhookSecret(botID int64) string {
+	secret := os.Getenv("TELEGRAM_WEBHOOK_SECRET")
+	if secret == "" || botID == 0 {
+		return secret
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(botID, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// StartTelegramUpdates sets up delivery of bot updates for chat verification,
+// for the shared bot and every bot registered by a user. With
+// TELEGRAM_WEBHOOK_URL (and TELEGRAM_WEBHOOK_SECRET) webhooks are registered;
+// otherwise background workers long-poll getUpdates.
+func StartTelegramUpdates(db *sql.DB) {
+	if os.Getenv("TELEGRAM_WEBHOOK_URL") != "" && os.Getenv("TELEGRAM_WEBHOOK_SECRET") == "" {
+		log.Println("⚠️ TELEGRAM_WEBHOOK_URL is set without TELEGRAM_WEBHOOK_SECRET, Telegram updates disabled.")
+		return
+	}
+
+	if botToken := lib.TelegramBotToken(); botToken != "" {
+		startTelegramBotUpdates(db, 0, botToken)
+	} else {
+		log.Println("ℹ️ TELEGRAM_BOT_TOKEN not set, only user-registered Telegram bots will work.")
+	}
+
+	rows, err := db.Query(`SELECT bot_id, encrypted_token FROM telegram_bots`)
+	if err != nil {
+		log.Printf("❌ Failed to load Telegram bots: %v", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var botID int64
+		var encrypted string
+		if err := rows.Scan(&botID, &encrypted); err != nil {
+			log.Printf("❌ Failed to read Telegram bot: %v", err)
+			continue
+		}
+		token, err := lib.DecryptSecret(encrypted)
+		if err != nil {
+			log.Printf("❌ Failed to decrypt token of Telegram bot %d: %v", botID, err)
+			continue
+		}
+		startTelegramBotUpdates(db, botID, token)
+	}
+}
+
+// startTelegramBotUpdates registers the webhook for a bot or starts its poller.
+// botID 0 is the shared bot.
+func startTelegramBotUpdates(db *sql.DB, botID int64, botToken string) {
+	if webhookURL := os.Getenv("TELEGRAM_WEBHOOK_URL"); webhookURL != "" {
+		if botID != 0 {
+			webhookURL = strings.TrimSuffix(webhookURL, "/") + "/" + strconv.FormatInt(botID, 10)
+		}
+		if err := lib.TelegramSetWebhook(botToken, webhookURL, telegramWebhookSecret(botID)); err != nil {
+			log.Printf("[Telegram] Failed to register webhook for bot %d: %v", botID, err)
+		}
+		return
+	}
+
+	telegramPollersMu.Lock()
+	defer telegramPollersMu.Unlock()
+	if stop, ok := telegramPollers[botID]; ok {
+		close(stop)
+	}
+	stop := make(chan struct{})
+	telegramPollers[botID] = stop
+
+	// getUpdates is refused while a webhook is set
+	if err := lib.TelegramDeleteWebhook(botToken); err != nil {
+		log.Printf("[Telegram] Failed to clear webhook for bot %d: %v", botID, err)
+	}
+	go pollTelegramUpdates(db, botToken, stop)
+}
+
+func stopTelegramBotUpdates(botID int64) {
+	telegramPollersMu.Lock()
+	defer telegramPollersMu.Unlock()
+	if stop, ok := telegramPollers[botID]; ok {
+		close(stop)
+		delete(telegramPollers, botID)
+	}
+}
+
+func pollTelegramUpdates(db *sql.DB, botToken string, stop <-chan struct{}) {
+	var offset int64
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		updates, err := lib.TelegramGetUpdates(botToken, offset, telegramPollTimeout)
+		if err != nil {
+			wait := 5 * time.Second
+			var tgErr *lib.TelegramError
+			if errors.As(err, &tgErr) {
+				if tgErr.Parameters.RetryAfter > 0 {
+					wait = time.Duration(tgErr.Parameters.RetryAfter) * time.Second
+				} else if tgErr.Code == http.StatusConflict {
+					// Another instance is polling or a webhook was set
+					wait = time.Minute
+				} else if tgErr.Code == http.StatusUnauthorized {
+					log.Printf("[Telegram] Bot token was revoked, stopping updates")
+					return
+				}
+			}
+			log.Printf("[Telegram] getUpdates failed: %v", err)
+			select {
+			case <-stop:
+				return
+			case <-time.After(wait):
+			}
+			continue
+		}
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			handleTelegramUpdate(db, botToken, update)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"social-sync-backend/models"
+	"social-sync-backend/utils"
+
+	"github.com/google/uuid"
+)
+
+// ThreadOptions are the thread fields shared by the Twitter and Mastodon post requests.
+type ThreadOptions struct {
+	Thread     []string `json:"thread,omitempty"`     // explicit segments, posted in order
+	AutoThread bool     `json:"autoThread,omitempty"` // split an over-long message automatically
+	Numbering  bool     `json:"numbering,omitempty"`  // append " i/n" to auto-split segments
+}
+
+// threadMedia is a media item waiting to be attached to a segment. ID is set
+// once the item has been uploaded to the platform.
+type threadMedia struct {
+	ID      string
+	URL     string
+	AltText string
+	Video   bool // videos and GIFs get a segment to themselves
+}
+
+type threadSegment struct {
+	Text  string
+	Media []threadMedia
+}
+
+func (s threadSegment) mediaIDs() []string {
+	ids := make([]string, 0, len(s.Media))
+	for _, m := range s.Media {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+func (s threadSegment) mediaURLs() []string {
+	urls := make([]string, 0, len(s.Media))
+	for _, m := range s.Media {
+		urls = append(urls, m.URL)
+	}
+	return urls
+}
+
+// threadSegmentResult is reported back to the client for every posted segment.
+type threadSegmentResult struct {
+	Index int    `json:"index"`
+	ID    string `json:"id"`
+	URL   string `json:"url,omitempty"`
+	Text  string `json:"text"`
+}
+
+// threadError reports which segment of a thread failed. Segments before it were
+// published and remain live.
+type threadError struct {
+	Index int
+	Err   error
+}
+
+func (e *threadError) Error() string {
+	return fmt.Sprintf("segment %d failed: %v", e.Index+1, e.Err)
+}
+
+func (e *threadError) Unwrap() error { return e.Err }
+
+// buildThreadSegments returns the texts to publish. Explicit segments win; a
+// message is split only when it is too long and autoThread is set. It returns an
+// error when a segment still exceeds the limit.
+func buildThreadSegments(message string, opts ThreadOptions, limit int, length func(string) int, platform string) ([]string, error) {
+	var texts []string
+	if len(opts.Thread) > 0 {
+		for _, t := range opts.Thread {
+			if t = strings.TrimSpace(t); t != "" {
+				texts = append(texts, t)
+			}
+		}
+	} else if opts.AutoThread {
+		texts = utils.SplitThread(message, limit, opts.Numbering, length)
+	} else if message != "" {
+		texts = []string{message}
+	}
+
+	for i, t := range texts {
+		if n := length(t); n > limit {
+			if len(texts) == 1 {
+				return nil, fmt.Errorf("Message exceeds %s's %d character limit (%d characters). Enable autoThread to post it as a thread", platform, limit, n)
+			}
+			return nil, fmt.Errorf("Thread segment %d exceeds %s's %d character limit (%d characters)", i+1, platform, limit, n)
+		}
+	}
+	return texts, nil
+}
+
+// distributeThreadMedia assigns media to segments in order. Each segment takes up
+// to perSegment items; a video must be alone in its segment. It fails if the
+// media does not fit into the thread.
+func distributeThreadMedia(texts []string, media []threadMedia, perSegment int) ([]threadSegment, error) {
+	segments := make([]threadSegment, len(texts))
+	for i, t := range texts {
+		segments[i].Text = t
+	}
+
+	seg := 0
+	for _, m := range media {
+		for seg < len(segments) {
+			cur := segments[seg].Media
+			full := len(cur) >= perSegment
+			blocked := len(cur) > 0 && (m.Video || cur[0].Video)
+			if !full && !blocked {
+				break
+			}
+			seg++
+		}
+		if seg >= len(segments) {
+			if len(segments) == 1 {
+				return nil, fmt.Errorf("a post can contain one video or up to %d images, but not both", perSegment)
+			}
+			return nil, fmt.Errorf("too many media items for a %d-part thread (max %d per post, videos must be alone)", len(segments), perSegment)
+		}
+		segments[seg].Media = append(segments[seg].Media, m)
+	}
+	return segments, nil
+}
+
+// publishThread posts segments as a reply chain. post receives the ID of the
+// previous segment ("" for the first) and returns the new post's ID and URL.
+// On failure the segments already posted are returned with a *threadError;
+// a segment posted without an ID fails the thread, since the next one would
+// not be a reply.
+func publishThread(segments []threadSegment, post func(seg threadSegment, replyTo string) (string, string, error)) ([]threadSegmentResult, error) {
+	results := make([]threadSegmentResult, 0, len(segments))
+	replyTo := ""
+	for i, seg := range segments {
+		id, postURL, err := post(seg, replyTo)
+		if err != nil {
+			return results, &threadError{Index: i, Err: err}
+		}
+		if id == "" && i < len(segments)-1 {
+			return results, &threadError{Index: i, Err: errors.New("the platform didn't return the post's ID, so the rest of the thread can't reply to it")}
+		}
+		results = append(results, threadSegmentResult{Index: i, ID: id, URL: postURL, Text: seg.Text})
+		replyTo = id
+	}
+	return results, nil
+}
+
+// saveThreadPosts records every published segment in the posts table, linking
+// them to the first segment.
+func saveThreadPosts(db *sql.DB, userID, platform string, segments []threadSegment, results []threadSegmentResult) error {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return err
+	}
+
+	var rootID uuid.UUID
+	for i, res := range results {
+		now := time.Now().UTC()
+		post := models.Post{
+			ID:             uuid.New(),
+			UserID:         uid,
+			Platform:       platform,
+			PlatformPostID: res.ID,
+			Message:        res.Text,
+			MediaURLs:      segments[res.Index].mediaURLs(),
+			PostedAt:       now,
+			Status:         "posted",
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		if len(segments) > 1 {
+			if i == 0 {
+				rootID = post.ID
+			}
+			position := res.Index
+			post.ThreadRootID = &rootID
+			post.ThreadPosition = &position
+		}
+		if err := models.SavePost(db, post); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"social-sync-backend/middleware"
+	"social-sync-backend/utils"
+
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+const threadsGraphURL = "https://graph.threads.net"
+
+var threadsStates = make(map[string]string) // state -> user_id
+
+// getThreadsOAuthConfig returns OAuth2 config for Threads. Threads uses its own
+// app credentials and authorize endpoint, separate from Facebook Login.
+func getThreadsOAuthConfig() *oauth2.Config {
+	redirectURL := utils.GetCallbackURL("threads")
+	if redirectURL == "" {
+		log.Fatal("THREADS_REDIRECT_URL is empty!")
+	}
+
+	return &oauth2.Config{
+		ClientID:     os.Getenv("THREADS_APP_ID"),
+		ClientSecret: os.Getenv("THREADS_APP_SECRET"),
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"threads_basic", "threads_content_publish", "threads_manage_replies"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   "https://threads.net/oauth/authorize",
+			TokenURL:  threadsGraphURL + "/oauth/access_token",
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+}
+
+// ThreadsRedirectHandler initiates the OAuth flow and redirects to the Threads auth page
+func ThreadsRedirectHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		config := getThreadsOAuthConfig()
+
+		appUserIDStr, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated.", http.StatusUnauthorized)
+			return
+		}
+		if _, err := uuid.Parse(appUserIDStr); err != nil {
+			http.Error(w, "Invalid user ID format.", http.StatusInternalServerError)
+			return
+		}
+
+		state := generateState()
+		threadsStates[state] = appUserIDStr
+
+		http.Redirect(w, r, config.AuthCodeURL(state), http.StatusTemporaryRedirect)
+	}
+}
+
+// ThreadsCallbackHandler exchanges the code for a long-lived token, fetches the profile and saves the account
+func ThreadsCallbackHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		state := r.URL.Query().Get("state")
+		appUserIDStr, exists := threadsStates[state]
+		if state == "" || !exists {
+			http.Error(w, "Invalid or expired state parameter", http.StatusBadRequest)
+			return
+		}
+		delete(threadsStates, state)
+
+		code := r.URL.Query().Get("code")
+		if code == "" {
+			redirectURL := fmt.Sprintf("%s/home/manage-accounts?error=threads", utils.GetFrontendURL())
+			http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+			return
+		}
+
+		config := getThreadsOAuthConfig()
+		token, err := config.Exchange(context.Background(), code)
+		if err != nil {
+			http.Error(w, "Token exchange failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// The code exchange yields a one-hour token; swap it for a 60-day one
+		longLived, err := threadsTokenRequest("/access_token", url.Values{
+			"grant_type":    {"th_exchange_token"},
+			"client_secret": {config.ClientSecret},
+			"access_token":  {token.AccessToken},
+		})
+		if err != nil {
+			http.Error(w, "Failed to get long-lived Threads token: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var profile struct {
+			ID                string `json:"id"`
+			Username          string `json:"username"`
+			Name              string `json:"name"`
+			ProfilePictureURL string `json:"threads_profile_picture_url"`
+		}
+		err = threadsGet("/v1.0/me", url.Values{
+			"fields":       {"id,username,name,threads_profile_picture_url"},
+			"access_token": {longLived.AccessToken},
+		}, &profile)
+		if err != nil || profile.ID == "" {
+			http.Error(w, fmt.Sprintf("Failed to fetch Threads profile: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		profileName := "@" + profile.Username
+		if profile.Name != "" {
+			profileName = fmt.Sprintf("%s (@%s)", profile.Name, profile.Username)
+		}
+
+		_, err = db.Exec(`
+			INSERT INTO social_accounts (
+				user_id, platform, social_id, access_token, access_token_expires_at,
+				profile_picture_url, profile_name, connected_at
+			) VALUES (
+				$1, 'threads', $2, $3, $4, $5, $6, NOW()
+			)
+			ON CONFLICT (user_id, platform) DO UPDATE SET
+				access_token = EXCLUDED.access_token,
+				access_token_expires_at = EXCLUDED.access_token_expires_at,
+				social_id = EXCLUDED.social_id,
+				profile_picture_url = EXCLUDED.profile_picture_url,
+				profile_name = EXCLUDED.profile_name,
+				connected_at = NOW()
+		`,
+			appUserIDStr,
+			profile.ID,
+			longLived.AccessToken,
+			longLived.expiry(),
+			profile.ProfilePictureURL,
+			profileName,
+		)
+		if err != nil {
+			http.Error(w, "Failed to save Threads account: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		redirectURL := fmt.Sprintf("%s/home/manage-accounts?connected=threads", utils.GetFrontendURL())
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+	}
+}
+
+type threadsToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func (t *threadsToken) expiry() *time.Time {
+	if t.ExpiresIn == 0 {
+		return nil
+	}
+	exp := time.Now().Add(time.Duration(t.ExpiresIn) * time.Second)
+	return &exp
+}
+
+func threadsTokenRequest(path string, params url.Values) (*threadsToken, error) {
+	var token threadsToken
+	if err := threadsGet(path, params, &token); err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("no access token in response")
+	}
+	return &token, nil
+}
+
+// getThreadsAccount loads the user's Threads token, refreshing it when it is
+// within a week of expiring. Long-lived tokens can be refreshed once they are
+// a day old.
+func getThreadsAccount(db *sql.DB, userID string) (threadsUserID, accessToken string, err error) {
+	var expiresAt *time.Time
+	err = db.QueryRow(`
+		SELECT social_id, access_token, access_token_expires_at
+		FROM social_accounts
+		WHERE user_id = $1 AND platform = 'threads'
+	`, userID).Scan(&threadsUserID, &accessToken, &expiresAt)
+	if err != nil {
+		return "", "", err
+	}
+	if expiresAt == nil || time.Until(*expiresAt) > 7*24*time.Hour {
+		return threadsUserID, accessToken, nil
+	}
+	if time.Now().After(*expiresAt) {
+		return "", "", fmt.Errorf("Threads access token has expired. Please reconnect your account.")
+	}
+
+	refreshed, err := threadsTokenRequest("/refresh_access_token", url.Values{
+		"grant_type":   {"th_refresh_token"},
+		"access_token": {accessToken},
+	})
+	if err != nil {
+		log.Printf("[Threads] Token refresh failed for user %s: %v", userID, err)
+		return threadsUserID, accessToken, nil
+	}
+
+	_, err = db.Exec(`
+		UPDATE social_accounts
+		SET access_token = $1, access_token_expires_at = $2, last_synced_at = NOW()
+		WHERE user_id = $3 AND platform = 'threads'
+	`, refreshed.AccessToken, refreshed.expiry(), userID)
+	if err != nil {
+		log.Printf("[Threads] Failed to store refreshed token for user %s: %v", userID, err)
+	}
+	return threadsUserID, refreshed.AccessToken, nil
+}
+
+// threadsGet performs a GET against graph.threads.net and decodes the JSON body.
+func threadsGet(path string, params url.Values, out interface{}) error {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(threadsGraphURL + path + "?" + params.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeThreadsResponse(resp, out)
+}
+
+// threadsPost performs a form POST against graph.threads.net.
+func threadsPost(path string, form url.Values, out interface{}) error {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.PostForm(threadsGraphURL+path, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeThreadsResponse(resp, out)
+}
+
+// threadsDelete performs a DELETE against graph.threads.net.
+func threadsDelete(path string, params url.Values) error {
+	req, err := http.NewRequest(http.MethodDelete, threadsGraphURL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeThreadsResponse(resp, nil)
+}
+
+func decodeThreadsResponse(resp *http.Response, out interface{}) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var errRes struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(body, &errRes) == nil && errRes.Error.Message != "" {
+			return fmt.Errorf("Threads API error (status %d): %s", resp.StatusCode, errRes.Error.Message)
+		}
+		return fmt.Errorf("Threads API error (status %d): %s", resp.StatusCode, body)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
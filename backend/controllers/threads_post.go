@@ -0,0 +1,286 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+	"social-sync-backend/utils"
+
+	"github.com/google/uuid"
+)
+
+const threadsMaxCarouselItems = 20
+
+// Who may reply to a Threads post.
+var threadsReplyControls = map[string]bool{
+	"everyone":            true,
+	"accounts_you_follow": true,
+	"mentioned_only":      true,
+}
+
+type ThreadsPostRequest struct {
+	Message      string             `json:"message"`
+	MediaUrls    []string           `json:"mediaUrls,omitempty"`
+	Media        []models.MediaItem `json:"media,omitempty"`
+	ReplyControl string             `json:"replyControl,omitempty"` // everyone (default), accounts_you_follow or mentioned_only
+}
+
+func PostToThreadsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var req ThreadsPostRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		mediaItems, err := resolveMediaItems(db, userID, req.MediaUrls, req.Media)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		message := strings.TrimSpace(req.Message)
+		if message == "" && len(mediaItems) == 0 {
+			http.Error(w, "Message cannot be empty", http.StatusBadRequest)
+			return
+		}
+		if n := utils.MeasureText("threads", message, 0); !n.Valid {
+			http.Error(w, fmt.Sprintf("Message exceeds Threads' %d character limit (%d characters)", n.Limit, n.Length), http.StatusBadRequest)
+			return
+		}
+		if len(mediaItems) > threadsMaxCarouselItems {
+			http.Error(w, fmt.Sprintf("Threads carousels can have at most %d media items", threadsMaxCarouselItems), http.StatusBadRequest)
+			return
+		}
+		if req.ReplyControl != "" && !threadsReplyControls[req.ReplyControl] {
+			http.Error(w, "replyControl must be everyone, accounts_you_follow or mentioned_only", http.StatusBadRequest)
+			return
+		}
+
+		threadsUserID, accessToken, err := getThreadsAccount(db, userID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Threads account not connected", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		// Step 1: Build the container to publish. Carousel items get their own
+		// containers first and must all finish processing.
+		form := url.Values{}
+		form.Set("access_token", accessToken)
+		if message != "" {
+			form.Set("text", message)
+		}
+		if req.ReplyControl != "" {
+			form.Set("reply_control", req.ReplyControl)
+		}
+
+		switch len(mediaItems) {
+		case 0:
+			form.Set("media_type", "TEXT")
+		case 1:
+			setThreadsMediaFields(form, mediaItems[0])
+		default:
+			children, err := createThreadsCarouselItems(threadsUserID, accessToken, mediaItems)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			form.Set("media_type", "CAROUSEL")
+			form.Set("children", strings.Join(children, ","))
+		}
+
+		containerID, err := createThreadsContainer(threadsUserID, form)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to create Threads container: %v", err), http.StatusBadGateway)
+			return
+		}
+
+		// Step 2: Wait for processing, then publish
+		if err := waitForThreadsContainer(containerID, accessToken); err != nil {
+			http.Error(w, fmt.Sprintf("Threads post failed to process: %v", err), http.StatusBadGateway)
+			return
+		}
+
+		var published struct {
+			ID string `json:"id"`
+		}
+		err = threadsPost(fmt.Sprintf("/v1.0/%s/threads_publish", threadsUserID), url.Values{
+			"creation_id":  {containerID},
+			"access_token": {accessToken},
+		}, &published)
+		if err != nil || published.ID == "" {
+			http.Error(w, fmt.Sprintf("Failed to publish Threads post: %v", err), http.StatusBadGateway)
+			return
+		}
+
+		var details struct {
+			Permalink string `json:"permalink"`
+		}
+		if err := threadsGet("/v1.0/"+published.ID, url.Values{
+			"fields":       {"permalink"},
+			"access_token": {accessToken},
+		}, &details); err != nil {
+			log.Printf("[Threads] Failed to fetch permalink for %s: %v", published.ID, err)
+		}
+
+		uid, _ := uuid.Parse(userID)
+		now := time.Now().UTC()
+		post := models.Post{
+			ID:             uuid.New(),
+			UserID:         uid,
+			Platform:       "threads",
+			PlatformPostID: published.ID,
+			Message:        message,
+			MediaURLs:      mediaItemURLs(mediaItems),
+			PostedAt:       now,
+			Status:         "posted",
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		if err := models.SavePost(db, post); err != nil {
+			log.Printf("ERROR: Failed to save Threads post for user %s: %v", userID, err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Posted to Threads successfully",
+			"postId":  published.ID,
+			"url":     details.Permalink,
+		})
+	}
+}
+
+func setThreadsMediaFields(form url.Values, item models.MediaItem) {
+	if isVideoURL(item.URL) {
+		form.Set("media_type", "VIDEO")
+		form.Set("video_url", item.URL)
+	} else {
+		form.Set("media_type", "IMAGE")
+		form.Set("image_url", item.URL)
+	}
+	if item.AltText != "" {
+		form.Set("alt_text", item.AltText)
+	}
+}
+
+func createThreadsContainer(threadsUserID string, form url.Values) (string, error) {
+	var result struct {
+		ID string `json:"id"`
+	}
+	if err := threadsPost(fmt.Sprintf("/v1.0/%s/threads", threadsUserID), form, &result); err != nil {
+		return "", err
+	}
+	if result.ID == "" {
+		return "", fmt.Errorf("no container ID in response")
+	}
+	return result.ID, nil
+}
+
+// createThreadsCarouselItems creates a container per carousel item, all at
+// once, and waits until every one has finished processing.
+func createThreadsCarouselItems(threadsUserID, accessToken string, items []models.MediaItem) ([]string, error) {
+	children := make([]string, len(items))
+	errs := make([]error, len(items))
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		go func(i int, item models.MediaItem) {
+			defer wg.Done()
+			form := url.Values{}
+			form.Set("access_token", accessToken)
+			form.Set("is_carousel_item", "true")
+			setThreadsMediaFields(form, item)
+			children[i], errs[i] = createThreadsContainer(threadsUserID, form)
+		}(i, item)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create carousel item %d: %v", i+1, err)
+		}
+	}
+
+	if i, err := waitForThreadsContainers(children, accessToken); err != nil {
+		return nil, fmt.Errorf("Carousel item %d failed to process: %v", i+1, err)
+	}
+	return children, nil
+}
+
+// waitForThreadsContainer polls a container until it is FINISHED. Text-only
+// containers usually finish immediately; videos can take minutes.
+func waitForThreadsContainer(containerID, accessToken string) error {
+	_, err := waitForThreadsContainers([]string{containerID}, accessToken)
+	return err
+}
+
+// waitForThreadsContainers polls containers until all of them are FINISHED,
+// checking every unfinished one each round. On failure it returns the index
+// of the container that failed.
+func waitForThreadsContainers(containerIDs []string, accessToken string) (int, error) {
+	const maxRetries = 30
+	const delay = 5 * time.Second
+
+	pending := make(map[int]bool, len(containerIDs))
+	for i := range containerIDs {
+		pending[i] = true
+	}
+
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		for i, containerID := range containerIDs {
+			if !pending[i] {
+				continue
+			}
+			var res struct {
+				Status       string `json:"status"`
+				ErrorMessage string `json:"error_message"`
+			}
+			err := threadsGet("/v1.0/"+containerID, url.Values{
+				"fields":       {"status,error_message"},
+				"access_token": {accessToken},
+			}, &res)
+			if err != nil {
+				return i, fmt.Errorf("failed to get container status: %w", err)
+			}
+
+			switch res.Status {
+			case "FINISHED", "PUBLISHED":
+				delete(pending, i)
+			case "ERROR", "EXPIRED":
+				if res.ErrorMessage != "" {
+					return i, fmt.Errorf("container %s: %s", strings.ToLower(res.Status), res.ErrorMessage)
+				}
+				return i, fmt.Errorf("container %s", strings.ToLower(res.Status))
+			}
+		}
+		if len(pending) == 0 {
+			return 0, nil
+		}
+
+		time.Sleep(delay)
+	}
+
+	for i := range containerIDs {
+		if pending[i] {
+			return i, fmt.Errorf("container %s not ready after %s", containerIDs[i], time.Duration(maxRetries)*delay)
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"social-sync-backend/middleware"
+	"social-sync-backend/utils"
+
+	"github.com/google/uuid"
+)
+
+const (
+	tiktokAuthURL = "https://www.tiktok.com/v2/auth/authorize/"
+	tiktokAPIURL  = "https://open.tiktokapis.com/v2"
+	tiktokScopes  = "user.info.basic,video.publish,video.upload"
+)
+
+// tiktokToken is TikTok's token endpoint response. TikTok names the client ID
+// client_key, so the oauth2 package cannot be used for the exchange.
+type tiktokToken struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresIn int64  `json:"refresh_expires_in"`
+	OpenID           string `json:"open_id"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// TikTokRedirectHandler initiates the OAuth flow with PKCE and redirects to TikTok
+func TikTokRedirectHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appUserIDStr, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated.", http.StatusUnauthorized)
+			return
+		}
+		if _, err := uuid.Parse(appUserIDStr); err != nil {
+			http.Error(w, "Invalid user ID format.", http.StatusInternalServerError)
+			return
+		}
+
+		redirectURL := utils.GetCallbackURL("tiktok")
+		if redirectURL == "" {
+			log.Fatal("TIKTOK_REDIRECT_URL is empty!")
+		}
+
+		codeVerifier, codeChallenge, err := generatePKCE()
+		if err != nil {
+			http.Error(w, "Failed to generate PKCE parameters", http.StatusInternalServerError)
+			return
+		}
+
+		state := fmt.Sprintf("%s:%d", appUserIDStr, time.Now().UnixNano())
+		pkceStore[state] = codeVerifier
+
+		params := url.Values{
+			"client_key":            {os.Getenv("TIKTOK_CLIENT_KEY")},
+			"scope":                 {tiktokScopes},
+			"response_type":         {"code"},
+			"redirect_uri":          {redirectURL},
+			"state":                 {state},
+			"code_challenge":        {codeChallenge},
+			"code_challenge_method": {"S256"},
+		}
+		http.Redirect(w, r, tiktokAuthURL+"?"+params.Encode(), http.StatusTemporaryRedirect)
+	}
+}
+
+// TikTokCallbackHandler exchanges the code, fetches the creator profile and saves the account
+func TikTokCallbackHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		state := r.URL.Query().Get("state")
+		codeVerifier, exists := pkceStore[state]
+		if state == "" || !exists {
+			http.Error(w, "Invalid state: code verifier not found", http.StatusBadRequest)
+			return
+		}
+		delete(pkceStore, state)
+
+		appUserIDStr := strings.Split(state, ":")[0]
+		if _, err := uuid.Parse(appUserIDStr); err != nil {
+			http.Error(w, "Invalid user ID in state parameter", http.StatusBadRequest)
+			return
+		}
+
+		code := r.URL.Query().Get("code")
+		if code == "" {
+			redirectURL := fmt.Sprintf("%s/home/manage-accounts?error=tiktok", utils.GetFrontendURL())
+			http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+			return
+		}
+
+		token, err := tiktokTokenRequest(url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"redirect_uri":  {utils.GetCallbackURL("tiktok")},
+			"code_verifier": {codeVerifier},
+		})
+		if err != nil {
+			http.Error(w, "Token exchange failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var userInfo struct {
+			Data struct {
+				User struct {
+					OpenID      string `json:"open_id"`
+					AvatarURL   string `json:"avatar_url"`
+					DisplayName string `json:"display_name"`
+				} `json:"user"`
+			} `json:"data"`
+		}
+		if err := tiktokRequest(token.AccessToken, "GET", "/user/info/?fields=open_id,avatar_url,display_name", nil, &userInfo); err != nil {
+			http.Error(w, "Failed to fetch user info: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		expiresAt := time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+		_, err = db.Exec(`
+			INSERT INTO social_accounts (
+				user_id, platform, social_id, access_token, access_token_expires_at,
+				refresh_token, profile_picture_url, profile_name, connected_at
+			) VALUES (
+				$1, 'tiktok', $2, $3, $4, $5, $6, $7, NOW()
+			)
+			ON CONFLICT (user_id, platform) DO UPDATE SET
+				access_token = EXCLUDED.access_token,
+				access_token_expires_at = EXCLUDED.access_token_expires_at,
+				refresh_token = EXCLUDED.refresh_token,
+				social_id = EXCLUDED.social_id,
+				profile_picture_url = EXCLUDED.profile_picture_url,
+				profile_name = EXCLUDED.profile_name,
+				connected_at = NOW()
+		`,
+			appUserIDStr,
+			token.OpenID,
+			token.AccessToken,
+			expiresAt,
+			token.RefreshToken,
+			userInfo.Data.User.AvatarURL,
+			userInfo.Data.User.DisplayName,
+		)
+		if err != nil {
+			http.Error(w, "Failed to save TikTok account: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		redirectURL := fmt.Sprintf("%s/home/manage-accounts?connected=tiktok", utils.GetFrontendURL())
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+	}
+}
+
+// getTikTokAccessToken returns a valid access token, refreshing it when it
+// has expired. TikTok access tokens last a day, refresh tokens a year.
+func getTikTokAccessToken(db *sql.DB, userID string) (string, error) {
+	var accessToken string
+	var expiresAt *time.Time
+	var refreshToken *string
+	err := db.QueryRow(`
+		SELECT access_token, access_token_expires_at, refresh_token
+		FROM social_accounts
+		WHERE user_id = $1 AND platform = 'tiktok'
+	`, userID).Scan(&accessToken, &expiresAt, &refreshToken)
+	if err != nil {
+		return "", err
+	}
+	if expiresAt == nil || time.Now().Add(time.Minute).Before(*expiresAt) {
+		return accessToken, nil
+	}
+	if refreshToken == nil || *refreshToken == "" {
+		return "", fmt.Errorf("TikTok access token has expired. Please reconnect your account.")
+	}
+
+	token, err := tiktokTokenRequest(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {*refreshToken},
+	})
+	if err != nil {
+		return "", fmt.Errorf("TikTok access token has expired and could not be refreshed. Please reconnect your account.")
+	}
+
+	newExpiry := time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	_, err = db.Exec(`
+		UPDATE social_accounts
+		SET access_token = $1, access_token_expires_at = $2, refresh_token = $3, last_synced_at = NOW()
+		WHERE user_id = $4 AND platform = 'tiktok'
+	`, token.AccessToken, newExpiry, token.RefreshToken, userID)
+	if err != nil {
+		log.Printf("[TikTok] Failed to store refreshed token for user %s: %v", userID, err)
+	}
+	return token.AccessToken, nil
+}
+
+func tiktokTokenRequest(form url.Values) (*tiktokToken, error) {
+	form.Set("client_key", os.Getenv("TIKTOK_CLIENT_KEY"))
+	form.Set("client_secret", os.Getenv("TIKTOK_CLIENT_SECRET"))
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.PostForm(tiktokAPIURL+"/oauth/token/", form)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var token tiktokToken
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %v", err)
+	}
+	if token.Error != "" || token.AccessToken == "" {
+		return nil, fmt.Errorf("%s: %s", token.Error, token.ErrorDescription)
+	}
+	return &token, nil
+}
+
+// tiktokAPIError is the error object every Content Posting API response carries.
+type tiktokAPIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *tiktokAPIError) Error() string {
+	return fmt.Sprintf("TikTok API error %s: %s", e.Code, e.Message)
+}
+
+// tiktokRequest calls the TikTok v2 API and decodes the response into out. A
+// response whose error code is not "ok" becomes a *tiktokAPIError.
+func tiktokRequest(accessToken, method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, tiktokAPIURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("TikTok request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var envelope struct {
+		Error tiktokAPIError `json:"error"`
+	}
+	if err := json.Unmarshal(respBody, &envelope); err != nil {
+		return fmt.Errorf("TikTok API error (status %d): %s", resp.StatusCode, respBody)
+	}
+	if envelope.Error.Code != "" && envelope.Error.Code != "ok" {
+		return &envelope.Error
+	}
+	if out != nil {
+		return json.Unmarshal(respBody, out)
+	}
+	return nil
+}
@@ -0,0 +1,450 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+	"social-sync-backend/utils"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	tiktokMinChunkSize = 5 << 20
+	tiktokChunkSize    = 10 << 20
+	tiktokMaxChunkSize = 64 << 20
+
+	tiktokStatusPollInterval = 10 * time.Second
+	tiktokStatusPollTimeout  = 15 * time.Minute
+)
+
+type TikTokPostRequest struct {
+	Message        string `json:"message"`
+	VideoURL       string `json:"videoUrl"`
+	PrivacyLevel   string `json:"privacyLevel"`     // must be one of creator_info's privacy_level_options
+	Source         string `json:"source,omitempty"` // FILE_UPLOAD (default) or PULL_FROM_URL
+	DisableComment bool   `json:"disableComment,omitempty"`
+	DisableDuet    bool   `json:"disableDuet,omitempty"`
+	DisableStitch  bool   `json:"disableStitch,omitempty"`
+	CoverTimestamp int    `json:"coverTimestampMs,omitempty"`
+}
+
+// tiktokCreatorInfo is what TikTok requires apps to show before posting.
+type tiktokCreatorInfo struct {
+	CreatorUsername         string   `json:"creator_username"`
+	CreatorNickname         string   `json:"creator_nickname"`
+	CreatorAvatarURL        string   `json:"creator_avatar_url"`
+	PrivacyLevelOptions     []string `json:"privacy_level_options"`
+	CommentDisabled         bool     `json:"comment_disabled"`
+	DuetDisabled            bool     `json:"duet_disabled"`
+	StitchDisabled          bool     `json:"stitch_disabled"`
+	MaxVideoPostDurationSec int      `json:"max_video_post_duration_sec"`
+}
+
+type tiktokPublishStatus struct {
+	Status                   string  `json:"status"`
+	FailReason               string  `json:"fail_reason,omitempty"`
+	PubliclyAvailablePostIDs []int64 `json:"publicaly_available_post_id,omitempty"`
+	UploadedBytes            int64   `json:"uploaded_bytes,omitempty"`
+}
+
+func queryTikTokCreatorInfo(accessToken string) (*tiktokCreatorInfo, error) {
+	var res struct {
+		Data tiktokCreatorInfo `json:"data"`
+	}
+	if err := tiktokRequest(accessToken, "POST", "/post/publish/creator_info/query/", map[string]interface{}{}, &res); err != nil {
+		return nil, err
+	}
+	return &res.Data, nil
+}
+
+// GET /api/tiktok/creator-info
+// Returns the privacy levels and maximum video duration the creator may use.
+func GetTikTokCreatorInfoHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		accessToken, err := getTikTokAccessToken(db, userID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "TikTok account not connected", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		info, err := queryTikTokCreatorInfo(accessToken)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to fetch TikTok creator info: %v", err), http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	}
+}
+
+// PostToTikTokHandler starts a direct post. The video upload and TikTok's
+// processing run in the background; the response carries the publish ID to
+// poll with GET /api/tiktok/post/{publishId}/status.
+func PostToTikTokHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var req TikTokPostRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		req.VideoURL = strings.TrimSpace(req.VideoURL)
+		if req.VideoURL == "" {
+			http.Error(w, "TikTok requires a videoUrl", http.StatusBadRequest)
+			return
+		}
+		if !isVideoURL(req.VideoURL) {
+			http.Error(w, "TikTok only supports video posts", http.StatusBadRequest)
+			return
+		}
+		message := strings.TrimSpace(req.Message)
+		if n := utils.MeasureText("tiktok", message, 0); !n.Valid {
+			http.Error(w, fmt.Sprintf("Caption exceeds TikTok's %d character limit (%d characters)", n.Limit, n.Length), http.StatusBadRequest)
+			return
+		}
+		source := strings.ToUpper(req.Source)
+		if source == "" {
+			source = "FILE_UPLOAD"
+		}
+		if source != "FILE_UPLOAD" && source != "PULL_FROM_URL" {
+			http.Error(w, "source must be FILE_UPLOAD or PULL_FROM_URL", http.StatusBadRequest)
+			return
+		}
+
+		accessToken, err := getTikTokAccessToken(db, userID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "TikTok account not connected", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		// TikTok requires checking the creator's current settings before every post
+		info, err := queryTikTokCreatorInfo(accessToken)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to fetch TikTok creator info: %v", err), http.StatusBadGateway)
+			return
+		}
+		if !containsString(info.PrivacyLevelOptions, req.PrivacyLevel) {
+			http.Error(w, fmt.Sprintf("privacyLevel must be one of: %s", strings.Join(info.PrivacyLevelOptions, ", ")), http.StatusBadRequest)
+			return
+		}
+		// A video over the account's limit would only fail after the upload,
+		// with an opaque status
+		if maxDuration := info.MaxVideoPostDurationSec; maxDuration > 0 {
+			if meta, err := lib.GetCloudinaryVideoInfo(req.VideoURL); err != nil {
+				log.Printf("[TikTok] Could not check the length of %s: %v", req.VideoURL, err)
+			} else if meta.Duration > float64(maxDuration) {
+				http.Error(w, fmt.Sprintf("Video is %.0f seconds long; this TikTok account can post videos of up to %d seconds", meta.Duration, maxDuration), http.StatusBadRequest)
+				return
+			}
+		}
+
+		postInfo := map[string]interface{}{
+			"title":           message,
+			"privacy_level":   req.PrivacyLevel,
+			"disable_comment": req.DisableComment || info.CommentDisabled,
+			"disable_duet":    req.DisableDuet || info.DuetDisabled,
+			"disable_stitch":  req.DisableStitch || info.StitchDisabled,
+		}
+		if req.CoverTimestamp > 0 {
+			postInfo["video_cover_timestamp_ms"] = req.CoverTimestamp
+		}
+
+		var video *os.File
+		sourceInfo := map[string]interface{}{"source": source}
+		if source == "PULL_FROM_URL" {
+			sourceInfo["video_url"] = req.VideoURL
+		} else {
+			// The upload needs the exact size up front, so buffer the file first
+			var size int64
+			video, size, err = bufferMedia(req.VideoURL)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			chunkSize, chunks := tiktokChunks(size)
+			sourceInfo["video_size"] = size
+			sourceInfo["chunk_size"] = chunkSize
+			sourceInfo["total_chunk_count"] = chunks
+		}
+
+		var initRes struct {
+			Data struct {
+				PublishID string `json:"publish_id"`
+				UploadURL string `json:"upload_url"`
+			} `json:"data"`
+		}
+		err = tiktokRequest(accessToken, "POST", "/post/publish/video/init/", map[string]interface{}{
+			"post_info":   postInfo,
+			"source_info": sourceInfo,
+		}, &initRes)
+		if err != nil {
+			if video != nil {
+				video.Close()
+				os.Remove(video.Name())
+			}
+			http.Error(w, fmt.Sprintf("Failed to start TikTok post: %v", err), http.StatusBadGateway)
+			return
+		}
+		publishID := initRes.Data.PublishID
+
+		uid, _ := uuid.Parse(userID)
+		now := time.Now().UTC()
+		post := models.Post{
+			ID:             uuid.New(),
+			UserID:         uid,
+			Platform:       "tiktok",
+			PlatformPostID: publishID,
+			Message:        message,
+			MediaURLs:      []string{req.VideoURL},
+			PostedAt:       now,
+			Status:         "processing",
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		if err := models.SavePost(db, post); err != nil {
+			log.Printf("ERROR: Failed to save TikTok post for user %s: %v", userID, err)
+		}
+
+		go func() {
+			if video != nil {
+				err := uploadTikTokChunks(initRes.Data.UploadURL, video)
+				video.Close()
+				os.Remove(video.Name())
+				if err != nil {
+					log.Printf("[TikTok] Upload failed for publish %s: %v", publishID, err)
+					if err := models.UpdatePostStatus(db, "tiktok", publishID, "failed"); err != nil {
+						log.Printf("[TikTok] Failed to update post status: %v", err)
+					}
+					return
+				}
+			}
+			trackTikTokPublish(db, userID, publishID)
+		}()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":   "TikTok upload started. Check the status endpoint for progress.",
+			"publishId": publishID,
+			"status":    "processing",
+			"statusUrl": fmt.Sprintf("/api/tiktok/post/%s/status", publishID),
+		})
+	}
+}
+
+// GET /api/tiktok/post/{publishId}/status
+func GetTikTokPostStatusHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+		publishID := mux.Vars(r)["publishId"]
+
+		var status string
+		err = db.QueryRow(`
+			SELECT status FROM posts
+			WHERE user_id = $1 AND platform = 'tiktok' AND platform_post_id = $2
+		`, userID, publishID).Scan(&status)
+		if err == sql.ErrNoRows {
+			http.Error(w, "TikTok post not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to load TikTok post", http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]interface{}{
+			"publishId": publishID,
+			"status":    status,
+		}
+
+		// Ask TikTok for live progress while the post is still in flight
+		if status == "processing" {
+			accessToken, err := getTikTokAccessToken(db, userID)
+			if err == nil {
+				if live, err := fetchTikTokPublishStatus(accessToken, publishID); err == nil {
+					response["tiktokStatus"] = live.Status
+					response["uploadedBytes"] = live.UploadedBytes
+					if live.FailReason != "" {
+						response["failReason"] = live.FailReason
+					}
+				} else {
+					log.Printf("[TikTok] Status fetch failed for %s: %v", publishID, err)
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func fetchTikTokPublishStatus(accessToken, publishID string) (*tiktokPublishStatus, error) {
+	var res struct {
+		Data tiktokPublishStatus `json:"data"`
+	}
+	err := tiktokRequest(accessToken, "POST", "/post/publish/status/fetch/", map[string]string{
+		"publish_id": publishID,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res.Data, nil
+}
+
+// trackTikTokPublish polls TikTok until the post completes or fails and
+// records the outcome on the post.
+func trackTikTokPublish(db *sql.DB, userID, publishID string) {
+	deadline := time.Now().Add(tiktokStatusPollTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(tiktokStatusPollInterval)
+
+		accessToken, err := getTikTokAccessToken(db, userID)
+		if err != nil {
+			log.Printf("[TikTok] Stopped tracking %s: %v", publishID, err)
+			return
+		}
+		status, err := fetchTikTokPublishStatus(accessToken, publishID)
+		if err != nil {
+			log.Printf("[TikTok] Status fetch failed for %s: %v", publishID, err)
+			continue
+		}
+
+		var final string
+		switch status.Status {
+		case "PUBLISH_COMPLETE", "SEND_TO_USER_INBOX":
+			final = "posted"
+		case "FAILED":
+			final = "failed"
+			log.Printf("[TikTok] Publish %s failed: %s", publishID, status.FailReason)
+		default:
+			continue
+		}
+		if err := models.UpdatePostStatus(db, "tiktok", publishID, final); err != nil {
+			log.Printf("[TikTok] Failed to update post status: %v", err)
+		}
+		return
+	}
+	log.Printf("[TikTok] Gave up tracking %s after %s", publishID, tiktokStatusPollTimeout)
+}
+
+// tiktokChunks returns the chunk size and count for a file. Videos under 5MB
+// go in one chunk; otherwise the last chunk absorbs the remainder.
+func tiktokChunks(size int64) (int64, int64) {
+	if size < tiktokMinChunkSize {
+		return size, 1
+	}
+	chunkSize := int64(tiktokChunkSize)
+	if size/chunkSize > 1000 {
+		chunkSize = tiktokMaxChunkSize
+	}
+	if size < chunkSize {
+		return size, 1
+	}
+	return chunkSize, size / chunkSize
+}
+
+func uploadTikTokChunks(uploadURL string, video *os.File) error {
+	info, err := video.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	chunkSize, chunks := tiktokChunks(size)
+
+	client := &http.Client{Timeout: 10 * time.Minute}
+	for i := int64(0); i < chunks; i++ {
+		start := i * chunkSize
+		end := start + chunkSize - 1
+		if i == chunks-1 {
+			end = size - 1
+		}
+
+		req, err := http.NewRequest("PUT", uploadURL, io.NewSectionReader(video, start, end-start+1))
+		if err != nil {
+			return err
+		}
+		req.ContentLength = end - start + 1
+		req.Header.Set("Content-Type", "video/mp4")
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("chunk %d: %v", i+1, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("chunk %d: status %d: %s", i+1, resp.StatusCode, body)
+		}
+	}
+	return nil
+}
+
+// bufferMedia downloads a media URL into a temporary file and returns it
+// rewound, along with its size. The caller must close and remove the file.
+func bufferMedia(mediaURL string) (*os.File, int64, error) {
+	body, _, _, err := downloadMedia(mediaURL)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp("", "media-*")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to buffer media: %v", err)
+	}
+	size, err := io.Copy(tmp, body)
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, 0, errors.New("failed to download media")
+	}
+	return tmp, size, nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -46,7 +46,7 @@ func getTwitterOAuthConfig() *oauth2.Config {
 		ClientID:     os.Getenv("TWITTER_CLIENT_ID"),
 		ClientSecret: os.Getenv("TWITTER_CLIENT_SECRET"),
 		RedirectURL:  redirectURL,
-		Scopes:       []string{"tweet.read", "tweet.write", "users.read"},
+		Scopes:       []string{"tweet.read", "tweet.write", "users.read", "media.write"},
 		Endpoint: oauth2.Endpoint{
 			AuthURL:  "https://twitter.com/i/oauth2/authorize",
 			TokenURL: "https://api.twitter.com/2/oauth2/token",
@@ -0,0 +1,365 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-sync-backend/models"
+)
+
+const (
+	twitterMediaUploadURL   = "https://api.twitter.com/2/media/upload"
+	twitterMediaMetadataURL = "https://api.twitter.com/2/media/metadata"
+
+	twitterMaxImages       = 4
+	twitterMaxImageBytes   = 5 << 20
+	twitterMaxGIFBytes     = 15 << 20
+	twitterMaxVideoBytes   = 512 << 20
+	twitterChunkSize       = 4 << 20
+	twitterMaxAltTextChars = 1000
+)
+
+// twitterMediaResponse covers both the v2 ({"data": {...}}) and the legacy
+// v1.1 (top-level media_id_string) upload response shapes.
+type twitterMediaResponse struct {
+	Data struct {
+		ID             string                 `json:"id"`
+		ProcessingInfo *twitterProcessingInfo `json:"processing_info"`
+	} `json:"data"`
+	MediaIDString  string                 `json:"media_id_string"`
+	ProcessingInfo *twitterProcessingInfo `json:"processing_info"`
+}
+
+type twitterProcessingInfo struct {
+	State          string `json:"state"` // pending, in_progress, succeeded, failed
+	CheckAfterSecs int    `json:"check_after_secs"`
+	Error          *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (r twitterMediaResponse) mediaID() string {
+	if r.Data.ID != "" {
+		return r.Data.ID
+	}
+	return r.MediaIDString
+}
+
+func (r twitterMediaResponse) processingInfo() *twitterProcessingInfo {
+	if r.Data.ProcessingInfo != nil {
+		return r.Data.ProcessingInfo
+	}
+	return r.ProcessingInfo
+}
+
+// twitterMediaKind classifies a media item as image, gif or video.
+func twitterMediaKind(mediaURL string) string {
+	lower := strings.ToLower(mediaURL)
+	if i := strings.IndexAny(lower, "?#"); i != -1 {
+		lower = lower[:i]
+	}
+	switch {
+	case strings.HasSuffix(lower, ".gif"):
+		return "gif"
+	case isVideoURL(lower):
+		return "video"
+	default:
+		return "image"
+	}
+}
+
+// validateTwitterMedia checks per-item limits. How many items fit in one tweet
+// (4 images, or a single video or GIF) is enforced by distributeThreadMedia.
+func validateTwitterMedia(items []models.MediaItem) error {
+	for _, item := range items {
+		if len([]rune(item.AltText)) > twitterMaxAltTextChars {
+			return fmt.Errorf("alt text cannot exceed %d characters", twitterMaxAltTextChars)
+		}
+	}
+	return nil
+}
+
+// twitterThreadMedia converts media items for distribution across a thread.
+func twitterThreadMedia(items []models.MediaItem) []threadMedia {
+	media := make([]threadMedia, 0, len(items))
+	for _, item := range items {
+		media = append(media, threadMedia{
+			URL:     item.URL,
+			AltText: item.AltText,
+			Video:   twitterMediaKind(item.URL) != "image",
+		})
+	}
+	return media
+}
+
+// uploadTwitterMedia uploads every item and returns the media IDs in order.
+func uploadTwitterMedia(accessToken string, items []threadMedia) ([]string, error) {
+	mediaIDs := make([]string, 0, len(items))
+	for i, item := range items {
+		var mediaID string
+		var err error
+		if twitterMediaKind(item.URL) == "image" {
+			mediaID, err = uploadTwitterImage(accessToken, item.URL)
+		} else {
+			mediaID, err = uploadTwitterMediaChunked(accessToken, item.URL)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("media %d: %w", i+1, err)
+		}
+
+		if item.AltText != "" {
+			if err := setTwitterMediaAltText(accessToken, mediaID, item.AltText); err != nil {
+				return nil, fmt.Errorf("media %d: %w", i+1, err)
+			}
+		}
+		mediaIDs = append(mediaIDs, mediaID)
+	}
+	return mediaIDs, nil
+}
+
+// downloadMedia opens a media URL for reading and reports its size and MIME type.
+// The caller must close the returned body.
+func downloadMedia(mediaURL string) (io.ReadCloser, int64, string, error) {
+	client := &http.Client{Timeout: 10 * time.Minute}
+	resp, err := client.Get(mediaURL)
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("failed to download media: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, 0, "", fmt.Errorf("failed to download media: status %d", resp.StatusCode)
+	}
+
+	mediaType := resp.Header.Get("Content-Type")
+	if mt, _, err := mime.ParseMediaType(mediaType); err == nil {
+		mediaType = mt
+	}
+	if mediaType == "" || mediaType == "application/octet-stream" {
+		mediaType = mime.TypeByExtension(path.Ext(strings.SplitN(mediaURL, "?", 2)[0]))
+	}
+
+	return resp.Body, resp.ContentLength, mediaType, nil
+}
+
+// uploadTwitterImage sends an image in a single multipart request.
+func uploadTwitterImage(accessToken, mediaURL string) (string, error) {
+	body, size, mediaType, err := downloadMedia(mediaURL)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	if size > twitterMaxImageBytes {
+		return "", fmt.Errorf("image exceeds Twitter's %dMB limit", twitterMaxImageBytes>>20)
+	}
+
+	var b bytes.Buffer
+	writer := multipart.NewWriter(&b)
+	writer.WriteField("media_category", "tweet_image")
+	if mediaType != "" {
+		writer.WriteField("media_type", mediaType)
+	}
+	part, err := writer.CreateFormFile("media", path.Base(mediaURL))
+	if err != nil {
+		return "", err
+	}
+	n, err := io.Copy(part, io.LimitReader(body, twitterMaxImageBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %v", err)
+	}
+	if n > twitterMaxImageBytes {
+		return "", fmt.Errorf("image exceeds Twitter's %dMB limit", twitterMaxImageBytes>>20)
+	}
+	writer.Close()
+
+	res, err := twitterMediaRequest(accessToken, "POST", twitterMediaUploadURL, writer.FormDataContentType(), &b)
+	if err != nil {
+		return "", err
+	}
+	if res.mediaID() == "" {
+		return "", fmt.Errorf("twitter media upload returned no media ID")
+	}
+	return res.mediaID(), nil
+}
+
+// uploadTwitterMediaChunked runs the initialize/append/finalize sequence used for
+// videos and GIFs, streaming the file from its URL one chunk at a time, then
+// polls the upload status until processing is done.
+func uploadTwitterMediaChunked(accessToken, mediaURL string) (string, error) {
+	body, size, mediaType, err := downloadMedia(mediaURL)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	category, limit := "tweet_video", int64(twitterMaxVideoBytes)
+	if twitterMediaKind(mediaURL) == "gif" {
+		category, limit = "tweet_gif", twitterMaxGIFBytes
+	}
+	if size <= 0 {
+		return "", fmt.Errorf("media server did not report a file size")
+	}
+	if size > limit {
+		return "", fmt.Errorf("media exceeds Twitter's %dMB limit", limit>>20)
+	}
+	if mediaType == "" {
+		mediaType = "video/mp4"
+	}
+
+	initPayload, err := json.Marshal(map[string]interface{}{
+		"total_bytes":    size,
+		"media_type":     mediaType,
+		"media_category": category,
+	})
+	if err != nil {
+		return "", err
+	}
+	initRes, err := twitterMediaRequest(accessToken, "POST", twitterMediaUploadURL+"/initialize",
+		"application/json", bytes.NewReader(initPayload))
+	if err != nil {
+		return "", fmt.Errorf("initialize failed: %w", err)
+	}
+	mediaID := initRes.mediaID()
+	if mediaID == "" {
+		return "", fmt.Errorf("initialize returned no media ID")
+	}
+	uploadURL := twitterMediaUploadURL + "/" + url.PathEscape(mediaID)
+
+	chunk := make([]byte, twitterChunkSize)
+	for segment := 0; ; segment++ {
+		n, readErr := io.ReadFull(body, chunk)
+		if n > 0 {
+			var b bytes.Buffer
+			writer := multipart.NewWriter(&b)
+			writer.WriteField("segment_index", strconv.Itoa(segment))
+			part, err := writer.CreateFormFile("media", "chunk")
+			if err != nil {
+				return "", err
+			}
+			part.Write(chunk[:n])
+			writer.Close()
+
+			if _, err := twitterMediaRequest(accessToken, "POST", uploadURL+"/append", writer.FormDataContentType(), &b); err != nil {
+				return "", fmt.Errorf("append of segment %d failed: %w", segment, err)
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return "", fmt.Errorf("failed to read media: %v", readErr)
+		}
+	}
+
+	finalRes, err := twitterMediaRequest(accessToken, "POST", uploadURL+"/finalize", "", nil)
+	if err != nil {
+		return "", fmt.Errorf("finalize failed: %w", err)
+	}
+
+	info := finalRes.processingInfo()
+	for attempt := 0; info != nil && attempt < 60; attempt++ {
+		switch info.State {
+		case "succeeded":
+			return mediaID, nil
+		case "failed":
+			if info.Error != nil {
+				return "", fmt.Errorf("media processing failed: %s", info.Error.Message)
+			}
+			return "", fmt.Errorf("media processing failed")
+		}
+
+		wait := time.Duration(info.CheckAfterSecs) * time.Second
+		if wait <= 0 {
+			wait = 2 * time.Second
+		}
+		time.Sleep(wait)
+
+		statusURL := fmt.Sprintf("%s?command=STATUS&media_id=%s", twitterMediaUploadURL, url.QueryEscape(mediaID))
+		statusRes, err := twitterMediaRequest(accessToken, "GET", statusURL, "", nil)
+		if err != nil {
+			return "", fmt.Errorf("status check failed: %w", err)
+		}
+		info = statusRes.processingInfo()
+	}
+	if info != nil {
+		return "", fmt.Errorf("media %s still processing, try again later", mediaID)
+	}
+
+	return mediaID, nil
+}
+
+// setTwitterMediaAltText attaches alt text to an uploaded media item.
+func setTwitterMediaAltText(accessToken, mediaID, altText string) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"id": mediaID,
+		"metadata": map[string]interface{}{
+			"alt_text": map[string]string{"text": altText},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", twitterMediaMetadataURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to set alt text: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to set alt text: %s", string(body))
+	}
+	return nil
+}
+
+// twitterMediaRequest performs a media endpoint call and decodes the response.
+func twitterMediaRequest(accessToken, method, endpoint, contentType string, body io.Reader) (*twitterMediaResponse, error) {
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("User-Agent", "SocialSync/1.0")
+
+	client := &http.Client{Timeout: 2 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("twitter media API error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	var res twitterMediaResponse
+	if len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, &res); err != nil {
+			return nil, fmt.Errorf("failed to decode twitter media response: %v", err)
+		}
+	}
+	return &res, nil
+}
@@ -4,17 +4,26 @@ import (
 	"bytes"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"strings"
 	"time"
 
 	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+	"social-sync-backend/utils"
 )
 
+const twitterCharLimit = 280
+
 type TwitterPostRequest struct {
-	Message string `json:"message"`
+	Message   string             `json:"message"`
+	MediaUrls []string           `json:"mediaUrls,omitempty"`
+	Media     []models.MediaItem `json:"media,omitempty"` // media with alt text, merged with MediaUrls
+	ThreadOptions
 }
 
 type TwitterPostResponse struct {
@@ -31,6 +40,14 @@ type TwitterErrorResponse struct {
 	} `json:"errors"`
 }
 
+// twitterAPIError carries the user-facing message and HTTP status for a failed tweet.
+type twitterAPIError struct {
+	Status  int
+	Message string
+}
+
+func (e *twitterAPIError) Error() string { return e.Message }
+
 func PostToTwitterHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, err := middleware.GetUserIDFromContext(r)
@@ -45,16 +62,37 @@ func PostToTwitterHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		mediaItems, err := resolveMediaItems(db, userID, req.MediaUrls, req.Media)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := validateTwitterMedia(mediaItems); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		// Validate message
 		message := strings.TrimSpace(req.Message)
-		if message == "" {
+		if message == "" && len(req.Thread) == 0 && len(mediaItems) == 0 {
 			http.Error(w, "Message cannot be empty", http.StatusBadRequest)
 			return
 		}
 
-		// Check Twitter character limit (280 characters)
-		if len(message) > 280 {
-			http.Error(w, "Message exceeds Twitter's 280 character limit", http.StatusBadRequest)
+		// Check Twitter character limit, splitting into a thread if requested
+		texts, err := buildThreadSegments(message, req.ThreadOptions, twitterCharLimit, utils.TwitterTextLength, "Twitter")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(texts) == 0 {
+			// Media-only tweet
+			texts = []string{""}
+		}
+
+		segments, err := distributeThreadMedia(texts, twitterThreadMedia(mediaItems), twitterMaxImages)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
@@ -78,10 +116,6 @@ func PostToTwitterHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Debug: Print the access token (first 10 chars for privacy)
-		fmt.Printf("DEBUG: Twitter access token (first 10 chars): %s\n", accessToken[:10])
-		fmt.Printf("DEBUG: Twitter message content: %q\n", message)
-
 		// Check if token is expired (if expiry is set)
 		if tokenExpiry != nil && time.Now().After(*tokenExpiry) {
 			// In a production app, you'd refresh the token here
@@ -90,26 +124,107 @@ func PostToTwitterHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Prepare tweet payload
-		tweetPayload := map[string]interface{}{
-			"text": message,
+		results, err := publishThread(segments, func(seg threadSegment, replyTo string) (string, string, error) {
+			// Upload this segment's media before creating the tweet
+			mediaIDs, err := uploadTwitterMedia(accessToken, seg.Media)
+			if err != nil {
+				log.Printf("[Twitter] Media upload failed for user %s: %v", userID, err)
+				return "", "", &twitterAPIError{Status: http.StatusBadGateway, Message: fmt.Sprintf("Failed to upload media to Twitter: %v", err)}
+			}
+
+			tweet, err := createTweet(accessToken, seg.Text, mediaIDs, replyTo)
+			if err != nil {
+				return "", "", err
+			}
+			return tweet.Data.ID, fmt.Sprintf("https://twitter.com/i/web/status/%s", tweet.Data.ID), nil
+		})
+
+		if len(results) > 0 {
+			if err := saveThreadPosts(db, userID, "twitter", segments, results); err != nil {
+				log.Printf("ERROR: Failed to save tweets for user %s: %v", userID, err)
+			}
 		}
 
-		payloadBytes, err := json.Marshal(tweetPayload)
 		if err != nil {
-			http.Error(w, "Failed to prepare tweet payload", http.StatusInternalServerError)
+			var tErr *threadError
+			errors.As(err, &tErr)
+			status, msg := http.StatusInternalServerError, err.Error()
+			var apiErr *twitterAPIError
+			if errors.As(err, &apiErr) {
+				status, msg = apiErr.Status, apiErr.Message
+			}
+
+			if len(segments) == 1 {
+				http.Error(w, msg, status)
+				return
+			}
+
+			// Partial thread: report what was posted and where it broke
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadGateway)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":         fmt.Sprintf("Thread failed at segment %d of %d: %s", tErr.Index+1, len(segments), msg),
+				"failedSegment": tErr.Index,
+				"segments":      results,
+			})
 			return
 		}
 
-		// Debug: Print the payload being sent
-		fmt.Printf("DEBUG: Twitter payload: %s\n", string(payloadBytes))
+		// Return success with tweet ID
+		response := map[string]interface{}{
+			"message": "Tweet published successfully",
+			"tweetId": results[0].ID,
+			"text":    results[0].Text,
+		}
+		if len(results) > 1 {
+			response["message"] = "Thread published successfully"
+			response["segments"] = results
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// createTweet posts a single tweet, optionally as a reply, and maps Twitter's
+// failures to a *twitterAPIError.
+func createTweet(accessToken, text string, mediaIDs []string, replyTo string) (*TwitterPostResponse, error) {
+	// Prepare tweet payload
+	tweetPayload := map[string]interface{}{}
+	if text != "" {
+		tweetPayload["text"] = text
+	}
+	if len(mediaIDs) > 0 {
+		tweetPayload["media"] = map[string]interface{}{
+			"media_ids": mediaIDs,
+		}
+	}
+	if replyTo != "" {
+		tweetPayload["reply"] = map[string]interface{}{
+			"in_reply_to_tweet_id": replyTo,
+		}
+	}
+
+	payloadBytes, err := json.Marshal(tweetPayload)
+	if err != nil {
+		return nil, &twitterAPIError{Status: http.StatusInternalServerError, Message: "Failed to prepare tweet payload"}
+	}
+
+	tweetURL := "https://api.twitter.com/2/tweets"
 
+	// Make the request
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	// Simple retry mechanism
+	var resp *http.Response
+	for attempt := 1; attempt <= 2; attempt++ {
 		// Create HTTP request to Twitter API
-		tweetURL := "https://api.twitter.com/2/tweets"
-		req_twitter, err := http.NewRequest("POST", tweetURL, bytes.NewBuffer(payloadBytes))
+		req_twitter, err := http.NewRequest("POST", tweetURL, bytes.NewReader(payloadBytes))
 		if err != nil {
-			http.Error(w, "Failed to create request", http.StatusInternalServerError)
-			return
+			return nil, &twitterAPIError{Status: http.StatusInternalServerError, Message: "Failed to create request"}
 		}
 
 		// Set headers - Use OAuth 2.0 Bearer token
@@ -118,117 +233,80 @@ func PostToTwitterHandler(db *sql.DB) http.HandlerFunc {
 		req_twitter.Header.Set("User-Agent", "SocialSync/1.0")
 		req_twitter.Header.Set("Accept", "application/json")
 
-		// Debug: Print request details
-		fmt.Printf("DEBUG: Twitter request URL: %s\n", tweetURL)
-		fmt.Printf("DEBUG: Twitter request headers: %v\n", req_twitter.Header)
-
-		// Make the request
-		client := &http.Client{
-			Timeout: 30 * time.Second,
-		}
-
-		// Simple retry mechanism
-		var resp *http.Response
-		for attempt := 1; attempt <= 2; attempt++ {
-			resp, err = client.Do(req_twitter)
-			if err != nil {
-				if attempt == 2 {
-					http.Error(w, "Failed to publish tweet", http.StatusInternalServerError)
-					return
-				}
-				time.Sleep(2 * time.Second)
-				continue
-			}
-
-			// If we get a 500 error, retry once
-			if resp.StatusCode == 500 && attempt == 1 {
-				fmt.Printf("DEBUG: Twitter API 500 error, retrying...\n")
-				resp.Body.Close()
-				time.Sleep(2 * time.Second)
-				continue
+		resp, err = client.Do(req_twitter)
+		if err != nil {
+			if attempt == 2 {
+				return nil, &twitterAPIError{Status: http.StatusInternalServerError, Message: "Failed to publish tweet"}
 			}
-
-			break
+			time.Sleep(2 * time.Second)
+			continue
 		}
-		defer resp.Body.Close()
 
-		// Handle response
-		if resp.StatusCode == http.StatusCreated {
-			// Success - Tweet posted
-			var twitterResp TwitterPostResponse
-			if err := json.NewDecoder(resp.Body).Decode(&twitterResp); err != nil {
-				// Even if we can't decode response, the tweet was posted successfully
-				w.WriteHeader(http.StatusOK)
-				w.Write([]byte("Tweet published successfully"))
-				return
-			}
-
-			// Return success with tweet ID
-			response := map[string]interface{}{
-				"message": "Tweet published successfully",
-				"tweetId": twitterResp.Data.ID,
-				"text":    twitterResp.Data.Text,
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(response)
-			return
+		// If we get a 500 error, retry once
+		if resp.StatusCode == 500 && attempt == 1 {
+			log.Printf("[Twitter] API returned 500, retrying")
+			resp.Body.Close()
+			time.Sleep(2 * time.Second)
+			continue
 		}
 
-		// Handle errors
-		fmt.Printf("DEBUG: Twitter API response status: %d\n", resp.StatusCode)
-
-		// Read the full response body for debugging
-		bodyBytes, err := io.ReadAll(resp.Body)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to read response body: %v", err), resp.StatusCode)
-			return
-		}
+		break
+	}
+	defer resp.Body.Close()
 
-		fmt.Printf("DEBUG: Twitter API response body: %s\n", string(bodyBytes))
+	// Read the full response body
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &twitterAPIError{Status: resp.StatusCode, Message: fmt.Sprintf("Failed to read response body: %v", err)}
+	}
 
-		// Handle specific error cases
-		if resp.StatusCode == 500 {
-			// Twitter API internal server error - this is usually temporary
-			http.Error(w, "Twitter API is experiencing temporary issues. Please try again in a few minutes.", http.StatusServiceUnavailable)
-			return
+	// Handle response
+	if resp.StatusCode == http.StatusCreated {
+		// Without the ID a thread can't continue and the post can't be managed
+		var twitterResp TwitterPostResponse
+		if err := json.Unmarshal(bodyBytes, &twitterResp); err != nil || twitterResp.Data.ID == "" {
+			log.Printf("[Twitter] Tweet was created but its ID couldn't be read: %v", err)
+			return nil, &twitterAPIError{Status: http.StatusBadGateway, Message: "Twitter accepted the tweet but didn't return its ID"}
 		}
+		return &twitterResp, nil
+	}
 
-		if resp.StatusCode == 429 {
-			// Rate limiting
-			http.Error(w, "Twitter API rate limit exceeded. Please wait a moment before trying again.", http.StatusTooManyRequests)
-			return
-		}
+	// Handle errors
+	log.Printf("[Twitter] Tweet request failed with status %d", resp.StatusCode)
 
-		if resp.StatusCode == 400 {
-			// Check if it's a Cloudflare response
-			if strings.Contains(string(bodyBytes), "cloudflare") || strings.Contains(string(bodyBytes), "400 Bad Request") {
-				http.Error(w, "Twitter API request was blocked. This might be due to rate limiting or temporary issues. Please try again later.", http.StatusBadRequest)
-				return
-			}
-		}
+	// Handle specific error cases
+	if resp.StatusCode == 500 {
+		// Twitter API internal server error - this is usually temporary
+		return nil, &twitterAPIError{Status: http.StatusServiceUnavailable, Message: "Twitter API is experiencing temporary issues. Please try again in a few minutes."}
+	}
 
-		// Check for specific error patterns
-		if strings.Contains(string(bodyBytes), "The string did not match the expected pattern") {
-			// This error often occurs when the text format is invalid
-			http.Error(w, "Invalid tweet text format. Please check for special characters or formatting issues.", http.StatusBadRequest)
-			return
-		}
+	if resp.StatusCode == 429 {
+		// Rate limiting
+		return nil, &twitterAPIError{Status: http.StatusTooManyRequests, Message: "Twitter API rate limit exceeded. Please wait a moment before trying again."}
+	}
 
-		var errorResp TwitterErrorResponse
-		if err := json.Unmarshal(bodyBytes, &errorResp); err != nil {
-			http.Error(w, fmt.Sprintf("Twitter API error (status: %d, body: %s)", resp.StatusCode, string(bodyBytes)), resp.StatusCode)
-			return
+	if resp.StatusCode == 400 {
+		// Check if it's a Cloudflare response
+		if strings.Contains(string(bodyBytes), "cloudflare") || strings.Contains(string(bodyBytes), "400 Bad Request") {
+			return nil, &twitterAPIError{Status: http.StatusBadRequest, Message: "Twitter API request was blocked. This might be due to rate limiting or temporary issues. Please try again later."}
 		}
+	}
 
-		// Return specific error message
-		if len(errorResp.Errors) > 0 {
-			errorMsg := errorResp.Errors[0].Message
-			http.Error(w, fmt.Sprintf("Twitter API error: %s", errorMsg), resp.StatusCode)
-			return
-		}
+	// Check for specific error patterns
+	if strings.Contains(string(bodyBytes), "The string did not match the expected pattern") {
+		// This error often occurs when the text format is invalid
+		return nil, &twitterAPIError{Status: http.StatusBadRequest, Message: "Invalid tweet text format. Please check for special characters or formatting issues."}
+	}
 
-		http.Error(w, "Unknown Twitter API error", resp.StatusCode)
+	var errorResp TwitterErrorResponse
+	if err := json.Unmarshal(bodyBytes, &errorResp); err != nil {
+		return nil, &twitterAPIError{Status: resp.StatusCode, Message: fmt.Sprintf("Twitter API error (status: %d, body: %s)", resp.StatusCode, string(bodyBytes))}
 	}
+
+	// Return specific error message
+	if len(errorResp.Errors) > 0 {
+		return nil, &twitterAPIError{Status: resp.StatusCode, Message: fmt.Sprintf("Twitter API error: %s", errorResp.Errors[0].Message)}
+	}
+
+	return nil, &twitterAPIError{Status: resp.StatusCode, Message: "Unknown Twitter API error"}
 }
@@ -1,13 +1,31 @@
 package controllers
 
 import (
+	"encoding/json"
+	"log"
 	"net/http"
+	"strings"
+	"time"
+
 	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+
 	"github.com/google/uuid"
-	// "log"
 )
 
 func UploadImageHandler(w http.ResponseWriter, r *http.Request) {
+	userIDStr, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+		return
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		http.Error(w, "Invalid user ID format", http.StatusBadRequest)
+		return
+	}
+
 	// Parse multipart form with max memory 10MB (adjust if needed)
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
 		http.Error(w, "Failed to parse multipart form: "+err.Error(), http.StatusBadRequest)
@@ -31,8 +49,38 @@ func UploadImageHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Record the upload in the user's media library
+	mediaType := "image"
+	if isVideoURL(uploadedURL) {
+		mediaType = "video"
+	}
+	var altText *string
+	if alt := strings.TrimSpace(r.FormValue("alt_text")); alt != "" {
+		altText = &alt
+	}
+	now := time.Now().UTC()
+	asset := models.MediaAsset{
+		ID:        uuid.New(),
+		UserID:    userID,
+		URL:       uploadedURL,
+		MediaType: mediaType,
+		AltText:   altText,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := models.SaveMediaAsset(lib.DB, asset); err != nil {
+		log.Printf("ERROR: Failed to save media asset for user %s: %v", userIDStr, err)
+		http.Error(w, "Failed to save media asset", http.StatusInternalServerError)
+		return
+	}
+
 	// Return JSON with URL
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"url":"` + uploadedURL + `"}`))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":       asset.URL,
+		"assetId":   asset.ID,
+		"mediaType": asset.MediaType,
+		"altText":   asset.AltText,
+	})
 }
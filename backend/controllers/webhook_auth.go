@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+type WebhookConnectRequest struct {
+	WebhookURL string `json:"webhook_url"`
+	Name       string `json:"name"` // optional label shown in the accounts list
+}
+
+// webhookInfo is what validating a webhook URL tells us about the destination.
+type webhookInfo struct {
+	SocialID string
+	Name     string
+	Avatar   *string
+}
+
+// POST /connect/{platform}  (discord or slack)
+// Registers an incoming webhook as a publishing destination. The URL is a
+// credential, so it is validated against the platform and stored encrypted.
+func ConnectWebhookHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		platform := mux.Vars(r)["platform"]
+
+		var req WebhookConnectRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.WebhookURL = strings.TrimSpace(req.WebhookURL)
+		if req.WebhookURL == "" {
+			http.Error(w, "webhook_url is required", http.StatusBadRequest)
+			return
+		}
+
+		var info *webhookInfo
+		switch platform {
+		case "discord":
+			info, err = validateDiscordWebhook(req.WebhookURL)
+		case "slack":
+			info, err = validateSlackWebhook(req.WebhookURL)
+		default:
+			http.Error(w, "Unsupported webhook platform", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("[Webhook] %s webhook rejected for user %s: %v", platform, userID, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if name := strings.TrimSpace(req.Name); name != "" {
+			info.Name = name
+		}
+
+		encryptedURL, err := lib.EncryptSecret(req.WebhookURL)
+		if err != nil {
+			log.Printf("[Webhook] Failed to encrypt webhook URL: %v", err)
+			http.Error(w, "Failed to store webhook", http.StatusInternalServerError)
+			return
+		}
+
+		_, err = db.Exec(`
+			INSERT INTO social_accounts (
+				user_id, platform, social_id, access_token, encrypted_secret,
+				profile_picture_url, profile_name, connected_at
+			) VALUES (
+				$1, $2, $3, '', $4, $5, $6, NOW()
+			)
+			ON CONFLICT (user_id, platform) DO UPDATE SET
+				social_id = EXCLUDED.social_id,
+				encrypted_secret = EXCLUDED.encrypted_secret,
+				profile_picture_url = EXCLUDED.profile_picture_url,
+				profile_name = EXCLUDED.profile_name,
+				connected_at = NOW()
+		`, userID, platform, info.SocialID, encryptedURL, info.Avatar, info.Name)
+		if err != nil {
+			log.Printf("[Webhook] Failed to save %s webhook for user %s: %v", platform, userID, err)
+			http.Error(w, "Failed to save webhook", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": fmt.Sprintf("%s webhook connected successfully!", webhookPlatformName(platform)),
+			"name":    info.Name,
+		})
+	}
+}
+
+// getWebhookURL decrypts the user's stored webhook URL for platform.
+func getWebhookURL(db *sql.DB, userID, platform string) (string, error) {
+	var encrypted *string
+	err := db.QueryRow(`
+		SELECT encrypted_secret FROM social_accounts
+		WHERE user_id = $1 AND platform = $2
+	`, userID, platform).Scan(&encrypted)
+	if err != nil {
+		return "", err
+	}
+	if encrypted == nil {
+		return "", fmt.Errorf("%s webhook is missing. Please reconnect it.", webhookPlatformName(platform))
+	}
+	return lib.DecryptSecret(*encrypted)
+}
+
+func webhookPlatformName(platform string) string {
+	if platform == "slack" {
+		return "Slack"
+	}
+	return "Discord"
+}
+
+// validateDiscordWebhook fetches the webhook object, which Discord returns
+// without authentication for a valid id/token pair.
+func validateDiscordWebhook(webhookURL string) (*webhookInfo, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil || u.Scheme != "https" ||
+		(u.Host != "discord.com" && u.Host != "discordapp.com" && u.Host != "ptb.discord.com" && u.Host != "canary.discord.com") ||
+		!strings.HasPrefix(u.Path, "/api/webhooks/") {
+		return nil, fmt.Errorf("Invalid Discord webhook URL")
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(webhookURL)
+	if err != nil {
+		return nil, fmt.Errorf("Could not reach Discord: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Discord rejected the webhook URL (status %d)", resp.StatusCode)
+	}
+
+	var hook struct {
+		ID        string `json:"id"`
+		Name      string `json:"name"`
+		Avatar    string `json:"avatar"`
+		ChannelID string `json:"channel_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&hook); err != nil || hook.ID == "" {
+		return nil, fmt.Errorf("Unexpected response from Discord")
+	}
+
+	info := &webhookInfo{SocialID: hook.ID, Name: hook.Name}
+	if hook.Avatar != "" {
+		avatar := fmt.Sprintf("https://cdn.discordapp.com/avatars/%s/%s.png", hook.ID, hook.Avatar)
+		info.Avatar = &avatar
+	}
+	return info, nil
+}
+
+// validateSlackWebhook posts an empty payload. Slack answers a live webhook
+// with invalid_payload/no_text without posting anything, and a revoked or
+// mistyped one with no_service/invalid_token.
+func validateSlackWebhook(webhookURL string) (*webhookInfo, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil || u.Scheme != "https" || u.Host != "hooks.slack.com" || !strings.HasPrefix(u.Path, "/services/") {
+		return nil, fmt.Errorf("Invalid Slack webhook URL")
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("Invalid Slack webhook URL")
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader([]byte("{}")))
+	if err != nil {
+		return nil, fmt.Errorf("Could not reach Slack: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	switch strings.TrimSpace(string(body)) {
+	case "invalid_payload", "no_text", "missing_text_or_fallback_or_attachments":
+	default:
+		return nil, fmt.Errorf("Slack rejected the webhook URL: %s", strings.TrimSpace(string(body)))
+	}
+
+	// /services/T<team>/B<bot>/<secret>: keep the non-secret IDs
+	return &webhookInfo{SocialID: parts[1] + "/" + parts[2], Name: "Slack webhook"}, nil
+}
@@ -0,0 +1,387 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+	"social-sync-backend/utils"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	discordMaxEmbeds     = 4 // embeds sharing a url render as one gallery of up to 4 images
+	slackMaxSectionChars = 3000
+	slackMaxAltTextChars = 2000
+	webhookEmbedColor    = 0x5865F2
+)
+
+type WebhookPostRequest struct {
+	Message   string             `json:"message"`
+	Title     string             `json:"title,omitempty"`
+	Link      string             `json:"link,omitempty"` // makes the title clickable
+	MediaUrls []string           `json:"mediaUrls,omitempty"`
+	Media     []models.MediaItem `json:"media,omitempty"`
+}
+
+// POST /api/{platform}/post  (discord or slack)
+// Renders the post as a Discord embed or a Slack Block Kit message and sends
+// it to the user's registered webhook.
+func PostToWebhookHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+		platform := mux.Vars(r)["platform"]
+		name := webhookPlatformName(platform)
+
+		var req WebhookPostRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		mediaItems, err := resolveMediaItems(db, userID, req.MediaUrls, req.Media)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		message := strings.TrimSpace(req.Message)
+		if message == "" && len(mediaItems) == 0 {
+			http.Error(w, "Message cannot be empty", http.StatusBadRequest)
+			return
+		}
+		if n := utils.MeasureText(platform, message, 0); !n.Valid {
+			http.Error(w, fmt.Sprintf("Message exceeds %s's %d character limit (%d characters)", name, n.Limit, n.Length), http.StatusBadRequest)
+			return
+		}
+		req.Link = strings.TrimSpace(req.Link)
+		if req.Link != "" && !isHTTPURL(req.Link) {
+			http.Error(w, "link must be an http or https URL", http.StatusBadRequest)
+			return
+		}
+
+		webhookURL, err := getWebhookURL(db, userID, platform)
+		if err == sql.ErrNoRows {
+			http.Error(w, name+" webhook not connected", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Printf("[Webhook] Failed to load %s webhook for user %s: %v", platform, userID, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var payload map[string]interface{}
+		if platform == "slack" {
+			payload = slackWebhookPayload(req, message, mediaItems)
+		} else {
+			if len(mediaImages(mediaItems)) > discordMaxEmbeds {
+				http.Error(w, fmt.Sprintf("Discord posts can show at most %d images", discordMaxEmbeds), http.StatusBadRequest)
+				return
+			}
+			payload = discordWebhookPayload(req, message, mediaItems)
+		}
+
+		messageID, err := sendWebhook(platform, webhookURL, payload)
+		if err != nil {
+			log.Printf("[Webhook] %s post failed for user %s: %v", platform, userID, err)
+			http.Error(w, fmt.Sprintf("Failed to post to %s: %v", name, err), http.StatusBadGateway)
+			return
+		}
+
+		uid, _ := uuid.Parse(userID)
+		now := time.Now().UTC()
+		post := models.Post{
+			ID:             uuid.New(),
+			UserID:         uid,
+			Platform:       platform,
+			PlatformPostID: messageID,
+			Message:        message,
+			MediaURLs:      mediaItemURLs(mediaItems),
+			PostedAt:       now,
+			Status:         "posted",
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		if err := models.SavePost(db, post); err != nil {
+			log.Printf("ERROR: Failed to save %s post for user %s: %v", platform, userID, err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": fmt.Sprintf("Posted to %s successfully", name),
+			"postId":  messageID,
+		})
+	}
+}
+
+// mediaImages returns the items that can be shown inline; videos are linked.
+func mediaImages(items []models.MediaItem) []models.MediaItem {
+	images := make([]models.MediaItem, 0, len(items))
+	for _, item := range items {
+		if !isVideoURL(item.URL) {
+			images = append(images, item)
+		}
+	}
+	return images
+}
+
+func discordWebhookPayload(req WebhookPostRequest, message string, items []models.MediaItem) map[string]interface{} {
+	embed := map[string]interface{}{
+		"description": message,
+		"color":       webhookEmbedColor,
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+	}
+	if req.Title != "" {
+		embed["title"] = req.Title
+	}
+	// Discord groups embeds with the same url into one image gallery
+	galleryURL := req.Link
+	if galleryURL == "" {
+		galleryURL = utils.GetFrontendURL()
+	}
+	if galleryURL != "" {
+		embed["url"] = galleryURL
+	}
+
+	embeds := []map[string]interface{}{embed}
+	for i, image := range mediaImages(items) {
+		if i == 0 {
+			embed["image"] = map[string]string{"url": image.URL}
+			continue
+		}
+		extra := map[string]interface{}{"image": map[string]string{"url": image.URL}}
+		if galleryURL != "" {
+			extra["url"] = galleryURL
+		}
+		embeds = append(embeds, extra)
+	}
+
+	// Video URLs go in content so Discord unfurls a player
+	var videos []string
+	for _, item := range items {
+		if isVideoURL(item.URL) {
+			videos = append(videos, item.URL)
+		}
+	}
+
+	payload := map[string]interface{}{"embeds": embeds}
+	if len(videos) > 0 {
+		payload["content"] = strings.Join(videos, "\n")
+	}
+	return payload
+}
+
+func slackWebhookPayload(req WebhookPostRequest, message string, items []models.MediaItem) map[string]interface{} {
+	var blocks []map[string]interface{}
+	if req.Title != "" {
+		title := slackEscape(req.Title)
+		if req.Link != "" {
+			title = slackLink(req.Link, title)
+		}
+		blocks = append(blocks, map[string]interface{}{
+			"type": "section",
+			"text": map[string]string{"type": "mrkdwn", "text": "*" + title + "*"},
+		})
+	}
+
+	// Section text is capped, so long messages span several sections
+	for _, chunk := range utils.SplitThread(slackEscape(message), slackMaxSectionChars, false, utf8.RuneCountInString) {
+		blocks = append(blocks, map[string]interface{}{
+			"type": "section",
+			"text": map[string]string{"type": "mrkdwn", "text": chunk},
+		})
+	}
+
+	for _, item := range items {
+		if isVideoURL(item.URL) {
+			blocks = append(blocks, map[string]interface{}{
+				"type": "context",
+				"elements": []map[string]string{
+					{"type": "mrkdwn", "text": slackLink(item.URL, "Watch video")},
+				},
+			})
+			continue
+		}
+		alt := item.AltText
+		if alt == "" {
+			alt = "Image"
+		}
+		if r := []rune(alt); len(r) > slackMaxAltTextChars {
+			alt = string(r[:slackMaxAltTextChars])
+		}
+		blocks = append(blocks, map[string]interface{}{
+			"type":      "image",
+			"image_url": item.URL,
+			"alt_text":  alt,
+		})
+	}
+
+	// text is the notification fallback
+	fallback := message
+	if fallback == "" {
+		fallback = req.Title
+	}
+	return map[string]interface{}{
+		"text":   fallback,
+		"blocks": blocks,
+	}
+}
+
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// slackLink formats a mrkdwn link. label must already be escaped. A "|" in
+// the URL would end it early, so it is percent-encoded.
+func slackLink(link, label string) string {
+	return fmt.Sprintf("<%s|%s>", slackEscape(strings.ReplaceAll(link, "|", "%7C")), label)
+}
+
+// isHTTPURL reports whether s is an absolute http or https URL.
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// sendWebhook posts the payload and returns the message ID when the platform
+// reports one (Discord with ?wait=true; Slack incoming webhooks do not).
+func sendWebhook(platform, webhookURL string, payload map[string]interface{}) (string, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	target := webhookURL
+	if platform == "discord" {
+		sep := "?"
+		if strings.Contains(target, "?") {
+			sep = "&"
+		}
+		target += sep + "wait=true"
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(target, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	if platform == "discord" {
+		var msg struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(respBody, &msg); err == nil {
+			return msg.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// discordMessageURL returns the URL of a message sent through the webhook.
+// A thread_id in the webhook URL is kept, since messages in threads can only
+// be reached with it.
+func discordMessageURL(webhookURL, messageID string) (string, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return "", err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/messages/" + url.PathEscape(messageID)
+	u.RawPath = ""
+	query := url.Values{}
+	if threadID := u.Query().Get("thread_id"); threadID != "" {
+		query.Set("thread_id", threadID)
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// discordWebhookRequest calls a webhook message endpoint and decodes the
+// response into out if set.
+func discordWebhookRequest(method, endpoint string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		// The URL carries the webhook token, so don't echo the client error
+		return fmt.Errorf("Discord %s request failed", method)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	if out != nil && len(respBody) > 0 {
+		return json.Unmarshal(respBody, out)
+	}
+	return nil
+}
+
+// deleteDiscordMessage deletes a message the webhook sent.
+func deleteDiscordMessage(webhookURL, messageID string) error {
+	endpoint, err := discordMessageURL(webhookURL, messageID)
+	if err != nil {
+		return err
+	}
+	return discordWebhookRequest(http.MethodDelete, endpoint, nil, nil)
+}
+
+// editDiscordMessage replaces the text of a message the webhook sent. The
+// text is the description of the first embed, so the embeds are read and sent
+// back with only that changed.
+func editDiscordMessage(webhookURL, messageID, message string) error {
+	if n := utils.MeasureText("discord", message, 0); !n.Valid {
+		return &postNotSupportedError{Message: fmt.Sprintf("Message exceeds Discord's %d character limit (%d characters)", n.Limit, n.Length)}
+	}
+	endpoint, err := discordMessageURL(webhookURL, messageID)
+	if err != nil {
+		return err
+	}
+	var current struct {
+		Embeds []map[string]interface{} `json:"embeds"`
+	}
+	if err := discordWebhookRequest(http.MethodGet, endpoint, nil, &current); err != nil {
+		return err
+	}
+	if len(current.Embeds) == 0 {
+		return &postNotSupportedError{Message: "This Discord message has no text to edit"}
+	}
+	current.Embeds[0]["description"] = message
+	return discordWebhookRequest(http.MethodPatch, endpoint, map[string]interface{}{"embeds": current.Embeds}, nil)
+}
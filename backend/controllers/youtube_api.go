@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const youtubeAPIBase = "https://www.googleapis.com/youtube/v3/"
+
+// youtubeClient calls YouTube on behalf of one user and refreshes the access
+// token when it expires.
+type youtubeClient struct {
+	db           *sql.DB
+	userID       string
+	accessToken  string
+	refreshToken string
+}
+
+// newYouTubeClient loads the user's YouTube tokens. It returns sql.ErrNoRows
+// if no YouTube account is connected.
+func newYouTubeClient(db *sql.DB, userID string) (*youtubeClient, error) {
+	c := &youtubeClient{db: db, userID: userID}
+	err := db.QueryRow(`
+		SELECT access_token, COALESCE(refresh_token, '')
+		FROM social_accounts
+		WHERE user_id = $1 AND platform = 'youtube'`, userID).Scan(&c.accessToken, &c.refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// do sends a request to YouTube, refreshing the access token once if it has
+// expired. newRequest is called again for the retry, since bodies can only be
+// read once.
+func (c *youtubeClient) do(newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for refreshed := false; ; refreshed = true {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+c.accessToken)
+		resp, err := youtubeUploadClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || refreshed || c.refreshToken == "" {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		token, err := refreshYouTubeToken(c.refreshToken)
+		if err != nil {
+			return nil, youtubePermanentError{fmt.Errorf("failed to refresh YouTube token: %w", err)}
+		}
+		c.accessToken = token
+		_, err = c.db.Exec(`
+			UPDATE social_accounts
+			SET access_token = $1, last_synced_at = $2
+			WHERE user_id = $3 AND platform = 'youtube'
+		`, token, time.Now(), c.userID)
+		if err != nil {
+			log.Printf("[YouTube] Failed to store refreshed token for user %s: %v", c.userID, err)
+		}
+	}
+}
+
+// youtubeAPIError is an error response from the YouTube Data API.
+type youtubeAPIError struct {
+	Status  int
+	Reason  string
+	Message string
+}
+
+func (e *youtubeAPIError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("YouTube API error %d (%s): %s", e.Status, e.Reason, e.Message)
+	}
+	return fmt.Sprintf("YouTube API error %d: %s", e.Status, e.Message)
+}
+
+// request calls a Data API method. body, if set, is sent as JSON; out, if
+// set, receives the decoded response.
+func (c *youtubeClient) request(method, path string, params url.Values, body, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	endpoint := path
+	if !strings.HasPrefix(path, "https://") {
+		endpoint = youtubeAPIBase + path
+	}
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+
+	resp, err := c.do(func() (*http.Request, error) {
+		req, err := http.NewRequest(method, endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeYouTubeResponse(resp, out)
+}
+
+func decodeYouTubeResponse(resp *http.Response, out interface{}) error {
+	if resp.StatusCode >= 300 {
+		var res struct {
+			Error struct {
+				Message string `json:"message"`
+				Errors  []struct {
+					Reason string `json:"reason"`
+				} `json:"errors"`
+			} `json:"error"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		apiErr := &youtubeAPIError{Status: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+		if json.Unmarshal(data, &res) == nil && res.Error.Message != "" {
+			apiErr.Message = res.Error.Message
+			if len(res.Error.Errors) > 0 {
+				apiErr.Reason = res.Error.Errors[0].Reason
+			}
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
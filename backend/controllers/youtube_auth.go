@@ -62,14 +62,19 @@ type YouTubeChannelInfo struct {
 				} `json:"default"`
 			} `json:"thumbnails"`
 		} `json:"snippet"`
-		Statistics struct {
-			ViewCount       string `json:"viewCount"`
-			SubscriberCount string `json:"subscriberCount"`
-			VideoCount      string `json:"videoCount"`
-		} `json:"statistics"`
+		Statistics YouTubeChannelStatistics `json:"statistics"`
 	} `json:"items"`
 }
 
+// YouTubeChannelStatistics are the channel's counts, which the Data API
+// returns as strings. SubscriberCount is missing when the owner hides it.
+type YouTubeChannelStatistics struct {
+	ViewCount             string `json:"viewCount"`
+	SubscriberCount       string `json:"subscriberCount"`
+	HiddenSubscriberCount bool   `json:"hiddenSubscriberCount"`
+	VideoCount            string `json:"videoCount"`
+}
+
 func YouTubeCallbackHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		code := r.URL.Query().Get("code")
@@ -172,6 +177,9 @@ func YouTubeCallbackHandler(db *sql.DB) http.HandlerFunc {
 				return
 			}
 		}
+		// The first point of the subscriber growth chart
+		saveYouTubeChannelMetrics(db, userID, channel.ID, channel.Statistics)
+
 		redirectURL := fmt.Sprintf("%s/home/manage-accounts?connected=youtube", utils.GetFrontendURL())
 		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
 
@@ -0,0 +1,341 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+)
+
+const (
+	youtubeMaxThumbnailBytes = 2 << 20
+	youtubeShortsMaxDuration = 180 // seconds
+	youtubeCategoriesTTL     = 24 * time.Hour
+	youtubeDefaultRegion     = "US"
+)
+
+var youtubeLanguagePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// errYouTubeUnavailable wraps failures to look something up on YouTube, as
+// opposed to the post being invalid.
+var errYouTubeUnavailable = errors.New("YouTube could not be reached")
+
+// Assignable video categories per region, which rarely change.
+var (
+	youtubeCategoriesMu    sync.Mutex
+	youtubeCategoriesCache = make(map[string]youtubeCategoriesEntry)
+)
+
+type youtubeCategoriesEntry struct {
+	categories map[string]string // ID to title
+	fetchedAt  time.Time
+}
+
+// YouTubePlaylist is a playlist on the user's channel.
+type YouTubePlaylist struct {
+	ID            string `json:"id"`
+	Title         string `json:"title"`
+	PrivacyStatus string `json:"privacyStatus"`
+	ItemCount     int    `json:"itemCount"`
+}
+
+// validateYouTubePost checks the metadata that doesn't need YouTube to
+// validate, and fills in the defaults.
+func validateYouTubePost(req *YouTubePostRequest) error {
+	if strings.TrimSpace(req.Title) == "" {
+		return errors.New("title is required")
+	}
+
+	if req.PublishAt != nil {
+		// Scheduled videos stay private until YouTube publishes them
+		if req.Privacy != "" && req.Privacy != "private" {
+			return errors.New("publishAt requires privacy to be private; YouTube makes the video public at that time")
+		}
+		if !req.PublishAt.After(time.Now()) {
+			return errors.New("publishAt must be in the future")
+		}
+		req.Privacy = "private"
+	}
+	switch req.Privacy {
+	case "":
+		req.Privacy = "private"
+	case "private", "public", "unlisted":
+	default:
+		return errors.New("privacy must be private, public or unlisted")
+	}
+	if req.CategoryID == "" {
+		req.CategoryID = "22"
+	}
+
+	if req.DefaultLanguage != "" && !youtubeLanguagePattern.MatchString(req.DefaultLanguage) {
+		return errors.New("defaultLanguage must be a language code like en or pt-BR")
+	}
+	if req.License != "" && req.License != "youtube" && req.License != "creativeCommon" {
+		return errors.New("license must be youtube or creativeCommon")
+	}
+
+	seen := make(map[string]bool)
+	playlists := req.PlaylistIDs[:0]
+	for _, id := range req.PlaylistIDs {
+		if id = strings.TrimSpace(id); id != "" && !seen[id] {
+			seen[id] = true
+			playlists = append(playlists, id)
+		}
+	}
+	req.PlaylistIDs = playlists
+	return nil
+}
+
+// checkYouTubeThumbnail makes sure a custom thumbnail is an image YouTube
+// accepts before the video is queued.
+func checkYouTubeThumbnail(thumbnailURL string) error {
+	resp, err := youtubeUploadClient.Head(thumbnailURL)
+	if err != nil {
+		return errors.New("thumbnail could not be read")
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("thumbnail could not be read (status %d)", resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "image/jpeg" && contentType != "image/png" {
+		return errors.New("thumbnail must be a JPEG or PNG image")
+	}
+	if resp.ContentLength > youtubeMaxThumbnailBytes {
+		return fmt.Errorf("thumbnail must be at most %d MB", youtubeMaxThumbnailBytes>>20)
+	}
+	return nil
+}
+
+// youtubeChannelRegion returns the country of the user's channel, which
+// determines the categories available to it.
+func youtubeChannelRegion(client *youtubeClient) (string, error) {
+	params := url.Values{}
+	params.Set("part", "snippet")
+	params.Set("mine", "true")
+	var res struct {
+		Items []struct {
+			Snippet struct {
+				Country string `json:"country"`
+			} `json:"snippet"`
+		} `json:"items"`
+	}
+	if err := client.request(http.MethodGet, "channels", params, nil, &res); err != nil {
+		return "", err
+	}
+	if len(res.Items) == 0 || res.Items[0].Snippet.Country == "" {
+		return youtubeDefaultRegion, nil
+	}
+	return res.Items[0].Snippet.Country, nil
+}
+
+// youtubeCategories returns the categories videos can be assigned to in the
+// region, from videoCategories.list.
+func youtubeCategories(client *youtubeClient, region string) (map[string]string, error) {
+	youtubeCategoriesMu.Lock()
+	entry, ok := youtubeCategoriesCache[region]
+	youtubeCategoriesMu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < youtubeCategoriesTTL {
+		return entry.categories, nil
+	}
+
+	params := url.Values{}
+	params.Set("part", "snippet")
+	params.Set("regionCode", region)
+	var res struct {
+		Items []struct {
+			ID      string `json:"id"`
+			Snippet struct {
+				Title      string `json:"title"`
+				Assignable bool   `json:"assignable"`
+			} `json:"snippet"`
+		} `json:"items"`
+	}
+	if err := client.request(http.MethodGet, "videoCategories", params, nil, &res); err != nil {
+		return nil, err
+	}
+
+	categories := make(map[string]string)
+	for _, item := range res.Items {
+		if item.Snippet.Assignable {
+			categories[item.ID] = item.Snippet.Title
+		}
+	}
+	youtubeCategoriesMu.Lock()
+	youtubeCategoriesCache[region] = youtubeCategoriesEntry{categories: categories, fetchedAt: time.Now()}
+	youtubeCategoriesMu.Unlock()
+	return categories, nil
+}
+
+// listYouTubePlaylists returns all playlists on the user's channel.
+func listYouTubePlaylists(client *youtubeClient) ([]YouTubePlaylist, error) {
+	params := url.Values{}
+	params.Set("part", "snippet,status,contentDetails")
+	params.Set("mine", "true")
+	params.Set("maxResults", "50")
+
+	playlists := []YouTubePlaylist{}
+	for {
+		var res struct {
+			NextPageToken string `json:"nextPageToken"`
+			Items         []struct {
+				ID      string `json:"id"`
+				Snippet struct {
+					Title string `json:"title"`
+				} `json:"snippet"`
+				Status struct {
+					PrivacyStatus string `json:"privacyStatus"`
+				} `json:"status"`
+				ContentDetails struct {
+					ItemCount int `json:"itemCount"`
+				} `json:"contentDetails"`
+			} `json:"items"`
+		}
+		if err := client.request(http.MethodGet, "playlists", params, nil, &res); err != nil {
+			return nil, err
+		}
+		for _, item := range res.Items {
+			playlists = append(playlists, YouTubePlaylist{
+				ID:            item.ID,
+				Title:         item.Snippet.Title,
+				PrivacyStatus: item.Status.PrivacyStatus,
+				ItemCount:     item.ContentDetails.ItemCount,
+			})
+		}
+		if res.NextPageToken == "" {
+			return playlists, nil
+		}
+		params.Set("pageToken", res.NextPageToken)
+	}
+}
+
+// validateYouTubeAccount checks the category and playlists of a post against
+// the user's channel. Errors wrapping errYouTubeUnavailable mean the check
+// itself failed.
+func validateYouTubeAccount(client *youtubeClient, req YouTubePostRequest) error {
+	region, err := youtubeChannelRegion(client)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errYouTubeUnavailable, err)
+	}
+	categories, err := youtubeCategories(client, region)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errYouTubeUnavailable, err)
+	}
+	if _, ok := categories[req.CategoryID]; !ok {
+		return fmt.Errorf("category %s can't be used for videos in region %s", req.CategoryID, region)
+	}
+
+	if len(req.PlaylistIDs) == 0 {
+		return nil
+	}
+	playlists, err := listYouTubePlaylists(client)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errYouTubeUnavailable, err)
+	}
+	owned := make(map[string]bool, len(playlists))
+	for _, p := range playlists {
+		owned[p.ID] = true
+	}
+	for _, id := range req.PlaylistIDs {
+		if !owned[id] {
+			return fmt.Errorf("playlist %s doesn't belong to your channel", id)
+		}
+	}
+	return nil
+}
+
+// isYouTubeShort reports whether YouTube will treat the video as a Short:
+// vertical or square, and at most three minutes long. Videos whose details
+// can't be looked up are treated as regular videos.
+func isYouTubeShort(videoURL string) bool {
+	info, err := lib.GetCloudinaryVideoInfo(videoURL)
+	if err != nil {
+		log.Printf("[YouTube] Could not inspect %s for Shorts: %v", videoURL, err)
+		return false
+	}
+	return info.Width > 0 && info.Height >= info.Width &&
+		info.Duration > 0 && info.Duration <= youtubeShortsMaxDuration
+}
+
+// setYouTubeThumbnail uploads the custom thumbnail from the media store.
+func setYouTubeThumbnail(client *youtubeClient, videoID, thumbnailURL string) error {
+	params := url.Values{}
+	params.Set("videoId", videoID)
+	endpoint := "https://www.googleapis.com/upload/youtube/v3/thumbnails/set?" + params.Encode()
+
+	resp, err := client.do(func() (*http.Request, error) {
+		image, err := youtubeUploadClient.Get(thumbnailURL)
+		if err != nil {
+			return nil, err
+		}
+		if image.StatusCode != http.StatusOK {
+			image.Body.Close()
+			return nil, fmt.Errorf("thumbnail could not be read (status %d)", image.StatusCode)
+		}
+		req, err := http.NewRequest(http.MethodPost, endpoint, image.Body)
+		if err != nil {
+			image.Body.Close()
+			return nil, err
+		}
+		req.ContentLength = image.ContentLength
+		req.Header.Set("Content-Type", image.Header.Get("Content-Type"))
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeYouTubeResponse(resp, nil)
+}
+
+// addToYouTubePlaylist appends the video to a playlist.
+func addToYouTubePlaylist(client *youtubeClient, playlistID, videoID string) error {
+	params := url.Values{}
+	params.Set("part", "snippet")
+	body := map[string]interface{}{
+		"snippet": map[string]interface{}{
+			"playlistId": playlistID,
+			"resourceId": map[string]string{"kind": "youtube#video", "videoId": videoID},
+		},
+	}
+	return client.request(http.MethodPost, "playlistItems", params, body, nil)
+}
+
+// GET /api/youtube/playlists
+func ListYouTubePlaylistsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "user not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		client, err := newYouTubeClient(db, userID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "YouTube account not connected", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, "failed to get YouTube account", http.StatusInternalServerError)
+			return
+		}
+
+		playlists, err := listYouTubePlaylists(client)
+		if err != nil {
+			log.Printf("[YouTube] Failed to list playlists for user %s: %v", userID, err)
+			http.Error(w, "failed to load YouTube playlists", http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(playlists)
+	}
+}
@@ -5,16 +5,20 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
+	"log"
 	"net/http"
 	"social-sync-backend/lib"
+	"strconv"
 	"strings"
 	"time"
 
 	"social-sync-backend/middleware"
+	"social-sync-backend/models"
 
+	"github.com/google/uuid"
 	"golang.org/x/oauth2"
 )
 
@@ -26,9 +30,16 @@ type YouTubeVideoMetadata struct {
 		Description string   `json:"description"`
 		Tags        []string `json:"tags,omitempty"`
 		CategoryID  string   `json:"categoryId"`
+
+		DefaultLanguage string `json:"defaultLanguage,omitempty"`
 	} `json:"snippet"`
 	Status struct {
-		PrivacyStatus string `json:"privacyStatus"`
+		PrivacyStatus string     `json:"privacyStatus"`
+		PublishAt     *time.Time `json:"publishAt,omitempty"` // private videos become public at this time
+
+		SelfDeclaredMadeForKids *bool  `json:"selfDeclaredMadeForKids,omitempty"`
+		License                 string `json:"license,omitempty"` // youtube or creativeCommon
+		Embeddable              *bool  `json:"embeddable,omitempty"`
 	} `json:"status"`
 }
 
@@ -56,7 +67,34 @@ type YouTubeUploadResponse struct {
 	} `json:"status"`
 }
 
+// YouTubePostRequest is the JSON form of a YouTube post, for videos that are
+// already in the media store.
+type YouTubePostRequest struct {
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Tags        []string          `json:"tags,omitempty"`
+	Privacy     string            `json:"privacy,omitempty"`
+	CategoryID  string            `json:"categoryId,omitempty"`
+	MediaURL    string            `json:"mediaUrl,omitempty"`
+	Media       *models.MediaItem `json:"media,omitempty"` // a library asset or URL
+
+	ThumbnailURL      string     `json:"thumbnailUrl,omitempty"` // JPEG or PNG, up to 2 MB
+	PlaylistIDs       []string   `json:"playlistIds,omitempty"`
+	PublishAt         *time.Time `json:"publishAt,omitempty"` // uploads privately and publishes at this time
+	MadeForKids       *bool      `json:"madeForKids,omitempty"`
+	DefaultLanguage   string     `json:"defaultLanguage,omitempty"`
+	License           string     `json:"license,omitempty"` // youtube or creativeCommon
+	Embeddable        *bool      `json:"embeddable,omitempty"`
+	NotifySubscribers *bool      `json:"notifySubscribers,omitempty"` // defaults to true
+}
+
 // PostToYouTubeHandler handles video upload to YouTube
+// POST /api/youtube/post
+// Takes a multipart form whose video is streamed to the media store as it
+// arrives, or JSON pointing at a video that is already there. The video is
+// then uploaded to YouTube in resumable chunks by a background worker; the
+// response carries the upload ID, whose progress is available from
+// /api/youtube/uploads/{uploadId}.
 func PostToYouTubeHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, err := middleware.GetUserIDFromContext(r)
@@ -64,203 +102,247 @@ func PostToYouTubeHandler(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "user not authenticated", http.StatusUnauthorized)
 			return
 		}
-
-		err = r.ParseMultipartForm(100 << 20)
+		uid, err := uuid.Parse(userID)
 		if err != nil {
-			http.Error(w, "failed to parse form data", http.StatusBadRequest)
+			http.Error(w, "user not authenticated", http.StatusUnauthorized)
 			return
 		}
 
-		file, fileHeader, err := r.FormFile("video")
-		if err != nil {
-			http.Error(w, "video file is required", http.StatusBadRequest)
+		// Checked first so a video isn't stored for an account that can't post it
+		client, err := newYouTubeClient(db, userID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "YouTube account not connected", http.StatusBadRequest)
 			return
-		}
-		defer file.Close()
-
-		if !isValidVideoFile(fileHeader.Filename) {
-			http.Error(w, "invalid video file format. supported: mp4, mov, avi, wmv, flv, webm, mkv", http.StatusBadRequest)
+		} else if err != nil {
+			http.Error(w, "failed to get YouTube account", http.StatusInternalServerError)
 			return
 		}
 
-		title := r.FormValue("title")
-		description := r.FormValue("description")
-		tags := r.FormValue("tags")
-		privacy := r.FormValue("privacy")
-		categoryID := r.FormValue("category_id")
-
-		if title == "" {
-			http.Error(w, "title is required", http.StatusBadRequest)
+		var req YouTubePostRequest
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			req, err = readYouTubeMultipart(r)
+		} else {
+			req, err = readYouTubeJSON(db, userID, r)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		if privacy == "" {
-			privacy = "private"
+		if err := validateYouTubePost(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-		if categoryID == "" {
-			categoryID = "22"
+		if req.ThumbnailURL != "" {
+			if err := checkYouTubeThumbnail(req.ThumbnailURL); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 		}
-
-		var accessToken, refreshToken string
-		err = db.QueryRow(`
-			SELECT access_token, refresh_token 
-			FROM social_accounts 
-			WHERE user_id = $1 AND platform = 'youtube'
-		`, userID).Scan(&accessToken, &refreshToken)
-
-		if err == sql.ErrNoRows {
-			http.Error(w, "YouTube account not connected", http.StatusBadRequest)
+		if err := validateYouTubeAccount(client, req); errors.Is(err, errYouTubeUnavailable) {
+			log.Printf("[YouTube] Failed to validate post for user %s: %v", userID, err)
+			http.Error(w, "failed to check the video against your YouTube channel", http.StatusBadGateway)
 			return
 		} else if err != nil {
-			http.Error(w, "failed to get YouTube account", http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		cloudinaryURL, err := lib.UploadToCloudinary(file, "videos", fileHeader.Filename)
+		metadata := YouTubeVideoMetadata{}
+		metadata.Snippet.Title = req.Title
+		metadata.Snippet.Description = req.Description
+		metadata.Snippet.Tags = req.Tags
+		metadata.Snippet.CategoryID = req.CategoryID
+		metadata.Snippet.DefaultLanguage = req.DefaultLanguage
+		metadata.Status.PrivacyStatus = req.Privacy
+		metadata.Status.PublishAt = req.PublishAt
+		metadata.Status.SelfDeclaredMadeForKids = req.MadeForKids
+		metadata.Status.License = req.License
+		metadata.Status.Embeddable = req.Embeddable
+		metadataJSON, err := json.Marshal(metadata)
 		if err != nil {
-			http.Error(w, "failed to upload video to storage", http.StatusInternalServerError)
+			http.Error(w, "failed to encode video metadata", http.StatusInternalServerError)
 			return
 		}
 
-		file.Seek(0, 0)
-
-		videoID, err := uploadVideoToYouTube(file, title, description, tags, privacy, categoryID, accessToken)
-		if err != nil {
-			if strings.Contains(err.Error(), "401") && refreshToken != "" {
-				newAccessToken, err := refreshYouTubeToken(refreshToken)
-				if err != nil {
-					http.Error(w, "failed to refresh YouTube token", http.StatusUnauthorized)
-					return
-				}
-
-				_, err = db.Exec(`
-					UPDATE social_accounts 
-					SET access_token = $1, last_synced_at = $2
-					WHERE user_id = $3 AND platform = 'youtube'
-				`, newAccessToken, time.Now(), userID)
-				if err != nil {
-					http.Error(w, "failed to update access token", http.StatusInternalServerError)
-					return
-				}
-
-				file.Seek(0, 0)
-				videoID, err = uploadVideoToYouTube(file, title, description, tags, privacy, categoryID, newAccessToken)
-				if err != nil {
-					http.Error(w, fmt.Sprintf("failed to upload to YouTube: %v", err), http.StatusInternalServerError)
-					return
-				}
-			} else {
-				http.Error(w, fmt.Sprintf("failed to upload to YouTube: %v", err), http.StatusInternalServerError)
-				return
-			}
+		now := time.Now().UTC()
+		upload := models.YouTubeUpload{
+			ID:        uuid.New(),
+			UserID:    uid,
+			SourceURL: req.MediaURL,
+			Metadata:  metadataJSON,
+			Options: models.YouTubeUploadOptions{
+				ThumbnailURL:      req.ThumbnailURL,
+				PlaylistIDs:       req.PlaylistIDs,
+				NotifySubscribers: req.NotifySubscribers,
+				Short:             isYouTubeShort(req.MediaURL),
+			},
+			Status:    models.YouTubeUploadQueued,
+			CreatedAt: now,
+			UpdatedAt: now,
 		}
-
-		videoURL := fmt.Sprintf("https://www.youtube.com/watch?v=%s", videoID)
-
-		response := map[string]interface{}{
-			"message":    "video uploaded successfully to YouTube",
-			"video_id":   videoID,
-			"video_url":  videoURL,
-			"backup_url": cloudinaryURL,
-			"title":      title,
-			"privacy":    privacy,
+		if err := models.SaveYouTubeUpload(db, upload); err != nil {
+			http.Error(w, "failed to queue YouTube upload", http.StatusInternalServerError)
+			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(response)
-	}
-}
-
-func uploadVideoToYouTube(file multipart.File, title, description, tags, privacy, categoryID, accessToken string) (string, error) {
-	metadata := YouTubeVideoMetadata{}
-	metadata.Snippet.Title = title
-	metadata.Snippet.Description = description
-	metadata.Snippet.CategoryID = categoryID
-	metadata.Status.PrivacyStatus = privacy
+		go runYouTubeUpload(db, upload.ID)
 
-	if tags != "" {
-		tagList := strings.Split(tags, ",")
-		for i, tag := range tagList {
-			tagList[i] = strings.TrimSpace(tag)
+		kind := "video"
+		if upload.Options.Short {
+			kind = "Short"
 		}
-		metadata.Snippet.Tags = tagList
+		writePublishResult(w, http.StatusAccepted, PublishResult{
+			Platform: "youtube",
+			Status:   "processing",
+			JobID:    upload.ID.String(),
+			Message:  fmt.Sprintf("YouTube %s upload queued. Follow /api/youtube/uploads/%s for progress.", kind, upload.ID),
+		})
 	}
+}
 
-	metadataJSON, err := json.Marshal(metadata)
+// readYouTubeMultipart reads the form part by part, streaming the video to
+// the media store instead of buffering the whole request. Fields may come
+// before or after the video.
+func readYouTubeMultipart(r *http.Request) (YouTubePostRequest, error) {
+	var req YouTubePostRequest
+	reader, err := r.MultipartReader()
 	if err != nil {
-		return "", err
+		return req, errors.New("failed to parse form data")
 	}
 
-	fmt.Printf("DEBUG: Sending metadata to YouTube: %s\n", string(metadataJSON))
-
-	initURL := "https://www.googleapis.com/upload/youtube/v3/videos?uploadType=resumable&part=snippet,status"
-	initReq, err := http.NewRequest("POST", initURL, bytes.NewReader(metadataJSON))
-	if err != nil {
-		return "", err
-	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return req, errors.New("failed to parse form data")
+		}
 
-	initReq.Header.Set("Authorization", "Bearer "+accessToken)
-	initReq.Header.Set("Content-Type", "application/json")
-	initReq.Header.Set("X-Upload-Content-Type", "video/*")
-	initReq.Header.Set("X-Upload-Content-Length", "0")
+		if part.FormName() == "thumbnail" {
+			if req.ThumbnailURL != "" {
+				return req, errors.New("only one thumbnail can be uploaded")
+			}
+			name := strings.ToLower(part.FileName())
+			if !strings.HasSuffix(name, ".jpg") && !strings.HasSuffix(name, ".jpeg") && !strings.HasSuffix(name, ".png") {
+				return req, errors.New("thumbnail must be a JPEG or PNG image")
+			}
+			// Thumbnails are small, so read one whole to reject an oversized
+			// one before it is stored
+			thumbnail, err := io.ReadAll(io.LimitReader(part, youtubeMaxThumbnailBytes+1))
+			if err != nil {
+				return req, errors.New("failed to parse form data")
+			}
+			if len(thumbnail) > youtubeMaxThumbnailBytes {
+				return req, fmt.Errorf("thumbnail must be at most %d MB", youtubeMaxThumbnailBytes>>20)
+			}
+			req.ThumbnailURL, err = lib.UploadToCloudinary(bytes.NewReader(thumbnail), "thumbnails", uuid.New().String())
+			if err != nil {
+				log.Printf("[YouTube] Failed to store thumbnail: %v", err)
+				return req, errors.New("failed to upload thumbnail to storage")
+			}
+			continue
+		}
+		if part.FormName() == "video" {
+			if req.MediaURL != "" {
+				return req, errors.New("only one video can be uploaded")
+			}
+			if !isValidVideoFile(part.FileName()) {
+				return req, errors.New("invalid video file format. supported: mp4, mov, avi, wmv, flv, webm, mkv")
+			}
+			req.MediaURL, err = lib.UploadToCloudinary(part, "videos", uuid.New().String())
+			if err != nil {
+				log.Printf("[YouTube] Failed to store video: %v", err)
+				return req, errors.New("failed to upload video to storage")
+			}
+			continue
+		}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	initResp, err := client.Do(initReq)
-	if err != nil {
-		return "", err
+		value, err := io.ReadAll(io.LimitReader(part, 64<<10))
+		if err != nil {
+			return req, errors.New("failed to parse form data")
+		}
+		switch part.FormName() {
+		case "title":
+			req.Title = string(value)
+		case "description":
+			req.Description = string(value)
+		case "tags":
+			for _, tag := range strings.Split(string(value), ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					req.Tags = append(req.Tags, tag)
+				}
+			}
+		case "privacy":
+			req.Privacy = string(value)
+		case "category_id":
+			req.CategoryID = string(value)
+		case "playlist_ids":
+			req.PlaylistIDs = strings.Split(string(value), ",")
+		case "publish_at":
+			t, err := time.Parse(time.RFC3339, string(value))
+			if err != nil {
+				return req, errors.New("publish_at must be an RFC 3339 time")
+			}
+			req.PublishAt = &t
+		case "default_language":
+			req.DefaultLanguage = string(value)
+		case "license":
+			req.License = string(value)
+		case "made_for_kids", "embeddable", "notify_subscribers":
+			b, err := strconv.ParseBool(string(value))
+			if err != nil {
+				return req, fmt.Errorf("%s must be true or false", part.FormName())
+			}
+			switch part.FormName() {
+			case "made_for_kids":
+				req.MadeForKids = &b
+			case "embeddable":
+				req.Embeddable = &b
+			default:
+				req.NotifySubscribers = &b
+			}
+		}
 	}
-	defer initResp.Body.Close()
-
-	fmt.Printf("DEBUG: Init response status: %d\n", initResp.StatusCode)
 
-	if initResp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(initResp.Body)
-		fmt.Printf("DEBUG: Init error response: %s\n", string(bodyBytes))
-		return "", fmt.Errorf("failed to initialize upload: %d - %s", initResp.StatusCode, string(bodyBytes))
+	if req.MediaURL == "" {
+		return req, errors.New("video file is required")
 	}
+	return req, nil
+}
 
-	uploadURL := initResp.Header.Get("Location")
-	if uploadURL == "" {
-		return "", fmt.Errorf("no upload URL received from YouTube")
+// readYouTubeJSON reads a post whose video is referenced by URL or media
+// library asset.
+func readYouTubeJSON(db *sql.DB, userID string, r *http.Request) (YouTubePostRequest, error) {
+	var req YouTubePostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return req, errors.New("invalid JSON body")
 	}
 
-	fmt.Printf("DEBUG: Upload URL: %s\n", uploadURL)
-
-	file.Seek(0, 0)
-
-	uploadReq, err := http.NewRequest("PUT", uploadURL, file)
-	if err != nil {
-		return "", err
+	var urls []string
+	if req.MediaURL != "" {
+		urls = append(urls, req.MediaURL)
 	}
-
-	uploadReq.Header.Set("Content-Type", "video/*")
-	uploadReq.Header.Set("Content-Length", "0")
-
-	uploadClient := &http.Client{Timeout: 300 * time.Second}
-	uploadResp, err := uploadClient.Do(uploadReq)
+	var items []models.MediaItem
+	if req.Media != nil {
+		items = append(items, *req.Media)
+	}
+	media, err := resolveMediaItems(db, userID, urls, items)
 	if err != nil {
-		return "", err
+		return req, err
 	}
-	defer uploadResp.Body.Close()
-
-	fmt.Printf("DEBUG: Upload response status: %d\n", uploadResp.StatusCode)
-
-	if uploadResp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(uploadResp.Body)
-		fmt.Printf("DEBUG: Upload error response: %s\n", string(bodyBytes))
-		return "", fmt.Errorf("failed to upload video: %d - %s", uploadResp.StatusCode, string(bodyBytes))
+	if len(media) != 1 {
+		return req, errors.New("exactly one video is required")
 	}
-
-	var uploadRespData YouTubeUploadResponse
-	if err := json.NewDecoder(uploadResp.Body).Decode(&uploadRespData); err != nil {
-		return "", err
+	if !isVideoURL(media[0].URL) {
+		return req, errors.New("media must be a video")
 	}
+	req.MediaURL = media[0].URL
 
-	fmt.Printf("DEBUG: YouTube response - Title: %s, Privacy: %s\n", uploadRespData.Snippet.Title, uploadRespData.Status.PrivacyStatus)
-	fmt.Printf("DEBUG: Full YouTube response: %+v\n", uploadRespData)
-
-	return uploadRespData.ID, nil
+	for i := range req.Tags {
+		req.Tags[i] = strings.TrimSpace(req.Tags[i])
+	}
+	return req, nil
 }
 
 func refreshYouTubeToken(refreshToken string) (string, error) {
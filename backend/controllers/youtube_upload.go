@@ -0,0 +1,507 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"social-sync-backend/middleware"
+	"social-sync-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	youtubeResumableURL     = "https://www.googleapis.com/upload/youtube/v3/videos?uploadType=resumable&part=snippet,status"
+	youtubeDefaultChunkSize = 8 << 20 // bytes; YouTube wants multiples of 256 KiB
+	youtubeMaxRetries       = 8       // consecutive failures before an upload fails
+	youtubeMaxBackoff       = time.Minute
+)
+
+// Uploads currently being worked on, so an upload never runs twice in this process.
+var (
+	youtubeUploadsMu      sync.Mutex
+	youtubeUploadsRunning = make(map[uuid.UUID]bool)
+)
+
+// Each request carries at most one chunk, so the timeout bounds a chunk
+// rather than the whole video.
+var youtubeUploadClient = &http.Client{Timeout: 10 * time.Minute}
+
+// youtubeChunkSize returns the chunk size, configurable in whole megabytes
+// with YOUTUBE_UPLOAD_CHUNK_SIZE_MB. A megabyte is always a multiple of the
+// 256 KiB YouTube requires.
+func youtubeChunkSize() int64 {
+	if mb, err := strconv.Atoi(os.Getenv("YOUTUBE_UPLOAD_CHUNK_SIZE_MB")); err == nil && mb > 0 {
+		return int64(mb) << 20
+	}
+	return youtubeDefaultChunkSize
+}
+
+// youtubePermanentError is a failure that retrying won't fix, e.g. YouTube
+// rejecting the metadata or the source video being gone.
+type youtubePermanentError struct{ error }
+
+func (e youtubePermanentError) Unwrap() error { return e.error }
+
+// StartYouTubeUploads resumes the uploads that were interrupted by a restart.
+// Uploads with a session continue from the offset YouTube reports.
+func StartYouTubeUploads(db *sql.DB) {
+	ids, err := models.ListUnfinishedYouTubeUploadIDs(db)
+	if err != nil {
+		log.Printf("❌ Failed to load YouTube uploads: %v", err)
+		return
+	}
+	for _, id := range ids {
+		go runYouTubeUpload(db, id)
+	}
+	if len(ids) > 0 {
+		log.Printf("✅ Resumed %d YouTube uploads.", len(ids))
+	}
+}
+
+// runYouTubeUpload streams the video from the media store to YouTube chunk by
+// chunk, recording progress after every chunk. Network and server errors are
+// retried with backoff; the offset is then queried again, since YouTube may
+// have stored less than was sent. Once the video is in, the thumbnail is set
+// and the video added to its playlists.
+func runYouTubeUpload(db *sql.DB, uploadID uuid.UUID) {
+	youtubeUploadsMu.Lock()
+	if youtubeUploadsRunning[uploadID] {
+		youtubeUploadsMu.Unlock()
+		return
+	}
+	youtubeUploadsRunning[uploadID] = true
+	youtubeUploadsMu.Unlock()
+	defer func() {
+		youtubeUploadsMu.Lock()
+		delete(youtubeUploadsRunning, uploadID)
+		youtubeUploadsMu.Unlock()
+	}()
+
+	upload, err := models.GetYouTubeUploadByID(db, uploadID)
+	if err != nil {
+		log.Printf("[YouTube] Failed to load upload %s: %v", uploadID, err)
+		return
+	}
+
+	s := &youtubeUploadSession{db: db, upload: upload, chunkSize: youtubeChunkSize()}
+	fail := func(msg string) {
+		log.Printf("[YouTube] Upload %s failed: %s", uploadID, msg)
+		upload.Status = models.YouTubeUploadFailed
+		upload.Error = msg
+		s.save()
+	}
+
+	s.client, err = newYouTubeClient(db, upload.UserID.String())
+	if err != nil {
+		fail("YouTube account not connected")
+		return
+	}
+
+	upload.Status = models.YouTubeUploadUploading
+	upload.Error = ""
+	s.save()
+
+	if upload.Size == 0 {
+		if err := s.probeSource(); err != nil {
+			fail(fmt.Sprintf("Video could not be read from storage: %v", err))
+			return
+		}
+		s.save()
+	}
+
+	retries := 0
+	for {
+		done, err := s.step()
+		if err == nil {
+			retries = 0
+			if done {
+				break
+			}
+			continue
+		}
+
+		var permanent youtubePermanentError
+		if errors.As(err, &permanent) || retries >= youtubeMaxRetries {
+			fail(err.Error())
+			return
+		}
+		backoff := time.Second << retries
+		if backoff > youtubeMaxBackoff {
+			backoff = youtubeMaxBackoff
+		}
+		retries++
+		log.Printf("[YouTube] Upload %s interrupted at %d/%d bytes, retrying in %s: %v",
+			uploadID, upload.BytesUploaded, upload.Size, backoff, err)
+		s.synced = false
+		time.Sleep(backoff)
+	}
+
+	upload.BytesUploaded = upload.Size
+	s.save()
+
+	// The video is up either way; failed extras are only reported on the upload
+	var problems []string
+	if upload.Options.ThumbnailURL != "" {
+		if err := setYouTubeThumbnail(s.client, upload.VideoID, upload.Options.ThumbnailURL); err != nil {
+			log.Printf("[YouTube] Thumbnail for %s failed: %v", upload.VideoID, err)
+			problems = append(problems, fmt.Sprintf("the thumbnail failed: %v", err))
+		}
+	}
+	for _, playlistID := range upload.Options.PlaylistIDs {
+		if err := addToYouTubePlaylist(s.client, playlistID, upload.VideoID); err != nil {
+			log.Printf("[YouTube] Adding %s to playlist %s failed: %v", upload.VideoID, playlistID, err)
+			problems = append(problems, fmt.Sprintf("adding to playlist %s failed: %v", playlistID, err))
+		}
+	}
+	if len(problems) > 0 {
+		upload.Error = "Uploaded, but " + strings.Join(problems, "; ")
+	}
+	upload.Status = models.YouTubeUploadUploaded
+	s.save()
+
+	var metadata YouTubeVideoMetadata
+	json.Unmarshal(upload.Metadata, &metadata)
+	now := time.Now().UTC()
+	post := models.Post{
+		ID:             uuid.New(),
+		UserID:         upload.UserID,
+		Platform:       "youtube",
+		PlatformPostID: upload.VideoID,
+		Message:        metadata.Snippet.Title,
+		MediaURLs:      []string{upload.SourceURL},
+		PostedAt:       now,
+		Status:         "posted",
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if metadata.Status.PublishAt != nil {
+		post.PostedAt = *metadata.Status.PublishAt
+		post.Status = "scheduled"
+	}
+	if err := models.SavePost(db, post); err != nil {
+		log.Printf("ERROR: Failed to save YouTube post for upload %s: %v", uploadID, err)
+	}
+	log.Printf("[YouTube] Upload %s finished as video %s", uploadID, upload.VideoID)
+}
+
+// youtubeUploadSession drives one resumable upload.
+type youtubeUploadSession struct {
+	db        *sql.DB
+	client    *youtubeClient
+	upload    *models.YouTubeUpload
+	chunkSize int64
+	synced    bool // BytesUploaded matches what YouTube has
+}
+
+func (s *youtubeUploadSession) save() {
+	s.upload.UpdatedAt = time.Now().UTC()
+	if err := models.UpdateYouTubeUpload(s.db, *s.upload); err != nil {
+		log.Printf("[YouTube] Failed to save upload %s: %v", s.upload.ID, err)
+	}
+}
+
+// step makes one request towards finishing the upload and reports whether
+// the video is complete.
+func (s *youtubeUploadSession) step() (bool, error) {
+	if s.upload.SessionURI == "" {
+		return false, s.startSession()
+	}
+	if !s.synced {
+		done, err := s.queryOffset()
+		if err != nil || done {
+			return done, err
+		}
+		s.synced = s.upload.SessionURI != ""
+		return false, nil
+	}
+	return s.sendChunk()
+}
+
+// probeSource learns the size and type of the video in the media store.
+func (s *youtubeUploadSession) probeSource() error {
+	resp, err := youtubeUploadClient.Head(s.upload.SourceURL)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("media store returned %d", resp.StatusCode)
+	}
+	if resp.ContentLength <= 0 {
+		return errors.New("media store did not report the video's size")
+	}
+	s.upload.Size = resp.ContentLength
+	if contentType := resp.Header.Get("Content-Type"); strings.HasPrefix(contentType, "video/") {
+		s.upload.ContentType = contentType
+	}
+	return nil
+}
+
+func (s *youtubeUploadSession) contentType() string {
+	if s.upload.ContentType != "" {
+		return s.upload.ContentType
+	}
+	return "video/*"
+}
+
+// startSession creates a resumable upload session and stores its URI, so the
+// upload can continue from another process after a restart.
+func (s *youtubeUploadSession) startSession() error {
+	endpoint := youtubeResumableURL
+	if notify := s.upload.Options.NotifySubscribers; notify != nil && !*notify {
+		endpoint += "&notifySubscribers=false"
+	}
+	resp, err := s.client.do(func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(s.upload.Metadata))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+		req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(s.upload.Size, 10))
+		req.Header.Set("X-Upload-Content-Type", s.contentType())
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return youtubeResponseError("failed to start upload session", resp)
+	}
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return errors.New("no upload URL received from YouTube")
+	}
+
+	s.upload.SessionURI = location
+	s.upload.BytesUploaded = 0
+	s.synced = true
+	s.save()
+	return nil
+}
+
+// queryOffset asks YouTube how much of the video it has, after an
+// interruption. An expired session is dropped so the next step starts over.
+func (s *youtubeUploadSession) queryOffset() (bool, error) {
+	resp, err := s.client.do(func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPut, s.upload.SessionURI, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", s.upload.Size))
+		return req, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	return s.handleUploadResponse(resp)
+}
+
+// sendChunk streams the next chunk from the media store to YouTube.
+func (s *youtubeUploadSession) sendChunk() (bool, error) {
+	start := s.upload.BytesUploaded
+	end := start + s.chunkSize - 1
+	if end >= s.upload.Size {
+		end = s.upload.Size - 1
+	}
+
+	resp, err := s.client.do(func() (*http.Request, error) {
+		chunk, err := s.openSourceRange(start, end)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequest(http.MethodPut, s.upload.SessionURI, chunk)
+		if err != nil {
+			chunk.Close()
+			return nil, err
+		}
+		req.ContentLength = end - start + 1
+		req.Header.Set("Content-Type", s.contentType())
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, s.upload.Size))
+		return req, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	return s.handleUploadResponse(resp)
+}
+
+// openSourceRange reads bytes start to end (inclusive) of the video from the
+// media store.
+func (s *youtubeUploadSession) openSourceRange(start, end int64) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, s.upload.SourceURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	resp, err := youtubeUploadClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		return resp.Body, nil
+	case resp.StatusCode == http.StatusOK && start == 0:
+		// The whole file is coming; send only the chunk
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(resp.Body, end+1), resp.Body}, nil
+	case resp.StatusCode == http.StatusOK:
+		resp.Body.Close()
+		return nil, youtubePermanentError{errors.New("media store doesn't support range requests")}
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		resp.Body.Close()
+		return nil, youtubePermanentError{fmt.Errorf("media store returned %d", resp.StatusCode)}
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("media store returned %d", resp.StatusCode)
+	}
+}
+
+// handleUploadResponse records what YouTube reports after a chunk or offset
+// query: 308 with the range it has stored so far, or the video once complete.
+func (s *youtubeUploadSession) handleUploadResponse(resp *http.Response) (bool, error) {
+	switch {
+	case resp.StatusCode == http.StatusPermanentRedirect:
+		offset, err := parseYouTubeUploadRange(resp.Header.Get("Range"))
+		if err != nil {
+			return false, err
+		}
+		s.upload.BytesUploaded = offset
+		s.save()
+		return false, nil
+
+	case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated:
+		var video YouTubeUploadResponse
+		if err := json.NewDecoder(resp.Body).Decode(&video); err != nil {
+			return false, fmt.Errorf("invalid response from YouTube: %w", err)
+		}
+		if video.ID == "" {
+			return false, errors.New("YouTube did not return a video ID")
+		}
+		s.upload.VideoID = video.ID
+		return true, nil
+
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		// The session expired; start a new one from the beginning
+		log.Printf("[YouTube] Upload session for %s expired, starting over", s.upload.ID)
+		s.upload.SessionURI = ""
+		s.upload.BytesUploaded = 0
+		s.save()
+		return false, nil
+
+	default:
+		return false, youtubeResponseError("upload failed", resp)
+	}
+}
+
+// parseYouTubeUploadRange returns the number of bytes stored according to a
+// Range header like "bytes=0-1048575". No header means nothing was stored.
+func parseYouTubeUploadRange(header string) (int64, error) {
+	if header == "" {
+		return 0, nil
+	}
+	i := strings.LastIndex(header, "-")
+	if i == -1 {
+		return 0, fmt.Errorf("invalid Range header %q", header)
+	}
+	last, err := strconv.ParseInt(header[i+1:], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Range header %q", header)
+	}
+	return last + 1, nil
+}
+
+// youtubeResponseError turns an error response into an error, retryable only
+// for server errors and rate limits.
+func youtubeResponseError(msg string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	err := fmt.Errorf("%s: %d - %s", msg, resp.StatusCode, strings.TrimSpace(string(body)))
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return err
+	}
+	return youtubePermanentError{err}
+}
+
+// GET /api/youtube/uploads/{uploadId}
+func GetYouTubeUploadHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		upload, err := models.GetYouTubeUpload(db, userID, mux.Vars(r)["uploadId"])
+		if err == sql.ErrNoRows {
+			http.Error(w, "Upload not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to load upload", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(upload)
+	}
+}
+
+// POST /api/youtube/uploads/{uploadId}/resume
+// Retries a failed upload. It continues from YouTube's offset if the upload
+// session is still valid.
+func ResumeYouTubeUploadHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		upload, err := models.GetYouTubeUpload(db, userID, mux.Vars(r)["uploadId"])
+		if err == sql.ErrNoRows {
+			http.Error(w, "Upload not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to load upload", http.StatusInternalServerError)
+			return
+		}
+		if upload.Status != models.YouTubeUploadFailed {
+			http.Error(w, "Only failed uploads can be resumed", http.StatusConflict)
+			return
+		}
+
+		upload.Status = models.YouTubeUploadQueued
+		upload.Error = ""
+		if err := models.UpdateYouTubeUpload(db, *upload); err != nil {
+			http.Error(w, "Failed to resume upload", http.StatusInternalServerError)
+			return
+		}
+
+		go runYouTubeUpload(db, upload.ID)
+
+		writePublishResult(w, http.StatusAccepted, PublishResult{
+			Platform: "youtube",
+			Status:   "processing",
+			JobID:    upload.ID.String(),
+			Message:  fmt.Sprintf("YouTube upload resumed. Follow /api/youtube/uploads/%s for progress.", upload.ID),
+		})
+	}
+}
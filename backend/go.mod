@@ -15,6 +15,7 @@ require (
 	github.com/robfig/cron/v3 v3.0.1
 	golang.org/x/crypto v0.39.0
 	golang.org/x/oauth2 v0.30.0
+	golang.org/x/text v0.26.0
 )
 
 require (
@@ -25,5 +26,4 @@ require (
 	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
 	github.com/jackc/puddle/v2 v2.2.2 // indirect
 	golang.org/x/sync v0.15.0 // indirect
-	golang.org/x/text v0.26.0 // indirect
 )
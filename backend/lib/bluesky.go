@@ -0,0 +1,235 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultBlueskyPDS = "https://bsky.social"
+
+var blueskyClient = &http.Client{Timeout: 30 * time.Second}
+
+// BlueskyPDSURL returns the PDS used for XRPC calls. Set BLUESKY_PDS_URL to point
+// at a self-hosted or local PDS.
+func BlueskyPDSURL() string {
+	if pds := os.Getenv("BLUESKY_PDS_URL"); pds != "" {
+		return strings.TrimSuffix(pds, "/")
+	}
+	return defaultBlueskyPDS
+}
+
+// BlueskySession is returned by createSession and refreshSession.
+type BlueskySession struct {
+	AccessJwt  string `json:"accessJwt"`
+	RefreshJwt string `json:"refreshJwt"`
+	Handle     string `json:"handle"`
+	DID        string `json:"did"`
+}
+
+type BlueskyProfile struct {
+	DID         string `json:"did"`
+	Handle      string `json:"handle"`
+	DisplayName string `json:"displayName"`
+	Avatar      string `json:"avatar"`
+}
+
+// BlueskyBlob is the blob reference returned by uploadBlob and embedded in records.
+type BlueskyBlob struct {
+	Type string `json:"$type"`
+	Ref  struct {
+		Link string `json:"$link"`
+	} `json:"ref"`
+	MimeType string `json:"mimeType"`
+	Size     int64  `json:"size"`
+}
+
+// BlueskyStrongRef identifies a specific version of a record.
+type BlueskyStrongRef struct {
+	URI string `json:"uri"`
+	CID string `json:"cid"`
+}
+
+// BlueskyError is an XRPC error response.
+type BlueskyError struct {
+	Status  int
+	Code    string `json:"error"`
+	Message string `json:"message"`
+}
+
+func (e *BlueskyError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("bluesky %s (status %d): %s", e.Code, e.Status, e.Message)
+	}
+	return fmt.Sprintf("bluesky %s (status %d)", e.Code, e.Status)
+}
+
+// IsExpiredToken reports whether the session token needs refreshing.
+func (e *BlueskyError) IsExpiredToken() bool {
+	return e.Code == "ExpiredToken" || e.Code == "InvalidToken"
+}
+
+// BlueskyCreateSession logs in with a handle (or DID/email) and an app password.
+func BlueskyCreateSession(identifier, appPassword string) (*BlueskySession, error) {
+	var session BlueskySession
+	err := blueskyXRPC("POST", "com.atproto.server.createSession", "", nil, map[string]string{
+		"identifier": identifier,
+		"password":   appPassword,
+	}, &session)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// BlueskyRefreshSession exchanges a refresh JWT for a new session.
+func BlueskyRefreshSession(refreshJwt string) (*BlueskySession, error) {
+	var session BlueskySession
+	if err := blueskyXRPC("POST", "com.atproto.server.refreshSession", refreshJwt, nil, nil, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func BlueskyGetProfile(accessJwt, actor string) (*BlueskyProfile, error) {
+	var profile BlueskyProfile
+	q := url.Values{"actor": {actor}}
+	if err := blueskyXRPC("GET", "app.bsky.actor.getProfile", accessJwt, q, nil, &profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// BlueskyResolveHandle returns the DID for a handle.
+func BlueskyResolveHandle(handle string) (string, error) {
+	var out struct {
+		DID string `json:"did"`
+	}
+	q := url.Values{"handle": {handle}}
+	if err := blueskyXRPC("GET", "com.atproto.identity.resolveHandle", "", q, nil, &out); err != nil {
+		return "", err
+	}
+	return out.DID, nil
+}
+
+// BlueskyUploadBlob uploads raw bytes and returns the blob to embed.
+func BlueskyUploadBlob(accessJwt string, data []byte, mimeType string) (*BlueskyBlob, error) {
+	req, err := http.NewRequest("POST", BlueskyPDSURL()+"/xrpc/com.atproto.repo.uploadBlob", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessJwt)
+	req.Header.Set("Content-Type", mimeType)
+
+	var out struct {
+		Blob BlueskyBlob `json:"blob"`
+	}
+	if err := blueskyDo(req, &out); err != nil {
+		return nil, err
+	}
+	return &out.Blob, nil
+}
+
+// BlueskyCreateRecord writes a record to the user's repo.
+func BlueskyCreateRecord(accessJwt, repo, collection string, record interface{}) (*BlueskyStrongRef, error) {
+	var ref BlueskyStrongRef
+	err := blueskyXRPC("POST", "com.atproto.repo.createRecord", accessJwt, nil, map[string]interface{}{
+		"repo":       repo,
+		"collection": collection,
+		"record":     record,
+	}, &ref)
+	if err != nil {
+		return nil, err
+	}
+	return &ref, nil
+}
+
+// BlueskyDeleteRecord deletes a record from the user's repo.
+func BlueskyDeleteRecord(accessJwt, repo, collection, rkey string) error {
+	return blueskyXRPC("POST", "com.atproto.repo.deleteRecord", accessJwt, nil, map[string]interface{}{
+		"repo":       repo,
+		"collection": collection,
+		"rkey":       rkey,
+	}, nil)
+}
+
+// BlueskyTokenExpiry reads the exp claim of a session JWT without verifying it.
+func BlueskyTokenExpiry(token string) *time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return nil
+	}
+	exp := time.Unix(claims.Exp, 0)
+	return &exp
+}
+
+func blueskyXRPC(method, nsid, token string, query url.Values, body interface{}, out interface{}) error {
+	endpoint := BlueskyPDSURL() + "/xrpc/" + nsid
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return blueskyDo(req, out)
+}
+
+func blueskyDo(req *http.Request, out interface{}) error {
+	resp, err := blueskyClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("bluesky request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &BlueskyError{Status: resp.StatusCode}
+		if json.Unmarshal(respBody, apiErr) != nil || apiErr.Code == "" {
+			apiErr.Code = http.StatusText(resp.StatusCode)
+			apiErr.Message = string(respBody)
+		}
+		return apiErr
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to decode bluesky response: %v", err)
+	}
+	return nil
+}
@@ -2,12 +2,18 @@ package lib
 
 import (
 	"context"
-	// "io" // io.ReadAll is no longer used, so 'io' import can be removed if not used elsewhere
-	"mime/multipart"
+	"errors"
+	"io"
+	"net/url"
 	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/cloudinary/cloudinary-go/v2"
 	"github.com/cloudinary/cloudinary-go/v2/api"
+	"github.com/cloudinary/cloudinary-go/v2/api/admin"
 	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
 )
 
@@ -24,15 +30,16 @@ func InitCloudinary() error {
 	return err
 }
 
-// Upload to Cloudinary and return the secure URL
-func UploadToCloudinary(file multipart.File, folder string, publicID string) (string, error) {
+// Upload to Cloudinary and return the secure URL. file is streamed, so a
+// multipart part can be passed on without buffering it first.
+func UploadToCloudinary(file io.Reader, folder string, publicID string) (string, error) {
 	// REMOVED: fileBytes, err := io.ReadAll(file)
 	// If you remove io.ReadAll, you can remove the "io" import as well if it's not used anywhere else in this file.
 	// if err != nil {
 	//     return "", err
 	// }
 
-	// FIX: Pass 'file' directly (multipart.File implements io.Reader, which is a supported source type)
+	// FIX: Pass 'file' directly (any io.Reader is a supported source type)
 	uploadResult, err := Cloud.Upload.Upload(context.Background(), file, uploader.UploadParams{
 		PublicID:     folder + "/" + publicID,
 		Folder:       folder,
@@ -44,4 +51,68 @@ func UploadToCloudinary(file multipart.File, folder string, publicID string) (st
 	}
 
 	return uploadResult.SecureURL, nil
-}
\ No newline at end of file
+}
+
+// VideoInfo describes a video in the media store.
+type VideoInfo struct {
+	Width    int
+	Height   int
+	Duration float64 // seconds
+}
+
+var cloudinaryVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// GetCloudinaryVideoInfo looks up the dimensions and length of a video by its
+// Cloudinary delivery URL.
+func GetCloudinaryVideoInfo(assetURL string) (*VideoInfo, error) {
+	publicID, err := cloudinaryPublicID(assetURL)
+	if err != nil {
+		return nil, err
+	}
+	res, err := Cloud.Admin.Asset(context.Background(), admin.AssetParams{
+		AssetType:     api.Video,
+		PublicID:      publicID,
+		MediaMetadata: api.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res.Error.Message != "" {
+		return nil, errors.New(res.Error.Message)
+	}
+
+	info := &VideoInfo{Width: res.Width, Height: res.Height}
+	if raw, ok := res.Response.(map[string]interface{}); ok {
+		if d, ok := raw["duration"].(float64); ok {
+			info.Duration = d
+		}
+	}
+	if info.Duration == 0 {
+		// Otherwise only present in the media metadata, as a string
+		if format, ok := res.VideoMetadata["format"].(map[string]interface{}); ok {
+			if d, ok := format["duration"].(string); ok {
+				info.Duration, _ = strconv.ParseFloat(d, 64)
+			}
+		}
+	}
+	return info, nil
+}
+
+// cloudinaryPublicID extracts the public ID from a delivery URL such as
+// https://res.cloudinary.com/<cloud>/video/upload/v123/videos/abc.mp4.
+func cloudinaryPublicID(assetURL string) (string, error) {
+	u, err := url.Parse(assetURL)
+	if err != nil || u.Host != "res.cloudinary.com" {
+		return "", errors.New("not a Cloudinary URL")
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 4 || parts[2] != "upload" {
+		return "", errors.New("not a Cloudinary upload URL")
+	}
+	parts = parts[3:]
+	if cloudinaryVersion.MatchString(parts[0]) && len(parts) > 1 {
+		parts = parts[1:]
+	}
+	id := strings.Join(parts, "/")
+	return strings.TrimSuffix(id, path.Ext(id)), nil
+}
@@ -0,0 +1,77 @@
+package lib
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+)
+
+// secretKey derives the AES-256 key used for credentials we must be able to read
+// back (app passwords, webhook URLs, bot tokens) from TOKEN_ENCRYPTION_KEY.
+func secretKey() ([]byte, error) {
+	key := os.Getenv("TOKEN_ENCRYPTION_KEY")
+	if key == "" {
+		return nil, errors.New("TOKEN_ENCRYPTION_KEY environment variable is not set")
+	}
+	sum := sha256.Sum256([]byte(key))
+	return sum[:], nil
+}
+
+// EncryptSecret encrypts plaintext with AES-GCM and returns it base64 encoded,
+// nonce first.
+func EncryptSecret(plaintext string) (string, error) {
+	key, err := secretKey()
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret reverses EncryptSecret.
+func DecryptSecret(encoded string) (string, error) {
+	key, err := secretKey()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("encrypted secret is too short")
+	}
+
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.New("failed to decrypt secret")
+	}
+	return string(plaintext), nil
+}
@@ -6,23 +6,17 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"strings"
 )
 
+// FetchFacebookPostAnalytics returns the lifetime insights of a Page post.
+// postID is the full "pageID_postID" ID; insights aren't available under the
+// bare post ID.
 func FetchFacebookPostAnalytics(postID string, accessToken string) (map[string]interface{}, error) {
-	// 🛠️ Strip compound ID like "pageID_postID"
-	if strings.Contains(postID, "_") {
-		parts := strings.Split(postID, "_")
-		if len(parts) == 2 {
-			postID = parts[1]
-		}
-	}
-
 	endpoint := fmt.Sprintf("https://graph.facebook.com/v19.0/%s/insights", postID)
 	params := url.Values{}
 
 	// ✅ Use only metrics that are valid for Page Posts
-	params.Set("metric", "post_impressions,post_engaged_users,post_reactions_by_type_total")
+	params.Set("metric", "post_impressions,post_reactions_by_type_total")
 	params.Set("access_token", accessToken)
 
 	url := fmt.Sprintf("%s?%s", endpoint, params.Encode())
@@ -0,0 +1,202 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+const telegramAPIURL = "https://api.telegram.org"
+
+// Long enough to cover a getUpdates long poll.
+var telegramClient = &http.Client{Timeout: 60 * time.Second}
+
+// TelegramBotToken returns the token of the app's Telegram bot.
+func TelegramBotToken() string {
+	return os.Getenv("TELEGRAM_BOT_TOKEN")
+}
+
+type TelegramUser struct {
+	ID        int64  `json:"id"`
+	IsBot     bool   `json:"is_bot"`
+	FirstName string `json:"first_name"`
+	Username  string `json:"username"`
+}
+
+type TelegramChatPhoto struct {
+	SmallFileID string `json:"small_file_id"`
+	BigFileID   string `json:"big_file_id"`
+}
+
+type TelegramChat struct {
+	ID        int64              `json:"id"`
+	Type      string             `json:"type"` // private, group, supergroup or channel
+	Title     string             `json:"title"`
+	Username  string             `json:"username"`
+	FirstName string             `json:"first_name"`
+	Photo     *TelegramChatPhoto `json:"photo"`
+}
+
+// TelegramChatMember is a member's status in a chat. The permission flags are
+// only present for administrators (can_post_messages) and restricted members
+// (can_send_messages).
+type TelegramChatMember struct {
+	Status          string       `json:"status"` // creator, administrator, member, restricted, left or kicked
+	User            TelegramUser `json:"user"`
+	CanPostMessages *bool        `json:"can_post_messages"`
+	CanSendMessages *bool        `json:"can_send_messages"`
+}
+
+type TelegramMessage struct {
+	MessageID  int           `json:"message_id"`
+	From       *TelegramUser `json:"from"`
+	SenderChat *TelegramChat `json:"sender_chat"`
+	Chat       TelegramChat  `json:"chat"`
+	Text       string        `json:"text"`
+	Caption    string        `json:"caption"`
+}
+
+type TelegramUpdate struct {
+	UpdateID    int64            `json:"update_id"`
+	Message     *TelegramMessage `json:"message"`
+	ChannelPost *TelegramMessage `json:"channel_post"`
+}
+
+// TelegramError is an unsuccessful Bot API response.
+type TelegramError struct {
+	Code        int    `json:"error_code"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+func (e *TelegramError) Error() string {
+	return fmt.Sprintf("telegram error %d: %s", e.Code, e.Description)
+}
+
+// TelegramCall invokes a Bot API method with a JSON body and decodes its result.
+func TelegramCall(botToken, method string, params interface{}, out interface{}) error {
+	if botToken == "" {
+		return fmt.Errorf("telegram bot token not set")
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	apiURL := fmt.Sprintf("%s/bot%s/%s", telegramAPIURL, botToken, method)
+	resp, err := telegramClient.Post(apiURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// The URL carries the token, so don't echo the client error
+		return fmt.Errorf("telegram %s request failed", method)
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		Ok     bool            `json:"ok"`
+		Result json.RawMessage `json:"result"`
+		TelegramError
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("telegram %s: unexpected response (status %d)", method, resp.StatusCode)
+	}
+	if !envelope.Ok {
+		return &envelope.TelegramError
+	}
+	if out != nil {
+		return json.Unmarshal(envelope.Result, out)
+	}
+	return nil
+}
+
+func TelegramGetMe(botToken string) (*TelegramUser, error) {
+	var me TelegramUser
+	if err := TelegramCall(botToken, "getMe", map[string]interface{}{}, &me); err != nil {
+		return nil, err
+	}
+	return &me, nil
+}
+
+func TelegramGetChat(botToken string, chatID int64) (*TelegramChat, error) {
+	var chat TelegramChat
+	if err := TelegramCall(botToken, "getChat", map[string]interface{}{"chat_id": chatID}, &chat); err != nil {
+		return nil, err
+	}
+	return &chat, nil
+}
+
+func TelegramGetChatMember(botToken string, chatID, userID int64) (*TelegramChatMember, error) {
+	var member TelegramChatMember
+	err := TelegramCall(botToken, "getChatMember", map[string]interface{}{
+		"chat_id": chatID,
+		"user_id": userID,
+	}, &member)
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func TelegramSendMessage(botToken string, chatID int64, text string) error {
+	return TelegramCall(botToken, "sendMessage", map[string]interface{}{
+		"chat_id": chatID,
+		"text":    text,
+	}, nil)
+}
+
+func TelegramDeleteMessage(botToken string, chatID int64, messageID int) error {
+	return TelegramCall(botToken, "deleteMessage", map[string]interface{}{
+		"chat_id":    chatID,
+		"message_id": messageID,
+	}, nil)
+}
+
+// TelegramDownloadFile opens the file with the given ID. The download URL
+// carries the bot token, so it is never returned; callers that need to keep
+// the file re-host it.
+func TelegramDownloadFile(botToken, fileID string) (io.ReadCloser, error) {
+	var file struct {
+		FilePath string `json:"file_path"`
+	}
+	if err := TelegramCall(botToken, "getFile", map[string]interface{}{"file_id": fileID}, &file); err != nil {
+		return nil, err
+	}
+	resp, err := telegramClient.Get(fmt.Sprintf("%s/file/bot%s/%s", telegramAPIURL, botToken, file.FilePath))
+	if err != nil {
+		return nil, fmt.Errorf("telegram file download failed")
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("telegram file download failed (status %d)", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// TelegramGetUpdates long-polls for updates after offset.
+func TelegramGetUpdates(botToken string, offset int64, timeoutSeconds int) ([]TelegramUpdate, error) {
+	var updates []TelegramUpdate
+	err := TelegramCall(botToken, "getUpdates", map[string]interface{}{
+		"offset":          offset,
+		"timeout":         timeoutSeconds,
+		"allowed_updates": []string{"message", "channel_post"},
+	}, &updates)
+	return updates, err
+}
+
+// TelegramSetWebhook points the bot's updates at url. Telegram echoes secret
+// in the X-Telegram-Bot-Api-Secret-Token header of every delivery.
+func TelegramSetWebhook(botToken, url, secret string) error {
+	return TelegramCall(botToken, "setWebhook", map[string]interface{}{
+		"url":             url,
+		"secret_token":    secret,
+		"allowed_updates": []string{"message", "channel_post"},
+	}, nil)
+}
+
+func TelegramDeleteWebhook(botToken string) error {
+	return TelegramCall(botToken, "deleteWebhook", map[string]interface{}{}, nil)
+}
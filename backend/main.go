@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 
+	"social-sync-backend/controllers"
 	"social-sync-backend/lib"
 	"social-sync-backend/routes"
 	"social-sync-backend/utils"
@@ -29,7 +30,7 @@ func CORSMiddleware(next http.Handler) http.Handler {
 
 		w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 		if r.Method == "OPTIONS" {
@@ -76,6 +77,20 @@ func main() {
 	}
 	log.Println("✅ Cloudinary initialized!")
 
+	// LinkedIn rejects calls with a sunset API version
+	if err := controllers.CheckLinkedInAPIVersion(); err != nil {
+		log.Fatalf("❌ Invalid LinkedIn configuration: %v", err)
+	}
+
+	// Telegram bot updates (chat verification)
+	controllers.StartTelegramUpdates(lib.DB)
+
+	// Instagram posts interrupted by a restart
+	controllers.StartInstagramJobs(lib.DB)
+
+	// YouTube uploads interrupted by a restart continue from their offset
+	controllers.StartYouTubeUploads(lib.DB)
+
 	// CRON Jobs
 	c := cron.New(cron.WithChain(
 		cron.Recover(cron.DefaultLogger),
@@ -90,13 +105,35 @@ func main() {
 		log.Fatalf("❌ Failed to schedule social account sync: %v", err)
 	}
 
-	// Post analytics sync every 6h
-	// if _, err := c.AddFunc("@every 1m", func() {
-	// 	log.Println("📊 Running scheduled Facebook analytics sync...")
-	// 	utils.SyncFacebookAnalytics(lib.DB)
-	// }); err != nil {
-	// 	log.Fatalf("❌ Failed to schedule Facebook analytics sync: %v", err)
-	// }
+	// Scheduled toots get a new status ID once the instance publishes them
+	if _, err := c.AddFunc("@every 15m", func() {
+		controllers.ResolveScheduledMastodonPosts(lib.DB)
+	}); err != nil {
+		log.Fatalf("❌ Failed to schedule Mastodon scheduled toot resolution: %v", err)
+	}
+
+	// Post analytics snapshots; each post is only snapshotted when its
+	// age-based interval has passed
+	if _, err := c.AddFunc("@every 15m", func() {
+		controllers.CollectPostAnalytics(lib.DB)
+	}); err != nil {
+		log.Fatalf("❌ Failed to schedule post analytics collection: %v", err)
+	}
+
+	// Daily follower counts; runs hourly so accounts that failed are retried
+	// the same day
+	if _, err := c.AddFunc("@hourly", func() {
+		controllers.CollectAccountMetrics(lib.DB)
+	}); err != nil {
+		log.Fatalf("❌ Failed to schedule account metrics collection: %v", err)
+	}
+
+	// Weekly and monthly analytics reports by email
+	if _, err := c.AddFunc("@every 15m", func() {
+		controllers.SendDueReports(lib.DB)
+	}); err != nil {
+		log.Fatalf("❌ Failed to schedule analytics reports: %v", err)
+	}
 
 	c.Start()
 	defer c.Stop()
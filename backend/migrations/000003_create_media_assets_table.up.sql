@@ -0,0 +1,12 @@
+CREATE TABLE media_assets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    url TEXT NOT NULL,
+    media_type TEXT NOT NULL,
+    alt_text TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX idx_media_assets_user_id ON media_assets(user_id);
+CREATE INDEX idx_media_assets_user_id_url ON media_assets(user_id, url);
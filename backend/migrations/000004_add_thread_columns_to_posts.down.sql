@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_posts_thread_root_id;
+ALTER TABLE posts DROP COLUMN IF EXISTS thread_position;
+ALTER TABLE posts DROP COLUMN IF EXISTS thread_root_id;
@@ -0,0 +1,4 @@
+ALTER TABLE posts ADD COLUMN thread_root_id UUID REFERENCES posts(id) ON DELETE CASCADE;
+ALTER TABLE posts ADD COLUMN thread_position INTEGER;
+
+CREATE INDEX idx_posts_thread_root_id ON posts(thread_root_id);
@@ -0,0 +1 @@
+ALTER TABLE social_accounts DROP COLUMN IF EXISTS encrypted_secret;
@@ -0,0 +1 @@
+ALTER TABLE social_accounts ADD COLUMN encrypted_secret TEXT;
@@ -0,0 +1 @@
+ALTER TABLE posts ADD COLUMN target TEXT;
@@ -0,0 +1,11 @@
+CREATE TABLE telegram_verifications (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    code TEXT NOT NULL UNIQUE,
+    chat_id BIGINT,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    verified_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX idx_telegram_verifications_user_id ON telegram_verifications(user_id);
@@ -0,0 +1,9 @@
+CREATE TABLE telegram_bots (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL UNIQUE,
+    bot_id BIGINT NOT NULL UNIQUE,
+    username TEXT NOT NULL,
+    encrypted_token TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
@@ -0,0 +1,15 @@
+CREATE TABLE instagram_jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    caption TEXT NOT NULL,
+    items JSONB NOT NULL,
+    carousel_id TEXT,
+    status TEXT NOT NULL,
+    error TEXT,
+    media_id TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX idx_instagram_jobs_user_id ON instagram_jobs(user_id);
+CREATE INDEX idx_instagram_jobs_status ON instagram_jobs(status);
@@ -0,0 +1,2 @@
+ALTER TABLE instagram_jobs DROP COLUMN IF EXISTS first_comment_id;
+ALTER TABLE instagram_jobs DROP COLUMN IF EXISTS options;
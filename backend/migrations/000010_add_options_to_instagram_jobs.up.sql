@@ -0,0 +1,2 @@
+ALTER TABLE instagram_jobs ADD COLUMN options JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE instagram_jobs ADD COLUMN first_comment_id TEXT;
@@ -0,0 +1,18 @@
+CREATE TABLE youtube_uploads (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    source_url TEXT NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    content_type TEXT,
+    metadata JSONB NOT NULL,
+    session_uri TEXT,
+    bytes_uploaded BIGINT NOT NULL DEFAULT 0,
+    status TEXT NOT NULL,
+    video_id TEXT,
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX idx_youtube_uploads_user_id ON youtube_uploads(user_id);
+CREATE INDEX idx_youtube_uploads_status ON youtube_uploads(status);
@@ -0,0 +1 @@
+ALTER TABLE youtube_uploads DROP COLUMN IF EXISTS options;
@@ -0,0 +1 @@
+ALTER TABLE youtube_uploads ADD COLUMN options JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,2 @@
+ALTER TABLE posts DROP COLUMN IF EXISTS extra_platform_ids;
+DROP TABLE IF EXISTS post_history;
@@ -0,0 +1,14 @@
+CREATE TABLE post_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    action TEXT NOT NULL,
+    previous_message TEXT,
+    message TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX idx_post_history_post_id ON post_history(post_id);
+
+-- Further messages a post was split into, e.g. Telegram albums and overflow text
+ALTER TABLE posts ADD COLUMN extra_platform_ids JSONB;
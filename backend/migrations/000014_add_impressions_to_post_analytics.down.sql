@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_post_analytics_post_id_snapshot_at;
+ALTER TABLE post_analytics DROP COLUMN IF EXISTS impressions;
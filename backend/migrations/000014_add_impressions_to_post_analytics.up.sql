@@ -0,0 +1,3 @@
+ALTER TABLE post_analytics ADD COLUMN impressions INTEGER DEFAULT 0;
+
+CREATE INDEX idx_post_analytics_post_id_snapshot_at ON post_analytics(post_id, snapshot_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_posts_user_id_platform_posted_at;
+DROP INDEX IF EXISTS idx_posts_user_id_posted_at;
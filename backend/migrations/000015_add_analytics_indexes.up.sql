@@ -0,0 +1,3 @@
+-- Analytics queries select a user's posts by publish time, optionally on one platform
+CREATE INDEX idx_posts_user_id_posted_at ON posts(user_id, posted_at);
+CREATE INDEX idx_posts_user_id_platform_posted_at ON posts(user_id, platform, posted_at);
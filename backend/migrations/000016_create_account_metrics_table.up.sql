@@ -0,0 +1,13 @@
+CREATE TABLE account_metrics (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    platform TEXT NOT NULL,
+    social_id TEXT NOT NULL,
+    followers INTEGER NOT NULL DEFAULT 0,
+    following INTEGER,
+    posts INTEGER,
+    views BIGINT,
+    snapshot_date DATE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+    UNIQUE (user_id, platform, snapshot_date)
+);
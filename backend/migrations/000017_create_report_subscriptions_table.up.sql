@@ -0,0 +1,20 @@
+CREATE TABLE report_subscriptions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    name TEXT NOT NULL,
+    frequency TEXT NOT NULL,
+    -- The account set the report covers; empty for all connected accounts
+    platforms JSONB NOT NULL DEFAULT '[]',
+    -- Empty to send to the user's own address
+    recipients JSONB NOT NULL DEFAULT '[]',
+    time_zone TEXT NOT NULL DEFAULT 'UTC',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    next_send_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_sent_at TIMESTAMP WITH TIME ZONE,
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX idx_report_subscriptions_user_id ON report_subscriptions(user_id);
+CREATE INDEX idx_report_subscriptions_next_send_at ON report_subscriptions(next_send_at) WHERE enabled;
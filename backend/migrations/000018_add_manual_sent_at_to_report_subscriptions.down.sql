@@ -0,0 +1 @@
+ALTER TABLE report_subscriptions DROP COLUMN IF EXISTS manual_sent_at;
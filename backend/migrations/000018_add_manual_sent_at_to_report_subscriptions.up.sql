@@ -0,0 +1,2 @@
+-- When the report was last sent on demand, to rate-limit those sends
+ALTER TABLE report_subscriptions ADD COLUMN manual_sent_at TIMESTAMP WITH TIME ZONE;
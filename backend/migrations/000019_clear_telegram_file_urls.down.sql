@@ -0,0 +1 @@
+-- The cleared URLs contained bot tokens and are not restored
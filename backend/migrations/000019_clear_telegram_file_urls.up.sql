@@ -0,0 +1,3 @@
+-- Telegram file URLs embed the bot token; chat photos are re-hosted instead
+UPDATE social_accounts SET profile_picture_url = NULL
+WHERE platform = 'telegram' AND profile_picture_url LIKE 'https://api.telegram.org/file/bot%';
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// AccountMetrics is a daily snapshot of a connected account's audience.
+// Followers is the platform's main audience count: page fans, subscribers or
+// chat members. The other counts are nil where the platform doesn't report
+// them.
+type AccountMetrics struct {
+	ID           uuid.UUID `json:"id"`
+	UserID       uuid.UUID `json:"userId"`
+	Platform     string    `json:"platform"`
+	SocialID     string    `json:"socialId"`
+	Followers    int       `json:"followers"`
+	Following    *int      `json:"following,omitempty"`
+	Posts        *int      `json:"posts,omitempty"`
+	Views        *int64    `json:"views,omitempty"`
+	SnapshotDate time.Time `json:"snapshotDate"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// SaveAccountMetrics stores the snapshot of the day, replacing an earlier one
+// from the same day.
+func SaveAccountMetrics(db *sql.DB, m AccountMetrics) error {
+	_, err := db.Exec(`
+		INSERT INTO account_metrics (id, user_id, platform, social_id, followers, following, posts, views, snapshot_date, created_at)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+		ON CONFLICT (user_id, platform, snapshot_date) DO UPDATE SET
+			social_id = EXCLUDED.social_id,
+			followers = EXCLUDED.followers,
+			following = EXCLUDED.following,
+			posts = EXCLUDED.posts,
+			views = EXCLUDED.views,
+			created_at = EXCLUDED.created_at
+	`, m.ID, m.UserID, m.Platform, m.SocialID, m.Followers, m.Following, m.Posts, m.Views,
+		m.SnapshotDate.Format("2006-01-02"), m.CreatedAt)
+	return err
+}
+
+// ListAccountsWithMetricsOn returns the user_id/platform pairs that already
+// have a snapshot for the given day, as "userID:platform".
+func ListAccountsWithMetricsOn(db *sql.DB, day time.Time) (map[string]bool, error) {
+	rows, err := db.Query(`
+		SELECT user_id, platform FROM account_metrics WHERE snapshot_date = $1
+	`, day.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	done := make(map[string]bool)
+	for rows.Next() {
+		var userID, platform string
+		if err := rows.Scan(&userID, &platform); err != nil {
+			return nil, err
+		}
+		done[userID+":"+platform] = true
+	}
+	return done, rows.Err()
+}
+
+// ListAccountMetrics returns the user's last snapshot in each day, week or
+// month bucket of [from, to), per platform, oldest first. SnapshotDate is
+// the date of the snapshot, not the start of its bucket.
+func ListAccountMetrics(db *sql.DB, userID string, platforms []string, interval string, from, to time.Time) ([]AccountMetrics, error) {
+	return queryAccountMetrics(db, `
+		SELECT id, user_id, platform, social_id, followers, following, posts, views, snapshot_date, created_at
+		FROM (
+			SELECT DISTINCT ON (platform, date_trunc($3, snapshot_date::timestamp)) *
+			FROM account_metrics
+			WHERE user_id = $1 AND (cardinality($2::text[]) = 0 OR platform = ANY($2::text[]))
+				AND snapshot_date >= $4 AND snapshot_date < $5
+			ORDER BY platform, date_trunc($3, snapshot_date::timestamp), snapshot_date DESC
+		) m
+		ORDER BY platform, snapshot_date
+	`, userID, pq.Array(platforms), interval, from.Format("2006-01-02"), to.Format("2006-01-02"))
+}
+
+// ListAccountMetricsBefore returns the user's last snapshot before the given
+// day on each platform, the baseline for growth from that day on.
+func ListAccountMetricsBefore(db *sql.DB, userID string, platforms []string, day time.Time) ([]AccountMetrics, error) {
+	return queryAccountMetrics(db, `
+		SELECT DISTINCT ON (platform)
+			id, user_id, platform, social_id, followers, following, posts, views, snapshot_date, created_at
+		FROM account_metrics
+		WHERE user_id = $1 AND (cardinality($2::text[]) = 0 OR platform = ANY($2::text[])) AND snapshot_date < $3
+		ORDER BY platform, snapshot_date DESC
+	`, userID, pq.Array(platforms), day.Format("2006-01-02"))
+}
+
+func queryAccountMetrics(db *sql.DB, query string, args ...interface{}) ([]AccountMetrics, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metrics := []AccountMetrics{}
+	for rows.Next() {
+		var m AccountMetrics
+		err := rows.Scan(&m.ID, &m.UserID, &m.Platform, &m.SocialID, &m.Followers, &m.Following,
+			&m.Posts, &m.Views, &m.SnapshotDate, &m.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, rows.Err()
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Instagram job statuses. Jobs in any other status than published or failed
+// are picked up again when the server restarts.
+const (
+	InstagramJobQueued     = "queued"
+	InstagramJobProcessing = "processing"
+	InstagramJobPublishing = "publishing"
+	InstagramJobPublished  = "published"
+	InstagramJobFailed     = "failed"
+)
+
+// InstagramJobItem is one media item of an Instagram post and the state of
+// its media container.
+type InstagramJobItem struct {
+	URL         string `json:"url"`
+	AltText     string `json:"altText,omitempty"`
+	Video       bool   `json:"video"`
+	ContainerID string `json:"containerId,omitempty"`
+	Status      string `json:"status"` // pending, processing, finished or failed
+
+	UserTags []InstagramUserTag `json:"userTags,omitempty"`
+}
+
+// InstagramUserTag tags an account on a media item. Feed images place the tag
+// at X/Y (0 to 1 from the top left); Reels tags have no position.
+type InstagramUserTag struct {
+	Username string   `json:"username"`
+	X        *float64 `json:"x,omitempty"`
+	Y        *float64 `json:"y,omitempty"`
+}
+
+// InstagramJobOptions are the post-level settings of a job.
+type InstagramJobOptions struct {
+	Type          string   `json:"type"` // feed, reel or story
+	ShareToFeed   bool     `json:"shareToFeed,omitempty"`
+	CoverURL      string   `json:"coverUrl,omitempty"`
+	ThumbOffset   *int     `json:"thumbOffset,omitempty"` // milliseconds into the video
+	LocationID    string   `json:"locationId,omitempty"`
+	Collaborators []string `json:"collaborators,omitempty"`
+	FirstComment  string   `json:"firstComment,omitempty"`
+}
+
+// InstagramJob is an Instagram post being published in the background.
+type InstagramJob struct {
+	ID         uuid.UUID           `json:"id"`
+	UserID     uuid.UUID           `json:"userId"`
+	Caption    string              `json:"caption"`
+	Items      []InstagramJobItem  `json:"items"`
+	Options    InstagramJobOptions `json:"options"`
+	CarouselID string              `json:"carouselId,omitempty"`
+	Status     string              `json:"status"`
+	Error      string              `json:"error,omitempty"`
+	MediaID    string              `json:"mediaId,omitempty"` // the published post
+	CommentID  string              `json:"firstCommentId,omitempty"`
+	CreatedAt  time.Time           `json:"createdAt"`
+	UpdatedAt  time.Time           `json:"updatedAt"`
+}
+
+// Done reports whether the job has reached a final status.
+func (j InstagramJob) Done() bool {
+	return j.Status == InstagramJobPublished || j.Status == InstagramJobFailed
+}
+
+func SaveInstagramJob(db *sql.DB, job InstagramJob) error {
+	items, err := json.Marshal(job.Items)
+	if err != nil {
+		return err
+	}
+	options, err := json.Marshal(job.Options)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		INSERT INTO instagram_jobs (id, user_id, caption, items, options, status, created_at, updated_at)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+	`, job.ID, job.UserID, job.Caption, items, options, job.Status, job.CreatedAt, job.UpdatedAt)
+	return err
+}
+
+// UpdateInstagramJob stores the progress of a job.
+func UpdateInstagramJob(db *sql.DB, job InstagramJob) error {
+	items, err := json.Marshal(job.Items)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		UPDATE instagram_jobs
+		SET items = $1, carousel_id = NULLIF($2, ''), status = $3,
+			error = NULLIF($4, ''), media_id = NULLIF($5, ''),
+			first_comment_id = NULLIF($6, ''), updated_at = NOW()
+		WHERE id = $7
+	`, items, job.CarouselID, job.Status, job.Error, job.MediaID, job.CommentID, job.ID)
+	return err
+}
+
+// GetInstagramJob returns the job with the given ID if it belongs to the user.
+func GetInstagramJob(db *sql.DB, userID, jobID string) (*InstagramJob, error) {
+	return scanInstagramJob(db.QueryRow(instagramJobSelect+` WHERE id = $1 AND user_id = $2`, jobID, userID))
+}
+
+// GetInstagramJobByID returns a job regardless of its owner, for the worker.
+func GetInstagramJobByID(db *sql.DB, jobID uuid.UUID) (*InstagramJob, error) {
+	return scanInstagramJob(db.QueryRow(instagramJobSelect+` WHERE id = $1`, jobID))
+}
+
+// ListUnfinishedInstagramJobIDs returns the jobs that were interrupted before
+// reaching a final status. A job in publishing may already be live, so the
+// worker checks its container before publishing it again.
+func ListUnfinishedInstagramJobIDs(db *sql.DB) ([]uuid.UUID, error) {
+	rows, err := db.Query(`
+		SELECT id FROM instagram_jobs
+		WHERE status NOT IN ($1, $2)
+		ORDER BY created_at
+	`, InstagramJobPublished, InstagramJobFailed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+const instagramJobSelect = `
+	SELECT id, user_id, caption, items, options, COALESCE(carousel_id, ''), status,
+		COALESCE(error, ''), COALESCE(media_id, ''), COALESCE(first_comment_id, ''),
+		created_at, updated_at
+	FROM instagram_jobs`
+
+func scanInstagramJob(row *sql.Row) (*InstagramJob, error) {
+	var job InstagramJob
+	var items, options []byte
+	err := row.Scan(
+		&job.ID, &job.UserID, &job.Caption, &items, &options, &job.CarouselID, &job.Status,
+		&job.Error, &job.MediaID, &job.CommentID, &job.CreatedAt, &job.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(items, &job.Items); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(options, &job.Options); err != nil {
+		return nil, err
+	}
+	if job.Options.Type == "" {
+		job.Options.Type = "feed"
+	}
+	return &job, nil
+}
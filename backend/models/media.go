@@ -0,0 +1,126 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MediaItem is a single piece of media attached to a publish request.
+// Either URL or AssetID must be set; AssetID refers to a row in media_assets.
+type MediaItem struct {
+	URL     string `json:"url,omitempty"`
+	AssetID string `json:"assetId,omitempty"`
+	AltText string `json:"altText,omitempty"`
+}
+
+// MediaAsset is an uploaded file in the user's media library.
+type MediaAsset struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"userId"`
+	URL       string    `json:"url"`
+	MediaType string    `json:"mediaType"` // image or video
+	AltText   *string   `json:"altText"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func SaveMediaAsset(db *sql.DB, asset MediaAsset) error {
+	_, err := db.Exec(`
+		INSERT INTO media_assets (id, user_id, url, media_type, alt_text, created_at, updated_at)
+		VALUES ($1,$2,$3,$4,$5,$6,$7)
+	`,
+		asset.ID,
+		asset.UserID,
+		asset.URL,
+		asset.MediaType,
+		asset.AltText,
+		asset.CreatedAt,
+		asset.UpdatedAt,
+	)
+	return err
+}
+
+// GetMediaAsset returns the asset with the given ID if it belongs to the user.
+func GetMediaAsset(db *sql.DB, userID, assetID string) (*MediaAsset, error) {
+	var asset MediaAsset
+	err := db.QueryRow(`
+		SELECT id, user_id, url, media_type, alt_text, created_at, updated_at
+		FROM media_assets
+		WHERE id = $1 AND user_id = $2
+	`, assetID, userID).Scan(
+		&asset.ID, &asset.UserID, &asset.URL, &asset.MediaType,
+		&asset.AltText, &asset.CreatedAt, &asset.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// FindMediaAssetByURL returns the most recent library entry for a URL, if any.
+func FindMediaAssetByURL(db *sql.DB, userID, url string) (*MediaAsset, error) {
+	var asset MediaAsset
+	err := db.QueryRow(`
+		SELECT id, user_id, url, media_type, alt_text, created_at, updated_at
+		FROM media_assets
+		WHERE user_id = $1 AND url = $2
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, userID, url).Scan(
+		&asset.ID, &asset.UserID, &asset.URL, &asset.MediaType,
+		&asset.AltText, &asset.CreatedAt, &asset.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func ListMediaAssets(db *sql.DB, userID string) ([]MediaAsset, error) {
+	rows, err := db.Query(`
+		SELECT id, user_id, url, media_type, alt_text, created_at, updated_at
+		FROM media_assets
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assets := []MediaAsset{}
+	for rows.Next() {
+		var asset MediaAsset
+		if err := rows.Scan(
+			&asset.ID, &asset.UserID, &asset.URL, &asset.MediaType,
+			&asset.AltText, &asset.CreatedAt, &asset.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		assets = append(assets, asset)
+	}
+	return assets, rows.Err()
+}
+
+// UpdateMediaAssetAltText sets the alt text of an asset. It returns sql.ErrNoRows
+// when the asset does not exist or belongs to another user.
+func UpdateMediaAssetAltText(db *sql.DB, userID, assetID string, altText *string) error {
+	result, err := db.Exec(`
+		UPDATE media_assets
+		SET alt_text = $1, updated_at = NOW()
+		WHERE id = $2 AND user_id = $3
+	`, altText, assetID, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type Post struct {
@@ -19,6 +20,16 @@ type Post struct {
 	Status         string    `json:"status"`
 	CreatedAt      time.Time `json:"createdAt"`
 	UpdatedAt      time.Time `json:"updatedAt"`
+
+	// Set on every segment of a thread; the first segment points at itself
+	ThreadRootID   *uuid.UUID `json:"threadRootId,omitempty"`
+	ThreadPosition *int       `json:"threadPosition,omitempty"`
+
+	// Destination within the platform, e.g. the subreddit a submission went to
+	Target string `json:"target,omitempty"`
+
+	// Further messages the post was split into, after PlatformPostID
+	ExtraPlatformIDs []string `json:"extraPlatformIds,omitempty"`
 }
 
 func SavePost(db *sql.DB, post Post) error {
@@ -26,12 +37,19 @@ func SavePost(db *sql.DB, post Post) error {
 	if err != nil {
 		return err
 	}
+	var extraIDsJSON []byte
+	if len(post.ExtraPlatformIDs) > 0 {
+		if extraIDsJSON, err = json.Marshal(post.ExtraPlatformIDs); err != nil {
+			return err
+		}
+	}
 
 	query := `
 		INSERT INTO posts (
 			id, user_id, platform, platform_post_id, message,
-			media_urls, posted_at, status, created_at, updated_at
-		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+			media_urls, posted_at, status, created_at, updated_at,
+			thread_root_id, thread_position, target, extra_platform_ids
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,NULLIF($13, ''),$14)
 	`
 
 	_, err = db.Exec(
@@ -46,7 +64,183 @@ func SavePost(db *sql.DB, post Post) error {
 		post.Status,
 		post.CreatedAt,
 		post.UpdatedAt,
+		post.ThreadRootID,
+		post.ThreadPosition,
+		post.Target,
+		extraIDsJSON,
 	)
 
 	return err
 }
+
+// UpdatePostStatus sets the status of a post identified by its platform ID,
+// e.g. once an asynchronous upload finishes processing.
+func UpdatePostStatus(db *sql.DB, platform, platformPostID, status string) error {
+	_, err := db.Exec(`
+		UPDATE posts SET status = $1, updated_at = NOW()
+		WHERE platform = $2 AND platform_post_id = $3
+	`, status, platform, platformPostID)
+	return err
+}
+
+const postSelect = `
+	SELECT id, user_id, platform, platform_post_id, message, media_urls,
+		posted_at, status, created_at, updated_at, thread_root_id, thread_position,
+		COALESCE(target, ''), extra_platform_ids
+	FROM posts`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPost(row rowScanner) (*Post, error) {
+	var post Post
+	var mediaURLs, extraIDs []byte
+	err := row.Scan(
+		&post.ID, &post.UserID, &post.Platform, &post.PlatformPostID, &post.Message, &mediaURLs,
+		&post.PostedAt, &post.Status, &post.CreatedAt, &post.UpdatedAt, &post.ThreadRootID, &post.ThreadPosition,
+		&post.Target, &extraIDs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(mediaURLs) > 0 {
+		if err := json.Unmarshal(mediaURLs, &post.MediaURLs); err != nil {
+			return nil, err
+		}
+	}
+	if len(extraIDs) > 0 {
+		if err := json.Unmarshal(extraIDs, &post.ExtraPlatformIDs); err != nil {
+			return nil, err
+		}
+	}
+	return &post, nil
+}
+
+// GetPostByPlatformID returns the user's post with the given platform ID.
+func GetPostByPlatformID(db *sql.DB, userID, platform, platformPostID string) (*Post, error) {
+	return scanPost(db.QueryRow(postSelect+`
+		WHERE user_id = $1 AND platform = $2 AND platform_post_id = $3
+	`, userID, platform, platformPostID))
+}
+
+// ListPostsByStatus returns the user's posts on a platform with the given
+// status, oldest first by posted_at (the publish time for scheduled posts).
+func ListPostsByStatus(db *sql.DB, userID, platform, status string) ([]Post, error) {
+	rows, err := db.Query(postSelect+`
+		WHERE user_id = $1 AND platform = $2 AND status = $3
+		ORDER BY posted_at
+	`, userID, platform, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, *post)
+	}
+	return posts, rows.Err()
+}
+
+// MarkDueScheduledPosts flips the user's scheduled posts on a platform whose
+// publish time has passed to posted; the platform published them itself.
+func MarkDueScheduledPosts(db *sql.DB, userID, platform string) error {
+	_, err := db.Exec(`
+		UPDATE posts SET status = 'posted', updated_at = NOW()
+		WHERE user_id = $1 AND platform = $2 AND status = 'scheduled' AND posted_at <= NOW()
+	`, userID, platform)
+	return err
+}
+
+// ListDueScheduledPosts returns every user's scheduled posts on a platform
+// whose publish time has passed.
+func ListDueScheduledPosts(db *sql.DB, platform string) ([]Post, error) {
+	rows, err := db.Query(postSelect+`
+		WHERE platform = $1 AND status = 'scheduled' AND posted_at <= NOW()
+		ORDER BY user_id, posted_at
+	`, platform)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, *post)
+	}
+	return posts, rows.Err()
+}
+
+// SetPostPublished records that a scheduled or pending post went live under
+// a new platform ID.
+func SetPostPublished(db *sql.DB, postID uuid.UUID, platformPostID string, postedAt time.Time) error {
+	_, err := db.Exec(`
+		UPDATE posts SET platform_post_id = $1, status = 'posted', posted_at = $2, updated_at = NOW()
+		WHERE id = $3
+	`, platformPostID, postedAt, postID)
+	return err
+}
+
+// PublishDueScheduledPosts flips every user's scheduled posts on the given
+// platforms to posted once their publish time has passed. Only use it for
+// platforms that publish scheduled posts under the ID they were scheduled
+// with.
+func PublishDueScheduledPosts(db *sql.DB, platforms []string) error {
+	_, err := db.Exec(`
+		UPDATE posts SET status = 'posted', updated_at = NOW()
+		WHERE platform = ANY($1::text[]) AND status = 'scheduled' AND posted_at <= NOW()
+	`, pq.Array(platforms))
+	return err
+}
+
+// GetPost returns the post with the given ID if it belongs to the user.
+func GetPost(db *sql.DB, userID, postID string) (*Post, error) {
+	return scanPost(db.QueryRow(postSelect+` WHERE id = $1 AND user_id = $2`, postID, userID))
+}
+
+// ListThreadPosts returns the segments of a thread in order, the root first.
+func ListThreadPosts(db *sql.DB, rootID uuid.UUID) ([]Post, error) {
+	rows, err := db.Query(postSelect+`
+		WHERE thread_root_id = $1
+		ORDER BY thread_position
+	`, rootID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, *post)
+	}
+	return posts, rows.Err()
+}
+
+// UpdatePostMessage stores the text of an edited post.
+func UpdatePostMessage(db *sql.DB, postID uuid.UUID, message string) error {
+	_, err := db.Exec(`
+		UPDATE posts SET message = $1, updated_at = NOW() WHERE id = $2
+	`, message, postID)
+	return err
+}
+
+// SetPostStatus sets the status of a post by its ID.
+func SetPostStatus(db *sql.DB, postID uuid.UUID, status string) error {
+	_, err := db.Exec(`
+		UPDATE posts SET status = $1, updated_at = NOW() WHERE id = $2
+	`, status, postID)
+	return err
+}
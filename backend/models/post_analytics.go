@@ -0,0 +1,337 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// PostAnalytics is a snapshot of a post's engagement at SnapshotAt. Metrics a
+// platform doesn't report stay 0.
+type PostAnalytics struct {
+	ID          uuid.UUID `json:"id"`
+	PostID      uuid.UUID `json:"postId"`
+	Likes       int       `json:"likes"`
+	Comments    int       `json:"comments"`
+	Shares      int       `json:"shares"`
+	Views       int       `json:"views"`
+	Impressions int       `json:"impressions"`
+	SnapshotAt  time.Time `json:"snapshotAt"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+func SavePostAnalytics(db *sql.DB, a PostAnalytics) error {
+	_, err := db.Exec(`
+		INSERT INTO post_analytics (id, post_id, likes, comments, shares, views, impressions, snapshot_at, created_at)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+	`, a.ID, a.PostID, a.Likes, a.Comments, a.Shares, a.Views, a.Impressions, a.SnapshotAt, a.CreatedAt)
+	return err
+}
+
+// ListPublishedPostsSince returns every user's published posts from after
+// since, for the analytics collector.
+func ListPublishedPostsSince(db *sql.DB, since time.Time) ([]Post, error) {
+	rows, err := db.Query(postSelect+`
+		WHERE status = 'posted' AND posted_at > $1 AND posted_at <= NOW()
+		ORDER BY posted_at
+	`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, *post)
+	}
+	return posts, rows.Err()
+}
+
+// LatestAnalyticsSnapshots returns when each post published after since was
+// last snapshotted. Posts without a snapshot are missing from the map.
+func LatestAnalyticsSnapshots(db *sql.DB, since time.Time) (map[uuid.UUID]time.Time, error) {
+	rows, err := db.Query(`
+		SELECT a.post_id, MAX(a.snapshot_at)
+		FROM post_analytics a
+		JOIN posts p ON p.id = a.post_id
+		WHERE p.posted_at > $1
+		GROUP BY a.post_id
+	`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	latest := make(map[uuid.UUID]time.Time)
+	for rows.Next() {
+		var id uuid.UUID
+		var at time.Time
+		if err := rows.Scan(&id, &at); err != nil {
+			return nil, err
+		}
+		latest[id] = at
+	}
+	return latest, rows.Err()
+}
+
+// LatestPostAnalytics returns the most recent snapshot of each of the posts.
+// Posts without a snapshot are missing from the map.
+func LatestPostAnalytics(db *sql.DB, postIDs []uuid.UUID) (map[uuid.UUID]PostAnalytics, error) {
+	ids := make([]string, len(postIDs))
+	for i, id := range postIDs {
+		ids[i] = id.String()
+	}
+	rows, err := db.Query(`
+		SELECT DISTINCT ON (post_id)
+			id, post_id, COALESCE(likes, 0), COALESCE(comments, 0), COALESCE(shares, 0),
+			COALESCE(views, 0), COALESCE(impressions, 0), snapshot_at, created_at
+		FROM post_analytics
+		WHERE post_id = ANY($1::uuid[])
+		ORDER BY post_id, snapshot_at DESC
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	latest := make(map[uuid.UUID]PostAnalytics)
+	for rows.Next() {
+		var a PostAnalytics
+		if err := rows.Scan(&a.ID, &a.PostID, &a.Likes, &a.Comments, &a.Shares,
+			&a.Views, &a.Impressions, &a.SnapshotAt, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		latest[a.PostID] = a
+	}
+	return latest, rows.Err()
+}
+
+// AnalyticsPoint is one point of a metric time series. Depending on the
+// series the metrics are running totals or what was gained in the bucket.
+type AnalyticsPoint struct {
+	At          time.Time `json:"at"`
+	Likes       int       `json:"likes"`
+	Comments    int       `json:"comments"`
+	Shares      int       `json:"shares"`
+	Views       int       `json:"views"`
+	Impressions int       `json:"impressions"`
+	Engagements int       `json:"engagements"` // likes, comments and shares
+}
+
+// ListPostAnalyticsSeries returns a post's running totals: every snapshot if
+// interval is empty, otherwise the last snapshot of each day, week or month
+// in the time zone tz.
+func ListPostAnalyticsSeries(db *sql.DB, postID uuid.UUID, interval, tz string) ([]AnalyticsPoint, error) {
+	var rows *sql.Rows
+	var err error
+	if interval == "" {
+		rows, err = db.Query(`
+			SELECT snapshot_at, likes, comments, shares, views, impressions
+			FROM post_analytics
+			WHERE post_id = $1
+			ORDER BY snapshot_at
+		`, postID)
+	} else {
+		rows, err = db.Query(`
+			SELECT bucket AT TIME ZONE $3, likes, comments, shares, views, impressions
+			FROM (
+				SELECT DISTINCT ON (bucket) bucket, likes, comments, shares, views, impressions
+				FROM (
+					SELECT date_trunc($2, snapshot_at AT TIME ZONE $3) AS bucket, snapshot_at,
+						likes, comments, shares, views, impressions
+					FROM post_analytics
+					WHERE post_id = $1
+				) s
+				ORDER BY bucket, snapshot_at DESC
+			) b
+			ORDER BY bucket
+		`, postID, interval, tz)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return scanAnalyticsPoints(rows)
+}
+
+// ListAnalyticsTimeSeries returns what the user's posts gained in each day,
+// week or month bucket of [from, to) in the time zone tz, with empty buckets
+// filled in. A post's gain is the difference between consecutive snapshots.
+// Only posts published after trackedSince can have snapshots in the range.
+func ListAnalyticsTimeSeries(db *sql.DB, userID string, platforms []string, interval, tz string, from, to, trackedSince time.Time) ([]AnalyticsPoint, error) {
+	rows, err := db.Query(`
+		WITH gains AS (
+			SELECT a.snapshot_at,
+				a.likes - COALESCE(LAG(a.likes) OVER w, 0) AS likes,
+				a.comments - COALESCE(LAG(a.comments) OVER w, 0) AS comments,
+				a.shares - COALESCE(LAG(a.shares) OVER w, 0) AS shares,
+				a.views - COALESCE(LAG(a.views) OVER w, 0) AS views,
+				a.impressions - COALESCE(LAG(a.impressions) OVER w, 0) AS impressions
+			FROM post_analytics a
+			JOIN posts p ON p.id = a.post_id
+			WHERE p.user_id = $1 AND (cardinality($2::text[]) = 0 OR p.platform = ANY($2::text[]))
+				AND p.posted_at >= $7 AND p.posted_at < $4 AND a.snapshot_at < $4
+			WINDOW w AS (PARTITION BY a.post_id ORDER BY a.snapshot_at)
+		)
+		SELECT b.bucket AT TIME ZONE $6,
+			COALESCE(SUM(g.likes), 0), COALESCE(SUM(g.comments), 0), COALESCE(SUM(g.shares), 0),
+			COALESCE(SUM(g.views), 0), COALESCE(SUM(g.impressions), 0)
+		FROM generate_series(
+			date_trunc($5, $3::timestamptz AT TIME ZONE $6),
+			($4::timestamptz AT TIME ZONE $6) - INTERVAL '1 microsecond',
+			('1 ' || $5)::interval
+		) AS b(bucket)
+		LEFT JOIN gains g ON g.snapshot_at >= $3 AND date_trunc($5, g.snapshot_at AT TIME ZONE $6) = b.bucket
+		GROUP BY b.bucket
+		ORDER BY b.bucket
+	`, userID, pq.Array(platforms), from, to, interval, tz, trackedSince)
+	if err != nil {
+		return nil, err
+	}
+	return scanAnalyticsPoints(rows)
+}
+
+func scanAnalyticsPoints(rows *sql.Rows) ([]AnalyticsPoint, error) {
+	defer rows.Close()
+
+	points := []AnalyticsPoint{}
+	for rows.Next() {
+		var p AnalyticsPoint
+		if err := rows.Scan(&p.At, &p.Likes, &p.Comments, &p.Shares, &p.Views, &p.Impressions); err != nil {
+			return nil, err
+		}
+		p.Engagements = p.Likes + p.Comments + p.Shares
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// PostMetricGain is what one post gained in a date range.
+type PostMetricGain struct {
+	PostID      uuid.UUID
+	Platform    string
+	Message     string
+	Status      string
+	PostedAt    time.Time
+	Likes       int
+	Comments    int
+	Shares      int
+	Views       int
+	Impressions int
+}
+
+// ListPostMetricGains returns what each of the user's posts gained in
+// [from, to): its last snapshot before to minus its last snapshot before
+// from. Posts without a snapshot in the range are left out. Only posts
+// published after trackedSince can have snapshots in the range.
+func ListPostMetricGains(db *sql.DB, userID string, platforms []string, from, to, trackedSince time.Time) ([]PostMetricGain, error) {
+	rows, err := db.Query(`
+		WITH tracked AS (
+			SELECT a.post_id, a.snapshot_at, a.likes, a.comments, a.shares, a.views, a.impressions
+			FROM post_analytics a
+			JOIN posts p ON p.id = a.post_id
+			WHERE p.user_id = $1 AND (cardinality($2::text[]) = 0 OR p.platform = ANY($2::text[]))
+				AND p.posted_at >= $5 AND p.posted_at < $4 AND a.snapshot_at < $4
+		),
+		until_to AS (
+			SELECT DISTINCT ON (post_id) * FROM tracked ORDER BY post_id, snapshot_at DESC
+		),
+		until_from AS (
+			SELECT DISTINCT ON (post_id) * FROM tracked WHERE snapshot_at < $3 ORDER BY post_id, snapshot_at DESC
+		)
+		SELECT p.id, p.platform, p.message, p.status, p.posted_at,
+			t.likes - COALESCE(f.likes, 0), t.comments - COALESCE(f.comments, 0),
+			t.shares - COALESCE(f.shares, 0), t.views - COALESCE(f.views, 0),
+			t.impressions - COALESCE(f.impressions, 0)
+		FROM until_to t
+		JOIN posts p ON p.id = t.post_id
+		LEFT JOIN until_from f ON f.post_id = t.post_id
+		WHERE t.snapshot_at >= $3
+	`, userID, pq.Array(platforms), from, to, trackedSince)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	gains := []PostMetricGain{}
+	for rows.Next() {
+		var g PostMetricGain
+		err := rows.Scan(&g.PostID, &g.Platform, &g.Message, &g.Status, &g.PostedAt,
+			&g.Likes, &g.Comments, &g.Shares, &g.Views, &g.Impressions)
+		if err != nil {
+			return nil, err
+		}
+		gains = append(gains, g)
+	}
+	return gains, rows.Err()
+}
+
+// CountPublishedPosts returns how many posts the user published on each
+// platform in [from, to), including posts deleted since.
+func CountPublishedPosts(db *sql.DB, userID string, platforms []string, from, to time.Time) (map[string]int, error) {
+	rows, err := db.Query(`
+		SELECT platform, COUNT(*)
+		FROM posts
+		WHERE user_id = $1 AND (cardinality($2::text[]) = 0 OR platform = ANY($2::text[]))
+			AND posted_at >= $3 AND posted_at < $4 AND status IN ('posted', 'deleted')
+		GROUP BY platform
+	`, userID, pq.Array(platforms), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var platform string
+		var n int
+		if err := rows.Scan(&platform, &n); err != nil {
+			return nil, err
+		}
+		counts[platform] = n
+	}
+	return counts, rows.Err()
+}
+
+// AnalyticsSnapshotRow is a snapshot together with the post it belongs to.
+type AnalyticsSnapshotRow struct {
+	PostAnalytics
+	Platform       string
+	PlatformPostID string
+	PostedAt       time.Time
+}
+
+// ListAnalyticsSnapshots returns every snapshot of the user's posts taken in
+// [from, to), oldest first.
+func ListAnalyticsSnapshots(db *sql.DB, userID string, platforms []string, from, to time.Time) ([]AnalyticsSnapshotRow, error) {
+	rows, err := db.Query(`
+		SELECT a.id, a.post_id, a.likes, a.comments, a.shares, a.views, a.impressions, a.snapshot_at, a.created_at,
+			p.platform, p.platform_post_id, p.posted_at
+		FROM post_analytics a
+		JOIN posts p ON p.id = a.post_id
+		WHERE p.user_id = $1 AND (cardinality($2::text[]) = 0 OR p.platform = ANY($2::text[]))
+			AND a.snapshot_at >= $3 AND a.snapshot_at < $4
+		ORDER BY a.snapshot_at, p.platform
+	`, userID, pq.Array(platforms), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := []AnalyticsSnapshotRow{}
+	for rows.Next() {
+		var s AnalyticsSnapshotRow
+		err := rows.Scan(&s.ID, &s.PostID, &s.Likes, &s.Comments, &s.Shares, &s.Views, &s.Impressions, &s.SnapshotAt, &s.CreatedAt,
+			&s.Platform, &s.PlatformPostID, &s.PostedAt)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, rows.Err()
+}
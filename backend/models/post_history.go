@@ -0,0 +1,57 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Actions recorded in a post's history
+const (
+	PostHistoryEdited  = "edited"
+	PostHistoryDeleted = "deleted"
+)
+
+// PostHistoryEntry is a change made to a post after it was published.
+type PostHistoryEntry struct {
+	ID              uuid.UUID `json:"id"`
+	PostID          uuid.UUID `json:"postId"`
+	UserID          uuid.UUID `json:"userId"`
+	Action          string    `json:"action"`
+	PreviousMessage string    `json:"previousMessage,omitempty"`
+	Message         string    `json:"message,omitempty"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+func SavePostHistoryEntry(db *sql.DB, entry PostHistoryEntry) error {
+	_, err := db.Exec(`
+		INSERT INTO post_history (id, post_id, user_id, action, previous_message, message, created_at)
+		VALUES ($1,$2,$3,$4,NULLIF($5, ''),NULLIF($6, ''),$7)
+	`, entry.ID, entry.PostID, entry.UserID, entry.Action, entry.PreviousMessage, entry.Message, entry.CreatedAt)
+	return err
+}
+
+// ListPostHistory returns the changes to a post, oldest first.
+func ListPostHistory(db *sql.DB, postID uuid.UUID) ([]PostHistoryEntry, error) {
+	rows, err := db.Query(`
+		SELECT id, post_id, user_id, action, COALESCE(previous_message, ''), COALESCE(message, ''), created_at
+		FROM post_history
+		WHERE post_id = $1
+		ORDER BY created_at
+	`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []PostHistoryEntry{}
+	for rows.Next() {
+		var e PostHistoryEntry
+		if err := rows.Scan(&e.ID, &e.PostID, &e.UserID, &e.Action, &e.PreviousMessage, &e.Message, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,192 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Report frequencies. Weekly reports cover Monday to Sunday and monthly
+// reports the calendar month, in the subscription's time zone.
+const (
+	ReportWeekly  = "weekly"
+	ReportMonthly = "monthly"
+)
+
+// ReportSubscription is an analytics report emailed on a schedule.
+type ReportSubscription struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"userId"`
+	Name       string     `json:"name"`
+	Frequency  string     `json:"frequency"`
+	Platforms  []string   `json:"platforms"`  // empty for all connected accounts
+	Recipients []string   `json:"recipients"` // empty for the user's own address
+	TimeZone   string     `json:"timeZone"`
+	Enabled    bool       `json:"enabled"`
+	NextSendAt time.Time  `json:"nextSendAt"`
+	LastSentAt *time.Time `json:"lastSentAt,omitempty"`
+	LastError  string     `json:"lastError,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
+
+func SaveReportSubscription(db *sql.DB, s ReportSubscription) error {
+	platforms, recipients, err := marshalReportLists(s)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		INSERT INTO report_subscriptions (id, user_id, name, frequency, platforms, recipients, time_zone, enabled, next_send_at, created_at, updated_at)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
+	`, s.ID, s.UserID, s.Name, s.Frequency, platforms, recipients, s.TimeZone, s.Enabled, s.NextSendAt, s.CreatedAt, s.UpdatedAt)
+	return err
+}
+
+// UpdateReportSubscription stores the settings of a subscription.
+func UpdateReportSubscription(db *sql.DB, s ReportSubscription) error {
+	platforms, recipients, err := marshalReportLists(s)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		UPDATE report_subscriptions
+		SET name = $1, frequency = $2, platforms = $3, recipients = $4, time_zone = $5,
+			enabled = $6, next_send_at = $7, updated_at = NOW()
+		WHERE id = $8 AND user_id = $9
+	`, s.Name, s.Frequency, platforms, recipients, s.TimeZone, s.Enabled, s.NextSendAt, s.ID, s.UserID)
+	return err
+}
+
+// MarkReportSent records a send attempt and when to send next. errMsg is
+// empty if the report was sent.
+func MarkReportSent(db *sql.DB, id uuid.UUID, sentAt, nextSendAt time.Time, errMsg string) error {
+	_, err := db.Exec(`
+		UPDATE report_subscriptions
+		SET last_sent_at = CASE WHEN $3 = '' THEN $2 ELSE last_sent_at END,
+			next_send_at = $4, last_error = NULLIF($3, ''), updated_at = NOW()
+		WHERE id = $1
+	`, id, sentAt, errMsg, nextSendAt)
+	return err
+}
+
+// ClaimManualReportSend records an on-demand send of the user's subscription
+// unless one happened within the last interval. It reports whether the send
+// may go ahead and, if not, when the last one was.
+func ClaimManualReportSend(db *sql.DB, userID, id string, interval time.Duration) (bool, time.Time, error) {
+	var sentAt time.Time
+	err := db.QueryRow(`
+		UPDATE report_subscriptions SET manual_sent_at = NOW()
+		WHERE id = $1 AND user_id = $2
+			AND (manual_sent_at IS NULL OR manual_sent_at <= NOW() - $3 * INTERVAL '1 second')
+		RETURNING manual_sent_at
+	`, id, userID, interval.Seconds()).Scan(&sentAt)
+	if err == nil {
+		return true, sentAt, nil
+	}
+	if err != sql.ErrNoRows {
+		return false, time.Time{}, err
+	}
+	err = db.QueryRow(`
+		SELECT manual_sent_at FROM report_subscriptions WHERE id = $1 AND user_id = $2
+	`, id, userID).Scan(&sentAt)
+	return false, sentAt, err
+}
+
+// CountReportSubscriptions returns how many subscriptions the user has.
+func CountReportSubscriptions(db *sql.DB, userID string) (int, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM report_subscriptions WHERE user_id = $1`, userID).Scan(&n)
+	return n, err
+}
+
+// DeleteReportSubscription deletes the user's subscription, returning
+// sql.ErrNoRows if there is none with that ID.
+func DeleteReportSubscription(db *sql.DB, userID, id string) error {
+	res, err := db.Exec(`DELETE FROM report_subscriptions WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return err
+}
+
+// GetReportSubscription returns the subscription if it belongs to the user.
+func GetReportSubscription(db *sql.DB, userID, id string) (*ReportSubscription, error) {
+	return scanReportSubscription(db.QueryRow(reportSubscriptionSelect+` WHERE id = $1 AND user_id = $2`, id, userID))
+}
+
+// ListReportSubscriptions returns the user's subscriptions, oldest first.
+func ListReportSubscriptions(db *sql.DB, userID string) ([]ReportSubscription, error) {
+	return queryReportSubscriptions(db, reportSubscriptionSelect+`
+		WHERE user_id = $1
+		ORDER BY created_at
+	`, userID)
+}
+
+// ListDueReportSubscriptions returns the enabled subscriptions whose next
+// report is due.
+func ListDueReportSubscriptions(db *sql.DB, now time.Time) ([]ReportSubscription, error) {
+	return queryReportSubscriptions(db, reportSubscriptionSelect+`
+		WHERE enabled AND next_send_at <= $1
+		ORDER BY next_send_at
+	`, now)
+}
+
+const reportSubscriptionSelect = `
+	SELECT id, user_id, name, frequency, platforms, recipients, time_zone, enabled,
+		next_send_at, last_sent_at, COALESCE(last_error, ''), created_at, updated_at
+	FROM report_subscriptions`
+
+func queryReportSubscriptions(db *sql.DB, query string, args ...interface{}) ([]ReportSubscription, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []ReportSubscription{}
+	for rows.Next() {
+		s, err := scanReportSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, *s)
+	}
+	return subscriptions, rows.Err()
+}
+
+func scanReportSubscription(row rowScanner) (*ReportSubscription, error) {
+	var s ReportSubscription
+	var platforms, recipients []byte
+	err := row.Scan(&s.ID, &s.UserID, &s.Name, &s.Frequency, &platforms, &recipients, &s.TimeZone, &s.Enabled,
+		&s.NextSendAt, &s.LastSentAt, &s.LastError, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(platforms, &s.Platforms); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(recipients, &s.Recipients); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func marshalReportLists(s ReportSubscription) ([]byte, []byte, error) {
+	if s.Platforms == nil {
+		s.Platforms = []string{}
+	}
+	if s.Recipients == nil {
+		s.Recipients = []string{}
+	}
+	platforms, err := json.Marshal(s.Platforms)
+	if err != nil {
+		return nil, nil, err
+	}
+	recipients, err := json.Marshal(s.Recipients)
+	return platforms, recipients, err
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// YouTube upload statuses. Uploads that are queued or uploading are picked up
+// again when the server restarts.
+const (
+	YouTubeUploadQueued    = "queued"
+	YouTubeUploadUploading = "uploading"
+	YouTubeUploadUploaded  = "uploaded"
+	YouTubeUploadFailed    = "failed"
+)
+
+// YouTubeUploadOptions are the steps that follow the upload itself.
+type YouTubeUploadOptions struct {
+	ThumbnailURL      string   `json:"thumbnailUrl,omitempty"`
+	PlaylistIDs       []string `json:"playlistIds,omitempty"`
+	NotifySubscribers *bool    `json:"notifySubscribers,omitempty"` // YouTube's default is true
+	Short             bool     `json:"short,omitempty"`             // vertical or square and short enough for Shorts
+}
+
+// YouTubeUpload is a video being sent to YouTube in chunks from the media
+// store. SessionURI is the resumable upload session, kept so an interrupted
+// upload continues from BytesUploaded instead of starting over.
+type YouTubeUpload struct {
+	ID            uuid.UUID            `json:"id"`
+	UserID        uuid.UUID            `json:"userId"`
+	SourceURL     string               `json:"sourceUrl"`
+	Size          int64                `json:"size"`
+	ContentType   string               `json:"contentType,omitempty"`
+	Metadata      json.RawMessage      `json:"metadata"` // the videos.insert resource
+	Options       YouTubeUploadOptions `json:"options"`
+	SessionURI    string               `json:"-"`
+	BytesUploaded int64                `json:"bytesUploaded"`
+	Status        string               `json:"status"`
+	VideoID       string               `json:"videoId,omitempty"`
+	Error         string               `json:"error,omitempty"`
+	CreatedAt     time.Time            `json:"createdAt"`
+	UpdatedAt     time.Time            `json:"updatedAt"`
+}
+
+// Done reports whether the upload has reached a final status.
+func (u YouTubeUpload) Done() bool {
+	return u.Status == YouTubeUploadUploaded || u.Status == YouTubeUploadFailed
+}
+
+func SaveYouTubeUpload(db *sql.DB, upload YouTubeUpload) error {
+	options, err := json.Marshal(upload.Options)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		INSERT INTO youtube_uploads (id, user_id, source_url, size, content_type, metadata, options, status, created_at, updated_at)
+		VALUES ($1,$2,$3,$4,NULLIF($5, ''),$6,$7,$8,$9,$10)
+	`, upload.ID, upload.UserID, upload.SourceURL, upload.Size, upload.ContentType, []byte(upload.Metadata),
+		options, upload.Status, upload.CreatedAt, upload.UpdatedAt)
+	return err
+}
+
+// UpdateYouTubeUpload stores the progress of an upload.
+func UpdateYouTubeUpload(db *sql.DB, upload YouTubeUpload) error {
+	_, err := db.Exec(`
+		UPDATE youtube_uploads
+		SET size = $1, content_type = NULLIF($2, ''), session_uri = NULLIF($3, ''),
+			bytes_uploaded = $4, status = $5, video_id = NULLIF($6, ''),
+			error = NULLIF($7, ''), updated_at = NOW()
+		WHERE id = $8
+	`, upload.Size, upload.ContentType, upload.SessionURI, upload.BytesUploaded, upload.Status,
+		upload.VideoID, upload.Error, upload.ID)
+	return err
+}
+
+// GetYouTubeUpload returns the upload with the given ID if it belongs to the user.
+func GetYouTubeUpload(db *sql.DB, userID, uploadID string) (*YouTubeUpload, error) {
+	return scanYouTubeUpload(db.QueryRow(youtubeUploadSelect+` WHERE id = $1 AND user_id = $2`, uploadID, userID))
+}
+
+// GetYouTubeUploadByID returns an upload regardless of its owner, for the worker.
+func GetYouTubeUploadByID(db *sql.DB, uploadID uuid.UUID) (*YouTubeUpload, error) {
+	return scanYouTubeUpload(db.QueryRow(youtubeUploadSelect+` WHERE id = $1`, uploadID))
+}
+
+// ListUnfinishedYouTubeUploadIDs returns the uploads that were interrupted
+// before reaching a final status.
+func ListUnfinishedYouTubeUploadIDs(db *sql.DB) ([]uuid.UUID, error) {
+	rows, err := db.Query(`
+		SELECT id FROM youtube_uploads
+		WHERE status NOT IN ($1, $2)
+		ORDER BY created_at
+	`, YouTubeUploadUploaded, YouTubeUploadFailed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+const youtubeUploadSelect = `
+	SELECT id, user_id, source_url, size, COALESCE(content_type, ''), metadata, options,
+		COALESCE(session_uri, ''), bytes_uploaded, status, COALESCE(video_id, ''),
+		COALESCE(error, ''), created_at, updated_at
+	FROM youtube_uploads`
+
+func scanYouTubeUpload(row *sql.Row) (*YouTubeUpload, error) {
+	var upload YouTubeUpload
+	var metadata, options []byte
+	err := row.Scan(
+		&upload.ID, &upload.UserID, &upload.SourceURL, &upload.Size, &upload.ContentType, &metadata, &options,
+		&upload.SessionURI, &upload.BytesUploaded, &upload.Status, &upload.VideoID,
+		&upload.Error, &upload.CreatedAt, &upload.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	upload.Metadata = metadata
+	if err := json.Unmarshal(options, &upload.Options); err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
@@ -0,0 +1,48 @@
+package routes
+
+import (
+	"social-sync-backend/controllers"
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+func RegisterAnalyticsRoutes(r *mux.Router) {
+	// Totals, per-platform breakdown and top posts over a date range
+	r.Handle("/api/analytics/summary",
+		middleware.JWTMiddleware(controllers.GetAnalyticsSummaryHandler(lib.DB)),
+	).Methods("GET")
+
+	// Metrics gained per day, week or month
+	r.Handle("/api/analytics/timeseries",
+		middleware.JWTMiddleware(controllers.GetAnalyticsTimeSeriesHandler(lib.DB)),
+	).Methods("GET")
+
+	// Follower counts of the connected accounts
+	r.Handle("/api/analytics/growth",
+		middleware.JWTMiddleware(controllers.GetAccountGrowthHandler(lib.DB)),
+	).Methods("GET")
+
+	// Scheduled reports by email
+	r.Handle("/api/analytics/reports",
+		middleware.JWTMiddleware(controllers.ListReportSubscriptionsHandler(lib.DB)),
+	).Methods("GET")
+	r.Handle("/api/analytics/reports",
+		middleware.JWTMiddleware(controllers.CreateReportSubscriptionHandler(lib.DB)),
+	).Methods("POST")
+	r.Handle("/api/analytics/reports/{id}",
+		middleware.JWTMiddleware(controllers.UpdateReportSubscriptionHandler(lib.DB)),
+	).Methods("PATCH")
+	r.Handle("/api/analytics/reports/{id}",
+		middleware.JWTMiddleware(controllers.DeleteReportSubscriptionHandler(lib.DB)),
+	).Methods("DELETE")
+	r.Handle("/api/analytics/reports/{id}/send",
+		middleware.JWTMiddleware(controllers.SendReportNowHandler(lib.DB)),
+	).Methods("POST")
+
+	// Snapshots of one post
+	r.Handle("/api/analytics/posts/{id}",
+		middleware.JWTMiddleware(controllers.GetPostAnalyticsHandler(lib.DB)),
+	).Methods("GET")
+}
@@ -29,6 +29,12 @@ func AuthRoutes(r *mux.Router) {
 	r.Handle("/api/facebook/post", middleware.JWTMiddleware(
 		http.HandlerFunc(controllers.PostToFacebookHandler(lib.DB)),
 	)).Methods("POST")
+	r.Handle("/api/facebook/scheduled", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetFacebookScheduledPostsHandler(lib.DB)),
+	)).Methods("GET")
+	r.Handle("/api/facebook/scheduled/{postId}", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.CancelFacebookScheduledPostHandler(lib.DB)),
+	)).Methods("DELETE")
 
 	// ----------- Instagram Oauth ----------- //
 	r.Handle("/connect/instagram", middleware.JWTMiddleware(
@@ -37,6 +43,12 @@ func AuthRoutes(r *mux.Router) {
 	r.Handle("/api/instagram/post", middleware.JWTMiddleware(
 		http.HandlerFunc(controllers.PostToInstagramHandler(lib.DB)),
 	)).Methods("POST")
+	r.Handle("/api/instagram/jobs/{jobId}", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetInstagramJobHandler(lib.DB)),
+	)).Methods("GET")
+	r.Handle("/api/instagram/jobs/{jobId}/events", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.InstagramJobEventsHandler(lib.DB)),
+	)).Methods("GET")
 
 	// ----------- YouTube Oauth ----------- //
 	r.Handle("/auth/youtube/login", middleware.EnableCORS(middleware.JWTMiddleware(
@@ -46,6 +58,15 @@ func AuthRoutes(r *mux.Router) {
 	r.Handle("/api/youtube/post", middleware.JWTMiddleware(
 		http.HandlerFunc(controllers.PostToYouTubeHandler(lib.DB)),
 	)).Methods("POST")
+	r.Handle("/api/youtube/uploads/{uploadId}", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetYouTubeUploadHandler(lib.DB)),
+	)).Methods("GET")
+	r.Handle("/api/youtube/uploads/{uploadId}/resume", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.ResumeYouTubeUploadHandler(lib.DB)),
+	)).Methods("POST")
+	r.Handle("/api/youtube/playlists", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.ListYouTubePlaylistsHandler(lib.DB)),
+	)).Methods("GET")
 
 	// ----------- Twitter Oauth (X) ----------- //
 	r.Handle("/auth/twitter/login", middleware.EnableCORS(middleware.JWTMiddleware(
@@ -56,10 +77,74 @@ func AuthRoutes(r *mux.Router) {
 		http.HandlerFunc(controllers.PostToTwitterHandler(lib.DB)),
 	)).Methods("POST")
 
+	// ----------- LinkedIn OAuth ----------- //
+	r.Handle("/auth/linkedin/login", middleware.EnableCORS(middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.LinkedInRedirectHandler()),
+	))).Methods("GET")
+	r.HandleFunc("/auth/linkedin/callback", controllers.LinkedInCallbackHandler(lib.DB)).Methods("GET")
+	r.Handle("/api/linkedin/organizations", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetLinkedInOrganizationsHandler(lib.DB)),
+	)).Methods("GET")
+	r.Handle("/api/linkedin/post", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.PostToLinkedInHandler(lib.DB)),
+	)).Methods("POST")
+
+	// ----------- Threads OAuth ----------- //
+	r.Handle("/auth/threads/login", middleware.EnableCORS(middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.ThreadsRedirectHandler()),
+	))).Methods("GET")
+	r.HandleFunc("/auth/threads/callback", controllers.ThreadsCallbackHandler(lib.DB)).Methods("GET")
+	r.Handle("/api/threads/post", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.PostToThreadsHandler(lib.DB)),
+	)).Methods("POST")
+
 	// ----------- TikTok Upload ----------- //
-	// r.Handle("/api/tiktok/post", middleware.JWTMiddleware(
-	// 	http.HandlerFunc(controllers.PostToTikTokHandler(lib.DB)),
-	// )).Methods("POST")
+	r.Handle("/auth/tiktok/login", middleware.EnableCORS(middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.TikTokRedirectHandler()),
+	))).Methods("GET")
+	r.HandleFunc("/auth/tiktok/callback", controllers.TikTokCallbackHandler(lib.DB)).Methods("GET")
+	r.Handle("/api/tiktok/creator-info", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetTikTokCreatorInfoHandler(lib.DB)),
+	)).Methods("GET")
+	r.Handle("/api/tiktok/post", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.PostToTikTokHandler(lib.DB)),
+	)).Methods("POST")
+	r.Handle("/api/tiktok/post/{publishId}/status", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetTikTokPostStatusHandler(lib.DB)),
+	)).Methods("GET")
+
+	// ----------- Pinterest OAuth ----------- //
+	r.Handle("/auth/pinterest/login", middleware.EnableCORS(middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.PinterestRedirectHandler()),
+	))).Methods("GET")
+	r.HandleFunc("/auth/pinterest/callback", controllers.PinterestCallbackHandler(lib.DB)).Methods("GET")
+	r.Handle("/api/pinterest/boards", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetPinterestBoardsHandler(lib.DB)),
+	)).Methods("GET")
+	r.Handle("/api/pinterest/boards", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.CreatePinterestBoardHandler(lib.DB)),
+	)).Methods("POST")
+	r.Handle("/api/pinterest/post", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.PostToPinterestHandler(lib.DB)),
+	)).Methods("POST")
+	r.Handle("/api/pinterest/media/{mediaId}/status", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetPinterestMediaStatusHandler(lib.DB)),
+	)).Methods("GET")
+
+	// ----------- Reddit OAuth ----------- //
+	r.Handle("/auth/reddit/login", middleware.EnableCORS(middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.RedditRedirectHandler()),
+	))).Methods("GET")
+	r.HandleFunc("/auth/reddit/callback", controllers.RedditCallbackHandler(lib.DB)).Methods("GET")
+	r.Handle("/api/reddit/subreddits", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetRedditSubredditsHandler(lib.DB)),
+	)).Methods("GET")
+	r.Handle("/api/reddit/subreddits/{subreddit}/flairs", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetRedditFlairsHandler(lib.DB)),
+	)).Methods("GET")
+	r.Handle("/api/reddit/post", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.PostToRedditHandler(lib.DB)),
+	)).Methods("POST")
 
 	// ----------- Mastodon OAuth ----------- //
 	r.Handle("/auth/mastodon/login", middleware.EnableCORS(middleware.JWTMiddleware(
@@ -74,11 +159,41 @@ func AuthRoutes(r *mux.Router) {
 	r.Handle("/connect/telegram", middleware.JWTMiddleware(
 		http.HandlerFunc(controllers.ConnectTelegram),
 	)).Methods("POST")
+	r.Handle("/connect/telegram/status", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetTelegramConnectStatus),
+	)).Methods("GET")
+	r.Handle("/connect/telegram/bot", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.GetTelegramBot),
+	)).Methods("GET")
+	r.Handle("/connect/telegram/bot", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.RegisterTelegramBot),
+	)).Methods("PUT")
+	r.Handle("/connect/telegram/bot", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.DeleteTelegramBot),
+	)).Methods("DELETE")
+	r.HandleFunc("/webhooks/telegram", controllers.TelegramWebhookHandler(lib.DB)).Methods("POST")
+	r.HandleFunc("/webhooks/telegram/{botId:[0-9]+}", controllers.TelegramWebhookHandler(lib.DB)).Methods("POST")
 
 	r.Handle("/api/telegram/post", middleware.JWTMiddleware(
 		http.HandlerFunc(controllers.PostToTelegram),
 	)).Methods("POST")
 
+	// ----------- Bluesky Connect ----------- //
+	r.Handle("/connect/bluesky", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.ConnectBlueskyHandler(lib.DB)),
+	)).Methods("POST")
+	r.Handle("/api/bluesky/post", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.PostToBlueskyHandler(lib.DB)),
+	)).Methods("POST")
+
+	// ----------- Discord / Slack Webhooks ----------- //
+	r.Handle("/connect/{platform:discord|slack}", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.ConnectWebhookHandler(lib.DB)),
+	)).Methods("POST")
+	r.Handle("/api/{platform:discord|slack}/post", middleware.JWTMiddleware(
+		http.HandlerFunc(controllers.PostToWebhookHandler(lib.DB)),
+	)).Methods("POST")
+
 	// ----------- Social Account Management ----------- //
 	r.Handle("/api/social-accounts", middleware.EnableCORS(middleware.JWTMiddleware(
 		http.HandlerFunc(controllers.GetSocialAccountsHandler(lib.DB)),
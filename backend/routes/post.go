@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"net/http"
+	"social-sync-backend/controllers"
+	"social-sync-backend/lib"
+	"social-sync-backend/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+func RegisterPostRoutes(r *mux.Router) {
+	// Live character counts for the composer
+	r.Handle("/api/posts/validate",
+		middleware.JWTMiddleware(http.HandlerFunc(controllers.ValidatePostHandler)),
+	).Methods("POST", "OPTIONS")
+
+	// Retract or correct published posts on their platform
+	r.Handle("/api/posts/{id}",
+		middleware.JWTMiddleware(http.HandlerFunc(controllers.DeletePostHandler(lib.DB))),
+	).Methods("DELETE")
+	r.Handle("/api/posts/{id}",
+		middleware.JWTMiddleware(http.HandlerFunc(controllers.EditPostHandler(lib.DB))),
+	).Methods("PATCH")
+	r.Handle("/api/posts/{id}/history",
+		middleware.JWTMiddleware(http.HandlerFunc(controllers.GetPostHistoryHandler(lib.DB))),
+	).Methods("GET")
+}
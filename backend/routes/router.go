@@ -16,7 +16,8 @@ func InitRoutes() *mux.Router {
 
 	AuthRoutes(r)
 	RegisterUserRoutes(r)
-	// Add more like RegisterPostRoutes(r), etc.
+	RegisterPostRoutes(r)
+	RegisterAnalyticsRoutes(r)
 
 	return r
 }
@@ -4,8 +4,8 @@ import (
 	"net/http"
 	"social-sync-backend/controllers"
 	"social-sync-backend/middleware"
-	// "social-sync-backend/lib"
-	
+	"social-sync-backend/lib"
+
 	"github.com/gorilla/mux"
 )
 
@@ -35,6 +35,14 @@ func RegisterUserRoutes(r *mux.Router) {
 
 	r.Handle("/api/upload", middleware.EnableCORS(middleware.JWTMiddleware(http.HandlerFunc(controllers.UploadImageHandler)))).Methods("POST", "OPTIONS")
 
+	// Media library
+	r.Handle("/api/media",
+		middleware.JWTMiddleware(controllers.ListMediaAssetsHandler(lib.DB)),
+	).Methods("GET")
+	r.Handle("/api/media/{id}",
+		middleware.JWTMiddleware(controllers.UpdateMediaAssetHandler(lib.DB)),
+	).Methods("PATCH")
+
 	// r.HandleFunc("/api/facebook/analytics", controllers.GetFacebookPostAnalyticsHandler(lib.DB)).Methods("GET")
 
 
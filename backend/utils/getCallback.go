@@ -43,6 +43,36 @@ func GetCallbackURL(provider string) string {
 			return os.Getenv("MASTODON_CALLBACK_PROD")
 		}
 		return os.Getenv("MASTODON_CALLBACK_LOCAL")
+
+	case "linkedin":
+		if env == "production" {
+			return os.Getenv("LINKEDIN_CALLBACK_PROD")
+		}
+		return os.Getenv("LINKEDIN_CALLBACK_LOCAL")
+
+	case "threads":
+		if env == "production" {
+			return os.Getenv("THREADS_CALLBACK_PROD")
+		}
+		return os.Getenv("THREADS_CALLBACK_LOCAL")
+
+	case "tiktok":
+		if env == "production" {
+			return os.Getenv("TIKTOK_CALLBACK_PROD")
+		}
+		return os.Getenv("TIKTOK_CALLBACK_LOCAL")
+
+	case "pinterest":
+		if env == "production" {
+			return os.Getenv("PINTEREST_CALLBACK_PROD")
+		}
+		return os.Getenv("PINTEREST_CALLBACK_LOCAL")
+
+	case "reddit":
+		if env == "production" {
+			return os.Getenv("REDDIT_CALLBACK_PROD")
+		}
+		return os.Getenv("REDDIT_CALLBACK_LOCAL")
 	}
 
 	return ""
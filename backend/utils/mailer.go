@@ -1,32 +1,169 @@
 package utils
 
 import (
+	"bytes"
+	"encoding/base64"
 	"fmt"
+	"io"
 	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
 	"net/smtp"
+	"net/textproto"
 	"os"
+	"strings"
+	"time"
 )
 
+// Email is a message with a plain-text body and, optionally, an HTML
+// alternative and attachments.
+type Email struct {
+	To          []string
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []EmailAttachment
+}
 
-func SendVerificationEmail(toEmail, token string) error {
+type EmailAttachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// SendEmail sends the email through the SMTP server in the environment.
+func SendEmail(email Email) error {
 	smtpHost := os.Getenv("SMTP_HOST")
 	smtpPort := os.Getenv("SMTP_PORT")
 	smtpUser := os.Getenv("SMTP_USERNAME")
 	smtpPass := os.Getenv("SMTP_PASSWORD")
 	sender := os.Getenv("EMAIL_SENDER")
 
+	msg, err := buildEmail(sender, email)
+	if err != nil {
+		return err
+	}
+
 	auth := smtp.PlainAuth("", smtpUser, smtpPass, smtpHost)
+	err = smtp.SendMail(smtpHost+":"+smtpPort, auth, sender, email.To, msg)
+	if err != nil {
+		log.Printf("Error sending email to %s: %v", strings.Join(email.To, ", "), err)
+		return err
+	}
+	return nil
+}
 
-	subject := "Subject: SocialSync Email Verification Code\r\n"
-	from := fmt.Sprintf("From: SocialSync <%s>\r\n", sender)
-	body := fmt.Sprintf("Your verification code is: %s\r\n\r\nIf you did not request this, please ignore.\r\n", token)
-	msg := []byte(from + subject + "\r\n" + body)
+// buildEmail renders the MIME message: the text on its own, or a
+// multipart/alternative of text and HTML, wrapped in multipart/mixed when
+// there are attachments.
+func buildEmail(sender string, email Email) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s <%s>\r\n", mime.QEncoding.Encode("utf-8", "SocialSync"), sender)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(email.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
 
+	// The body: the text, or the text and HTML as alternatives
+	bodyHeader := textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	}
+	var body bytes.Buffer
+	if email.HTML == "" {
+		if err := writeQuotedPrintable(&body, email.Text); err != nil {
+			return nil, err
+		}
+	} else {
+		alternative := multipart.NewWriter(&body)
+		if err := writeTextPart(alternative, "text/plain", email.Text); err != nil {
+			return nil, err
+		}
+		if err := writeTextPart(alternative, "text/html", email.HTML); err != nil {
+			return nil, err
+		}
+		if err := alternative.Close(); err != nil {
+			return nil, err
+		}
+		bodyHeader = textproto.MIMEHeader{
+			"Content-Type": {"multipart/alternative; boundary=" + alternative.Boundary()},
+		}
+	}
+
+	if len(email.Attachments) == 0 {
+		for key, values := range bodyHeader {
+			fmt.Fprintf(&buf, "%s: %s\r\n", key, values[0])
+		}
+		buf.WriteString("\r\n")
+		buf.Write(body.Bytes())
+		return buf.Bytes(), nil
+	}
 
-	err := smtp.SendMail(smtpHost+":"+smtpPort, auth, sender, []string{toEmail}, msg)
+	mixed := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mixed.Boundary())
+	part, err := mixed.CreatePart(bodyHeader)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(body.Bytes()); err != nil {
+		return nil, err
+	}
+	for _, a := range email.Attachments {
+		part, err := mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(a.ContentType, map[string]string{"name": a.Filename})},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64(part, a.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeTextPart(w *multipart.Writer, contentType, text string) error {
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
 	if err != nil {
-		log.Printf("Error sending email to %s: %v", toEmail, err)
 		return err
 	}
-	return nil
+	return writeQuotedPrintable(part, text)
+}
+
+func writeQuotedPrintable(w io.Writer, text string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(text)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// writeBase64 writes data in lines of 76 characters, as RFC 2045 requires.
+func writeBase64(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := fmt.Fprintf(w, "%s\r\n", encoded[:76]); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err := fmt.Fprintf(w, "%s\r\n", encoded)
+	return err
+}
+
+func SendVerificationEmail(toEmail, token string) error {
+	return SendEmail(Email{
+		To:      []string{toEmail},
+		Subject: "SocialSync Email Verification Code",
+		Text:    fmt.Sprintf("Your verification code is: %s\r\n\r\nIf you did not request this, please ignore.\r\n", token),
+	})
 }
@@ -0,0 +1,484 @@
+package utils
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Inline delimiters understood by TelegramHTML, longest first so "**" wins
+// over "*".
+var telegramInlineTags = []struct {
+	delim string
+	tag   string
+}{
+	{"**", "b"},
+	{"__", "u"},
+	{"~~", "s"},
+	{"||", "tg-spoiler"},
+	{"*", "i"},
+	{"_", "i"},
+}
+
+var (
+	htmlTagPattern      = regexp.MustCompile(`<[^>]*>`)
+	telegramLinkSchemes = []string{"http://", "https://", "tg://", "mailto:"}
+)
+
+// TelegramHTML renders Markdown as the HTML subset accepted by Telegram's
+// parse_mode "HTML", escaping everything else. Supported: **bold**, *italic*
+// or _italic_, __underline__, ~~strike~~, ||spoiler||, `code`, fenced code
+// blocks, [links](https://...) and "> " quotes. A backslash escapes the next
+// punctuation character. Underscores inside words (snake_case) stay literal.
+func TelegramHTML(markdown string) string {
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+	var out []string
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if fence := strings.TrimSpace(line); strings.HasPrefix(fence, "```") {
+			lang := strings.TrimSpace(strings.TrimPrefix(fence, "```"))
+			var code []string
+			j := i + 1
+			for j < len(lines) && strings.TrimSpace(lines[j]) != "```" {
+				code = append(code, lines[j])
+				j++
+			}
+			if j < len(lines) {
+				body := html.EscapeString(strings.Join(code, "\n"))
+				if lang != "" && !strings.ContainsAny(lang, " \"<>&") {
+					out = append(out, `<pre><code class="language-`+lang+`">`+body+`</code></pre>`)
+				} else {
+					out = append(out, "<pre>"+body+"</pre>")
+				}
+				i = j
+				continue
+			}
+			// Unclosed fence: treat as text
+		}
+
+		if isQuoteLine(line) {
+			var quote []string
+			for i < len(lines) && isQuoteLine(lines[i]) {
+				quote = append(quote, telegramInline(strings.TrimPrefix(strings.TrimPrefix(lines[i], ">"), " ")))
+				i++
+			}
+			i--
+			out = append(out, "<blockquote>"+strings.Join(quote, "\n")+"</blockquote>")
+			continue
+		}
+
+		out = append(out, telegramInline(line))
+	}
+	return strings.Join(out, "\n")
+}
+
+// TelegramTextLength is the length Telegram checks against its text and
+// caption limits: the visible text after formatting, in UTF-16 code units.
+func TelegramTextLength(markdown string) int {
+	visible := html.UnescapeString(htmlTagPattern.ReplaceAllString(TelegramHTML(markdown), ""))
+	n := 0
+	for _, r := range visible {
+		if r > 0xFFFF {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+func isQuoteLine(line string) bool {
+	return strings.HasPrefix(line, ">")
+}
+
+func telegramInline(text string) string {
+	runes := []rune(text)
+	var b strings.Builder
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		if r == '\\' && i+1 < len(runes) && (unicode.IsPunct(runes[i+1]) || unicode.IsSymbol(runes[i+1])) {
+			b.WriteString(html.EscapeString(string(runes[i+1])))
+			i += 2
+			continue
+		}
+
+		if r == '`' {
+			if end := indexRune(runes, '`', i+1); end > i+1 {
+				b.WriteString("<code>" + html.EscapeString(string(runes[i+1:end])) + "</code>")
+				i = end + 1
+				continue
+			}
+		}
+
+		if r == '[' {
+			if label, href, next, ok := parseMarkdownLink(runes, i); ok {
+				b.WriteString(`<a href="` + html.EscapeString(href) + `">` + telegramInline(label) + "</a>")
+				i = next
+				continue
+			}
+		}
+
+		if tag, inner, next, ok := matchInlineTag(runes, i); ok {
+			b.WriteString("<" + tag + ">" + telegramInline(inner) + "</" + tag + ">")
+			i = next
+			continue
+		}
+
+		b.WriteString(html.EscapeString(string(r)))
+		i++
+	}
+	return b.String()
+}
+
+// matchInlineTag checks for an emphasis-style span opening at i.
+func matchInlineTag(runes []rune, i int) (tag, inner string, next int, ok bool) {
+	for _, t := range telegramInlineTags {
+		d := []rune(t.delim)
+		if !hasRunesAt(runes, i, d) {
+			continue
+		}
+		start := i + len(d)
+		// The opening delimiter must touch the text it formats
+		if start >= len(runes) || unicode.IsSpace(runes[start]) {
+			continue
+		}
+		if t.delim == "_" && i > 0 && isWordRune(runes[i-1]) {
+			continue
+		}
+		for j := start + 1; j+len(d) <= len(runes); j++ {
+			if !hasRunesAt(runes, j, d) || unicode.IsSpace(runes[j-1]) {
+				continue
+			}
+			// "**" closes bold, not an italic span that happens to end there
+			if len(d) == 1 && j+1 < len(runes) && runes[j+1] == d[0] {
+				j++
+				continue
+			}
+			if t.delim == "_" && j+1 < len(runes) && isWordRune(runes[j+1]) {
+				continue
+			}
+			return t.tag, string(runes[start:j]), j + len(d), true
+		}
+	}
+	return "", "", 0, false
+}
+
+// parseMarkdownLink parses [label](href) at i. Only link schemes Telegram
+// accepts are turned into links.
+func parseMarkdownLink(runes []rune, i int) (label, href string, next int, ok bool) {
+	closeLabel := indexRune(runes, ']', i+1)
+	if closeLabel < 0 || closeLabel+1 >= len(runes) || runes[closeLabel+1] != '(' {
+		return "", "", 0, false
+	}
+	closeHref := indexRune(runes, ')', closeLabel+2)
+	if closeHref < 0 {
+		return "", "", 0, false
+	}
+	href = strings.TrimSpace(string(runes[closeLabel+2 : closeHref]))
+	for _, scheme := range telegramLinkSchemes {
+		if strings.HasPrefix(strings.ToLower(href), scheme) {
+			return string(runes[i+1 : closeLabel]), href, closeHref + 1, true
+		}
+	}
+	return "", "", 0, false
+}
+
+func indexRune(runes []rune, r rune, from int) int {
+	for j := from; j < len(runes); j++ {
+		if runes[j] == r {
+			return j
+		}
+	}
+	return -1
+}
+
+func hasRunesAt(runes []rune, i int, want []rune) bool {
+	if i+len(want) > len(runes) {
+		return false
+	}
+	for k, r := range want {
+		if runes[i+k] != r {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// SplitTelegramMarkdown splits Markdown into messages whose rendered text fits
+// within limit, as measured by TelegramTextLength. Breaks fall between lines
+// where possible, then between words. Code blocks, inline spans and links are
+// never cut open: one too long for a message of its own is split into several
+// complete ones.
+func SplitTelegramMarkdown(markdown string, limit int) []string {
+	markdown = strings.TrimSpace(strings.ReplaceAll(markdown, "\r\n", "\n"))
+	if markdown == "" || limit <= 0 {
+		return nil
+	}
+	if TelegramTextLength(markdown) <= limit {
+		return []string{markdown}
+	}
+
+	var out []string
+	cur := ""
+	flush := func() {
+		if s := strings.Trim(cur, "\n"); strings.TrimSpace(s) != "" {
+			out = append(out, s)
+		}
+		cur = ""
+	}
+
+	for _, block := range telegramBlocks(markdown) {
+		candidate := block
+		if cur != "" {
+			candidate = cur + "\n" + block
+		}
+		if TelegramTextLength(candidate) <= limit {
+			cur = candidate
+			continue
+		}
+		flush()
+		if TelegramTextLength(block) <= limit {
+			cur = block
+			continue
+		}
+
+		var pieces []string
+		if isClosedFence(block) {
+			pieces = splitTelegramFence(block, limit)
+		} else {
+			pieces = splitTelegramLine(block, limit)
+		}
+		if len(pieces) == 0 {
+			continue
+		}
+		out = append(out, pieces[:len(pieces)-1]...)
+		cur = pieces[len(pieces)-1]
+	}
+	flush()
+	return out
+}
+
+// telegramBlocks splits Markdown into lines, keeping each closed code fence
+// together as one block.
+func telegramBlocks(markdown string) []string {
+	lines := strings.Split(markdown, "\n")
+	var blocks []string
+	for i := 0; i < len(lines); i++ {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), "```") {
+			j := i + 1
+			for j < len(lines) && strings.TrimSpace(lines[j]) != "```" {
+				j++
+			}
+			if j < len(lines) {
+				blocks = append(blocks, strings.Join(lines[i:j+1], "\n"))
+				i = j
+				continue
+			}
+		}
+		blocks = append(blocks, lines[i])
+	}
+	return blocks
+}
+
+func isClosedFence(block string) bool {
+	return strings.Contains(block, "\n") && strings.HasPrefix(strings.TrimSpace(block), "```")
+}
+
+// splitTelegramFence splits a code block into several, each reopened with the
+// original fence line so they keep their language.
+func splitTelegramFence(block string, limit int) []string {
+	lines := strings.Split(block, "\n")
+	open, code := lines[0], lines[1:len(lines)-1]
+	wrap := func(body string) string { return open + "\n" + body + "\n```" }
+	length := func(body string) int { return TelegramTextLength(wrap(body)) }
+
+	var out []string
+	cur := ""
+	started := false
+	for _, line := range code {
+		candidate := line
+		if started {
+			candidate = cur + "\n" + line
+		}
+		if length(candidate) <= limit {
+			cur, started = candidate, true
+			continue
+		}
+		if started {
+			out = append(out, wrap(cur))
+		}
+		cur, started = line, true
+		if length(line) > limit {
+			pieces := cutRunes(line, limit, length)
+			for _, p := range pieces[:len(pieces)-1] {
+				out = append(out, wrap(p))
+			}
+			cur = pieces[len(pieces)-1]
+		}
+	}
+	if started {
+		out = append(out, wrap(cur))
+	}
+	return out
+}
+
+// splitTelegramLine splits a line between words. A continued quote line keeps
+// its "> " marker.
+func splitTelegramLine(line string, limit int) []string {
+	prefix, body := "", line
+	if isQuoteLine(line) {
+		prefix = "> "
+		body = strings.TrimPrefix(strings.TrimPrefix(line, ">"), " ")
+	}
+	length := func(s string) int { return TelegramTextLength(prefix + s) }
+
+	var out []string
+	cur := ""
+	flush := func() {
+		if s := strings.TrimSpace(cur); s != "" {
+			out = append(out, prefix+s)
+		}
+		cur = ""
+	}
+
+	for _, word := range telegramWords(body) {
+		if length(strings.TrimSpace(cur+word)) <= limit {
+			cur += word
+			continue
+		}
+		flush()
+		if length(strings.TrimSpace(word)) <= limit {
+			cur = word
+			continue
+		}
+		pieces := splitTelegramWord(strings.TrimSpace(word), limit, length)
+		if len(pieces) == 0 {
+			continue
+		}
+		for _, p := range pieces[:len(pieces)-1] {
+			out = append(out, prefix+p)
+		}
+		cur = pieces[len(pieces)-1] + trailingSpace(word)
+	}
+	flush()
+	return out
+}
+
+// telegramToken is a piece of inline Markdown that renders on its own. Spans
+// have the delimiters around their inner text in open and close.
+type telegramToken struct {
+	text               string
+	open, inner, close string
+}
+
+// telegramTokens splits inline Markdown the way telegramInline reads it, so a
+// token is either a single character or a complete span.
+func telegramTokens(text string) []telegramToken {
+	runes := []rune(text)
+	var tokens []telegramToken
+	for i := 0; i < len(runes); {
+		tok, next := telegramTokenAt(runes, i)
+		tok.text = string(runes[i:next])
+		tokens = append(tokens, tok)
+		i = next
+	}
+	return tokens
+}
+
+// telegramTokenAt reads the token starting at i and returns it with the index
+// just past it. Only spans have their delimiters filled in.
+func telegramTokenAt(runes []rune, i int) (telegramToken, int) {
+	r := runes[i]
+	if r == '\\' && i+1 < len(runes) && (unicode.IsPunct(runes[i+1]) || unicode.IsSymbol(runes[i+1])) {
+		return telegramToken{}, i + 2
+	}
+	if r == '`' {
+		if end := indexRune(runes, '`', i+1); end > i+1 {
+			return telegramToken{open: "`", inner: string(runes[i+1 : end]), close: "`"}, end + 1
+		}
+	}
+	if r == '[' {
+		if label, href, next, ok := parseMarkdownLink(runes, i); ok {
+			return telegramToken{open: "[", inner: label, close: "](" + href + ")"}, next
+		}
+	}
+	if _, inner, next, ok := matchInlineTag(runes, i); ok {
+		// The delimiters are equally wide on both sides of the inner text
+		width := (next - i - len([]rune(inner))) / 2
+		delim := string(runes[i : i+width])
+		return telegramToken{open: delim, inner: inner, close: delim}, next
+	}
+	return telegramToken{}, i + 1
+}
+
+// telegramWords splits inline Markdown after whitespace, keeping the
+// whitespace with the word before it. Spans are never split, even when they
+// contain spaces.
+func telegramWords(text string) []string {
+	var words []string
+	cur := ""
+	inSpace := false
+	for _, tok := range telegramTokens(text) {
+		space := len([]rune(tok.text)) == 1 && unicode.IsSpace([]rune(tok.text)[0])
+		if inSpace && !space {
+			words = append(words, cur)
+			cur = ""
+		}
+		cur += tok.text
+		inSpace = space
+	}
+	if cur != "" {
+		words = append(words, cur)
+	}
+	return words
+}
+
+// splitTelegramWord splits a word longer than limit between its tokens. A
+// span too long on its own is split into several spans with the same
+// delimiters, and plain text is cut between characters.
+func splitTelegramWord(word string, limit int, length func(string) int) []string {
+	var out []string
+	cur := ""
+	for _, tok := range telegramTokens(word) {
+		if length(cur+tok.text) <= limit {
+			cur += tok.text
+			continue
+		}
+		if cur != "" {
+			out = append(out, cur)
+			cur = ""
+		}
+		if length(tok.text) <= limit || tok.open == "" {
+			cur = tok.text
+			continue
+		}
+
+		wrapped := func(s string) int { return length(tok.open + s + tok.close) }
+		var inner []string
+		if tok.open == "`" {
+			inner = cutRunes(tok.inner, limit, wrapped)
+		} else {
+			inner = splitTelegramLine(tok.inner, limit)
+		}
+		for _, p := range inner {
+			out = append(out, tok.open+p+tok.close)
+		}
+		if len(out) > 0 {
+			cur = out[len(out)-1]
+			out = out[:len(out)-1]
+		}
+	}
+	if cur != "" {
+		out = append(out, cur)
+	}
+	return out
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"html"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTelegramHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     string
+	}{
+		{"plain text is escaped", "a & b <c>", "a &amp; b &lt;c&gt;"},
+		{"bold", "**bold**", "<b>bold</b>"},
+		{"italic", "*it* _it_", "<i>it</i> <i>it</i>"},
+		{"underline strike spoiler", "__u__ ~~s~~ ||sp||", "<u>u</u> <s>s</s> <tg-spoiler>sp</tg-spoiler>"},
+		{"nested", "**bold _and italic_**", "<b>bold <i>and italic</i></b>"},
+		{"snake case", "snake_case_name", "snake_case_name"},
+		{"delimiter must touch text", "* not italic *", "* not italic *"},
+		{"escaped delimiters", `\*not italic\*`, "*not italic*"},
+		{"inline code", "`a<b`", "<code>a&lt;b</code>"},
+		{"code block with language", "```go\nx := 1 < 2\n```", `<pre><code class="language-go">x := 1 &lt; 2</code></pre>`},
+		{"code block", "```\n**plain**\n```", "<pre>**plain**</pre>"},
+		{"unclosed code block", "```\nopen", "```\nopen"},
+		{"link", "[site](https://example.com/?a=1&b=2)", `<a href="https://example.com/?a=1&amp;b=2">site</a>`},
+		{"unsupported link scheme", "[x](javascript:alert)", "[x](javascript:alert)"},
+		{"quote", "> quote\n> **more**\nafter", "<blockquote>quote\n<b>more</b></blockquote>\nafter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TelegramHTML(tt.markdown); got != tt.want {
+				t.Errorf("TelegramHTML(%q) = %q, want %q", tt.markdown, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitTelegramMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		limit    int
+		want     []string
+	}{
+		{"empty", " \n ", 10, nil},
+		{"fits", "**bold** text", 9, []string{"**bold** text"}},
+		{"lines", "aaaa\nbbbb", 5, []string{"aaaa", "bbbb"}},
+		{"span kept whole", "xx **bold span** yy", 10, []string{"xx", "**bold span**", "yy"}},
+		{"long span split into spans", "**aaa bbb ccc**", 7, []string{"**aaa bbb**", "**ccc**"}},
+		{"inline code split into code", "`abcdef`", 4, []string{"`abcd`", "`ef`"}},
+		{"link split into links", "[aaa bbb](https://x.io)", 4, []string{"[aaa](https://x.io)", "[bbb](https://x.io)"}},
+		{"quote continued", "> aaa bbb", 3, []string{"> aaa", "> bbb"}},
+		{
+			"code block split into code blocks",
+			"```go\nline1\nline2\nline3\n```",
+			11,
+			[]string{"```go\nline1\nline2\n```", "```go\nline3\n```"},
+		},
+		{
+			"code block kept whole",
+			"intro\n```\ncode\n```\noutro",
+			9,
+			[]string{"intro", "```\ncode\n```", "outro"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SplitTelegramMarkdown(tt.markdown, tt.limit)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitTelegramMarkdown(%q, %d) = %q, want %q", tt.markdown, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitTelegramMarkdownKeepsText(t *testing.T) {
+	paragraph := "Some **bold words** and _italic words_ with `code` and a [link](https://example.com). "
+	markdown := strings.Repeat(paragraph, 20) + "\n```\n" + strings.Repeat("fmt.Println(i)\n", 40) + "```\n> " + strings.Repeat("quoted ", 50)
+
+	visible := func(md string) []string {
+		return strings.Fields(html.UnescapeString(htmlTagPattern.ReplaceAllString(TelegramHTML(md), "")))
+	}
+
+	for _, limit := range []int{40, 100, 500} {
+		chunks := SplitTelegramMarkdown(markdown, limit)
+		var words []string
+		for i, chunk := range chunks {
+			if n := TelegramTextLength(chunk); n > limit {
+				t.Errorf("limit %d: chunk %d is %d characters", limit, i+1, n)
+			}
+			if rendered := TelegramHTML(chunk); strings.Contains(rendered, "**") || strings.Contains(rendered, "```") {
+				t.Errorf("limit %d: chunk %d has unrendered markup: %q", limit, i+1, rendered)
+			}
+			words = append(words, visible(chunk)...)
+		}
+		if want := visible(markdown); !reflect.DeepEqual(words, want) {
+			t.Errorf("limit %d: chunks render %d words, want %d", limit, len(words), len(want))
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// urlLength is the length both Twitter (t.co) and Mastodon charge for any link.
+const urlLength = 23
+
+// Character limits of each platform's main text field.
+var PlatformTextLimits = map[string]int{
+	"twitter":   280,
+	"mastodon":  500,
+	"facebook":  63206,
+	"instagram": 2200,
+	"telegram":  4096,
+	"bluesky":   300,
+	"linkedin":  3000,
+	"threads":   500,
+	"tiktok":    2200,
+	"discord":   4096,
+	"slack":     40000,
+	"pinterest": 800,
+	"reddit":    40000, // self post body; titles are capped at 300 separately
+}
+
+// TextLength is the result of measuring a post against a platform's rules.
+type TextLength struct {
+	Length    int  `json:"length"`
+	Limit     int  `json:"limit"`
+	Remaining int  `json:"remaining"`
+	Valid     bool `json:"valid"`
+}
+
+var (
+	// twitterURLPattern matches http(s) links and bare www. hosts, both of
+	// which twitter-text shortens.
+	twitterURLPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"]+`)
+	// mastodonURLPattern matches only http(s) links; Mastodon counts a bare
+	// www. host as plain text.
+	mastodonURLPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"]+`)
+	// mastodonMentionPattern matches remote mentions; group 1 is the local part.
+	mastodonMentionPattern = regexp.MustCompile(`(?:^|[^\w/@])(@\w+)@[\w.-]+\w`)
+)
+
+// TextLengthFor returns the length counter for a platform. Platforms without
+// special rules count Unicode code points.
+func TextLengthFor(platform string) func(string) int {
+	switch platform {
+	case "twitter":
+		return TwitterTextLength
+	case "mastodon":
+		return MastodonTextLength
+	case "bluesky":
+		return BlueskyTextLength
+	case "threads":
+		return ThreadsTextLength
+	case "telegram":
+		return TelegramTextLength
+	default:
+		return utf8.RuneCountInString
+	}
+}
+
+// MeasureText counts text using the platform's rules and compares it to limit.
+// A limit of 0 uses the platform's default from PlatformTextLimits.
+func MeasureText(platform, text string, limit int) TextLength {
+	if limit <= 0 {
+		limit = PlatformTextLimits[platform]
+	}
+	n := TextLengthFor(platform)(text)
+	return TextLength{
+		Length:    n,
+		Limit:     limit,
+		Remaining: limit - n,
+		Valid:     limit == 0 || n <= limit,
+	}
+}
+
+// TwitterTextLength implements twitter-text's weighted length: after NFC
+// normalisation, code points in the Latin-1, general punctuation and similar
+// ranges count 1, everything else (CJK, most symbols) counts 2, every emoji
+// sequence counts 2 and every URL counts 23.
+func TwitterTextLength(text string) int {
+	text = norm.NFC.String(text)
+	length := 0
+	text = replaceURLs(text, twitterURLPattern, func(string) { length += urlLength })
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if isEmojiStart(runes, i) {
+			length += 2
+			i = skipEmojiSequence(runes, i)
+			continue
+		}
+		length += twitterWeight(runes[i])
+		i++
+	}
+	return length
+}
+
+// MastodonTextLength counts grapheme clusters the way Mastodon's status length
+// validator does: every http(s) URL counts 23 and remote mentions count only their
+// local part, so "@user@example.social" counts as "@user".
+func MastodonTextLength(text string) int {
+	text = mastodonMentionPattern.ReplaceAllStringFunc(text, func(m string) string {
+		sub := mastodonMentionPattern.FindStringSubmatch(m)
+		prefix := m[:strings.Index(m, sub[1])]
+		return prefix + sub[1]
+	})
+
+	length := 0
+	text = replaceURLs(text, mastodonURLPattern, func(string) { length += urlLength })
+	return length + countGraphemes(text)
+}
+
+// BlueskyTextLength counts grapheme clusters. Unlike Twitter and Mastodon,
+// Bluesky does not shorten links, so URLs count in full.
+func BlueskyTextLength(text string) int {
+	return countGraphemes(text)
+}
+
+// ThreadsTextLength counts code points, except that emoji are charged their
+// UTF-8 byte length as Meta's Threads API does.
+func ThreadsTextLength(text string) int {
+	runes := []rune(text)
+	length := 0
+	for i := 0; i < len(runes); {
+		if isEmojiStart(runes, i) {
+			end := skipEmojiSequence(runes, i)
+			length += len(string(runes[i:end]))
+			i = end
+			continue
+		}
+		length++
+		i++
+	}
+	return length
+}
+
+// replaceURLs removes every URL matched by pattern from text, calling found for
+// each one. Trailing punctuation is left in the text, as both platforms exclude
+// it from links.
+func replaceURLs(text string, pattern *regexp.Regexp, found func(string)) string {
+	return pattern.ReplaceAllStringFunc(text, func(u string) string {
+		trimmed := strings.TrimRight(u, `.,!?:;)'"]}`)
+		found(trimmed)
+		return u[len(trimmed):]
+	})
+}
+
+func twitterWeight(r rune) int {
+	switch {
+	case r <= 4351, // Latin through Georgian, includes Thai and Burmese
+		r >= 8192 && r <= 8205,
+		r >= 8208 && r <= 8223,
+		r >= 8242 && r <= 8247:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// countGraphemes approximates extended grapheme clusters: combining marks,
+// variation selectors, emoji modifiers and ZWJ sequences attach to the
+// preceding character, and regional indicators pair up into flags.
+func countGraphemes(text string) int {
+	runes := []rune(text)
+	count := 0
+	for i := 0; i < len(runes); {
+		if isEmojiStart(runes, i) {
+			i = skipEmojiSequence(runes, i)
+		} else {
+			i++
+			for i < len(runes) && isGraphemeExtend(runes[i]) {
+				i++
+			}
+		}
+		count++
+	}
+	return count
+}
+
+func isGraphemeExtend(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) ||
+		r == 0x200D || // zero width joiner
+		isVariationSelector(r)
+}
+
+func isVariationSelector(r rune) bool {
+	return (r >= 0xFE00 && r <= 0xFE0F) || (r >= 0xE0100 && r <= 0xE01EF)
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+func isEmojiModifier(r rune) bool {
+	return r >= 0x1F3FB && r <= 0x1F3FF
+}
+
+// isEmojiStart reports whether runes[i] begins an emoji sequence, including
+// keycaps such as "1️⃣".
+func isEmojiStart(runes []rune, i int) bool {
+	r := runes[i]
+	if isPictographic(r) || isRegionalIndicator(r) {
+		return true
+	}
+	// Keycap: [0-9#*] FE0F? 20E3
+	if (r >= '0' && r <= '9') || r == '#' || r == '*' {
+		j := i + 1
+		if j < len(runes) && runes[j] == 0xFE0F {
+			j++
+		}
+		return j < len(runes) && runes[j] == 0x20E3
+	}
+	return false
+}
+
+func isPictographic(r rune) bool {
+	return (r >= 0x1F000 && r <= 0x1FAFF) ||
+		(r >= 0x2600 && r <= 0x27BF) ||
+		(r >= 0x2300 && r <= 0x23FF) ||
+		(r >= 0x2B00 && r <= 0x2BFF) ||
+		r == 0x3030 || r == 0x303D
+}
+
+// skipEmojiSequence returns the index just past the emoji sequence at runes[i].
+func skipEmojiSequence(runes []rune, i int) int {
+	if isRegionalIndicator(runes[i]) {
+		if i+1 < len(runes) && isRegionalIndicator(runes[i+1]) {
+			return i + 2
+		}
+		return i + 1
+	}
+
+	i++
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case isVariationSelector(r), isEmojiModifier(r), r == 0x20E3,
+			r >= 0xE0020 && r <= 0xE007F: // tag sequences (subdivision flags)
+			i++
+		case r == 0x200D && i+1 < len(runes):
+			i += 2 // the joined character belongs to this sequence
+		default:
+			return i
+		}
+	}
+	return i
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMeasureText(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform string
+		text     string
+		limit    int
+		want     TextLength
+	}{
+		{"twitter plain", "twitter", "hello", 0, TextLength{5, 280, 275, true}},
+		{"twitter over limit", "twitter", strings.Repeat("a", 281), 0, TextLength{281, 280, -1, false}},
+		{"twitter url", "twitter", "see https://example.com/a/very/long/path?x=1.", 0, TextLength{28, 280, 252, true}},
+		{"twitter bare www", "twitter", "www.example.com", 0, TextLength{23, 280, 257, true}},
+		{"twitter cjk", "twitter", "你好", 0, TextLength{4, 280, 276, true}},
+		{"twitter emoji with modifier", "twitter", "👍🏽", 0, TextLength{2, 280, 278, true}},
+		{"twitter nfc", "twitter", "e\u0301", 0, TextLength{1, 280, 279, true}},
+		{"mastodon url", "mastodon", "https://example.com/" + strings.Repeat("x", 40), 0, TextLength{23, 500, 477, true}},
+		{"mastodon bare www", "mastodon", "www.example.com", 0, TextLength{15, 500, 485, true}},
+		{"mastodon remote mention", "mastodon", "@user@example.social hi", 0, TextLength{8, 500, 492, true}},
+		{"bluesky url counts in full", "bluesky", "https://example.com", 0, TextLength{19, 300, 281, true}},
+		{"bluesky zwj family", "bluesky", "👨‍👩‍👧", 0, TextLength{1, 300, 299, true}},
+		{"threads emoji bytes", "threads", "hi 👍", 0, TextLength{7, 500, 493, true}},
+		{"telegram markup hidden", "telegram", "**bold** text", 0, TextLength{9, 4096, 4087, true}},
+		{"default code points", "facebook", "héllo", 0, TextLength{5, 63206, 63201, true}},
+		{"explicit limit", "twitter", "hello", 3, TextLength{5, 3, -2, false}},
+		{"unknown platform", "myspace", "abc", 0, TextLength{3, 0, -3, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MeasureText(tt.platform, tt.text, tt.limit); got != tt.want {
+				t.Errorf("MeasureText(%q, %q, %d) = %+v, want %+v", tt.platform, tt.text, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// sentenceEnders are the characters after which a thread prefers to break.
+// Includes CJK, Devanagari and Burmese full stops.
+const sentenceEnders = ".!?…。！？।။"
+
+// SplitThread splits text into segments that each fit within limit as measured by
+// length. Breaks prefer line and sentence boundaries, then word boundaries; a word
+// longer than a whole segment is cut. When numbered is set every segment gets a
+// " i/n" suffix, which is counted against the limit. Text that already fits is
+// returned as a single unnumbered segment.
+func SplitThread(text string, limit int, numbered bool, length func(string) int) []string {
+	text = strings.TrimSpace(text)
+	if text == "" || limit <= 0 {
+		return nil
+	}
+	if length == nil {
+		length = utf8.RuneCountInString
+	}
+	if length(text) <= limit {
+		return []string{text}
+	}
+	if !numbered {
+		return splitToFit(text, limit, length)
+	}
+
+	// The suffix width depends on the number of segments, which depends on the
+	// suffix width; widen the reservation until the digit count is stable.
+	total := 9
+	for {
+		reserve := len(fmt.Sprintf(" %d/%d", total, total))
+		if reserve >= limit {
+			return splitToFit(text, limit, length)
+		}
+		parts := splitToFit(text, limit-reserve, length)
+		if len(parts) <= total || len(fmt.Sprint(len(parts))) <= len(fmt.Sprint(total)) {
+			for i := range parts {
+				parts[i] = fmt.Sprintf("%s %d/%d", parts[i], i+1, len(parts))
+			}
+			return parts
+		}
+		total = len(parts)
+	}
+}
+
+func splitToFit(text string, limit int, length func(string) int) []string {
+	return pack(sentenceUnits(text), limit, length, 0)
+}
+
+// pack greedily joins units into segments no longer than limit. Units keep their
+// trailing whitespace so paragraph breaks survive inside a segment. Units that do
+// not fit on their own are broken down a level: sentences into words, words into
+// characters.
+func pack(units []string, limit int, length func(string) int, level int) []string {
+	var out []string
+	cur := ""
+
+	flush := func() {
+		if s := strings.TrimSpace(cur); s != "" {
+			out = append(out, s)
+		}
+		cur = ""
+	}
+
+	for _, u := range units {
+		if length(strings.TrimSpace(cur+u)) <= limit {
+			cur += u
+			continue
+		}
+		flush()
+		if length(strings.TrimSpace(u)) <= limit {
+			cur = u
+			continue
+		}
+
+		var pieces []string
+		switch level {
+		case 0:
+			pieces = pack(wordUnits(u), limit, length, 1)
+		default:
+			pieces = cutRunes(strings.TrimSpace(u), limit, length)
+		}
+		if len(pieces) == 0 {
+			continue
+		}
+		out = append(out, pieces[:len(pieces)-1]...)
+		// Keep the separator that followed the unit
+		cur = pieces[len(pieces)-1] + trailingSpace(u)
+	}
+	flush()
+	return out
+}
+
+// sentenceUnits splits text after sentence-ending punctuation followed by
+// whitespace, and after every newline.
+func sentenceUnits(text string) []string {
+	var units []string
+	runes := []rune(text)
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		atBoundary := r == '\n' ||
+			(strings.ContainsRune(sentenceEnders, r) && (i+1 == len(runes) || unicode.IsSpace(runes[i+1])))
+		if !atBoundary {
+			continue
+		}
+		// Swallow the whitespace after the boundary into this unit
+		j := i + 1
+		for j < len(runes) && unicode.IsSpace(runes[j]) {
+			j++
+		}
+		units = append(units, string(runes[start:j]))
+		start = j
+		i = j - 1
+	}
+	if start < len(runes) {
+		units = append(units, string(runes[start:]))
+	}
+	return units
+}
+
+// wordUnits splits text into words that keep their trailing whitespace.
+func wordUnits(text string) []string {
+	var units []string
+	runes := []rune(text)
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		if !unicode.IsSpace(runes[i]) {
+			continue
+		}
+		j := i
+		for j < len(runes) && unicode.IsSpace(runes[j]) {
+			j++
+		}
+		units = append(units, string(runes[start:j]))
+		start = j
+		i = j - 1
+	}
+	if start < len(runes) {
+		units = append(units, string(runes[start:]))
+	}
+	return units
+}
+
+// cutRunes hard-splits a single word into pieces that fit within limit.
+func cutRunes(word string, limit int, length func(string) int) []string {
+	var out []string
+	cur := ""
+	for _, r := range word {
+		if cur != "" && length(cur+string(r)) > limit {
+			out = append(out, cur)
+			cur = ""
+		}
+		cur += string(r)
+	}
+	if cur != "" {
+		out = append(out, cur)
+	}
+	return out
+}
+
+func trailingSpace(s string) string {
+	return s[len(strings.TrimRightFunc(s, unicode.IsSpace)):]
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitThread(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		limit    int
+		numbered bool
+		want     []string
+	}{
+		{"empty", "   ", 10, false, nil},
+		{"no limit", "hello", 0, false, nil},
+		{"fits", "  hello world  ", 11, true, []string{"hello world"}},
+		{"sentences", "One two. Three four. Five.", 12, false, []string{"One two.", "Three four.", "Five."}},
+		{"newlines", "first line\nsecond line", 15, false, []string{"first line", "second line"}},
+		{"words", "alpha beta gamma delta", 11, false, []string{"alpha beta", "gamma delta"}},
+		{"long word", "abcdefghij", 4, false, []string{"abcd", "efgh", "ij"}},
+		{"cjk full stop", "你好。再见。", 3, false, []string{"你好。", "再见。"}},
+		{"decimal point", "Pi is 3.14 ok", 10, false, []string{"Pi is 3.14", "ok"}},
+		{"numbered", "aaa bbb ccc", 8, true, []string{"aaa 1/3", "bbb 2/3", "ccc 3/3"}},
+		{
+			"numbered several per segment",
+			strings.Repeat("w ", 10),
+			7, true,
+			[]string{"w w 1/5", "w w 2/5", "w w 3/5", "w w 4/5", "w w 5/5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SplitThread(tt.text, tt.limit, tt.numbered, nil)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitThread(%q, %d, %v) = %q, want %q", tt.text, tt.limit, tt.numbered, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitThreadWidensNumbering(t *testing.T) {
+	// Ten "w w" segments need two-digit numbering, which leaves room for one word each
+	parts := SplitThread(strings.Repeat("w ", 20), 8, true, nil)
+	if len(parts) != 20 {
+		t.Fatalf("got %d parts, want 20: %q", len(parts), parts)
+	}
+	if parts[0] != "w 1/20" || parts[19] != "w 20/20" {
+		t.Errorf("got %q ... %q, want \"w 1/20\" ... \"w 20/20\"", parts[0], parts[19])
+	}
+}
+
+func TestSplitThreadNumberedSegmentsFit(t *testing.T) {
+	text := strings.Repeat("word ", 300)
+	for _, limit := range []int{12, 20, 50} {
+		parts := SplitThread(text, limit, true, nil)
+		if len(parts) < 10 {
+			t.Fatalf("limit %d: got %d parts, want at least 10", limit, len(parts))
+		}
+		for i, p := range parts {
+			if n := utf8.RuneCountInString(p); n > limit {
+				t.Errorf("limit %d: part %d %q has %d characters", limit, i+1, p, n)
+			}
+		}
+	}
+}
+
+func TestSplitThreadUsesLength(t *testing.T) {
+	// Every character counts double, as CJK text does on Twitter
+	double := func(s string) int { return 2 * utf8.RuneCountInString(s) }
+	got := SplitThread("ab cd", 4, false, double)
+	want := []string{"ab", "cd"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -47,7 +47,7 @@ export function useMultiPlatformPublish({ message, mediaFiles, youtubeConfig })
                 'Content-Type': 'application/json',
                 Authorization: `Bearer ${token}`,
               },
-              body: JSON.stringify({ message }),
+              body: JSON.stringify({ message, mediaUrls: mediaFiles }),
             });
             break;
 